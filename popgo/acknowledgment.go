@@ -0,0 +1,251 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ObjectTypeAcknowledgment is used in CouchDB documents of acknowledgments
+const ObjectTypeAcknowledgment = "ack"
+
+// AcknowledgmentDoc records that an organization has seen and accepted a
+// segment. A segment has at most one acknowledgment per MSP.
+type AcknowledgmentDoc struct {
+	ObjectType     string     `json:"docType"`
+	LinkHash       string     `json:"linkHash"`
+	MSPID          string     `json:"mspId"`
+	AcknowledgedBy *Submitter `json:"acknowledgedBy"`
+	Timestamp      int64      `json:"timestamp"`
+}
+
+// FullAcknowledgment is the payload of the event set when all the
+// acknowledgers of the process of a segment have acknowledged it
+type FullAcknowledgment struct {
+	LinkHash string   `json:"linkHash"`
+	MSPIDs   []string `json:"mspIds"`
+}
+
+func getAcknowledgmentKey(stub shim.ChaincodeStubInterface, linkHash, mspID string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeAcknowledgment, []string{linkHash, mspID})
+}
+
+// Acknowledge records that the organization of the caller accepts a
+// segment. When the process of the segment has acknowledgers, only they can
+// acknowledge its segments and the segmentAcknowledged event is set once all
+// of them did. Arguments are the link hash.
+func (s *SmartContract) Acknowledge(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Link hash is required")
+	}
+	submitter, err := getSubmitter(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if submitter == nil {
+		return shim.Error(ErrUnauthorized.Error())
+	}
+
+	segmentDocBytes, _, err := getSegmentDocBytes(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if segmentDocBytes == nil {
+		return shim.Error("Segment not found")
+	}
+	segmentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	process, err := getProcess(stub, segmentDoc.Segment.Link.GetProcess())
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var acknowledgers []string
+	if process != nil {
+		acknowledgers = process.Acknowledgers
+	}
+	if len(acknowledgers) > 0 && !containsString(acknowledgers, submitter.MSPID) {
+		return shim.Error(ErrUnauthorized.Error())
+	}
+
+	key, err := getAcknowledgmentKey(stub, args[0], submitter.MSPID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	existing, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("Segment already acknowledged by " + submitter.MSPID)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ackBytes, err := json.Marshal(AcknowledgmentDoc{
+		ObjectType:     ObjectTypeAcknowledgment,
+		LinkHash:       args[0],
+		MSPID:          submitter.MSPID,
+		AcknowledgedBy: submitter,
+		Timestamp:      now.UnixNano() / int64(time.Millisecond),
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, ackBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// A transaction has a single event, full acknowledgment supersedes
+	// the acknowledgment of the caller.
+	mspIDs, err := getAcknowledgingMSPs(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !containsString(mspIDs, submitter.MSPID) {
+		mspIDs = append(mspIDs, submitter.MSPID)
+		sort.Strings(mspIDs)
+	}
+	if len(acknowledgers) > 0 && len(intersectStrings(acknowledgers, mspIDs)) == len(acknowledgers) {
+		eventBytes, err := json.Marshal(FullAcknowledgment{LinkHash: args[0], MSPIDs: mspIDs})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.SetEvent("segmentAcknowledged", eventBytes)
+	} else {
+		err = stub.SetEvent("acknowledge", ackBytes)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(ackBytes)
+}
+
+// getAcknowledgingMSPs returns the sorted MSP IDs that acknowledged a
+// segment
+func getAcknowledgingMSPs(stub shim.ChaincodeStubInterface, linkHash string) ([]string, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ObjectTypeAcknowledgment, []string{linkHash})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var mspIDs []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		ack := &AcknowledgmentDoc{}
+		if err := json.Unmarshal(queryResponse.Value, ack); err != nil {
+			return nil, err
+		}
+		mspIDs = append(mspIDs, ack.MSPID)
+	}
+	sort.Strings(mspIDs)
+	return mspIDs, nil
+}
+
+// GetAcknowledgments returns the acknowledgments of a segment
+func (s *SmartContract) GetAcknowledgments(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Link hash is required")
+	}
+	if err := checkSegmentTenant(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ObjectTypeAcknowledgment, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	acks := []json.RawMessage{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		acks = append(acks, queryResponse.Value)
+	}
+	acksBytes, err := json.Marshal(acks)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(acksBytes, nil)
+}
+
+// deleteAcknowledgments deletes the acknowledgments of a segment
+func deleteAcknowledgments(stub shim.ChaincodeStubInterface, linkHash string) error {
+	mspIDs, err := getAcknowledgingMSPs(stub, linkHash)
+	if err != nil {
+		return err
+	}
+	for _, mspID := range mspIDs {
+		key, err := getAcknowledgmentKey(stub, linkHash, mspID)
+		if err != nil {
+			return err
+		}
+		if err := stub.DelState(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getAcknowledgedLinkHashes returns the sorted link hashes of the segments
+// acknowledged by an MSP
+func getAcknowledgedLinkHashes(stub shim.ChaincodeStubInterface, config *Config, mspID string) ([]string, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": ObjectTypeAcknowledgment,
+			"mspId":   mspID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkQueryPlan(config, acknowledgmentIndexes, string(queryBytes)); err != nil {
+		return nil, err
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var linkHashes []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		ack := &AcknowledgmentDoc{}
+		if err := json.Unmarshal(queryResponse.Value, ack); err != nil {
+			return nil, err
+		}
+		linkHashes = append(linkHashes, ack.LinkHash)
+	}
+	sort.Strings(linkHashes)
+	return linkHashes, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_Acknowledge(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Invoke(t, "CreateProcess", []byte(`{
+		"name": "signoff",
+		"rules": [{"from": "", "to": "draft"}, {"from": "draft", "to": "draft"}],
+		"acknowledgers": ["BuyerMSP", "SellerMSP"]
+	}`))
+	root := testutil.Root("signoff").WithAction("draft").Build()
+	child := testutil.Child(root).WithAction("draft").Build()
+	stub.SaveSegment(t, root, child)
+	linkHash := []byte(root.GetLinkHashString())
+
+	stub.Creator = testutil.NewIdentity("BuyerMSP", "buyer")
+	stub.Invoke(t, "Acknowledge", linkHash)
+	if stub.EventName != "acknowledge" {
+		fmt.Println("Got event", stub.EventName)
+		t.FailNow()
+	}
+	stub.InvokeError(t, "Acknowledge", linkHash)
+	stub.InvokeError(t, "Acknowledge", []byte("missing"))
+
+	for _, test := range []struct {
+		filter   string
+		expected int
+	}{
+		{`{"notAcknowledgedBy":"BuyerMSP"}`, 1},
+		{`{"notAcknowledgedBy":"SellerMSP"}`, 2},
+		{`{"notAcknowledgedBy":"BuyerMSP","disputed":false}`, 1},
+	} {
+		var found cs.SegmentSlice
+		json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(test.filter)), &found)
+		if len(found) != test.expected {
+			fmt.Println("Filter", test.filter, "returned", len(found), "segments, expected", test.expected)
+			t.FailNow()
+		}
+	}
+	stub.InvokeError(t, "FindSegments", []byte(`{"notAcknowledgedBy":"$gt"}`))
+
+	stub.Creator = testutil.NewIdentity("OtherMSP", "other")
+	if message := stub.InvokeError(t, "Acknowledge", linkHash); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("SellerMSP", "seller")
+	stub.Invoke(t, "Acknowledge", linkHash)
+	full := &FullAcknowledgment{}
+	json.Unmarshal(stub.EventPayload, full)
+	if stub.EventName != "segmentAcknowledged" || len(full.MSPIDs) != 2 {
+		fmt.Println("Got event", stub.EventName, string(stub.EventPayload))
+		t.FailNow()
+	}
+
+	var acks []AcknowledgmentDoc
+	json.Unmarshal(stub.Invoke(t, "GetAcknowledgments", linkHash), &acks)
+	if len(acks) != 2 || acks[0].MSPID != "BuyerMSP" || acks[1].AcknowledgedBy.Subject != "seller" {
+		fmt.Println("Got acknowledgments", acks)
+		t.FailNow()
+	}
+}
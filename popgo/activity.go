@@ -0,0 +1,106 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Activity buckets count the segments saved per process and per UTC day.
+// They are sharded counters keyed by process and day, so saving segments
+// of the same process doesn't serialize transactions.
+const (
+	// ObjectTypeActivity is used in the keys of activity buckets
+	ObjectTypeActivity = "activity"
+
+	// ActivityDayLayout is the format of the days of activity series
+	ActivityDayLayout = "2006-01-02"
+
+	// MaxActivityDays is the maximum number of days of an activity series
+	MaxActivityDays = 366
+)
+
+// ActivityBucket is the number of segments of a process saved in a day
+type ActivityBucket struct {
+	Day      string `json:"day"`
+	Segments int    `json:"segments"`
+}
+
+// addActivity counts a segment saved by the transaction in the bucket of
+// its day
+func addActivity(stub shim.ChaincodeStubInterface, process string) error {
+	now, err := txTime(stub)
+	if err != nil {
+		return err
+	}
+	day := now.UTC().Format(ActivityDayLayout)
+	return addShardedCounter(stub, ObjectTypeActivity, []string{process, day}, 1)
+}
+
+// GetActivitySeries returns the daily activity buckets of a process, days
+// without activity included. Arguments are the process and the first and
+// last days, formatted as 2006-01-02.
+func (s *SmartContract) GetActivitySeries(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 3 || args[0] == "" {
+		return shim.Error("Process, from and to are required")
+	}
+	from, err := time.Parse(ActivityDayLayout, args[1])
+	if err != nil {
+		return shim.Error("Could not parse day " + args[1])
+	}
+	to, err := time.Parse(ActivityDayLayout, args[2])
+	if err != nil {
+		return shim.Error("Could not parse day " + args[2])
+	}
+	if err := validateActivityRange(from, to); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkAggregateTenant(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	series := []ActivityBucket{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		bucket := ActivityBucket{Day: day.Format(ActivityDayLayout)}
+		bucket.Segments, err = getShardedCounter(stub, ObjectTypeActivity, []string{args[0], bucket.Day})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		series = append(series, bucket)
+	}
+	seriesBytes, err := json.Marshal(series)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(seriesBytes, nil)
+}
+
+// validateActivityRange checks a range of days is ordered and not longer
+// than MaxActivityDays
+func validateActivityRange(from, to time.Time) error {
+	if to.Before(from) {
+		return errors.New("Last day should not be before the first day")
+	}
+	if from.AddDate(0, 0, MaxActivityDays).Before(to.AddDate(0, 0, 1)) {
+		return errors.New("Activity series should not be longer than " + strconv.Itoa(MaxActivityDays) + " days")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// ObjectTypeActor is used in CouchDB documents of registered actors
+const ObjectTypeActor = "actor"
+
+// ActorDoc is used to store registered actors in CouchDB. Actors are
+// decentralized identifiers registered with their public key, so business
+// identities don't depend on Fabric enrollment certificates.
+type ActorDoc struct {
+	ObjectType   string `json:"docType"`
+	DID          string `json:"did"`
+	PublicKey    string `json:"publicKey"`
+	RegisteredBy string `json:"registeredBy"`
+}
+
+// LinkSignature is an entry of segment.meta.signatures. Signatures that
+// reference a DID must be made with its registered key.
+type LinkSignature struct {
+	Type      string `json:"type"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+	DID       string `json:"did,omitempty"`
+}
+
+func getActorKey(stub shim.ChaincodeStubInterface, did string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeActor, []string{did})
+}
+
+func getActor(stub shim.ChaincodeStubInterface, did string) (*ActorDoc, error) {
+	key, err := getActorKey(stub, did)
+	if err != nil {
+		return nil, err
+	}
+	actorBytes, err := stub.GetState(key)
+	if err != nil || actorBytes == nil {
+		return nil, err
+	}
+	actor := &ActorDoc{}
+	if err := json.Unmarshal(actorBytes, actor); err != nil {
+		return nil, err
+	}
+	return actor, nil
+}
+
+// RegisterActor registers the public key of a DID. Keys can't be changed
+// once registered.
+func (s *SmartContract) RegisterActor(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 || args[1] == "" {
+		return shim.Error("DID and public key are required")
+	}
+	did, publicKey := args[0], args[1]
+	if !strings.HasPrefix(did, "did:") {
+		return shim.Error("Invalid DID " + did)
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, err := parsePublicKey(publicKey); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	existing, err := getActor(stub, did)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		if existing.PublicKey != publicKey {
+			return shim.Error("DID " + did + " is already registered with another key")
+		}
+		return shim.Success(nil)
+	}
+
+	mspID, err := getCreatorMSPID(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	actorBytes, err := json.Marshal(ActorDoc{ObjectTypeActor, did, publicKey, mspID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := getActorKey(stub, did)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, actorBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// checkActorKey checks a DID is registered with a public key
+func checkActorKey(stub shim.ChaincodeStubInterface, did, publicKey string) error {
+	actor, err := getActor(stub, did)
+	if err != nil {
+		return err
+	}
+	if actor == nil {
+		return errors.New("DID " + did + " is not registered")
+	}
+	if actor.PublicKey != publicKey {
+		return errors.New("Signature key doesn't match the key of " + did)
+	}
+	return nil
+}
+
+// validateSignatures verifies the signatures of a segment that reference a
+// DID. A signature without public key uses the registered key.
+func validateSignatures(stub shim.ChaincodeStubInterface, segment *cs.Segment) error {
+	v, ok := segment.Meta["signatures"]
+	if !ok {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var signatures []LinkSignature
+	if err := json.Unmarshal(b, &signatures); err != nil {
+		return errors.New("meta.signatures should be an array of signatures")
+	}
+	for _, sig := range signatures {
+		if sig.DID == "" {
+			continue
+		}
+		if sig.PublicKey == "" {
+			actor, err := getActor(stub, sig.DID)
+			if err != nil {
+				return err
+			}
+			if actor == nil {
+				return errors.New("DID " + sig.DID + " is not registered")
+			}
+			sig.PublicKey = actor.PublicKey
+		} else if err := checkActorKey(stub, sig.DID, sig.PublicKey); err != nil {
+			return err
+		}
+		if err := verifyLinkSignature(&segment.Link, sig.Type, sig.PublicKey, sig.Signature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
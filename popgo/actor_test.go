@@ -0,0 +1,72 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_RegisterActor(t *testing.T) {
+	stub := newAdminStub(t)
+	signer := testutil.NewSigner()
+	did := []byte("did:example:alice")
+
+	stub.Invoke(t, "RegisterActor", did, []byte(signer.PublicKey()))
+	stub.Invoke(t, "RegisterActor", did, []byte(signer.PublicKey()))
+	stub.InvokeError(t, "RegisterActor", did, []byte(testutil.NewSigner().PublicKey()))
+	stub.InvokeError(t, "RegisterActor", []byte("alice"), []byte(signer.PublicKey()))
+	stub.InvokeError(t, "RegisterActor", []byte("did:example:bob"), []byte("not a key"))
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "RegisterActor", []byte("did:example:bob"), []byte(signer.PublicKey())); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
+
+func TestPop_SaveSegmentActorSignatures(t *testing.T) {
+	stub := newAdminStub(t)
+	alice, mallory := testutil.NewSigner(), testutil.NewSigner()
+	stub.Invoke(t, "RegisterActor", []byte("did:example:alice"), []byte(alice.PublicKey()))
+
+	segment := testutil.Root("main").WithState("step", "signed").Build()
+	signed := func(sig testutil.Signature) *cs.Segment {
+		return testutil.Root("main").WithMapID(segment.Link.GetMapID()).WithState("step", "signed").WithSignature(sig).Build()
+	}
+
+	valid := alice.Sign(&segment.Link)
+	valid.DID = "did:example:alice"
+	stub.SaveSegment(t, signed(valid))
+
+	// The registered key is used when the signature has none
+	withoutKey := valid
+	withoutKey.PublicKey = ""
+	stub.SaveSegment(t, signed(withoutKey))
+
+	// Signatures without DID are not checked
+	stub.SaveSegment(t, testutil.Root("main").WithSignature(testutil.Signature{Type: "other"}).Build())
+
+	forged := mallory.Sign(&segment.Link)
+	forged.DID = "did:example:alice"
+	unregistered := alice.Sign(&segment.Link)
+	unregistered.DID = "did:example:bob"
+	for _, sig := range []testutil.Signature{forged, unregistered} {
+		stub.InvokeError(t, "SaveSegment", mustMarshal(signed(sig)))
+	}
+}
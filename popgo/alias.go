@@ -0,0 +1,160 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ObjectTypeMapAlias is used in the CouchDB documents of map aliases.
+// Aliases are identifiers of maps in external systems, such as ERP or CRM
+// record IDs. An alias points to a single map, a map can have several
+// aliases.
+const ObjectTypeMapAlias = "mapalias"
+
+// MapAliasDoc is used to store map aliases in CouchDB
+type MapAliasDoc struct {
+	ObjectType string     `json:"docType"`
+	Alias      string     `json:"alias"`
+	MapID      string     `json:"mapId"`
+	SetBy      *Submitter `json:"setBy,omitempty"`
+	SetAt      int64      `json:"setAt"`
+}
+
+func getMapAliasKey(stub shim.ChaincodeStubInterface, alias string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeMapAlias, []string{alias})
+}
+
+func getMapAlias(stub shim.ChaincodeStubInterface, alias string) (*MapAliasDoc, error) {
+	key, err := getMapAliasKey(stub, alias)
+	if err != nil {
+		return nil, err
+	}
+	aliasBytes, err := stub.GetState(key)
+	if err != nil || aliasBytes == nil {
+		return nil, err
+	}
+	aliasDoc := &MapAliasDoc{}
+	if err := json.Unmarshal(aliasBytes, aliasDoc); err != nil {
+		return nil, err
+	}
+	return aliasDoc, nil
+}
+
+func validateAlias(alias string) error {
+	if alias == "" {
+		return errors.New("External ID is required")
+	}
+	return validateFilterValue("external ID", alias)
+}
+
+// SetMapAlias gives an external ID to a map. Arguments are the map ID and
+// the external ID, which must not be used by another map. Only the owner
+// of the map or an admin can set its aliases.
+func (s *SmartContract) SetMapAlias(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 || args[0] == "" {
+		return shim.Error("Map ID and external ID are required")
+	}
+	if err := validateAlias(args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	mapDoc, err := getMap(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if mapDoc == nil {
+		return shim.Error("Map not found")
+	}
+	if err := requireMapOwner(stub, mapDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	existing, err := getMapAlias(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil && existing.MapID != mapDoc.ID {
+		return shim.Error("External ID " + args[1] + " is already used by map " + existing.MapID)
+	}
+	if existing != nil {
+		return shim.Success(nil)
+	}
+
+	aliasDoc := &MapAliasDoc{ObjectType: ObjectTypeMapAlias, Alias: args[1], MapID: mapDoc.ID}
+	if aliasDoc.SetBy, err = getSubmitter(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	aliasDoc.SetAt = now.UnixNano() / int64(time.Millisecond)
+	key, err := getMapAliasKey(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	aliasBytes, err := json.Marshal(aliasDoc)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, aliasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// GetMapByAlias returns the map with an external ID, or nothing if no map
+// has it. Merged maps are returned as is, with the map they were merged
+// into.
+func (s *SmartContract) GetMapByAlias(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 {
+		return shim.Error("External ID is required")
+	}
+	if err := validateAlias(args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	aliasDoc, err := getMapAlias(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if aliasDoc == nil {
+		return shim.Success(nil)
+	}
+	mapDoc, err := getMap(stub, aliasDoc.MapID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tenant, err := getTenantScope(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if mapDoc == nil || (tenant != "" && mapDoc.Tenant != tenant) {
+		return shim.Success(nil)
+	}
+	mapDocBytes, err := json.Marshal(mapDoc)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(mapDocBytes, nil)
+}
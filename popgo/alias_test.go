@@ -0,0 +1,59 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_MapAliases(t *testing.T) {
+	stub := newAdminStub(t)
+	segment, other := testutil.Root("main").Build(), testutil.Root("main").Build()
+	stub.SaveSegment(t, segment, other)
+	mapID := segment.Link.GetMapID()
+
+	stub.Invoke(t, "SetMapAlias", []byte(mapID), []byte("ERP-1042"))
+	stub.Invoke(t, "SetMapAlias", []byte(mapID), []byte("CRM-7"))
+	stub.Invoke(t, "SetMapAlias", []byte(mapID), []byte("ERP-1042"))
+	if message := stub.InvokeError(t, "SetMapAlias", []byte(other.Link.GetMapID()), []byte("ERP-1042")); message != "External ID ERP-1042 is already used by map "+mapID {
+		fmt.Println("Got error", message)
+		t.FailNow()
+	}
+	stub.InvokeError(t, "SetMapAlias", []byte("missing"), []byte("ERP-1043"))
+	stub.InvokeError(t, "SetMapAlias", []byte(mapID), []byte("$gt"))
+
+	for _, alias := range []string{"ERP-1042", "CRM-7"} {
+		mapDoc := &MapDoc{}
+		json.Unmarshal(stub.Invoke(t, "GetMapByAlias", []byte(alias)), mapDoc)
+		if mapDoc.ID != mapID || mapDoc.Process != "main" {
+			fmt.Println("Alias", alias, "returned", mapDoc)
+			t.FailNow()
+		}
+	}
+	if res := stub.Invoke(t, "GetMapByAlias", []byte("ERP-0")); res != nil {
+		fmt.Println("Unknown aliases should return nothing")
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "SetMapAlias", []byte(other.Link.GetMapID()), []byte("ERP-1043")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
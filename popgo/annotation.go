@@ -0,0 +1,309 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ObjectTypeAnnotation is used in CouchDB documents of annotations
+const ObjectTypeAnnotation = "annotation"
+
+// Targets of annotations
+const (
+	AnnotationTargetSegment = "segment"
+	AnnotationTargetMap     = "map"
+)
+
+// MaxAnnotationFilters is the maximum number of annotations a segment
+// filter can match
+const MaxAnnotationFilters = 5
+
+// AnnotationDoc is a mutable key/value attached to a segment or a map, for
+// operational tagging like "reviewed" or "disputed". Annotations are stored
+// apart so that links and segment documents are left untouched.
+type AnnotationDoc struct {
+	ObjectType  string     `json:"docType"`
+	Target      string     `json:"target"`
+	TargetID    string     `json:"targetId"`
+	Key         string     `json:"key"`
+	Value       string     `json:"value"`
+	AnnotatedBy *Submitter `json:"annotatedBy"`
+	Timestamp   int64      `json:"timestamp"`
+}
+
+func getAnnotationKey(stub shim.ChaincodeStubInterface, target, targetID, key string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeAnnotation, []string{target, targetID, key})
+}
+
+// AnnotateSegment sets an annotation of a segment, an empty value removes
+// it. Arguments are the link hash, the key and the value.
+func (s *SmartContract) AnnotateSegment(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 3 || args[0] == "" {
+		return shim.Error("Link hash, key and value are required")
+	}
+	segmentDocBytes, _, err := getSegmentDocBytes(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if segmentDocBytes == nil {
+		return shim.Error("Segment not found")
+	}
+	segmentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	mapDoc, err := getMap(stub, segmentDoc.Segment.Link.GetMapID())
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return annotate(stub, mapDoc, AnnotationTargetSegment, args)
+}
+
+// AnnotateMap sets an annotation of a map, an empty value removes it.
+// Arguments are the map ID, the key and the value.
+func (s *SmartContract) AnnotateMap(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 3 || args[0] == "" {
+		return shim.Error("Map ID, key and value are required")
+	}
+	mapDoc, err := getMap(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if mapDoc == nil {
+		return shim.Error("Map not found")
+	}
+	return annotate(stub, mapDoc, AnnotationTargetMap, args)
+}
+
+// annotate stores or removes an annotation. Only the owner of the map of
+// the target or an admin can annotate it.
+func annotate(stub shim.ChaincodeStubInterface, mapDoc *MapDoc, target string, args []string) sc.Response {
+	targetID, key, value := args[0], args[1], args[2]
+	if key == "" {
+		return shim.Error("Annotation key is required")
+	}
+	if err := validateFilterValue("annotation key", key); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := validateFilterValue("annotation value", value); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var err error
+	if mapDoc != nil {
+		err = requireMapOwner(stub, mapDoc)
+	} else {
+		err = requireAdmin(stub)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	annotationKey, err := getAnnotationKey(stub, target, targetID, key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if value == "" {
+		if err := stub.DelState(annotationKey); err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(nil)
+	}
+
+	submitter, err := getSubmitter(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	annotationBytes, err := json.Marshal(AnnotationDoc{
+		ObjectType:  ObjectTypeAnnotation,
+		Target:      target,
+		TargetID:    targetID,
+		Key:         key,
+		Value:       value,
+		AnnotatedBy: submitter,
+		Timestamp:   now.UnixNano() / int64(time.Millisecond),
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(annotationKey, annotationBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(annotationBytes)
+}
+
+// GetAnnotations returns the annotations of a segment or a map. Arguments
+// are the target, segment or map, and its link hash or map ID.
+func (s *SmartContract) GetAnnotations(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 || args[1] == "" {
+		return shim.Error("Target and ID are required")
+	}
+	if args[0] != AnnotationTargetSegment && args[0] != AnnotationTargetMap {
+		return shim.Error("Annotation target should be segment or map")
+	}
+	checkTarget := checkSegmentTenant
+	if args[0] == AnnotationTargetMap {
+		checkTarget = checkMapTenant
+	}
+	if err := checkTarget(stub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ObjectTypeAnnotation, []string{args[0], args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	annotations := []json.RawMessage{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		annotations = append(annotations, queryResponse.Value)
+	}
+	annotationsBytes, err := json.Marshal(annotations)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(annotationsBytes, nil)
+}
+
+// deleteAnnotations deletes the annotations of a segment or a map
+func deleteAnnotations(stub shim.ChaincodeStubInterface, target, targetID string) error {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ObjectTypeAnnotation, []string{target, targetID})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	var keys []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, queryResponse.Key)
+	}
+	for _, key := range keys {
+		if err := stub.DelState(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateAnnotationFilter checks the annotations of a segment filter
+func validateAnnotationFilter(name string, annotations map[string]string) error {
+	if len(annotations) > MaxAnnotationFilters {
+		return errors.New("Filter " + name + " should not have more than " + strconv.Itoa(MaxAnnotationFilters) + " annotations")
+	}
+	for key, value := range annotations {
+		if err := validateFilterValue(name, key); err != nil {
+			return err
+		}
+		if err := validateFilterValue(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getAnnotatedIDs returns the sorted IDs of the targets that have all the
+// given annotations
+func getAnnotatedIDs(stub shim.ChaincodeStubInterface, config *Config, target string, annotations map[string]string) ([]string, error) {
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var ids []string
+	for i, key := range keys {
+		matching, err := findAnnotatedIDs(stub, config, target, key, annotations[key])
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			ids = matching
+		} else {
+			ids = intersectStrings(ids, matching)
+		}
+		if len(ids) == 0 {
+			return nil, nil
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func findAnnotatedIDs(stub shim.ChaincodeStubInterface, config *Config, target, key, value string) ([]string, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": ObjectTypeAnnotation,
+			"target":  target,
+			"key":     key,
+			"value":   value,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkQueryPlan(config, annotationIndexes, string(queryBytes)); err != nil {
+		return nil, err
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var ids []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		annotation := &AnnotationDoc{}
+		if err := json.Unmarshal(queryResponse.Value, annotation); err != nil {
+			return nil, err
+		}
+		ids = append(ids, annotation.TargetID)
+	}
+	return ids, nil
+}
+
+// intersectStrings returns the values of a that are also in b
+func intersectStrings(a, b []string) []string {
+	var values []string
+	for _, value := range a {
+		if containsString(b, value) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
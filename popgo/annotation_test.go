@@ -0,0 +1,96 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_Annotations(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Creator = testutil.NewIdentity("SellerMSP", "seller")
+	segments := testutil.Chain("main", 3)
+	other := testutil.Root("main").Build()
+	stub.SaveSegment(t, append(segments, other)...)
+	linkHash := []byte(segments[1].GetLinkHashString())
+	mapID := []byte(segments[0].Link.GetMapID())
+
+	stub.Invoke(t, "AnnotateSegment", linkHash, []byte("reviewed"), []byte("true"))
+	stub.Invoke(t, "AnnotateSegment", linkHash, []byte("disputed"), []byte("no"))
+	stub.Invoke(t, "AnnotateSegment", []byte(other.GetLinkHashString()), []byte("reviewed"), []byte("true"))
+	stub.Invoke(t, "AnnotateMap", mapID, []byte("priority"), []byte("high"))
+
+	for _, test := range []struct {
+		filter   string
+		expected int
+	}{
+		{`{"annotations":{"reviewed":"true"}}`, 2},
+		{`{"annotations":{"reviewed":"true","disputed":"no"}}`, 1},
+		{`{"annotations":{"reviewed":"false"}}`, 0},
+		{`{"mapAnnotations":{"priority":"high"}}`, 3},
+		{`{"mapAnnotations":{"priority":"high"},"annotations":{"reviewed":"true"}}`, 1},
+	} {
+		var found cs.SegmentSlice
+		json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(test.filter)), &found)
+		if len(found) != test.expected {
+			fmt.Println("Filter", test.filter, "returned", len(found), "segments, expected", test.expected)
+			t.FailNow()
+		}
+	}
+	stub.InvokeError(t, "FindSegments", []byte(`{"annotations":{"$gt":""}}`))
+
+	var annotations []AnnotationDoc
+	json.Unmarshal(stub.Invoke(t, "GetAnnotations", []byte("segment"), linkHash), &annotations)
+	if len(annotations) != 2 || annotations[0].AnnotatedBy.MSPID != "SellerMSP" {
+		fmt.Println("Got annotations", annotations)
+		t.FailNow()
+	}
+
+	stub.Invoke(t, "AnnotateSegment", linkHash, []byte("disputed"), []byte(""))
+	annotations = nil
+	json.Unmarshal(stub.Invoke(t, "GetAnnotations", []byte("segment"), linkHash), &annotations)
+	if len(annotations) != 1 {
+		fmt.Println("Empty values should remove annotations")
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("BuyerMSP", "buyer")
+	if message := stub.InvokeError(t, "AnnotateMap", mapID, []byte("priority"), []byte("low")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+	stub.InvokeError(t, "AnnotateSegment", []byte("missing"), []byte("reviewed"), []byte("true"))
+}
+
+func TestPop_DeleteSegmentAnnotations(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"admins":["AdminMSP"]}`)})
+	stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+	segment := testutil.Root("main").Build()
+	stub.SaveSegment(t, segment)
+	linkHash := []byte(segment.GetLinkHashString())
+	stub.Invoke(t, "AnnotateSegment", linkHash, []byte("reviewed"), []byte("true"))
+
+	stub.Invoke(t, "DeleteSegment", linkHash)
+	if payload := stub.Invoke(t, "GetAnnotations", []byte("segment"), linkHash); string(payload) != "[]" {
+		fmt.Println("Annotations should be deleted with the segment, got", string(payload))
+		t.FailNow()
+	}
+}
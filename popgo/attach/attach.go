@@ -0,0 +1,162 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package attach pins files attached to pop segments to IPFS.
+//
+// Attachments are registered on-chain with PutAttachmentHash. The service
+// looks them up in a Registry, fetches the content of those stored at an
+// ipfs:// URI from an IPFS node and only pins or serves it once its hash
+// matches the registered hash, so the content served is the one the
+// segment is evidence of.
+package attach
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Attachment is the metadata of an attachment registered on-chain.
+type Attachment struct {
+	LinkHash string `json:"linkHash"`
+	Hash     string `json:"hash"`
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+	URI      string `json:"uri"`
+}
+
+// Registry must be implemented by attachment registry clients, typically
+// calling GetAttachmentMeta on the pop chaincode.
+type Registry interface {
+	// GetAttachment returns the metadata of an attachment, nil if it isn't
+	// registered.
+	GetAttachment(ctx context.Context, linkHash, hash string) (*Attachment, error)
+}
+
+// Node must be implemented by IPFS clients.
+type Node interface {
+	// Cat returns the content of a CID.
+	Cat(ctx context.Context, cid string) (io.ReadCloser, error)
+
+	// Pin pins a CID so it isn't garbage collected.
+	Pin(ctx context.Context, cid string) error
+}
+
+// IPFSScheme starts the URI of attachments stored on IPFS.
+const IPFSScheme = "ipfs://"
+
+var (
+	// ErrNotFound is returned when an attachment isn't registered.
+	ErrNotFound = errors.New("attachment not found")
+
+	// ErrNotOnIPFS is returned for attachments that aren't stored on IPFS.
+	ErrNotOnIPFS = errors.New("attachment is not stored on IPFS")
+
+	// ErrHashMismatch is returned when the content of a CID doesn't match
+	// the registered hash.
+	ErrHashMismatch = errors.New("attachment content doesn't match its hash")
+)
+
+// Service pins and serves attachments.
+type Service struct {
+	registry Registry
+	node     Node
+}
+
+// New creates a service.
+func New(registry Registry, node Node) *Service {
+	return &Service{registry, node}
+}
+
+// Pin pins an attachment after checking its content.
+func (s *Service) Pin(ctx context.Context, linkHash, hash string) error {
+	attachment, _, err := s.fetch(ctx, linkHash, hash)
+	if err != nil {
+		return err
+	}
+	return s.node.Pin(ctx, CID(attachment))
+}
+
+// Get returns an attachment with its checked content.
+func (s *Service) Get(ctx context.Context, linkHash, hash string) (*Attachment, []byte, error) {
+	return s.fetch(ctx, linkHash, hash)
+}
+
+// fetch reads the content of an attachment and checks it against the
+// registered hash.
+func (s *Service) fetch(ctx context.Context, linkHash, hash string) (*Attachment, []byte, error) {
+	attachment, err := s.registry.GetAttachment(ctx, linkHash, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if attachment == nil {
+		return nil, nil, ErrNotFound
+	}
+	cid := CID(attachment)
+	if cid == "" {
+		return nil, nil, ErrNotOnIPFS
+	}
+
+	r, err := s.node.Cat(ctx, cid)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	// Read one more byte than the registered size to detect larger files.
+	content, err := ioutil.ReadAll(io.LimitReader(r, attachment.Size+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(content)) != attachment.Size {
+		return nil, nil, ErrHashMismatch
+	}
+	if err := Verify(attachment.Hash, bytes.NewReader(content)); err != nil {
+		return nil, nil, err
+	}
+	return attachment, content, nil
+}
+
+// CID returns the CID of an attachment stored on IPFS, or an empty string.
+func CID(attachment *Attachment) string {
+	if !strings.HasPrefix(attachment.URI, IPFSScheme) {
+		return ""
+	}
+	return strings.TrimPrefix(attachment.URI, IPFSScheme)
+}
+
+// Verify checks content against a registered hash. Hashes are hex encoded
+// SHA-256 digests, optionally prefixed by "sha256:".
+func Verify(hash string, content io.Reader) error {
+	expected := hash
+	if i := strings.Index(hash, ":"); i >= 0 {
+		if hash[:i] != "sha256" {
+			return fmt.Errorf("unsupported hash algorithm %q", hash[:i])
+		}
+		expected = hash[i+1:]
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return err
+	}
+	if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), expected) {
+		return ErrHashMismatch
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attach
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockRegistry map[string]*Attachment
+
+func (r mockRegistry) GetAttachment(ctx context.Context, linkHash, hash string) (*Attachment, error) {
+	return r[linkHash+"/"+hash], nil
+}
+
+// newIPFS starts a fake IPFS API serving files by CID.
+func newIPFS(files map[string]string, pinned map[string]bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cid := r.URL.Query().Get("arg")
+		content, ok := files[cid]
+		if r.Method != http.MethodPost || !ok {
+			http.Error(w, "not found", http.StatusInternalServerError)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v0/cat":
+			w.Write([]byte(content))
+		case "/api/v0/pin/add":
+			pinned[cid] = true
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func hashOf(content string) string {
+	h := sha256.Sum256([]byte(content))
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+func TestService(t *testing.T) {
+	content := "invoice"
+	pinned := map[string]bool{}
+	ipfs := newIPFS(map[string]string{"QmGood": content, "QmBad": "forged!"}, pinned)
+	defer ipfs.Close()
+
+	registry := mockRegistry{
+		"l/" + hashOf(content): {"l", hashOf(content), "application/pdf", int64(len(content)), "ipfs://QmGood"},
+		"l/forged":             {"l", hashOf(content), "application/pdf", int64(len(content)), "ipfs://QmBad"},
+		"l/s3":                 {"l", hashOf(content), "application/pdf", int64(len(content)), "s3://bucket/invoice"},
+	}
+	server := httptest.NewServer(New(registry, NewHTTPNode(ipfs.URL, nil)).Handler())
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/attachments/l/" + hashOf(content))
+	if err != nil {
+		fmt.Println("Get failed", err)
+		t.FailNow()
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != content || res.Header.Get("Content-Type") != "application/pdf" {
+		fmt.Println("Got content", string(body), res.Header.Get("Content-Type"))
+		t.FailNow()
+	}
+
+	res, err = http.Post(server.URL+"/attachments/l/"+hashOf(content)+"/pin", "", nil)
+	if err != nil {
+		fmt.Println("Post failed", err)
+		t.FailNow()
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent || !pinned["QmGood"] {
+		fmt.Println("Attachment not pinned", res.StatusCode)
+		t.FailNow()
+	}
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/attachments/l/forged", http.StatusConflict},
+		{"/attachments/l/s3", http.StatusBadRequest},
+		{"/attachments/l/unknown", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		res, err := http.Post(server.URL+test.path+"/pin", "", nil)
+		if err != nil {
+			fmt.Println("Post failed", err)
+			t.FailNow()
+		}
+		res.Body.Close()
+		if res.StatusCode != test.status {
+			fmt.Println(test.path, "responded with status", res.StatusCode, "expected", test.status)
+			t.FailNow()
+		}
+	}
+	if pinned["QmBad"] {
+		fmt.Println("Forged content should not be pinned")
+		t.FailNow()
+	}
+}
+
+func TestVerify(t *testing.T) {
+	if err := Verify("md5:abc", nil); err == nil {
+		fmt.Println("Unsupported hash algorithms should be rejected")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attach
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Handler returns the HTTP endpoints of the service:
+//
+//	GET  /attachments/{linkHash}/{hash}      serves the checked content
+//	POST /attachments/{linkHash}/{hash}/pin  pins the attachment
+func (s *Service) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/attachments/", s.serveAttachment)
+	return mux
+}
+
+func (s *Service) serveAttachment(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/attachments/"), "/")
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		attachment, content, err := s.Get(r.Context(), parts[0], parts[1])
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", attachment.MimeType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	case len(parts) == 3 && parts[2] == "pin" && r.Method == http.MethodPost:
+		if err := s.Pin(r.Context(), parts[0], parts[1]); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	switch err {
+	case ErrNotFound:
+		status = http.StatusNotFound
+	case ErrNotOnIPFS:
+		status = http.StatusBadRequest
+	case ErrHashMismatch:
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+}
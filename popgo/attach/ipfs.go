@@ -0,0 +1,71 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attach
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HTTPNode is a Node using the HTTP API of an IPFS daemon.
+type HTTPNode struct {
+	apiURL string
+	client *http.Client
+}
+
+// NewHTTPNode creates a node for the API at apiURL, ie
+// "http://localhost:5001".
+func NewHTTPNode(apiURL string, client *http.Client) *HTTPNode {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPNode{strings.TrimSuffix(apiURL, "/"), client}
+}
+
+// Cat implements Node.Cat.
+func (n *HTTPNode) Cat(ctx context.Context, cid string) (io.ReadCloser, error) {
+	return n.call(ctx, "cat", cid)
+}
+
+// Pin implements Node.Pin.
+func (n *HTTPNode) Pin(ctx context.Context, cid string) error {
+	body, err := n.call(ctx, "pin/add", cid)
+	if err != nil {
+		return err
+	}
+	return body.Close()
+}
+
+// call posts a command of the API and returns the response body.
+func (n *HTTPNode) call(ctx context.Context, command, arg string) (io.ReadCloser, error) {
+	u := n.apiURL + "/api/v0/" + command + "?arg=" + url.QueryEscape(arg)
+	req, err := http.NewRequest(http.MethodPost, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := n.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		res.Body.Close()
+		return nil, fmt.Errorf("ipfs %s responded with status %d", command, res.StatusCode)
+	}
+	return res.Body, nil
+}
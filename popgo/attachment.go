@@ -0,0 +1,160 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ObjectTypeAttachment is used in CouchDB documents of attachments
+const ObjectTypeAttachment = "attachment"
+
+// AttachmentDoc is used to store metadata about files kept off-chain. The
+// hash of the file must be referenced from the state of the segment it is
+// attached to, so the segment is the evidence of the file.
+type AttachmentDoc struct {
+	ObjectType    string     `json:"docType"`
+	LinkHash      string     `json:"linkHash"`
+	Hash          string     `json:"hash"`
+	MimeType      string     `json:"mimeType"`
+	Size          int64      `json:"size"`
+	URI           string     `json:"uri"`
+	RegisteredBy  *Submitter `json:"registeredBy,omitempty"`
+	TransactionID string     `json:"transactionId"`
+}
+
+func (a *AttachmentDoc) validate() error {
+	if a.Hash == "" {
+		return errors.New("Attachment hash is required")
+	}
+	if a.MimeType == "" {
+		return errors.New("Attachment MIME type is required")
+	}
+	if a.Size < 0 {
+		return errors.New("Attachment size should be positive")
+	}
+	if a.URI == "" {
+		return errors.New("Attachment storage URI is required")
+	}
+	return nil
+}
+
+func getAttachmentKey(stub shim.ChaincodeStubInterface, linkHash, hash string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeAttachment, []string{linkHash, hash})
+}
+
+// PutAttachmentHash registers a file attached to a segment. The hash of the
+// file must be a value of the state of the segment.
+func (s *SmartContract) PutAttachmentHash(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 {
+		return shim.Error("Link hash and attachment are required")
+	}
+	attachment := &AttachmentDoc{}
+	if err := json.Unmarshal([]byte(args[1]), attachment); err != nil {
+		return shim.Error("Could not parse attachment")
+	}
+	if err := attachment.validate(); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	segmentDocBytes, _, err := getSegmentDocBytes(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if segmentDocBytes == nil {
+		return shim.Error("Segment not found")
+	}
+	segmentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, ok := segmentDoc.Segment.Meta["encryptedState"]; ok {
+		return shim.Error("Attachments cannot be checked against encrypted segments")
+	}
+	if !referencesValue(segmentDoc.Segment.Link.State, attachment.Hash) {
+		return shim.Error("Attachment " + attachment.Hash + " is not referenced by the segment")
+	}
+
+	key, err := getAttachmentKey(stub, args[0], attachment.Hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	existing, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("Attachment " + attachment.Hash + " is already registered")
+	}
+
+	attachment.ObjectType = ObjectTypeAttachment
+	attachment.LinkHash = args[0]
+	attachment.TransactionID = stub.GetTxID()
+	if attachment.RegisteredBy, err = getSubmitter(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	attachmentBytes, err := json.Marshal(attachment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, attachmentBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(attachmentBytes)
+}
+
+// GetAttachmentMeta returns the metadata of a file attached to a segment
+func (s *SmartContract) GetAttachmentMeta(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 {
+		return shim.Error("Link hash and attachment hash are required")
+	}
+	if err := checkSegmentTenant(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := getAttachmentKey(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	attachmentBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(attachmentBytes, nil)
+}
+
+// referencesValue tells whether a string is one of the values of a state
+func referencesValue(value interface{}, str string) bool {
+	switch v := value.(type) {
+	case string:
+		return v == str
+	case map[string]interface{}:
+		for _, child := range v {
+			if referencesValue(child, str) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if referencesValue(child, str) {
+				return true
+			}
+		}
+	}
+	return false
+}
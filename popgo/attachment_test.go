@@ -0,0 +1,53 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_PutAttachmentHash(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	fileHash := "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	segment := testutil.Root("main").
+		WithState("documents", []interface{}{map[string]interface{}{"invoice": fileHash}}).
+		Build()
+	stub.SaveSegment(t, segment)
+	linkHash := []byte(segment.GetLinkHashString())
+
+	attachment := []byte(`{"hash":"` + fileHash + `","mimeType":"application/pdf","size":1024,"uri":"s3://bucket/invoice.pdf"}`)
+	stub.Invoke(t, "PutAttachmentHash", linkHash, attachment)
+	stub.InvokeError(t, "PutAttachmentHash", linkHash, attachment)
+
+	got := &AttachmentDoc{}
+	json.Unmarshal(stub.Invoke(t, "GetAttachmentMeta", linkHash, []byte(fileHash)), got)
+	if got.LinkHash != string(linkHash) || got.MimeType != "application/pdf" || got.Size != 1024 || got.URI != "s3://bucket/invoice.pdf" {
+		fmt.Println("Got attachment", got)
+		t.FailNow()
+	}
+
+	stub.InvokeError(t, "PutAttachmentHash", linkHash, []byte(`{"hash":"sha256:00","mimeType":"text/plain","size":1,"uri":"ipfs://x"}`))
+	stub.InvokeError(t, "PutAttachmentHash", linkHash, []byte(`{"hash":"`+fileHash+`","size":1}`))
+	stub.InvokeError(t, "PutAttachmentHash", []byte("unknown"), attachment)
+
+	if payload := stub.Invoke(t, "GetAttachmentMeta", linkHash, []byte("sha256:00")); payload != nil {
+		fmt.Println("Unknown attachments should not be found")
+		t.FailNow()
+	}
+}
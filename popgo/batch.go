@@ -0,0 +1,144 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// MaxBatchSegments is the maximum number of segments of a SaveSegments
+const MaxBatchSegments = 50
+
+// pendingStub makes the writes of a transaction visible to its later
+// reads, which Fabric doesn't do, so a batch can save a child segment after
+// its parent and counters are incremented once per segment. It also
+// collects the saveSegment events, since a transaction has a single event.
+type pendingStub struct {
+	shim.ChaincodeStubInterface
+	pending  map[string]stateWrite
+	segments []json.RawMessage
+}
+
+func newPendingStub(stub shim.ChaincodeStubInterface) *pendingStub {
+	return &pendingStub{ChaincodeStubInterface: stub, pending: map[string]stateWrite{}}
+}
+
+// GetState returns the pending value of a key if it was written
+func (s *pendingStub) GetState(key string) ([]byte, error) {
+	if w, ok := s.pending[key]; ok {
+		return w.value, nil
+	}
+	return s.ChaincodeStubInterface.GetState(key)
+}
+
+// PutState writes a key and remembers its value
+func (s *pendingStub) PutState(key string, value []byte) error {
+	s.pending[key] = stateWrite{key: key, value: value}
+	return s.ChaincodeStubInterface.PutState(key, value)
+}
+
+// DelState deletes a key and remembers it was deleted
+func (s *pendingStub) DelState(key string) error {
+	s.pending[key] = stateWrite{key: key, delete: true}
+	return s.ChaincodeStubInterface.DelState(key)
+}
+
+// SetEvent collects saveSegment events
+func (s *pendingStub) SetEvent(name string, payload []byte) error {
+	if name == "saveSegment" {
+		s.segments = append(s.segments, payload)
+		return nil
+	}
+	return s.ChaincodeStubInterface.SetEvent(name, payload)
+}
+
+// orderParentsFirst returns the indexes of the segments of a batch in an
+// order where parents are saved before their children
+func orderParentsFirst(segments []*cs.Segment) []int {
+	index := map[string]int{}
+	for i, segment := range segments {
+		// Segments are validated later, the link hash may be missing
+		if linkHash, ok := segment.Meta["linkHash"].(string); ok {
+			index[linkHash] = i
+		}
+	}
+	ordered := make([]int, 0, len(segments))
+	visited := make([]bool, len(segments))
+	var visit func(i int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		prevLinkHash := segments[i].Link.GetPrevLinkHashString()
+		if parent, ok := index[prevLinkHash]; ok && prevLinkHash != "" {
+			visit(parent)
+		}
+		ordered = append(ordered, i)
+	}
+	for i := range segments {
+		visit(i)
+	}
+	return ordered
+}
+
+// SaveSegments saves several segments atomically. Children can be saved
+// with their parents, in any order. SaveOptions can be passed as second
+// argument. A single saveSegments event lists the saved segments.
+func (s *SmartContract) SaveSegments(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 {
+		return shim.Error("Segments are required")
+	}
+	var segments []*cs.Segment
+	if err := json.Unmarshal([]byte(args[0]), &segments); err != nil {
+		return shim.Error("Could not parse segments")
+	}
+	if len(segments) == 0 || len(segments) > MaxBatchSegments {
+		return shim.Error("A batch should have between 1 and " + strconv.Itoa(MaxBatchSegments) + " segments")
+	}
+	for _, segment := range segments {
+		if segment == nil {
+			return shim.Error("Could not parse segments")
+		}
+		if err := rejectCompensation(segment); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	saveArgs := []string{"", ""}
+	if len(args) > 1 {
+		saveArgs = append(saveArgs, args[1])
+	}
+
+	pstub := newPendingStub(stub)
+	for _, i := range orderParentsFirst(segments) {
+		if res := s.saveSegment(pstub, segments[i], saveArgs); res.Status != shim.OK {
+			return shim.Error("Segment " + strconv.Itoa(i) + ": " + res.Message)
+		}
+	}
+
+	eventBytes, err := json.Marshal(pstub.segments)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.SetEvent("saveSegments", eventBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
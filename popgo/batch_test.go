@@ -0,0 +1,73 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_SaveSegments(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Invoke(t, "CreateProcess", testProcess)
+
+	open := testutil.Root("auction").WithAction("open").Build()
+	bid := testutil.Child(open).WithAction("bid").Build()
+	closed := testutil.Child(bid).WithAction("close").Build()
+	batch, _ := json.Marshal([]*cs.Segment{closed, open, bid})
+	stub.Invoke(t, "SaveSegments", batch)
+
+	for _, segment := range []*cs.Segment{open, bid, closed} {
+		if payload := stub.Invoke(t, "GetSegment", []byte(segment.GetLinkHashString())); payload == nil {
+			fmt.Println("Segment not saved", segment.Link.Meta["action"])
+			t.FailNow()
+		}
+	}
+	if n, _ := getMapCounter(stub, open.Link.GetMapID(), MapCounterSegments); n != 3 {
+		fmt.Println("Expected 3 segments, got", n)
+		t.FailNow()
+	}
+
+	orphan := testutil.Child(testutil.Root("auction").WithAction("open").Build()).WithAction("bid").Build()
+	batch, _ = json.Marshal([]*cs.Segment{orphan})
+	stub.InvokeError(t, "SaveSegments", batch)
+	stub.InvokeError(t, "SaveSegments", []byte(`[null]`))
+	stub.InvokeError(t, "SaveSegments", []byte(`[]`))
+}
+
+func TestPendingStub(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	stub.MockTransactionStart("1")
+	defer stub.MockTransactionEnd("1")
+
+	// The write set stub doesn't apply writes, like Fabric during simulation
+	pstub := newPendingStub(newWriteSetStub(stub))
+	pstub.PutState("a", []byte("1"))
+	pstub.PutState("b", []byte("2"))
+	pstub.DelState("b")
+	if got, _ := pstub.GetState("a"); !reflect.DeepEqual(got, []byte("1")) {
+		fmt.Println("Pending writes should be read")
+		t.FailNow()
+	}
+	if got, _ := pstub.GetState("b"); got != nil {
+		fmt.Println("Pending deletions should be read")
+		t.FailNow()
+	}
+}
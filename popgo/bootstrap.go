@@ -0,0 +1,65 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Bootstrap provisions state when the chaincode is instantiated or
+// upgraded. It is read from the same JSON argument as the Config, next to
+// the configuration options (permissions are part of the Config).
+// Applying a bootstrap again gives the same state: process templates are
+// replaced and listed feature flags are set.
+type Bootstrap struct {
+	Processes []*ProcessDoc   `json:"processes,omitempty"`
+	Features  map[string]bool `json:"features,omitempty"`
+}
+
+func (b *Bootstrap) validate() error {
+	for _, process := range b.Processes {
+		if err := process.validate(); err != nil {
+			return err
+		}
+	}
+	for name := range b.Features {
+		if !containsString(knownFeatures, name) {
+			return errors.New("Unknown feature " + name)
+		}
+	}
+	return nil
+}
+
+// apply writes the bootstrapped state
+func (b *Bootstrap) apply(stub shim.ChaincodeStubInterface) error {
+	for _, process := range b.Processes {
+		if _, err := putProcess(stub, process); err != nil {
+			return err
+		}
+	}
+	if len(b.Features) == 0 {
+		return nil
+	}
+	features, err := getFeatures(stub)
+	if err != nil {
+		return err
+	}
+	for name, enabled := range b.Features {
+		features.set(name, enabled)
+	}
+	return saveFeatures(stub, features)
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// MaxBundleOperations is the maximum number of operations of a ReadBundle
+const MaxBundleOperations = 20
+
+// BundleOperation is a read operation of a ReadBundle
+type BundleOperation struct {
+	Function string   `json:"function"`
+	Args     []string `json:"args"`
+}
+
+// BundleResult is the response of a read operation of a ReadBundle
+type BundleResult struct {
+	Status  int32  `json:"status"`
+	Message string `json:"message,omitempty"`
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// readFunctions returns the functions that can be bundled
+func (s *SmartContract) readFunctions() map[string]func(shim.ChaincodeStubInterface, []string) sc.Response {
+	return map[string]func(shim.ChaincodeStubInterface, []string) sc.Response{
+		"GetSegment":             s.GetSegment,
+		"HasSegment":             s.HasSegment,
+		"FindSegments":           s.FindSegments,
+		"FindMySegments":         s.FindMySegments,
+		"GetMapIDs":              s.GetMapIDs,
+		"GetProcessStats":        s.GetProcessStats,
+		"GetActivitySeries":      s.GetActivitySeries,
+		"GetTagFacets":           s.GetTagFacets,
+		"GetProcess":             s.GetProcess,
+		"DetectGaps":             s.DetectGaps,
+		"GetMapDelta":            s.GetMapDelta,
+		"GetAttachmentMeta":      s.GetAttachmentMeta,
+		"GetInfo":                s.GetInfo,
+		"GetLink":                s.GetLink,
+		"GetEvidences":           s.GetEvidences,
+		"GetValue":               s.GetValue,
+		"GetDoc":                 s.GetDoc,
+		"FindDocs":               s.FindDocs,
+		"GetWebhooks":            s.GetWebhooks,
+		"GetSegmentMetaAudit":    s.GetSegmentMetaAudit,
+		"GetAnnotations":         s.GetAnnotations,
+		"GetDispute":             s.GetDispute,
+		"GetAcknowledgments":     s.GetAcknowledgments,
+		"GetJobStatus":           s.GetJobStatus,
+		"GetQuota":               s.GetQuota,
+		"GetMapByAlias":          s.GetMapByAlias,
+		"GetSegmentByExternalID": s.GetSegmentByExternalID,
+
+		"FindSegmentsWithExpiringEvidence": s.FindSegmentsWithExpiringEvidence,
+	}
+}
+
+// ReadBundle runs several read operations in one invocation, so their
+// results come from the same ledger snapshot. It returns the responses of
+// the operations in order.
+func (s *SmartContract) ReadBundle(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 {
+		return shim.Error("Operations are required")
+	}
+	var operations []BundleOperation
+	if err := json.Unmarshal([]byte(args[0]), &operations); err != nil {
+		return shim.Error("Could not parse operations")
+	}
+	if len(operations) == 0 || len(operations) > MaxBundleOperations {
+		return shim.Error("A bundle should have between 1 and " + strconv.Itoa(MaxBundleOperations) + " operations")
+	}
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	functions := s.readFunctions()
+	for i := range operations {
+		op := &operations[i]
+		op.Function = resolveAlias(op.Function)
+		if _, ok := functions[op.Function]; !ok {
+			return shim.Error("Function " + op.Function + " cannot be bundled")
+		}
+		if len(op.Args) == 0 {
+			return shim.Error("Function " + op.Function + " requires arguments")
+		}
+		if err := checkArgs(op.Function, op.Args); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := checkPermission(stub, config, op.Function); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	results := make([]BundleResult, len(operations))
+	for i, op := range operations {
+		res := functions[op.Function](stub, op.Args)
+		results[i] = BundleResult{res.Status, res.Message, res.Payload}
+	}
+
+	resultsBytes, err := json.Marshal(results)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(resultsBytes, nil)
+}
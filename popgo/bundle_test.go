@@ -0,0 +1,65 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_ReadBundle(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segments := testutil.Chain("main", 2)
+	stub.SaveSegment(t, segments...)
+
+	operations, _ := json.Marshal([]BundleOperation{
+		{"GetSegment", []string{segments[0].GetLinkHashString()}},
+		{"GetSegment", []string{segments[1].GetLinkHashString()}},
+		{"FindSegments", []string{`{"process":"main"}`}},
+		{"FindSegments", []string{`{`}},
+	})
+	var results []BundleResult
+	json.Unmarshal(stub.Invoke(t, "ReadBundle", operations), &results)
+	if len(results) != 4 {
+		fmt.Println("ReadBundle returned", len(results), "results")
+		t.FailNow()
+	}
+	for i, segment := range segments {
+		got := &cs.Segment{}
+		if err := json.Unmarshal(results[i].Payload, got); err != nil || got.GetLinkHashString() != segment.GetLinkHashString() {
+			fmt.Println("Wrong result for operation", i)
+			t.FailNow()
+		}
+	}
+	var found []interface{}
+	json.Unmarshal(results[2].Payload, &found)
+	if results[2].Status != shim.OK || len(found) != 2 {
+		fmt.Println("Wrong result for FindSegments")
+		t.FailNow()
+	}
+	if results[3].Status != shim.ERROR {
+		fmt.Println("Failed operations should be reported")
+		t.FailNow()
+	}
+
+	stub.InvokeError(t, "ReadBundle", []byte(`[{"function":"SaveSegment","args":["{}"]}]`))
+	stub.InvokeError(t, "ReadBundle", []byte(`[]`))
+	stub.InvokeError(t, "ReadBundle", []byte(`[{"function":"GetSegment"}]`))
+}
@@ -0,0 +1,175 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/stratumn/sdk/cs"
+)
+
+// Submitter sends a batch of segments to the SaveSegments function of the
+// chaincode.
+type Submitter interface {
+	SaveSegments(segments []*cs.Segment) error
+}
+
+// ReadFileStore reads the segments of a Stratumn file store directory.
+func ReadFileStore(dir string) ([]*cs.Segment, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []*cs.Segment
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		js, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		segment := &cs.Segment{}
+		if err := json.Unmarshal(js, segment); err != nil {
+			return nil, errors.New(file.Name() + ": " + err.Error())
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// SortParentsFirst orders segments so that parents come before their
+// children. Segments are first sorted by link hash so the order doesn't
+// depend on the store. Parents missing from the segments are assumed to
+// be on the ledger already.
+func SortParentsFirst(segments []*cs.Segment) []*cs.Segment {
+	sorted := append([]*cs.Segment{}, segments...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].GetLinkHashString() < sorted[j].GetLinkHashString()
+	})
+	index := map[string]*cs.Segment{}
+	for _, segment := range sorted {
+		index[segment.GetLinkHashString()] = segment
+	}
+
+	ordered := make([]*cs.Segment, 0, len(sorted))
+	visited := map[string]bool{}
+	var visit func(segment *cs.Segment)
+	visit = func(segment *cs.Segment) {
+		linkHash := segment.GetLinkHashString()
+		if visited[linkHash] {
+			return
+		}
+		visited[linkHash] = true
+		if parent, ok := index[segment.Link.GetPrevLinkHashString()]; ok {
+			visit(parent)
+		}
+		ordered = append(ordered, segment)
+	}
+	for _, segment := range sorted {
+		visit(segment)
+	}
+	return ordered
+}
+
+// Progress is saved after every batch so an interrupted import resumes
+// where it stopped.
+type Progress struct {
+	Total    int    `json:"total"`
+	Imported int    `json:"imported"`
+	LastHash string `json:"lastHash,omitempty"`
+}
+
+// Importer submits segments in batches.
+type Importer struct {
+	Submitter Submitter
+	BatchSize int
+
+	// StatePath is the file the progress is saved to, no progress is
+	// saved if it is empty
+	StatePath string
+
+	// OnBatch is called after every batch
+	OnBatch func(progress *Progress)
+}
+
+// Import submits ordered segments, skipping the ones imported by a
+// previous run with the same state file.
+func (im *Importer) Import(segments []*cs.Segment) (*Progress, error) {
+	if im.BatchSize <= 0 {
+		return nil, errors.New("batch size should be positive")
+	}
+	progress, err := im.loadProgress()
+	if err != nil {
+		return nil, err
+	}
+	if progress.Imported > 0 {
+		if progress.Total != len(segments) || segments[progress.Imported-1].GetLinkHashString() != progress.LastHash {
+			return nil, errors.New("segments changed since the previous run, remove " + im.StatePath + " to start over")
+		}
+	}
+	progress.Total = len(segments)
+
+	for progress.Imported < len(segments) {
+		end := progress.Imported + im.BatchSize
+		if end > len(segments) {
+			end = len(segments)
+		}
+		if err := im.Submitter.SaveSegments(segments[progress.Imported:end]); err != nil {
+			return progress, err
+		}
+		progress.Imported = end
+		progress.LastHash = segments[end-1].GetLinkHashString()
+		if err := im.saveProgress(progress); err != nil {
+			return progress, err
+		}
+		if im.OnBatch != nil {
+			im.OnBatch(progress)
+		}
+	}
+	return progress, nil
+}
+
+func (im *Importer) loadProgress() (*Progress, error) {
+	progress := &Progress{}
+	if im.StatePath == "" {
+		return progress, nil
+	}
+	js, err := ioutil.ReadFile(im.StatePath)
+	if os.IsNotExist(err) {
+		return progress, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return progress, json.Unmarshal(js, progress)
+}
+
+func (im *Importer) saveProgress(progress *Progress) error {
+	if im.StatePath == "" {
+		return nil
+	}
+	js, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(im.StatePath, js, 0644)
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+type fakeSubmitter struct {
+	saved   []*cs.Segment
+	failAt  int
+	batches int
+}
+
+func (f *fakeSubmitter) SaveSegments(segments []*cs.Segment) error {
+	f.batches++
+	if f.batches == f.failAt {
+		return errors.New("peer unavailable")
+	}
+	f.saved = append(f.saved, segments...)
+	return nil
+}
+
+func TestImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "importer")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	chain := testutil.Chain("main", 5)
+	for _, segment := range chain {
+		js, _ := json.Marshal(segment)
+		ioutil.WriteFile(filepath.Join(dir, segment.GetLinkHashString()+".json"), js, 0644)
+	}
+	segments, err := ReadFileStore(dir)
+	if err != nil || len(segments) != 5 {
+		fmt.Println("Read", len(segments), "segments", err)
+		t.FailNow()
+	}
+	segments = SortParentsFirst(segments)
+	for i, segment := range segments {
+		if segment.GetLinkHashString() != chain[i].GetLinkHashString() {
+			fmt.Println("Segment", i, "is not in parents first order")
+			t.FailNow()
+		}
+	}
+
+	// The import stops at the third batch and resumes after it
+	submitter := &fakeSubmitter{failAt: 3}
+	im := &Importer{Submitter: submitter, BatchSize: 2, StatePath: filepath.Join(dir, "state")}
+	if progress, err := im.Import(segments); err == nil || progress.Imported != 4 {
+		fmt.Println("Import should have failed after 4 segments", progress, err)
+		t.FailNow()
+	}
+	if progress, err := im.Import(segments); err != nil || progress.Imported != 5 || len(submitter.saved) != 5 {
+		fmt.Println("Import should have resumed", progress, err)
+		t.FailNow()
+	}
+	if _, err := im.Import(segments[:3]); err == nil {
+		fmt.Println("Import should fail when the segments changed")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The command importer moves the segments of a Stratumn file store to the
+// pop chaincode. Segments are sorted parents first and saved in batches
+// with SaveSegments, using the peer command:
+//
+//	importer -dir /var/stratumn/filestore -C mychannel -n pop -o orderer:7050
+//
+// Progress is saved to a state file after every batch, running the same
+// command again resumes an interrupted import. Only file stores can be
+// read, no PostgreSQL driver is vendored.
+package main
+
+import (
+	"flag"
+	"log"
+)
+
+var (
+	dir       = flag.String("dir", "/var/stratumn/filestore", "path of the file store")
+	peerPath  = flag.String("peer", "peer", "path of the peer command")
+	channel   = flag.String("C", "mychannel", "channel of the chaincode")
+	chaincode = flag.String("n", "pop", "name of the chaincode")
+	orderer   = flag.String("o", "", "address of the orderer")
+	batchSize = flag.Int("batch", 50, "number of segments per transaction")
+	statePath = flag.String("state", "importer.state", "path of the progress file")
+)
+
+func main() {
+	flag.Parse()
+
+	segments, err := ReadFileStore(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	segments = SortParentsFirst(segments)
+	log.Printf("Read %d segments", len(segments))
+
+	im := &Importer{
+		Submitter: &PeerCLI{Path: *peerPath, Channel: *channel, Chaincode: *chaincode, Orderer: *orderer},
+		BatchSize: *batchSize,
+		StatePath: *statePath,
+		OnBatch: func(progress *Progress) {
+			log.Printf("Imported %d/%d segments", progress.Imported, progress.Total)
+		},
+	}
+	if _, err := im.Import(segments); err != nil {
+		log.Fatal(err)
+	}
+}
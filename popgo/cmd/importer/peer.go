@@ -0,0 +1,54 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+
+	"github.com/stratumn/sdk/cs"
+)
+
+// PeerCLI submits segments with the peer command of Fabric, configured
+// by the CORE_PEER_* environment variables.
+type PeerCLI struct {
+	Path      string
+	Channel   string
+	Chaincode string
+	// Orderer is the address of the orderer, passed to peer with -o
+	Orderer string
+}
+
+// SaveSegments invokes SaveSegments and waits for the peer command.
+func (p *PeerCLI) SaveSegments(segments []*cs.Segment) error {
+	segmentsJSON, err := json.Marshal(segments)
+	if err != nil {
+		return err
+	}
+	ctor, err := json.Marshal(map[string][]string{"Args": {"SaveSegments", string(segmentsJSON)}})
+	if err != nil {
+		return err
+	}
+	args := []string{"chaincode", "invoke", "-C", p.Channel, "-n", p.Chaincode, "-c", string(ctor)}
+	if p.Orderer != "" {
+		args = append(args, "-o", p.Orderer)
+	}
+	out, err := exec.Command(p.Path, args...).CombinedOutput()
+	if err != nil {
+		return errors.New(err.Error() + ": " + string(out))
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Index is a CouchDB JSON index.
+type Index struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+}
+
+// Suggestion is an index missing for logged queries.
+type Suggestion struct {
+	Index
+	// Queries is the number of logged queries the index would serve.
+	Queries int `json:"queries"`
+}
+
+// query is the part of a CouchDB query that decides which index is used.
+type query struct {
+	Selector map[string]interface{}   `json:"selector"`
+	Sort     []map[string]interface{} `json:"sort"`
+}
+
+// ReadQueries reads logged queries. Lines are either CouchDB queries, or
+// JSON log entries with the query string in a "query" field.
+func ReadQueries(r io.Reader) ([]string, error) {
+	var queries []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		entry := struct {
+			Query    string          `json:"query"`
+			Selector json.RawMessage `json:"selector"`
+		}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		switch {
+		case entry.Query != "":
+			queries = append(queries, entry.Query)
+		case entry.Selector != nil:
+			queries = append(queries, line)
+		}
+	}
+	return queries, scanner.Err()
+}
+
+// Advise returns the indexes missing to serve queries, most used first.
+func Advise(indexes []Index, queries []string) []Suggestion {
+	suggestions := map[string]*Suggestion{}
+	for _, queryString := range queries {
+		q := &query{}
+		if err := json.Unmarshal([]byte(queryString), q); err != nil || q.Selector == nil {
+			continue
+		}
+		if covered(indexes, q) {
+			continue
+		}
+		fields := indexFields(q)
+		if len(fields) == 0 {
+			continue
+		}
+		key := strings.Join(fields, ",")
+		if s, ok := suggestions[key]; ok {
+			s.Queries++
+			continue
+		}
+		suggestions[key] = &Suggestion{Index{indexName(fields), fields}, 1}
+	}
+
+	var result []Suggestion
+	for _, s := range suggestions {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Queries != result[j].Queries {
+			return result[i].Queries > result[j].Queries
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// covered tells whether an index can serve a query: the selector must have
+// all its fields, and the sort fields must be part of it. This is the rule
+// the chaincode applies in checkQueryPlan.
+func covered(indexes []Index, q *query) bool {
+	sortFields := sortFields(q)
+	for _, index := range indexes {
+		usable := true
+		for _, field := range index.Fields {
+			if _, ok := q.Selector[field]; !ok && !contains(sortFields, field) {
+				usable = false
+			}
+		}
+		for _, field := range sortFields {
+			if !contains(index.Fields, field) {
+				usable = false
+			}
+		}
+		if usable {
+			return true
+		}
+	}
+	return false
+}
+
+// indexFields returns the fields of an index for a query: the selector
+// fields in alphabetical order followed by the sort fields.
+func indexFields(q *query) []string {
+	sortFields := sortFields(q)
+	var fields []string
+	for field := range q.Selector {
+		if !strings.HasPrefix(field, "$") && !contains(sortFields, field) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return append(fields, sortFields...)
+}
+
+func sortFields(q *query) []string {
+	var fields []string
+	for _, s := range q.Sort {
+		for field := range s {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// indexName derives a stable name from the fields of an index.
+func indexName(fields []string) string {
+	hash := sha256.Sum256([]byte(strings.Join(fields, ",")))
+	return "indexAdvised" + hex.EncodeToString(hash[:4])
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAdvise(t *testing.T) {
+	logs := strings.Join([]string{
+		`{"selector":{"docType":"segment","segment.link.meta.process":"main"}}`,
+		`{"level":"info","query":"{\"selector\":{\"docType\":\"segment\",\"segment.link.meta.tags\":{\"$all\":[\"a\"]}}}"}`,
+		`{"selector":{"docType":"segment","segment.link.meta.tags":{"$all":["b"]}},"limit":10}`,
+		`{"selector":{"docType":"segment","segment.link.meta.mapId":{"$in":["m"]}},"sort":[{"sequence":"asc"}]}`,
+		`not a query`,
+	}, "\n")
+	queries, err := ReadQueries(strings.NewReader(logs))
+	if err != nil || len(queries) != 4 {
+		fmt.Println("Read", len(queries), "queries", err)
+		t.FailNow()
+	}
+
+	indexes := []Index{{"indexSegmentProcess", []string{"docType", "segment.link.meta.process"}}}
+	suggestions := Advise(indexes, queries)
+	if len(suggestions) != 2 {
+		fmt.Println("Got suggestions", suggestions)
+		t.FailNow()
+	}
+	if suggestions[0].Queries != 2 || !reflect.DeepEqual(suggestions[0].Fields, []string{"docType", "segment.link.meta.tags"}) {
+		fmt.Println("Wrong first suggestion", suggestions[0])
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(suggestions[1].Fields, []string{"docType", "segment.link.meta.mapId", "sequence"}) {
+		fmt.Println("Wrong second suggestion", suggestions[1])
+		t.FailNow()
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CouchDB manages the indexes of a state database.
+type CouchDB struct {
+	dbURL  string
+	client *http.Client
+}
+
+// NewCouchDB creates a client for the database at dbURL, ie
+// "http://localhost:5984/mychannel_pop".
+func NewCouchDB(dbURL string, client *http.Client) *CouchDB {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &CouchDB{strings.TrimSuffix(dbURL, "/"), client}
+}
+
+// Indexes returns the JSON indexes of the database.
+func (c *CouchDB) Indexes() ([]Index, error) {
+	res, err := c.client.Get(c.dbURL + "/_index")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("couchdb responded with status %d", res.StatusCode)
+	}
+
+	body := struct {
+		Indexes []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+			Def  struct {
+				Fields []map[string]string `json:"fields"`
+			} `json:"def"`
+		} `json:"indexes"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	var indexes []Index
+	for _, i := range body.Indexes {
+		if i.Type != "json" {
+			continue
+		}
+		index := Index{Name: i.Name}
+		for _, field := range i.Def.Fields {
+			for name := range field {
+				index.Fields = append(index.Fields, name)
+			}
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// CreateIndex creates a JSON index in its own design document.
+func (c *CouchDB) CreateIndex(index Index) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"index": map[string]interface{}{"fields": index.Fields},
+		"ddoc":  index.Name,
+		"name":  index.Name,
+		"type":  "json",
+	})
+	if err != nil {
+		return err
+	}
+	res, err := c.client.Post(c.dbURL+"/_index", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		return fmt.Errorf("couchdb responded with status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The command indexadvisor compares the queries run by the pop chaincode
+// with the indexes of the state database of a peer, and suggests or creates
+// the missing indexes.
+//
+// Queries are read from a log file, one per line, either as CouchDB
+// queries or as JSON log entries with a "query" field:
+//
+//	indexadvisor -db http://localhost:5984/mychannel_pop -log queries.log
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+)
+
+var (
+	dbURL      = flag.String("db", "http://localhost:5984/mychannel_pop", "URL of the CouchDB state database")
+	logPath    = flag.String("log", "-", "path of the query log, - for stdin")
+	create     = flag.Bool("create", false, "create the suggested indexes")
+	minQueries = flag.Int("min", 1, "minimum number of queries to suggest an index")
+)
+
+func main() {
+	flag.Parse()
+
+	var r io.Reader = os.Stdin
+	if *logPath != "-" {
+		f, err := os.Open(*logPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		r = f
+	}
+	queries, err := ReadQueries(r)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db := NewCouchDB(*dbURL, nil)
+	indexes, err := db.Indexes()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, suggestion := range Advise(indexes, queries) {
+		if suggestion.Queries < *minQueries {
+			continue
+		}
+		if err := enc.Encode(suggestion); err != nil {
+			log.Fatal(err)
+		}
+		if *create {
+			if err := db.CreateIndex(suggestion.Index); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Created index %s", suggestion.Name)
+		}
+	}
+}
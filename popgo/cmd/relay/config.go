@@ -0,0 +1,123 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+
+	"github.com/piedup/chaincode/popgo/relay"
+)
+
+// Config is the configuration file of the relay.
+type Config struct {
+	// The path of the file storing the number of the last relayed block.
+	Checkpoint string `json:"checkpoint"`
+
+	// The block to start from when no checkpoint exists.
+	StartBlock uint64 `json:"startBlock"`
+
+	// The delays between retries of a failed publication, ie "100ms".
+	RetryDelay    relay.Duration `json:"retryDelay"`
+	MaxRetryDelay relay.Duration `json:"maxRetryDelay"`
+
+	EventHub EventHubConfig `json:"eventHub"`
+
+	Sinks []SinkConfig `json:"sinks"`
+}
+
+// EventHubConfig contains the options of the event hub source.
+type EventHubConfig struct {
+	// The address of the event hub of the peer, ie "peer0:7053".
+	PeerAddress string `json:"peerAddress"`
+
+	// The chaincode whose events are relayed.
+	ChaincodeID string `json:"chaincodeId"`
+
+	RegTimeout relay.Duration `json:"regTimeout"`
+
+	// See eventhub.Config.SkipMissed.
+	SkipMissed bool `json:"skipMissed"`
+
+	// The local MSP the relay registers with.
+	MSPDir string `json:"mspDir"`
+	MSPID  string `json:"mspId"`
+
+	// TLS is enabled when set.
+	TLS *TLSConfig `json:"tls,omitempty"`
+}
+
+// TLSConfig contains the TLS options of the connection to the peer.
+type TLSConfig struct {
+	RootCertFile       string `json:"rootCertFile"`
+	ServerHostOverride string `json:"serverHostOverride"`
+}
+
+// SinkConfig configures a sink of a kind registered with relay.RegisterSink,
+// ie "http", "file" or "nats".
+type SinkConfig struct {
+	Kind   string          `json:"kind"`
+	Config json.RawMessage `json:"config"`
+}
+
+// LoadConfig reads and validates a configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	if c.Checkpoint == "" {
+		return errors.New("checkpoint is required")
+	}
+	if c.EventHub.PeerAddress == "" || c.EventHub.MSPDir == "" || c.EventHub.MSPID == "" {
+		return errors.New("eventHub.peerAddress, eventHub.mspDir and eventHub.mspId are required")
+	}
+	if len(c.Sinks) == 0 {
+		return relay.ErrNoSink
+	}
+	return nil
+}
+
+// newSinks creates the configured sinks.
+func newSinks(configs []SinkConfig) ([]relay.Sink, error) {
+	var sinks []relay.Sink
+	for _, config := range configs {
+		sink, err := relay.NewSink(config.Kind, config.Config)
+		if err != nil {
+			closeSinks(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func closeSinks(sinks []relay.Sink) {
+	for _, sink := range sinks {
+		sink.Close()
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "relay.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.FailNow()
+	}
+	return path
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "relay")
+	if err != nil {
+		t.FailNow()
+	}
+	return dir
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeConfig(t, dir, `{
+		"checkpoint": "/var/lib/relay/checkpoint",
+		"retryDelay": "200ms",
+		"eventHub": {"peerAddress": "peer0:7053", "chaincodeId": "pop", "regTimeout": "5s", "mspDir": "msp", "mspId": "Org1MSP"},
+		"sinks": [
+			{"kind": "file", "config": {"path": "`+filepath.Join(dir, "events")+`"}},
+			{"kind": "nats", "config": {"url": "nats://localhost", "subject": "pop", "timeout": "2s"}}
+		]
+	}`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		fmt.Println("LoadConfig failed", err)
+		t.FailNow()
+	}
+	if time.Duration(config.RetryDelay) != 200*time.Millisecond || time.Duration(config.EventHub.RegTimeout) != 5*time.Second {
+		fmt.Println("Durations not parsed", config.RetryDelay, config.EventHub.RegTimeout)
+		t.FailNow()
+	}
+
+	sinks, err := newSinks(config.Sinks)
+	if err != nil || len(sinks) != 2 {
+		fmt.Println("newSinks failed", err)
+		t.FailNow()
+	}
+	closeSinks(sinks)
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	for _, content := range []string{
+		`{"eventHub": {"peerAddress": "peer0:7053", "mspDir": "msp", "mspId": "Org1MSP"}, "sinks": [{"kind": "file"}]}`,
+		`{"checkpoint": "checkpoint", "eventHub": {"mspDir": "msp", "mspId": "Org1MSP"}, "sinks": [{"kind": "file"}]}`,
+		`{"checkpoint": "checkpoint", "eventHub": {"peerAddress": "peer0:7053", "mspDir": "msp", "mspId": "Org1MSP"}}`,
+		`{"checkpoint": "checkpoint", "retryDelay": 100}`,
+	} {
+		if _, err := LoadConfig(writeConfig(t, dir, content)); err == nil {
+			fmt.Println("Config should be rejected", content)
+			t.FailNow()
+		}
+	}
+
+	if _, err := newSinks([]SinkConfig{{Kind: "kafka"}}); err == nil {
+		fmt.Println("Unknown sink kinds should be rejected")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command relay republishes the events of the pop chaincode to message
+// brokers. It reads blocks from the event hub of a peer and publishes their
+// chaincode events to the sinks of its configuration file:
+//
+//	relay -config relay.json
+//
+// The event hub source depends on the Fabric events client, the command
+// must be built with the eventhub build tag:
+//
+//	go build -tags eventhub ./cmd/relay
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/piedup/chaincode/popgo/relay"
+
+	// Register the broker sinks
+	_ "github.com/piedup/chaincode/popgo/relay/nats"
+)
+
+func main() {
+	configPath := flag.String("config", "relay.json", "path of the configuration file")
+	flag.Parse()
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	source, err := newSource(&config.EventHub)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sinks, err := newSinks(config.Sinks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closeSinks(sinks)
+
+	r, err := relay.New(&relay.Config{
+		StartBlock:    config.StartBlock,
+		RetryDelay:    time.Duration(config.RetryDelay),
+		MaxRetryDelay: time.Duration(config.MaxRetryDelay),
+	}, source, relay.NewFileCheckpoint(config.Checkpoint), sinks...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	if err := r.Start(ctx); err != nil && err != context.Canceled {
+		log.Println(err)
+		closeSinks(sinks)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !eventhub
+// +build !eventhub
+
+package main
+
+import (
+	"errors"
+
+	"github.com/piedup/chaincode/popgo/relay"
+)
+
+// newSource fails when the relay is built without the event hub source.
+func newSource(config *EventHubConfig) (relay.Source, error) {
+	return nil, errors.New("the relay was built without the eventhub build tag")
+}
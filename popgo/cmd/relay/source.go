@@ -0,0 +1,48 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build eventhub
+// +build eventhub
+
+package main
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric/bccsp/factory"
+	mspmgmt "github.com/hyperledger/fabric/msp/mgmt"
+	"github.com/spf13/viper"
+
+	"github.com/piedup/chaincode/popgo/relay"
+	"github.com/piedup/chaincode/popgo/relay/eventhub"
+)
+
+// newSource loads the local MSP and creates the event hub source. The
+// Fabric events client reads its TLS options from viper.
+func newSource(config *EventHubConfig) (relay.Source, error) {
+	if err := mspmgmt.LoadLocalMsp(config.MSPDir, factory.GetDefaultOpts(), config.MSPID); err != nil {
+		return nil, err
+	}
+	if config.TLS != nil {
+		viper.Set("peer.tls.enabled", true)
+		viper.Set("peer.tls.rootcert.file", config.TLS.RootCertFile)
+		viper.Set("peer.tls.serverhostoverride", config.TLS.ServerHostOverride)
+	}
+	return eventhub.NewSource(&eventhub.Config{
+		PeerAddress: config.PeerAddress,
+		ChaincodeID: config.ChaincodeID,
+		RegTimeout:  time.Duration(config.RegTimeout),
+		SkipMissed:  config.SkipMissed,
+	}), nil
+}
@@ -0,0 +1,277 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Segments older than the coldAfterDays option can be moved to cold
+// storage by ArchiveSegments: the segment document is replaced by a
+// compressed copy under a cold key, which isn't indexed by CouchDB.
+// Cold segments are still returned by GetSegment but no longer by
+// FindSegments. Saving a cold segment again moves it back to hot storage.
+const (
+	// ObjectTypeColdSegment is used in CouchDB documents of cold segments
+	ObjectTypeColdSegment = "coldsegment"
+
+	// DefaultArchivePageSize is the number of segments archived by a
+	// transaction when no page size is given
+	DefaultArchivePageSize = 100
+)
+
+// ColdSegmentDoc is used to store cold segments in CouchDB. Data is the
+// gzipped SegmentDoc.
+type ColdSegmentDoc struct {
+	ObjectType string `json:"docType"`
+	ID         string `json:"id"`
+	MapID      string `json:"mapId"`
+	Sequence   int    `json:"sequence,omitempty"`
+	// MergedInto is meta.mergedInto of the segment, see MergeMaps
+	MergedInto string `json:"mergedInto,omitempty"`
+	Data       []byte `json:"data"`
+}
+
+// ArchiveResult is returned by ArchiveSegments
+type ArchiveResult struct {
+	Archived int `json:"archived"`
+	// More is set when other segments are old enough to be archived
+	More bool `json:"more"`
+}
+
+func getColdSegmentKey(stub shim.ChaincodeStubInterface, linkHash string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeColdSegment, []string{linkHash})
+}
+
+// getSegmentDocBytes returns the document of a segment with its link state,
+// decompressing it if it is in cold storage. The boolean tells whether it
+// is.
+func getSegmentDocBytes(stub shim.ChaincodeStubInterface, linkHash string) ([]byte, bool, error) {
+	segmentDocBytes, err := stub.GetState(linkHash)
+	if err != nil {
+		return nil, false, err
+	}
+	if segmentDocBytes != nil {
+		segmentDocBytes, err = withSegmentState(stub, segmentDocBytes)
+		return segmentDocBytes, false, err
+	}
+	key, err := getColdSegmentKey(stub, linkHash)
+	if err != nil {
+		return nil, false, err
+	}
+	coldBytes, err := stub.GetState(key)
+	if err != nil || coldBytes == nil {
+		return nil, false, err
+	}
+	coldDoc := &ColdSegmentDoc{}
+	if err := json.Unmarshal(coldBytes, coldDoc); err != nil {
+		return nil, false, err
+	}
+	r, err := gzip.NewReader(bytes.NewReader(coldDoc.Data))
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Close()
+	segmentDocBytes, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, false, err
+	}
+	return segmentDocBytes, true, nil
+}
+
+// deleteColdSegment removes a segment from cold storage
+func deleteColdSegment(stub shim.ChaincodeStubInterface, linkHash string) error {
+	key, err := getColdSegmentKey(stub, linkHash)
+	if err != nil {
+		return err
+	}
+	return stub.DelState(key)
+}
+
+// archiveSegment moves a segment document to cold storage, with its link
+// state
+func archiveSegment(stub shim.ChaincodeStubInterface, linkHash string, segmentDocBytes []byte) error {
+	segmentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+		return err
+	}
+	if segmentDoc.SplitState {
+		if err := loadSegmentState(stub, segmentDoc); err != nil {
+			return err
+		}
+		if err := deleteSegmentState(stub, linkHash); err != nil {
+			return err
+		}
+		var err error
+		if segmentDocBytes, err = json.Marshal(segmentDoc); err != nil {
+			return err
+		}
+	}
+	var data bytes.Buffer
+	w := gzip.NewWriter(&data)
+	if _, err := w.Write(segmentDocBytes); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	coldDoc := ColdSegmentDoc{
+		ObjectType: ObjectTypeColdSegment,
+		ID:         linkHash,
+		MapID:      segmentDoc.Segment.Link.GetMapID(),
+		Sequence:   segmentDoc.Sequence,
+		Data:       data.Bytes(),
+	}
+	coldDoc.MergedInto, _ = segmentDoc.Segment.Meta[MergedIntoKey].(string)
+	coldBytes, err := json.Marshal(coldDoc)
+	if err != nil {
+		return err
+	}
+	key, err := getColdSegmentKey(stub, linkHash)
+	if err != nil {
+		return err
+	}
+	if err := stub.PutState(key, coldBytes); err != nil {
+		return err
+	}
+	return stub.DelState(linkHash)
+}
+
+// ArchiveSegments moves a page of the segments saved more than
+// coldAfterDays ago to cold storage. Segments saved before savedAt was
+// recorded, pinned segments and segments under legal hold are never
+// archived.
+func (s *SmartContract) ArchiveSegments(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	pageSize := DefaultArchivePageSize
+	if len(args) > 0 && args[0] != "" {
+		var err error
+		if pageSize, err = strconv.Atoi(args[0]); err != nil || pageSize <= 0 {
+			return shim.Error("Invalid page size " + args[0])
+		}
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if config.ColdAfterDays == 0 {
+		return shim.Error("Cold storage is disabled")
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	cutoff := now.Add(-time.Duration(config.ColdAfterDays) * 24 * time.Hour)
+
+	selector := map[string]interface{}{
+		"docType": ObjectTypeSegment,
+		"savedAt": map[string]interface{}{"$lt": cutoff.UnixNano() / int64(time.Millisecond)},
+		"pinned":  map[string]interface{}{"$exists": false},
+	}
+	heldProcesses, heldMapIDs, err := heldTargets(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(heldProcesses) > 0 {
+		selector["segment.link.meta.process"] = map[string]interface{}{"$nin": heldProcesses}
+	}
+	if len(heldMapIDs) > 0 {
+		selector["segment.link.meta.mapId"] = map[string]interface{}{"$nin": heldMapIDs}
+	}
+
+	// Fetch one more segment than the page size to know if there are more
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": selector,
+		"limit":    pageSize + 1,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, err := checkQueryPlan(config, segmentIndexes, string(queryBytes)); err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	result := ArchiveResult{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if result.Archived == pageSize {
+			result.More = true
+			break
+		}
+		if err := archiveSegment(stub, queryResponse.Key, queryResponse.Value); err != nil {
+			return shim.Error(err.Error())
+		}
+		result.Archived++
+	}
+
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(resultBytes)
+}
+
+// getColdSequences returns the sequence numbers of the cold segments of a
+// map by link hash
+func getColdSequences(stub shim.ChaincodeStubInterface, mapID string) (map[string]int, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": ObjectTypeColdSegment,
+			"mapId":   mapID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	sequences := map[string]int{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		coldDoc := &ColdSegmentDoc{}
+		if err := json.Unmarshal(queryResponse.Value, coldDoc); err != nil {
+			return nil, err
+		}
+		sequences[coldDoc.ID] = coldDoc.Sequence
+	}
+	return sequences, nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_ArchiveSegments(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.InvokeError(t, "ArchiveSegments")
+	// The archive query is covered by an index, so strict queries accept it
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"admins":["AdminMSP"],"coldAfterDays":30,"strictQueries":true}`)})
+
+	day := int64(24 * 3600)
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 100 * day}
+	segments := testutil.Chain("main", 3)
+	stub.SaveSegment(t, segments[:2]...)
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 120 * day}
+	stub.SaveSegment(t, segments[2])
+
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 140 * day}
+	result := &ArchiveResult{}
+	json.Unmarshal(stub.Invoke(t, "ArchiveSegments", []byte("1")), result)
+	if result.Archived != 1 || !result.More {
+		fmt.Println("Got result", result)
+		t.FailNow()
+	}
+	json.Unmarshal(stub.Invoke(t, "ArchiveSegments"), result)
+	if result.Archived != 1 || result.More {
+		fmt.Println("Got result", result)
+		t.FailNow()
+	}
+
+	for _, segment := range segments[:2] {
+		if stub.State[segment.GetLinkHashString()] != nil {
+			fmt.Println("Old segments should be archived")
+			t.FailNow()
+		}
+		got := &cs.Segment{}
+		json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(segment.GetLinkHashString())), got)
+		if !reflect.DeepEqual(got.Link, segment.Link) {
+			fmt.Println("Cold segment should be returned by GetSegment")
+			t.FailNow()
+		}
+	}
+
+	var found cs.SegmentSlice
+	json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"process":"main"}`)), &found)
+	if len(found) != 1 {
+		fmt.Println("FindSegments returned", len(found), "segments")
+		t.FailNow()
+	}
+
+	report := &GapReport{}
+	json.Unmarshal(stub.Invoke(t, "DetectGaps", []byte(segments[0].Link.GetMapID())), report)
+	if len(report.Missing) != 0 {
+		fmt.Println("Cold segments should not be reported missing", report.Missing)
+		t.FailNow()
+	}
+
+	// Saving a cold segment again moves it back to hot storage
+	stub.SaveSegment(t, segments[0])
+	segmentDoc := &SegmentDoc{}
+	json.Unmarshal(stub.State[segments[0].GetLinkHashString()], segmentDoc)
+	if segmentDoc.Sequence != 1 || segmentDoc.SavedAt != 100*day*1000 {
+		fmt.Println("Rehydrated segment lost its sequence", segmentDoc.Sequence, segmentDoc.SavedAt)
+		t.FailNow()
+	}
+	if key, _ := getColdSegmentKey(stub, segments[0].GetLinkHashString()); stub.State[key] != nil {
+		fmt.Println("Rehydrated segment should leave cold storage")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+)
+
+// validateCollections checks the private data collections pool
+func validateCollections(collections []string) error {
+	seen := map[string]bool{}
+	for _, collection := range collections {
+		if collection == "" {
+			return errors.New("Private collection names should not be empty")
+		}
+		if seen[collection] {
+			return errors.New("Private collection " + collection + " is listed twice")
+		}
+		seen[collection] = true
+	}
+	return nil
+}
+
+// assignCollection picks the collection of a private process with
+// rendezvous hashing: growing the pool only moves the processes assigned
+// to the new collections. Assignments are recorded in the process
+// registry, so existing processes never move.
+func assignCollection(config *Config, process string) (string, error) {
+	if len(config.PrivateCollections) == 0 {
+		return "", errors.New("No private collection is configured")
+	}
+	var assigned string
+	var best []byte
+	for _, collection := range config.PrivateCollections {
+		score := sha256.Sum256([]byte(process + "\x00" + collection))
+		if best == nil || bytes.Compare(score[:], best) > 0 {
+			assigned, best = collection, score[:]
+		}
+	}
+	return assigned, nil
+}
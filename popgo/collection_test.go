@@ -0,0 +1,58 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestPop_PrivateProcessCollection(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.InvokeError(t, "CreateProcess", []byte(`{"name":"secret","initialActions":["a"],"private":true}`))
+
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"admins":["AdminMSP"],"privateCollections":["c1","c2","c3"]}`)})
+	process := &ProcessDoc{}
+	json.Unmarshal(stub.Invoke(t, "CreateProcess", []byte(`{"name":"secret","initialActions":["a"],"private":true}`)), process)
+	if process.Collection == "" {
+		fmt.Println("Private processes should be assigned a collection")
+		t.FailNow()
+	}
+	json.Unmarshal(stub.Invoke(t, "GetProcess", []byte("secret")), process)
+	if process.Collection == "" {
+		fmt.Println("The collection should be recorded in the process registry")
+		t.FailNow()
+	}
+
+	// Growing the pool only moves processes to the new collection
+	grown := &Config{PrivateCollections: []string{"c1", "c2", "c3", "c4"}}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		before, _ := assignCollection(&Config{PrivateCollections: []string{"c1", "c2", "c3"}}, name)
+		after, _ := assignCollection(grown, name)
+		if after != before && after != "c4" {
+			fmt.Println("Process", name, "moved from", before, "to", after)
+			t.FailNow()
+		}
+	}
+
+	stub.InvokeError(t, "CreateProcess", []byte(`{"name":"pinned","initialActions":["a"],"collection":"c1"}`))
+	if res := stub.MockInit("bad", [][]byte{[]byte("init"), []byte(`{"admins":["AdminMSP"],"privateCollections":["c1","c1"]}`)}); res.Status == shim.OK {
+		fmt.Println("Duplicate collections should be rejected")
+		t.FailNow()
+	}
+}
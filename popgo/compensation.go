@@ -0,0 +1,124 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Compensations support sagas: a compensating segment undoes an earlier
+// step of its map. It has the link hash of the step in link.meta.compensates
+// and the step gets the link hash of the compensation in
+// meta.compensatedBy, so workflow engines see it in query results.
+const (
+	// CompensatesKey is the link meta key of the compensated step
+	CompensatesKey = "compensates"
+
+	// CompensatedByKey is the meta key of the compensating segment
+	CompensatedByKey = "compensatedBy"
+)
+
+// compensatedStep returns the link hash of the step a segment compensates,
+// empty if it isn't a compensation
+func compensatedStep(segment *cs.Segment) (string, error) {
+	value, ok := segment.Link.Meta[CompensatesKey]
+	if !ok {
+		return "", nil
+	}
+	linkHash, ok := value.(string)
+	if !ok || linkHash == "" {
+		return "", errors.New("link.meta.compensates should be a link hash")
+	}
+	return linkHash, nil
+}
+
+// rejectCompensation rejects compensations saved without
+// CompensateSegment, which wouldn't flag the compensated step
+func rejectCompensation(segment *cs.Segment) error {
+	if _, ok := segment.Link.Meta[CompensatesKey]; ok {
+		return errors.New("Compensating segments should be saved with CompensateSegment")
+	}
+	return nil
+}
+
+// CompensateSegment saves a segment compensating an earlier step of its
+// map. The step must exist in the same map, must not be a compensation and
+// can only be compensated once. It takes the same arguments as
+// SaveSegment.
+func (s *SmartContract) CompensateSegment(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	byteArgs := stub.GetArgs()
+	if len(byteArgs) < 2 {
+		return shim.Error("Segment is required")
+	}
+	segment := &cs.Segment{}
+	if err := json.Unmarshal(byteArgs[1], segment); err != nil {
+		return shim.Error("Could not parse segment")
+	}
+	stepLinkHash, err := compensatedStep(segment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if stepLinkHash == "" {
+		return shim.Error("link.meta.compensates is required")
+	}
+	if segment.Link.GetPrevLinkHashString() == "" {
+		return shim.Error("Compensating segments should have a parent")
+	}
+
+	stepDocBytes, cold, err := getSegmentDocBytes(stub, stepLinkHash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if stepDocBytes == nil {
+		return shim.Error("Compensated segment not found")
+	}
+	stepDoc := &SegmentDoc{}
+	if err := json.Unmarshal(stepDocBytes, stepDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	step := &stepDoc.Segment
+	if step.Link.GetMapID() != segment.Link.GetMapID() {
+		return shim.Error("Compensated segment should be in the same map")
+	}
+	if _, ok := step.Link.Meta[CompensatesKey]; ok {
+		return shim.Error("Compensating segments cannot be compensated")
+	}
+	if compensatedBy, ok := step.Meta[CompensatedByKey].(string); ok {
+		return shim.Error("Segment already compensated by " + compensatedBy)
+	}
+
+	if res := s.saveSegment(stub, segment, args); res.Status != shim.OK {
+		return res
+	}
+
+	if step.Meta == nil {
+		step.Meta = map[string]interface{}{}
+	}
+	step.Meta[CompensatedByKey] = segment.GetLinkHashString()
+	if err := putSegmentDoc(stub, *stepDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	if cold {
+		if err := deleteColdSegment(stub, stepLinkHash); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success(nil)
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_CompensateSegment(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segments := testutil.Chain("saga", 2)
+	stub.SaveSegment(t, segments...)
+	step := segments[0].GetLinkHashString()
+
+	compensation := testutil.Child(segments[1]).WithLinkMeta(CompensatesKey, step).Build()
+	stub.InvokeError(t, "SaveSegment", mustMarshal(compensation))
+	stub.Invoke(t, "CompensateSegment", mustMarshal(compensation))
+
+	got := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(step)), got)
+	if got.Meta[CompensatedByKey] != compensation.GetLinkHashString() {
+		fmt.Println("Got meta", got.Meta)
+		t.FailNow()
+	}
+	var found cs.SegmentSlice
+	json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"mapIds":["`+segments[0].Link.GetMapID()+`"]}`)), &found)
+	compensated := 0
+	for _, segment := range found {
+		if segment.Meta[CompensatedByKey] != nil {
+			compensated++
+		}
+	}
+	if len(found) != 3 || compensated != 1 {
+		fmt.Println("FindSegments should flag the compensated step")
+		t.FailNow()
+	}
+
+	stub.SaveSegment(t, segments[0])
+	got = &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(step)), got)
+	if got.Meta[CompensatedByKey] == nil {
+		fmt.Println("Saving a step again should keep its compensation")
+		t.FailNow()
+	}
+
+	for _, segment := range []*cs.Segment{
+		testutil.Child(compensation).WithLinkMeta(CompensatesKey, step).Build(),
+		testutil.Child(compensation).WithLinkMeta(CompensatesKey, compensation.GetLinkHashString()).Build(),
+		testutil.Child(compensation).WithLinkMeta(CompensatesKey, "missing").Build(),
+		testutil.Child(compensation).WithLinkMeta(CompensatesKey, 1).Build(),
+		testutil.Child(compensation).Build(),
+		testutil.Root("saga").WithLinkMeta(CompensatesKey, segments[1].GetLinkHashString()).Build(),
+	} {
+		stub.InvokeError(t, "CompensateSegment", mustMarshal(segment))
+	}
+	other := testutil.Chain("saga", 1)[0]
+	stub.SaveSegment(t, other)
+	stub.InvokeError(t, "CompensateSegment", mustMarshal(testutil.Child(other).WithLinkMeta(CompensatesKey, segments[1].GetLinkHashString()).Build()))
+
+	forged := testutil.Child(compensation).Build()
+	forged.Meta[CompensatedByKey] = "forged"
+	stub.SaveSegment(t, forged)
+	got = &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(forged.GetLinkHashString())), got)
+	if got.Meta[CompensatedByKey] != nil {
+		fmt.Println("compensatedBy should only be set by CompensateSegment")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stratumn/sdk/store"
+)
+
+// ObjectTypeConfig is the composite key object type of the configuration
+const ObjectTypeConfig = "config"
+
+// ErrUnauthorized is returned when the creator of a transaction isn't
+// allowed to call a function
+var ErrUnauthorized = errors.New("Unauthorized")
+
+// Config is the chaincode configuration, given as the first argument of
+// Init. Upgrading without arguments keeps the current configuration.
+type Config struct {
+	// Admins are the MSP IDs allowed to call admin functions
+	Admins []string `json:"admins"`
+
+	// Gateways are the MSP IDs allowed to submit segments on behalf of
+	// end users
+	Gateways []string `json:"gateways,omitempty"`
+
+	// Fossilizers are the MSP IDs allowed to add evidences to segments
+	Fossilizers []string `json:"fossilizers,omitempty"`
+
+	// AllowUnknownEvidenceBackends accepts evidences of backends without
+	// verifier when their proof contains the link hash
+	AllowUnknownEvidenceBackends bool `json:"allowUnknownEvidenceBackends,omitempty"`
+
+	// StrictQueries rejects queries that no index covers instead of
+	// returning a warning
+	StrictQueries bool `json:"strictQueries,omitempty"`
+
+	// DefaultPageSize is used by queries without limit and MaxPageSize
+	// caps the limit of queries, they default to store.DefaultLimit and
+	// store.MaxLimit
+	DefaultPageSize int `json:"defaultPageSize,omitempty"`
+	MaxPageSize     int `json:"maxPageSize,omitempty"`
+
+	// ColdAfterDays is the age in days after which ArchiveSegments moves
+	// segments to cold storage, zero disables cold storage
+	ColdAfterDays int `json:"coldAfterDays,omitempty"`
+
+	// Permissions restrict who can call functions, by function name
+	Permissions map[string]*Permission `json:"permissions,omitempty"`
+
+	// DeleteApproval makes deletions need the approval of a second
+	// organization
+	DeleteApproval *DeleteApproval `json:"deleteApproval,omitempty"`
+
+	// MultiTenant restricts queries to the segments and maps submitted by
+	// the organization of the caller
+	MultiTenant bool `json:"multiTenant,omitempty"`
+
+	// MaxResponseBytes is the size budget of FindSegments responses, it
+	// defaults to DefaultMaxResponseBytes
+	MaxResponseBytes int `json:"maxResponseBytes,omitempty"`
+
+	// PrivateCollections is the pool of private data collections private
+	// processes are assigned to
+	PrivateCollections []string `json:"privateCollections,omitempty"`
+
+	// DefaultQuota limits the writes of organizations without quota
+	// override, see SetQuota
+	DefaultQuota *Quota `json:"defaultQuota,omitempty"`
+
+	// Classification gives the policy of each segment label, see
+	// SetSegmentLabel
+	Classification map[string]*LabelPolicy `json:"classification,omitempty"`
+}
+
+// DefaultMaxResponseBytes keeps responses well under the 4MB default
+// message size of peer gRPC connections
+const DefaultMaxResponseBytes = 2 << 20
+
+func (c *Config) validate() error {
+	if c.ColdAfterDays < 0 {
+		return errors.New("Cold storage age should be positive")
+	}
+	if c.MaxResponseBytes < 0 {
+		return errors.New("Response size budget should be positive")
+	}
+	if c.DefaultPageSize < 0 || c.MaxPageSize < 0 {
+		return errors.New("Page sizes should be positive")
+	}
+	if c.MaxPageSize > 0 && c.DefaultPageSize > c.MaxPageSize {
+		return errors.New("Default page size should not exceed the maximum page size")
+	}
+	if c.DeleteApproval != nil {
+		if len(c.DeleteApproval.Approvers) < 2 {
+			return errors.New("Deletions need at least two approvers")
+		}
+		if c.DeleteApproval.WindowHours <= 0 {
+			return errors.New("Deletion approval window should be positive")
+		}
+	}
+	if c.DefaultQuota != nil {
+		if err := c.DefaultQuota.validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateClassification(c.Classification); err != nil {
+		return err
+	}
+	return validateCollections(c.PrivateCollections)
+}
+
+// pageLimit returns the number of results to return for a requested limit
+func (c *Config) pageLimit(limit int) int {
+	max := c.MaxPageSize
+	if max == 0 {
+		max = store.MaxLimit
+	}
+	def := c.DefaultPageSize
+	if def == 0 {
+		def = store.DefaultLimit
+	}
+	if def > max {
+		def = max
+	}
+	if limit <= 0 {
+		return def
+	}
+	if limit > max {
+		return max
+	}
+	return limit
+}
+
+// responseBudget returns the size budget of a response for a requested
+// budget, which can only lower the configured one
+func (c *Config) responseBudget(requested int) int {
+	max := c.MaxResponseBytes
+	if max == 0 {
+		max = DefaultMaxResponseBytes
+	}
+	if requested > 0 && requested < max {
+		return requested
+	}
+	return max
+}
+
+func getConfigKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeConfig, []string{})
+}
+
+// getConfig returns the stored configuration, or an empty one
+func getConfig(stub shim.ChaincodeStubInterface) (*Config, error) {
+	key, err := getConfigKey(stub)
+	if err != nil {
+		return nil, err
+	}
+	configBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if configBytes == nil {
+		return config, nil
+	}
+	if err := json.Unmarshal(configBytes, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func saveConfig(stub shim.ChaincodeStubInterface, config *Config) error {
+	key, err := getConfigKey(stub)
+	if err != nil {
+		return err
+	}
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, configBytes)
+}
+
+// requireAdmin checks the creator of the transaction is an admin
+func requireAdmin(stub shim.ChaincodeStubInterface) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	return requireCreatorIn(stub, config.Admins)
+}
+
+// requireGateway checks the creator of the transaction is a gateway
+func requireGateway(stub shim.ChaincodeStubInterface) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	return requireCreatorIn(stub, config.Gateways)
+}
+
+// requireFossilizer checks the creator of the transaction is a fossilizer
+func requireFossilizer(stub shim.ChaincodeStubInterface) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	return requireCreatorIn(stub, config.Fossilizers)
+}
+
+// requireCreatorIn checks the MSP ID of the creator of the transaction is
+// in a list
+func requireCreatorIn(stub shim.ChaincodeStubInterface, mspIDs []string) error {
+	mspID, err := getCreatorMSPID(stub)
+	if err != nil {
+		return err
+	}
+	for _, id := range mspIDs {
+		if mspID != "" && id == mspID {
+			return nil
+		}
+	}
+	return ErrUnauthorized
+}
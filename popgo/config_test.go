@@ -0,0 +1,210 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/store"
+)
+
+func newAdminStub(t *testing.T) *testutil.Stub {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	if res := stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"admins":["AdminMSP"]}`)}); res.Status != shim.OK {
+		fmt.Println("Init failed", res.Message)
+		t.FailNow()
+	}
+	stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+	return stub
+}
+
+func TestPop_InitConfig(t *testing.T) {
+	stub := newAdminStub(t)
+	config, err := getConfig(stub)
+	if err != nil || len(config.Admins) != 1 || config.Admins[0] != "AdminMSP" {
+		fmt.Println("Init did not save the config", config, err)
+		t.FailNow()
+	}
+
+	// Upgrading without arguments keeps the config
+	if res := stub.MockInit("upgrade", [][]byte{[]byte("init")}); res.Status != shim.OK {
+		fmt.Println("Init failed", res.Message)
+		t.FailNow()
+	}
+	if config, _ := getConfig(stub); len(config.Admins) != 1 {
+		fmt.Println("Init without config should keep the config")
+		t.FailNow()
+	}
+
+	if res := stub.MockInit("bad", [][]byte{[]byte("init"), []byte("{")}); res.Status == shim.OK {
+		fmt.Println("Init with an invalid config should fail")
+		t.FailNow()
+	}
+}
+
+func TestPop_InitBootstrap(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	bootstrap := []byte(`{
+		"admins": ["AdminMSP"],
+		"permissions": {"DeleteSegment": {"msps": ["AdminMSP"]}},
+		"processes": [{"name": "auction", "initialActions": ["open"]}],
+		"features": {"signed-only": true}
+	}`)
+	for i := 0; i < 2; i++ {
+		if res := stub.MockInit("init", [][]byte{[]byte("init"), bootstrap}); res.Status != shim.OK {
+			fmt.Println("Init failed", res.Message)
+			t.FailNow()
+		}
+	}
+
+	process := &ProcessDoc{}
+	json.Unmarshal(stub.Invoke(t, "GetProcess", []byte("auction")), process)
+	if process.Name != "auction" || len(process.InitialActions) != 1 {
+		fmt.Println("Got process", process)
+		t.FailNow()
+	}
+	info := &Info{}
+	json.Unmarshal(stub.Invoke(t, "GetInfo"), info)
+	if !info.Features[FeatureSignedOnly] {
+		fmt.Println("Got features", info.Features)
+		t.FailNow()
+	}
+	if config, _ := getConfig(stub); config.Permissions["DeleteSegment"] == nil {
+		fmt.Println("Permissions not saved", config)
+		t.FailNow()
+	}
+
+	if res := stub.MockInit("bad", [][]byte{[]byte("init"), []byte(`{"features":{"unknown":true}}`)}); res.Status == shim.OK {
+		fmt.Println("Init with an unknown feature should fail")
+		t.FailNow()
+	}
+}
+
+func TestPop_requireAdmin(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.MockTransactionStart("1")
+	defer stub.MockTransactionEnd("1")
+
+	if err := requireAdmin(stub); err != nil {
+		fmt.Println("Admin was refused", err)
+		t.FailNow()
+	}
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if err := requireAdmin(stub); err != ErrUnauthorized {
+		fmt.Println("User should be refused, got", err)
+		t.FailNow()
+	}
+}
+
+func TestPop_pageLimit(t *testing.T) {
+	tests := []struct {
+		config   Config
+		limit    int
+		expected int
+	}{
+		{Config{}, 0, store.DefaultLimit},
+		{Config{}, 1000, store.MaxLimit},
+		{Config{}, 5, 5},
+		{Config{DefaultPageSize: 3, MaxPageSize: 10}, 0, 3},
+		{Config{DefaultPageSize: 3, MaxPageSize: 10}, 11, 10},
+		{Config{MaxPageSize: 10}, 0, 10},
+	}
+	for _, test := range tests {
+		if limit := test.config.pageLimit(test.limit); limit != test.expected {
+			fmt.Println("Got limit", limit, "for", test.limit, "expected", test.expected)
+			t.FailNow()
+		}
+	}
+}
+
+func TestPop_FindSegmentsTruncated(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"defaultPageSize":2,"maxPageSize":3}`)})
+	stub.SaveSegment(t, testutil.Chain("main", 4)...)
+
+	for _, test := range []struct {
+		filter    string
+		expected  int
+		truncated bool
+	}{
+		{`{"process":"main"}`, 2, true},
+		{`{"process":"main","pagination":{"limit":10}}`, 3, true},
+		{`{"process":"main","pagination":{"limit":3,"offset":2}}`, 2, false},
+	} {
+		res := stub.Call("FindSegments", []byte(test.filter))
+		var segments []interface{}
+		json.Unmarshal(res.Payload, &segments)
+		meta := &ResponseMeta{}
+		json.Unmarshal([]byte(res.Message), meta)
+		if len(segments) != test.expected || meta.Truncated != test.truncated {
+			fmt.Println("Filter", test.filter, "returned", len(segments), "segments, truncated", meta.Truncated)
+			t.FailNow()
+		}
+	}
+
+	if res := stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"defaultPageSize":5,"maxPageSize":3}`)}); res.Status == shim.OK {
+		fmt.Println("Init should reject a default page size above the maximum")
+		t.FailNow()
+	}
+}
+
+func TestPop_FindSegmentsResponseBudget(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"maxResponseBytes":3000}`)})
+	for i := 0; i < 5; i++ {
+		stub.SaveSegment(t, testutil.Root("main").WithState("data", strings.Repeat("x", 1000)).Build())
+	}
+
+	seen := map[string]bool{}
+	bookmark := "0"
+	for pages := 0; bookmark != ""; pages++ {
+		if pages == 5 {
+			fmt.Println("Bookmarks should reach the last page")
+			t.FailNow()
+		}
+		res := stub.Call("FindSegments", []byte(`{"process":"main","pagination":{"offset":`+bookmark+`}}`))
+		if len(res.Payload) > 3000 {
+			fmt.Println("Response of", len(res.Payload), "bytes exceeds the budget")
+			t.FailNow()
+		}
+		var segments cs.SegmentSlice
+		json.Unmarshal(res.Payload, &segments)
+		for _, segment := range segments {
+			seen[segment.GetLinkHashString()] = true
+		}
+		meta := &ResponseMeta{}
+		json.Unmarshal([]byte(res.Message), meta)
+		bookmark = meta.Bookmark
+	}
+	if len(seen) != 5 {
+		fmt.Println("Got", len(seen), "segments")
+		t.FailNow()
+	}
+
+	res := stub.Call("FindSegments", []byte(`{"process":"main","maxResponseBytes":100}`))
+	var segments []interface{}
+	json.Unmarshal(res.Payload, &segments)
+	if len(segments) != 1 {
+		fmt.Println("The first segment should be returned even above the budget")
+		t.FailNow()
+	}
+	stub.InvokeError(t, "FindSegments", []byte(`{"process":"main","maxResponseBytes":-1}`))
+}
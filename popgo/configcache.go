@@ -0,0 +1,243 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/common"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ObjectTypeConfigVersion is used in the keys of the versions of the cached
+// documents, one per object type
+const ObjectTypeConfigVersion = "configversion"
+
+// cachedObjectTypes are the object types of the documents read by most
+// invocations: the configuration and its permissions, the feature flags and
+// the process templates
+var cachedObjectTypes = []string{ObjectTypeConfig, ObjectTypeFeatures, ObjectTypeProcess}
+
+// configCache keeps the cached documents in memory between invocations.
+// A chaincode container serves every channel it is instantiated on, so the
+// documents are cached by channel.
+//
+// Every write of a cached document sets the version of its object type to
+// the transaction ID. The first read of an object type in an invocation
+// reads its version: cached documents read at another version are dropped,
+// and since the version is in the read set, transactions that used a stale
+// cache fail MVCC validation. Documents of an object type without version,
+// ie right after an upgrade, aren't cached.
+type configCache struct {
+	mu     sync.Mutex
+	groups map[string]*cacheGroup
+}
+
+// cacheGroup holds the cached documents of an object type on a channel
+type cacheGroup struct {
+	version string
+	entries map[string][]byte
+}
+
+func cacheGroupKey(channel, objectType string) string {
+	return channel + "\x00" + objectType
+}
+
+func (c *configCache) get(channel, objectType, version, key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	group, ok := c.groups[cacheGroupKey(channel, objectType)]
+	if !ok || group.version != version {
+		return nil, false
+	}
+	value, ok := group.entries[key]
+	return value, ok
+}
+
+func (c *configCache) put(channel, objectType, version, key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.groups == nil {
+		c.groups = map[string]*cacheGroup{}
+	}
+	groupKey := cacheGroupKey(channel, objectType)
+	group, ok := c.groups[groupKey]
+	if !ok || group.version != version {
+		group = &cacheGroup{version: version, entries: map[string][]byte{}}
+		c.groups[groupKey] = group
+	}
+	group.entries[key] = value
+}
+
+// drop removes the cached documents of an object type on a channel
+func (c *configCache) drop(channel, objectType string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.groups, cacheGroupKey(channel, objectType))
+}
+
+func getConfigVersionKey(stub shim.ChaincodeStubInterface, objectType string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeConfigVersion, []string{objectType})
+}
+
+// getChannelID returns the channel of the transaction, or an empty string
+// if the stub has no signed proposal
+func getChannelID(stub shim.ChaincodeStubInterface) (string, error) {
+	signedProposal, err := stub.GetSignedProposal()
+	if err != nil || signedProposal == nil {
+		return "", err
+	}
+	proposal := &sc.Proposal{}
+	if err := proto.Unmarshal(signedProposal.ProposalBytes, proposal); err != nil {
+		return "", err
+	}
+	header := &common.Header{}
+	if err := proto.Unmarshal(proposal.Header, header); err != nil {
+		return "", err
+	}
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(header.ChannelHeader, channelHeader); err != nil {
+		return "", err
+	}
+	return channelHeader.ChannelId, nil
+}
+
+// cachedStub reads the cached documents from the cache and bumps the
+// version of their object type when they are written
+type cachedStub struct {
+	shim.ChaincodeStubInterface
+	cache    *configCache
+	channel  string
+	prefixes map[string]string
+
+	// versions are the versions read by the invocation, written the object
+	// types it wrote, which are no longer read from the cache
+	versions map[string]string
+	written  map[string]bool
+}
+
+// withConfigCache returns a stub using the cache. Documents are read
+// through when the channel is unknown, but writes still bump the versions.
+func (s *SmartContract) withConfigCache(stub shim.ChaincodeStubInterface) (shim.ChaincodeStubInterface, error) {
+	channel, err := getChannelID(stub)
+	if err != nil {
+		return nil, err
+	}
+	cached := &cachedStub{
+		ChaincodeStubInterface: stub,
+		channel:                channel,
+		prefixes:               map[string]string{},
+		versions:               map[string]string{},
+		written:                map[string]bool{},
+	}
+	if channel != "" {
+		cached.cache = &s.configCache
+	}
+	for _, objectType := range cachedObjectTypes {
+		prefix, err := stub.CreateCompositeKey(objectType, []string{})
+		if err != nil {
+			return nil, err
+		}
+		cached.prefixes[objectType] = prefix
+	}
+	return cached, nil
+}
+
+// objectType returns the object type of a cached document
+func (s *cachedStub) objectType(key string) (string, bool) {
+	for objectType, prefix := range s.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return objectType, true
+		}
+	}
+	return "", false
+}
+
+// version returns the version of an object type, reading it once per
+// invocation
+func (s *cachedStub) version(objectType string) (string, error) {
+	if version, ok := s.versions[objectType]; ok {
+		return version, nil
+	}
+	key, err := getConfigVersionKey(s, objectType)
+	if err != nil {
+		return "", err
+	}
+	versionBytes, err := s.ChaincodeStubInterface.GetState(key)
+	if err != nil {
+		return "", err
+	}
+	s.versions[objectType] = string(versionBytes)
+	return string(versionBytes), nil
+}
+
+// GetState reads cached documents from the cache
+func (s *cachedStub) GetState(key string) ([]byte, error) {
+	objectType, ok := s.objectType(key)
+	if !ok || s.cache == nil || s.written[objectType] {
+		return s.ChaincodeStubInterface.GetState(key)
+	}
+	version, err := s.version(objectType)
+	if err != nil {
+		return nil, err
+	}
+	if version == "" {
+		return s.ChaincodeStubInterface.GetState(key)
+	}
+	if value, ok := s.cache.get(s.channel, objectType, version, key); ok {
+		return value, nil
+	}
+	value, err := s.ChaincodeStubInterface.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(s.channel, objectType, version, key, value)
+	return value, nil
+}
+
+// PutState bumps the version when a cached document is written
+func (s *cachedStub) PutState(key string, value []byte) error {
+	if err := s.ChaincodeStubInterface.PutState(key, value); err != nil {
+		return err
+	}
+	return s.bumpVersion(key)
+}
+
+// DelState bumps the version when a cached document is deleted
+func (s *cachedStub) DelState(key string) error {
+	if err := s.ChaincodeStubInterface.DelState(key); err != nil {
+		return err
+	}
+	return s.bumpVersion(key)
+}
+
+func (s *cachedStub) bumpVersion(key string) error {
+	objectType, ok := s.objectType(key)
+	if !ok {
+		return nil
+	}
+	s.written[objectType] = true
+	if s.cache != nil {
+		s.cache.drop(s.channel, objectType)
+	}
+	versionKey, err := getConfigVersionKey(s, objectType)
+	if err != nil {
+		return err
+	}
+	return s.ChaincodeStubInterface.PutState(versionKey, []byte(s.GetTxID()))
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_ConfigCache(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Invoke(t, "SetFeature", []byte(FeatureSignedOnly), []byte("true"))
+	stub.Invoke(t, "GetProcess", []byte("auction"))
+
+	// Documents written by another peer are only read once the config
+	// version changes
+	stub.MockTransactionStart("peer")
+	configKey, _ := getConfigKey(stub)
+	stub.PutState(configKey, []byte(`{"admins":["OtherMSP"]}`))
+	stub.MockTransactionEnd("peer")
+	stub.Invoke(t, "SetFeature", []byte(FeatureSignedOnly), []byte("false"))
+
+	stub.MockTransactionStart("peer")
+	versionKey, _ := getConfigVersionKey(stub, ObjectTypeConfig)
+	stub.PutState(versionKey, []byte("peer"))
+	stub.MockTransactionEnd("peer")
+	if message := stub.InvokeError(t, "SetFeature", []byte(FeatureSignedOnly), []byte("true")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+
+	// Writes through the chaincode bump the version
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"admins":["AdminMSP"]}`)})
+	if version, _ := stub.GetState(versionKey); string(version) != "init" {
+		fmt.Println("Config version is", string(version))
+		t.FailNow()
+	}
+	stub.Invoke(t, "CreateProcess", testProcess)
+	stub.InvokeError(t, "SaveSegment", mustMarshal(testutil.Root("auction").WithAction("bid").Build()))
+
+	// Processes have their own version, so creating one doesn't conflict
+	// with transactions reading the config
+	if version, _ := stub.GetState(versionKey); string(version) != "init" {
+		fmt.Println("Creating a process bumped the config version to", string(version))
+		t.FailNow()
+	}
+	processVersionKey, _ := getConfigVersionKey(stub, ObjectTypeProcess)
+	if version, _ := stub.GetState(processVersionKey); len(version) == 0 {
+		fmt.Println("Creating a process should bump the process version")
+		t.FailNow()
+	}
+}
+
+func TestPop_ConfigCacheChannels(t *testing.T) {
+	// One chaincode instance serves every channel
+	cc := new(SmartContract)
+	stubs := map[string]*testutil.Stub{}
+	for channel, admin := range map[string]string{"a": "AdminMSP", "b": "OtherMSP"} {
+		stub := testutil.NewStub("pop", cc)
+		stub.ChannelID = channel
+		stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"admins":["` + admin + `"]}`)})
+		stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+		stubs[channel] = stub
+	}
+
+	stubs["a"].Invoke(t, "SetFeature", []byte(FeatureSignedOnly), []byte("true"))
+	if message := stubs["b"].InvokeError(t, "SetFeature", []byte(FeatureSignedOnly), []byte("true")); message != ErrUnauthorized.Error() {
+		fmt.Println("Channel b used the config of channel a:", message)
+		t.FailNow()
+	}
+
+	// Both channels have the same versions before the first write after an
+	// upgrade: documents without version aren't cached
+	for _, stub := range stubs {
+		stub.MockTransactionStart("upgrade")
+		versionKey, _ := getConfigVersionKey(stub, ObjectTypeConfig)
+		stub.DelState(versionKey)
+		stub.MockTransactionEnd("upgrade")
+	}
+	stubs["a"].Invoke(t, "SetFeature", []byte(FeatureSignedOnly), []byte("true"))
+	stubs["b"].InvokeError(t, "SetFeature", []byte(FeatureSignedOnly), []byte("true"))
+
+	stub := stubs["b"]
+	stub.MockTransactionStart("peer")
+	configKey, _ := getConfigKey(stub)
+	stub.PutState(configKey, []byte(`{"admins":["AdminMSP"]}`))
+	stub.MockTransactionEnd("peer")
+	stub.Invoke(t, "SetFeature", []byte(FeatureSignedOnly), []byte("true"))
+}
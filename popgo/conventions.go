@@ -0,0 +1,105 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Conventions are the tag and map ID conventions of a process, checked by
+// SaveSegment. Zero values don't constrain segments.
+type Conventions struct {
+	// AllowedTags is the tag vocabulary of the process
+	AllowedTags []string `json:"allowedTags,omitempty"`
+
+	// MapIDPattern is a regular expression map IDs must match entirely
+	MapIDPattern string `json:"mapIdPattern,omitempty"`
+
+	// RequiredTags are the tags segments must have, by action
+	RequiredTags map[string][]string `json:"requiredTags,omitempty"`
+}
+
+func (c *Conventions) validate() error {
+	if _, err := c.mapIDRegexp(); err != nil {
+		return errors.New("Invalid map ID pattern: " + err.Error())
+	}
+	if len(c.AllowedTags) == 0 {
+		return nil
+	}
+	for action, tags := range c.RequiredTags {
+		for _, tag := range tags {
+			if !containsString(c.AllowedTags, tag) {
+				return errors.New("Tag " + tag + " required by action " + action + " is not allowed")
+			}
+		}
+	}
+	return nil
+}
+
+// mapIDRegexp compiles the map ID pattern anchored at both ends, nil if
+// there is no pattern
+func (c *Conventions) mapIDRegexp() (*regexp.Regexp, error) {
+	if c.MapIDPattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + c.MapIDPattern + ")$")
+}
+
+// check returns the first convention a segment breaks
+func (c *Conventions) check(segment *cs.Segment, process string) error {
+	tags := segment.Link.GetTags()
+	if len(c.AllowedTags) > 0 {
+		for _, tag := range tags {
+			if !containsString(c.AllowedTags, tag) {
+				return errors.New("Tag " + tag + " is not allowed by process " + process)
+			}
+		}
+	}
+
+	re, err := c.mapIDRegexp()
+	if err != nil {
+		return err
+	}
+	if mapID := segment.Link.GetMapID(); re != nil && !re.MatchString(mapID) {
+		return errors.New("Map ID " + mapID + " does not match the pattern of process " + process)
+	}
+
+	action, _ := segment.Link.Meta["action"].(string)
+	var missing []string
+	for _, tag := range c.RequiredTags[action] {
+		if !containsString(tags, tag) {
+			missing = append(missing, tag)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("Action " + action + " of process " + process + " requires tags " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// validateConventions checks a segment follows the conventions of its
+// process, when it has some
+func validateConventions(stub shim.ChaincodeStubInterface, segment *cs.Segment) error {
+	process, err := getProcess(stub, segment.Link.GetProcess())
+	if err != nil || process == nil || process.Conventions == nil {
+		return err
+	}
+	return process.Conventions.check(segment, process.Name)
+}
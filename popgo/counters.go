@@ -0,0 +1,186 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Map counters are stored under their own composite keys so that updating
+// them doesn't touch the MapDoc
+const (
+	MapCounterSegments = "segments"
+
+	// MapCounterLastActivity is the timestamp in milliseconds of the last
+	// segment saved in the map
+	MapCounterLastActivity = "lastActivity"
+)
+
+// Process counters are updated by every segment of a process, so they are
+// split into shards: a transaction only updates the shard selected by its
+// ID and readers sum all shards
+const (
+	ProcessCounterSegments = "segments"
+	ProcessCounterMaps     = "maps"
+
+	processCounterShards = 16
+)
+
+// The height counts the segment writes and deletions. It is a sharded
+// counter too, so it doesn't serialize transactions.
+
+// addHeight increments the height
+func addHeight(stub shim.ChaincodeStubInterface) error {
+	return addShardedCounter(stub, ObjectTypeHeight, []string{}, 1)
+}
+
+// getHeight returns the height
+func getHeight(stub shim.ChaincodeStubInterface) (int, error) {
+	return getShardedCounter(stub, ObjectTypeHeight, []string{})
+}
+
+// ProcessStats is returned by GetProcessStats
+type ProcessStats struct {
+	Process  string `json:"process"`
+	Segments int    `json:"segments"`
+	Maps     int    `json:"maps"`
+}
+
+func getMapCounterKey(stub shim.ChaincodeStubInterface, mapID, name string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeMapCounter, []string{mapID, name})
+}
+
+// getMapCounter returns the value of a map counter, zero if it was never set
+func getMapCounter(stub shim.ChaincodeStubInterface, mapID, name string) (int, error) {
+	key, err := getMapCounterKey(stub, mapID, name)
+	if err != nil {
+		return 0, err
+	}
+	return getCounter(stub, key)
+}
+
+// addMapCounter adds delta to a map counter
+func addMapCounter(stub shim.ChaincodeStubInterface, mapID, name string, delta int) error {
+	key, err := getMapCounterKey(stub, mapID, name)
+	if err != nil {
+		return err
+	}
+	value, err := getCounter(stub, key)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, []byte(strconv.Itoa(value+delta)))
+}
+
+// setLastActivity sets the last activity of a map to the transaction time
+func setLastActivity(stub shim.ChaincodeStubInterface, mapID string) error {
+	now, err := txTime(stub)
+	if err != nil {
+		return err
+	}
+	key, err := getMapCounterKey(stub, mapID, MapCounterLastActivity)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, []byte(strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)))
+}
+
+func getCounter(stub shim.ChaincodeStubInterface, key string) (int, error) {
+	valueBytes, err := stub.GetState(key)
+	if err != nil || valueBytes == nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(valueBytes))
+}
+
+// addProcessCounter adds delta to the shard of a process counter selected by
+// the transaction ID
+func addProcessCounter(stub shim.ChaincodeStubInterface, process, name string, delta int) error {
+	return addShardedCounter(stub, ObjectTypeProcessCounter, []string{process, name}, delta)
+}
+
+// addShardedCounter adds delta to the shard of a counter selected by the
+// transaction ID. The shard is the last attribute of the composite key.
+func addShardedCounter(stub shim.ChaincodeStubInterface, objectType string, attributes []string, delta int) error {
+	h := fnv.New32a()
+	h.Write([]byte(stub.GetTxID()))
+	shard := strconv.Itoa(int(h.Sum32() % processCounterShards))
+
+	key, err := stub.CreateCompositeKey(objectType, append(attributes, shard))
+	if err != nil {
+		return err
+	}
+	value, err := getCounter(stub, key)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, []byte(strconv.Itoa(value+delta)))
+}
+
+// getProcessCounter sums the shards of a process counter
+func getProcessCounter(stub shim.ChaincodeStubInterface, process, name string) (int, error) {
+	return getShardedCounter(stub, ObjectTypeProcessCounter, []string{process, name})
+}
+
+// getShardedCounter sums the shards of a counter
+func getShardedCounter(stub shim.ChaincodeStubInterface, objectType string, attributes []string) (int, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(objectType, attributes)
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	total := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		value, err := strconv.Atoi(string(queryResponse.Value))
+		if err != nil {
+			return 0, err
+		}
+		total += value
+	}
+	return total, nil
+}
+
+// GetProcessStats returns the number of segments and maps of a process
+func (s *SmartContract) GetProcessStats(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if err := checkProcessTenant(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	stats := ProcessStats{Process: args[0]}
+
+	var err error
+	if stats.Segments, err = getProcessCounter(stub, args[0], ProcessCounterSegments); err != nil {
+		return shim.Error(err.Error())
+	}
+	if stats.Maps, err = getProcessCounter(stub, args[0], ProcessCounterMaps); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	statsBytes, err := json.Marshal(stats)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(statsBytes)
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_SaveMapUnchanged(t *testing.T) {
+	cc := new(SmartContract)
+	stub := testutil.NewStub("pop", cc)
+	root := testutil.Root("main").Build()
+	stub.SaveSegment(t, root)
+
+	other := testutil.Root("main").WithMapID(root.Link.GetMapID()).WithState("other", true).Build()
+	stub.MockTransactionStart("2")
+	writes := newWriteSetStub(stub)
+	if err := cc.SaveMap(writes, other); err != nil {
+		t.FailNow()
+	}
+	stub.MockTransactionEnd("2")
+
+	if len(writes.writes) != 0 {
+		fmt.Println("Unchanged map document should not be written")
+		t.FailNow()
+	}
+}
+
+func TestPop_MapSegmentsCounter(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segments := testutil.Chain("main", 3)
+	stub.SaveSegment(t, segments...)
+	stub.SaveSegment(t, segments[2])
+
+	mapID := segments[0].Link.GetMapID()
+	if count, _ := getMapCounter(stub, mapID, MapCounterSegments); count != 3 {
+		fmt.Println("Expected 3 segments, got", count)
+		t.FailNow()
+	}
+
+	stub.Invoke(t, "DeleteSegment", []byte(segments[2].GetLinkHashString()))
+	stub.Invoke(t, "DeleteSegment", []byte(segments[2].GetLinkHashString()))
+	if count, _ := getMapCounter(stub, mapID, MapCounterSegments); count != 2 {
+		fmt.Println("Expected 2 segments, got", count)
+		t.FailNow()
+	}
+}
+
+func TestPop_GetProcessStats(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	first, second := testutil.Chain("main", 3), testutil.Chain("main", 2)
+	stub.SaveSegment(t, first...)
+	stub.SaveSegment(t, second...)
+	stub.SaveSegment(t, testutil.Chain("other", 1)...)
+	stub.Invoke(t, "DeleteSegment", []byte(first[2].GetLinkHashString()))
+
+	stats := &ProcessStats{}
+	if err := json.Unmarshal(stub.Invoke(t, "GetProcessStats", []byte("main")), stats); err != nil {
+		t.FailNow()
+	}
+	if stats.Segments != 4 || stats.Maps != 2 {
+		fmt.Println("Unexpected stats", stats)
+		t.FailNow()
+	}
+
+	shards, _ := stub.GetStateByPartialCompositeKey(ObjectTypeProcessCounter, []string{"main", ProcessCounterSegments})
+	n := 0
+	for shards.HasNext() {
+		shards.Next()
+		n++
+	}
+	if n < 2 {
+		fmt.Println("Counter updates should be spread over shards")
+		t.FailNow()
+	}
+}
+
+func TestPop_GetMaps(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 1000}
+	segments := testutil.Chain("main", 3)
+	stub.SaveSegment(t, segments[:2]...)
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 2000}
+	stub.SaveSegment(t, segments[2])
+	stub.SaveSegment(t, testutil.Chain("other", 1)...)
+
+	var summaries []MapSummary
+	json.Unmarshal(stub.Invoke(t, "GetMaps", []byte(`{"process":"main"}`)), &summaries)
+	expected := MapSummary{
+		ID:           segments[0].Link.GetMapID(),
+		Process:      "main",
+		SegmentCount: 3,
+		LastActivity: 2000000,
+		RootLinkHash: segments[0].GetLinkHashString(),
+	}
+	if len(summaries) != 1 || summaries[0] != expected {
+		fmt.Println("Got summaries", summaries)
+		t.FailNow()
+	}
+}
+
+func TestPop_GetActivitySeries(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	// 2017-01-01T23:00:00Z then 2017-01-03T01:00:00Z
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 1483311600}
+	segments := testutil.Chain("main", 3)
+	stub.SaveSegment(t, segments[:2]...)
+	stub.SaveSegment(t, segments[1])
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 1483405200}
+	stub.SaveSegment(t, segments[2], testutil.Root("other").Build())
+
+	var series []ActivityBucket
+	json.Unmarshal(stub.Invoke(t, "GetActivitySeries", []byte("main"), []byte("2016-12-31"), []byte("2017-01-03")), &series)
+	expected := []ActivityBucket{{"2016-12-31", 0}, {"2017-01-01", 2}, {"2017-01-02", 0}, {"2017-01-03", 1}}
+	if fmt.Sprint(series) != fmt.Sprint(expected) {
+		fmt.Println("Got series", series, "expected", expected)
+		t.FailNow()
+	}
+
+	stub.InvokeError(t, "GetActivitySeries", []byte("main"), []byte("2017-01-03"), []byte("2017-01-01"))
+	stub.InvokeError(t, "GetActivitySeries", []byte("main"), []byte("2017-01-01"), []byte("2018-01-02"))
+	stub.InvokeError(t, "GetActivitySeries", []byte("main"), []byte("yesterday"), []byte("2017-01-01"))
+	stub.Invoke(t, "GetActivitySeries", []byte("main"), []byte("2017-01-01"), []byte("2018-01-01"))
+}
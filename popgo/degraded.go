@@ -0,0 +1,118 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/piedup/chaincode/popgo/selector"
+)
+
+// CouchDB refuses sorted queries when no index covers the sort, and
+// Fabric 1.0 doesn't deploy the packaged indexes. Instead of returning the
+// CouchDB error, such queries are run again on a range scan of the state
+// filtered by the chaincode. The scan stops when the page is full and its
+// results are in key order, responses have the degraded flag set.
+
+// isMissingIndex tells whether a query error comes from a missing index
+func isMissingIndex(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "no_usable_index") || strings.Contains(message, "No index exists")
+}
+
+// getQueryResult runs a rich query, falling back to a filtered scan when
+// CouchDB has no index for it. It tells whether the scan was used.
+func getQueryResult(stub shim.ChaincodeStubInterface, queryString string) (shim.StateQueryIteratorInterface, bool, error) {
+	resultsIterator, err := stub.GetQueryResult(queryString)
+	if err == nil || !isMissingIndex(err) {
+		return resultsIterator, false, err
+	}
+	resultsIterator, err = scanQueryResult(stub, queryString)
+	return resultsIterator, true, err
+}
+
+// scanQueryResult evaluates the selector of a query on every document of
+// the state until limit documents matched
+func scanQueryResult(stub shim.ChaincodeStubInterface, queryString string) (shim.StateQueryIteratorInterface, error) {
+	query := struct {
+		Selector map[string]interface{} `json:"selector"`
+		Limit    int                    `json:"limit"`
+		Skip     int                    `json:"skip"`
+	}{}
+	if err := json.Unmarshal([]byte(queryString), &query); err != nil {
+		return nil, err
+	}
+	if query.Selector == nil || query.Limit <= 0 {
+		return nil, errors.New("Queries without index should have a selector and a limit")
+	}
+
+	resultsIterator, err := stub.GetStateByRange("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results := &scanIterator{}
+	skipped := 0
+	for resultsIterator.HasNext() && len(results.kvs) < query.Limit {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		doc := map[string]interface{}{}
+		if json.Unmarshal(kv.Value, &doc) != nil {
+			continue
+		}
+		ok, err := selector.Match(doc, query.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if skipped < query.Skip {
+			skipped++
+			continue
+		}
+		results.kvs = append(results.kvs, kv)
+	}
+	return results, nil
+}
+
+// scanIterator iterates over the results of a scan
+type scanIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (it *scanIterator) HasNext() bool {
+	return len(it.kvs) > 0
+}
+
+func (it *scanIterator) Next() (*queryresult.KV, error) {
+	if len(it.kvs) == 0 {
+		return nil, errors.New("No more results")
+	}
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+func (it *scanIterator) Close() error {
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ObjectTypePendingDeletion is used in CouchDB documents of proposed
+// deletions
+const ObjectTypePendingDeletion = "pendingdeletion"
+
+// DeleteApproval configures dual approval of deletions: an approver
+// proposes to delete a segment with DeleteSegment, and an approver of
+// another organization must call ApproveDeletion within the window.
+type DeleteApproval struct {
+	// Approvers are the MSP IDs allowed to propose and approve deletions
+	Approvers   []string `json:"approvers"`
+	WindowHours int      `json:"windowHours"`
+}
+
+// PendingDeletionDoc is used to store proposed deletions in CouchDB. Times
+// are in milliseconds.
+type PendingDeletionDoc struct {
+	ObjectType string     `json:"docType"`
+	LinkHash   string     `json:"linkHash"`
+	Reason     string     `json:"reason"`
+	ProposedBy *Submitter `json:"proposedBy"`
+	ProposedAt int64      `json:"proposedAt"`
+	ExpiresAt  int64      `json:"expiresAt"`
+}
+
+func getPendingDeletionKey(stub shim.ChaincodeStubInterface, linkHash string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypePendingDeletion, []string{linkHash})
+}
+
+// getPendingDeletion returns the proposed deletion of a segment, nil if
+// there is none
+func getPendingDeletion(stub shim.ChaincodeStubInterface, linkHash string) (*PendingDeletionDoc, error) {
+	key, err := getPendingDeletionKey(stub, linkHash)
+	if err != nil {
+		return nil, err
+	}
+	pendingBytes, err := stub.GetState(key)
+	if err != nil || pendingBytes == nil {
+		return nil, err
+	}
+	pending := &PendingDeletionDoc{}
+	if err := json.Unmarshal(pendingBytes, pending); err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// proposeDeletion records the proposal to delete a segment. An expired
+// proposal can be replaced.
+func proposeDeletion(stub shim.ChaincodeStubInterface, approval *DeleteApproval, args []string) sc.Response {
+	if len(args) < 2 || args[0] == "" || args[1] == "" {
+		return shim.Error("Link hash and reason are required")
+	}
+	if err := requireCreatorIn(stub, approval.Approvers); err != nil {
+		return shim.Error(err.Error())
+	}
+	exists, err := segmentExists(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !exists {
+		return shim.Error("Segment not found")
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	nowMillis := now.UnixNano() / int64(time.Millisecond)
+	pending, err := getPendingDeletion(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if pending != nil && pending.ExpiresAt >= nowMillis {
+		return shim.Error("Deletion of segment " + args[0] + " is already proposed")
+	}
+
+	pending = &PendingDeletionDoc{
+		ObjectType: ObjectTypePendingDeletion,
+		LinkHash:   args[0],
+		Reason:     args[1],
+		ProposedAt: nowMillis,
+		ExpiresAt:  nowMillis + int64(approval.WindowHours)*int64(time.Hour/time.Millisecond),
+	}
+	if pending.ProposedBy, err = getSubmitter(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := getPendingDeletionKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	pendingBytes, err := json.Marshal(pending)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, pendingBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(pendingBytes)
+}
+
+// ApproveDeletion deletes a segment whose deletion was proposed by another
+// organization within the approval window
+func (s *SmartContract) ApproveDeletion(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Link hash is required")
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if config.DeleteApproval == nil {
+		return shim.Error("Deletions don't need approval")
+	}
+	if err := requireCreatorIn(stub, config.DeleteApproval.Approvers); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	pending, err := getPendingDeletion(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if pending == nil {
+		return shim.Error("Deletion of segment " + args[0] + " was not proposed")
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now.UnixNano()/int64(time.Millisecond) > pending.ExpiresAt {
+		return shim.Error("Deletion proposal of segment " + args[0] + " expired")
+	}
+	mspID, err := getCreatorMSPID(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if pending.ProposedBy == nil || pending.ProposedBy.MSPID == mspID {
+		return shim.Error("Deletions must be approved by another organization")
+	}
+
+	key, err := getPendingDeletionKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.DelState(key); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkLinkHashNotHeld(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	return s.deleteSegment(stub, args[:1])
+}
+
+// GetPendingDeletion returns the proposed deletion of a segment
+func (s *SmartContract) GetPendingDeletion(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 {
+		return shim.Error("Link hash is required")
+	}
+	key, err := getPendingDeletionKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	pendingBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(pendingBytes, nil)
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_DeleteSegmentApproval(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	config := []byte(`{"deleteApproval":{"approvers":["BankMSP","RegulatorMSP"],"windowHours":24}}`)
+	if res := stub.MockInit("init", [][]byte{[]byte("init"), config}); res.Status != shim.OK {
+		fmt.Println("Init failed", res.Message)
+		t.FailNow()
+	}
+	segments := testutil.Chain("main", 2)
+	stub.SaveSegment(t, segments...)
+	linkHash := []byte(segments[0].GetLinkHashString())
+	reason := []byte("GDPR erasure request")
+
+	hour := int64(3600)
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 1000 * hour}
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	stub.InvokeError(t, "DeleteSegment", linkHash, reason)
+	stub.Creator = testutil.NewIdentity("BankMSP", "bank")
+	stub.InvokeError(t, "DeleteSegment", linkHash)
+	stub.Invoke(t, "DeleteSegment", linkHash, reason)
+	stub.InvokeError(t, "DeleteSegment", linkHash, reason)
+
+	pending := &PendingDeletionDoc{}
+	json.Unmarshal(stub.Invoke(t, "GetPendingDeletion", linkHash), pending)
+	if pending.Reason != string(reason) || pending.ProposedBy.MSPID != "BankMSP" {
+		fmt.Println("Got pending deletion", pending)
+		t.FailNow()
+	}
+	if stub.Invoke(t, "GetSegment", linkHash) == nil {
+		fmt.Println("Proposing a deletion should not delete the segment")
+		t.FailNow()
+	}
+
+	stub.InvokeError(t, "ApproveDeletion", linkHash)
+	stub.Creator = testutil.NewIdentity("RegulatorMSP", "regulator")
+	stub.Invoke(t, "ApproveDeletion", linkHash)
+	if stub.Invoke(t, "GetSegment", linkHash) != nil {
+		fmt.Println("Approved deletions should delete the segment")
+		t.FailNow()
+	}
+
+	// Proposals expire
+	linkHash = []byte(segments[1].GetLinkHashString())
+	stub.Invoke(t, "DeleteSegment", linkHash, reason)
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 1025 * hour}
+	stub.Creator = testutil.NewIdentity("BankMSP", "bank")
+	stub.InvokeError(t, "ApproveDeletion", linkHash)
+	stub.Invoke(t, "DeleteSegment", linkHash, reason)
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Endorsing peers must compute identical write sets for a transaction to be
+// valid. Written state may therefore only depend on the transaction
+// arguments, the ledger state and the transaction header: never call
+// time.Now or math/rand in chaincode functions, use txTime instead.
+// Maps must not be iterated to produce written values or event payloads
+// unless the keys are sorted first (encoding/json already sorts them).
+//
+// Building with the strictdeterminism tag executes every invocation twice
+// and rejects the transaction if both executions disagree.
+
+// txTime returns the transaction timestamp chosen by the client.
+// It is the only source of time allowed in the chaincode.
+func txTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ptypes.Timestamp(ts)
+}
+
+// stateWrite is an entry of a write set
+type stateWrite struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+// writeSetStub records writes instead of applying them
+type writeSetStub struct {
+	shim.ChaincodeStubInterface
+	writes       []stateWrite
+	eventName    string
+	eventPayload []byte
+}
+
+func newWriteSetStub(stub shim.ChaincodeStubInterface) *writeSetStub {
+	return &writeSetStub{ChaincodeStubInterface: stub}
+}
+
+// PutState records a write
+func (s *writeSetStub) PutState(key string, value []byte) error {
+	s.writes = append(s.writes, stateWrite{key: key, value: value})
+	return nil
+}
+
+// DelState records a deletion
+func (s *writeSetStub) DelState(key string) error {
+	s.writes = append(s.writes, stateWrite{key: key, delete: true})
+	return nil
+}
+
+// SetEvent records the transaction event
+func (s *writeSetStub) SetEvent(name string, payload []byte) error {
+	s.eventName = name
+	s.eventPayload = payload
+	return nil
+}
+
+// equal checks two write sets contain the same writes in the same order
+func (s *writeSetStub) equal(other *writeSetStub) bool {
+	if len(s.writes) != len(other.writes) {
+		return false
+	}
+	for i, w := range s.writes {
+		o := other.writes[i]
+		if w.key != o.key || w.delete != o.delete || !bytes.Equal(w.value, o.value) {
+			return false
+		}
+	}
+	return s.eventName == other.eventName && bytes.Equal(s.eventPayload, other.eventPayload)
+}
+
+// apply performs the recorded writes on the underlying stub
+func (s *writeSetStub) apply() error {
+	for _, w := range s.writes {
+		var err error
+		if w.delete {
+			err = s.ChaincodeStubInterface.DelState(w.key)
+		} else {
+			err = s.ChaincodeStubInterface.PutState(w.key, w.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if s.eventName != "" {
+		return s.ChaincodeStubInterface.SetEvent(s.eventName, s.eventPayload)
+	}
+	return nil
+}
+
+// invokeTwice dispatches the invocation twice and only applies the writes
+// if both executions produced the same response and write set
+func (s *SmartContract) invokeTwice(stub shim.ChaincodeStubInterface) sc.Response {
+	first, second := newWriteSetStub(stub), newWriteSetStub(stub)
+	res1, res2 := s.dispatch(first), s.dispatch(second)
+
+	if res1.Status != res2.Status || res1.Message != res2.Message || !bytes.Equal(res1.Payload, res2.Payload) || !first.equal(second) {
+		return shim.Error("Non-deterministic execution")
+	}
+	if res1.Status != shim.OK {
+		return res1
+	}
+	if err := first.apply(); err != nil {
+		return shim.Error(err.Error())
+	}
+	return res1
+}
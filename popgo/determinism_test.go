@@ -0,0 +1,123 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func newDeterministicStub() *testutil.Stub {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 1504019167}
+	return stub
+}
+
+func TestPop_SaveSegmentDeterministic(t *testing.T) {
+	stub1, stub2 := newDeterministicStub(), newDeterministicStub()
+
+	for i, segment := range testutil.Chain("main", 3) {
+		segmentBytes, _ := json.Marshal(segment)
+		txID := fmt.Sprintf("tx%d", i)
+		args := [][]byte{[]byte("SaveSegment"), segmentBytes}
+
+		res1, res2 := stub1.MockInvoke(txID, args), stub2.MockInvoke(txID, args)
+		if res1.Status != shim.OK || res2.Status != shim.OK {
+			fmt.Println("SaveSegment failed", res1.Message, res2.Message)
+			t.FailNow()
+		}
+		if !reflect.DeepEqual(stub1.State, stub2.State) {
+			fmt.Println("Write sets differ after segment", i)
+			t.FailNow()
+		}
+		if stub1.EventName != stub2.EventName || !bytes.Equal(stub1.EventPayload, stub2.EventPayload) {
+			fmt.Println("Events differ after segment", i)
+			t.FailNow()
+		}
+	}
+}
+
+func TestPop_invokeTwice(t *testing.T) {
+	cc := new(SmartContract)
+	segment := testutil.Root("main").Build()
+	segmentBytes, _ := json.Marshal(segment)
+	args := [][]byte{[]byte("SaveSegment"), segmentBytes}
+
+	expected := newDeterministicStub()
+	res1 := expected.MockInvoke("1", args)
+
+	stub := newDeterministicStub()
+	stub.MockTransactionStart("1")
+	res2 := cc.invokeTwice(&argsStub{stub, args})
+	stub.MockTransactionEnd("1")
+
+	if res1.Status != shim.OK || res2.Status != shim.OK {
+		fmt.Println("SaveSegment failed", res1.Message, res2.Message)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(expected.State, stub.State) {
+		fmt.Println("invokeTwice did not apply the write set")
+		t.FailNow()
+	}
+	if stub.EventName != "saveSegment" {
+		fmt.Println("invokeTwice did not set the event")
+		t.FailNow()
+	}
+}
+
+func TestPop_writeSetStubEqual(t *testing.T) {
+	stub := shim.NewMockStub("pop", new(SmartContract))
+	a, b := newWriteSetStub(stub), newWriteSetStub(stub)
+	a.PutState("k", []byte("v"))
+	b.PutState("k", []byte("v"))
+	if !a.equal(b) {
+		fmt.Println("Identical write sets should be equal")
+		t.FailNow()
+	}
+	b.DelState("k")
+	if a.equal(b) {
+		fmt.Println("Different write sets should not be equal")
+		t.FailNow()
+	}
+	if len(stub.State) != 0 {
+		fmt.Println("Writes should not reach the underlying stub")
+		t.FailNow()
+	}
+}
+
+// argsStub overrides the arguments of a stub outside of MockInvoke
+type argsStub struct {
+	*testutil.Stub
+	args [][]byte
+}
+
+func (s *argsStub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *argsStub) GetFunctionAndParameters() (string, []string) {
+	var params []string
+	for _, a := range s.args[1:] {
+		params = append(params, string(a))
+	}
+	return string(s.args[0]), params
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// malformedArgs are argument lists no function accepts as they are: too
+// few arguments, empty values, undecodable JSON, oversized values and too
+// many arguments
+var malformedArgs = map[string][][]byte{
+	"none":      nil,
+	"empty":     {[]byte("")},
+	"emptyTwo":  {[]byte(""), []byte("")},
+	"badJSON":   {[]byte("{"), []byte("{"), []byte("{")},
+	"nullJSON":  {[]byte("null"), []byte("null"), []byte("null")},
+	"arrayJSON": {[]byte("[]"), []byte("[]"), []byte("[]")},
+	"oversized": {bytes.Repeat([]byte("a"), MaxArgsBytes+1)},
+	"tooMany":   {[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e"), []byte("f"), []byte("g"), []byte("h")},
+}
+
+// isInternalError tells whether a response is a recovered panic
+func isInternalError(res sc.Response) bool {
+	internalErr := &InternalError{}
+	return res.Status != shim.OK && json.Unmarshal([]byte(res.Message), internalErr) == nil && internalErr.CorrelationID != ""
+}
+
+func TestPop_DispatchMalformedArgs(t *testing.T) {
+	var functions []string
+	for function := range handlers {
+		functions = append(functions, function)
+	}
+	sort.Strings(functions)
+
+	var cases []string
+	for name := range malformedArgs {
+		cases = append(cases, name)
+	}
+	sort.Strings(cases)
+
+	failed := false
+	for _, function := range functions {
+		for _, name := range cases {
+			stub := newAdminStub(t)
+			res := stub.Call(function, malformedArgs[name]...)
+			if isInternalError(res) {
+				fmt.Println(function, "panicked with", name, "arguments:", res.Message)
+				failed = true
+			} else if res.Status != shim.OK && res.Message == "" {
+				fmt.Println(function, "failed without message with", name, "arguments")
+				failed = true
+			}
+		}
+	}
+	if failed {
+		t.FailNow()
+	}
+
+	stub := newAdminStub(t)
+	if message := stub.InvokeError(t, "GetSegment"); message != "Function GetSegment requires 1 arguments, got 0" {
+		fmt.Println("GetSegment failed with", message)
+		t.FailNow()
+	}
+	stub.InvokeError(t, "SaveValue", []byte("key"))
+}
+
+func TestPop_RequiredArgs(t *testing.T) {
+	for function := range requiredArgs {
+		if _, ok := handlers[function]; !ok {
+			fmt.Println("Arguments are declared for unknown function", function)
+			t.FailNow()
+		}
+	}
+
+	// Calls with fewer arguments than required fail before the function
+	// runs
+	for function, required := range requiredArgs {
+		if required == 0 {
+			continue
+		}
+		args := make([][]byte, required-1)
+		for i := range args {
+			args[i] = []byte("a")
+		}
+		stub := newAdminStub(t)
+		expected := "Function " + function + " requires " + strconv.Itoa(required) + " arguments, got " + strconv.Itoa(required-1)
+		if res := stub.Call(function, args...); res.Status == shim.OK || res.Message != expected {
+			fmt.Println(function, "failed with", res.Message)
+			t.FailNow()
+		}
+	}
+}
+
+func TestPop_MaxArgsBytes(t *testing.T) {
+	stub := newAdminStub(t)
+	half := bytes.Repeat([]byte("a"), MaxArgsBytes/2)
+	expected := "Arguments of SaveValue exceed " + strconv.Itoa(MaxArgsBytes) + " bytes"
+	if message := stub.InvokeError(t, "SaveValue", half, append(half, 'a')); message != expected {
+		fmt.Println("SaveValue failed with", message)
+		t.FailNow()
+	}
+	stub.Invoke(t, "SaveValue", []byte("key"), half)
+
+	// Arguments of aliases count as well
+	if message := stub.InvokeError(t, "LoadLink", bytes.Repeat([]byte("a"), MaxArgsBytes+1)); message != "Arguments of GetLink exceed "+strconv.Itoa(MaxArgsBytes)+" bytes" {
+		fmt.Println("LoadLink failed with", message)
+		t.FailNow()
+	}
+}
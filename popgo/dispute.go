@@ -0,0 +1,278 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Disputes let parties contest a segment without altering it. Who can open
+// and resolve disputes is set with the OpenDispute and ResolveDispute
+// permissions of the configuration. Without a ResolveDispute permission,
+// only admins resolve disputes.
+const (
+	// ObjectTypeDispute is used in CouchDB documents of disputes
+	ObjectTypeDispute = "dispute"
+
+	// ObjectTypeOpenDispute keys the open dispute of a segment
+	ObjectTypeOpenDispute = "opendispute"
+)
+
+// Statuses of disputes
+const (
+	DisputeOpen     = "open"
+	DisputeResolved = "resolved"
+)
+
+// DisputeDoc is used to store disputes in CouchDB. The ID of a dispute is
+// the ID of the transaction that opened it.
+type DisputeDoc struct {
+	ObjectType string     `json:"docType"`
+	ID         string     `json:"id"`
+	LinkHash   string     `json:"linkHash"`
+	MapID      string     `json:"mapId"`
+	Process    string     `json:"process"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	OpenedBy   *Submitter `json:"openedBy"`
+	OpenedAt   int64      `json:"openedAt"`
+	Outcome    string     `json:"outcome,omitempty"`
+	ResolvedBy *Submitter `json:"resolvedBy,omitempty"`
+	ResolvedAt int64      `json:"resolvedAt,omitempty"`
+}
+
+func getDisputeKey(stub shim.ChaincodeStubInterface, id string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeDispute, []string{id})
+}
+
+func getOpenDisputeKey(stub shim.ChaincodeStubInterface, linkHash string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeOpenDispute, []string{linkHash})
+}
+
+func getDispute(stub shim.ChaincodeStubInterface, id string) (*DisputeDoc, error) {
+	key, err := getDisputeKey(stub, id)
+	if err != nil {
+		return nil, err
+	}
+	disputeBytes, err := stub.GetState(key)
+	if err != nil || disputeBytes == nil {
+		return nil, err
+	}
+	dispute := &DisputeDoc{}
+	if err := json.Unmarshal(disputeBytes, dispute); err != nil {
+		return nil, err
+	}
+	return dispute, nil
+}
+
+// putDispute stores a dispute, sets the event of the transaction and
+// returns the document
+func putDispute(stub shim.ChaincodeStubInterface, event string, dispute *DisputeDoc) ([]byte, error) {
+	key, err := getDisputeKey(stub, dispute.ID)
+	if err != nil {
+		return nil, err
+	}
+	disputeBytes, err := json.Marshal(dispute)
+	if err != nil {
+		return nil, err
+	}
+	if err := stub.PutState(key, disputeBytes); err != nil {
+		return nil, err
+	}
+	if err := stub.SetEvent(event, disputeBytes); err != nil {
+		return nil, err
+	}
+	return disputeBytes, nil
+}
+
+// OpenDispute contests a segment. A segment has at most one open dispute.
+// Arguments are the link hash and the reason.
+func (s *SmartContract) OpenDispute(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 || args[0] == "" || args[1] == "" {
+		return shim.Error("Link hash and reason are required")
+	}
+	segmentDocBytes, _, err := getSegmentDocBytes(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if segmentDocBytes == nil {
+		return shim.Error("Segment not found")
+	}
+	segmentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	openKey, err := getOpenDisputeKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	open, err := stub.GetState(openKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if open != nil {
+		return shim.Error("Segment already has an open dispute " + string(open))
+	}
+
+	submitter, err := getSubmitter(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	dispute := &DisputeDoc{
+		ObjectType: ObjectTypeDispute,
+		ID:         stub.GetTxID(),
+		LinkHash:   args[0],
+		MapID:      segmentDoc.Segment.Link.GetMapID(),
+		Process:    segmentDoc.Segment.Link.GetProcess(),
+		Reason:     args[1],
+		Status:     DisputeOpen,
+		OpenedBy:   submitter,
+		OpenedAt:   now.UnixNano() / int64(time.Millisecond),
+	}
+	if err := stub.PutState(openKey, []byte(dispute.ID)); err != nil {
+		return shim.Error(err.Error())
+	}
+	disputeBytes, err := putDispute(stub, "openDispute", dispute)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(disputeBytes)
+}
+
+// ResolveDispute closes an open dispute with an outcome. Arguments are the
+// ID of the dispute and the outcome.
+func (s *SmartContract) ResolveDispute(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 || args[0] == "" || args[1] == "" {
+		return shim.Error("Dispute ID and outcome are required")
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if config.Permissions["ResolveDispute"] == nil {
+		if err := requireCreatorIn(stub, config.Admins); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	dispute, err := getDispute(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if dispute == nil {
+		return shim.Error("Dispute not found")
+	}
+	if dispute.Status != DisputeOpen {
+		return shim.Error("Dispute is already resolved")
+	}
+
+	submitter, err := getSubmitter(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	dispute.Status = DisputeResolved
+	dispute.Outcome = args[1]
+	dispute.ResolvedBy = submitter
+	dispute.ResolvedAt = now.UnixNano() / int64(time.Millisecond)
+
+	openKey, err := getOpenDisputeKey(stub, dispute.LinkHash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.DelState(openKey); err != nil {
+		return shim.Error(err.Error())
+	}
+	disputeBytes, err := putDispute(stub, "resolveDispute", dispute)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(disputeBytes)
+}
+
+// GetDispute returns a dispute
+func (s *SmartContract) GetDispute(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 {
+		return shim.Error("Dispute ID is required")
+	}
+	key, err := getDisputeKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	disputeBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if disputeBytes != nil {
+		dispute := &DisputeDoc{}
+		if err := json.Unmarshal(disputeBytes, dispute); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := checkSegmentTenant(stub, dispute.LinkHash); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return successWithMeta(disputeBytes, nil)
+}
+
+// getDisputedLinkHashes returns the sorted link hashes of the segments that
+// have an open dispute
+func getDisputedLinkHashes(stub shim.ChaincodeStubInterface, config *Config) ([]string, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": ObjectTypeDispute,
+			"status":  DisputeOpen,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkQueryPlan(config, disputeIndexes, string(queryBytes)); err != nil {
+		return nil, err
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var linkHashes []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		dispute := &DisputeDoc{}
+		if err := json.Unmarshal(queryResponse.Value, dispute); err != nil {
+			return nil, err
+		}
+		linkHashes = append(linkHashes, dispute.LinkHash)
+	}
+	sort.Strings(linkHashes)
+	return linkHashes, nil
+}
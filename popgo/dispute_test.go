@@ -0,0 +1,99 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_Disputes(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Creator = testutil.NewIdentity("BuyerMSP", "buyer")
+	segments := testutil.Chain("main", 3)
+	stub.SaveSegment(t, segments...)
+	linkHash := []byte(segments[1].GetLinkHashString())
+
+	dispute := &DisputeDoc{}
+	json.Unmarshal(stub.Invoke(t, "OpenDispute", linkHash, []byte("wrong quantity")), dispute)
+	if dispute.Status != DisputeOpen || dispute.OpenedBy.MSPID != "BuyerMSP" || stub.EventName != "openDispute" {
+		fmt.Println("Got dispute", dispute, "and event", stub.EventName)
+		t.FailNow()
+	}
+	stub.InvokeError(t, "OpenDispute", linkHash, []byte("again"))
+	stub.InvokeError(t, "OpenDispute", []byte("missing"), []byte("reason"))
+
+	for _, test := range []struct {
+		filter   string
+		expected int
+	}{
+		{`{"disputed":true}`, 1},
+		{`{"disputed":false}`, 2},
+	} {
+		var found cs.SegmentSlice
+		json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(test.filter)), &found)
+		if len(found) != test.expected {
+			fmt.Println("Filter", test.filter, "returned", len(found), "segments, expected", test.expected)
+			t.FailNow()
+		}
+	}
+
+	id := []byte(dispute.ID)
+	if message := stub.InvokeError(t, "ResolveDispute", id, []byte("refund")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+	stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+	stub.Invoke(t, "ResolveDispute", id, []byte("refund"))
+	if stub.EventName != "resolveDispute" {
+		fmt.Println("Got event", stub.EventName)
+		t.FailNow()
+	}
+	stub.InvokeError(t, "ResolveDispute", id, []byte("refund"))
+
+	dispute = &DisputeDoc{}
+	json.Unmarshal(stub.Invoke(t, "GetDispute", id), dispute)
+	if dispute.Status != DisputeResolved || dispute.Outcome != "refund" || dispute.ResolvedBy.MSPID != "AdminMSP" {
+		fmt.Println("Got dispute", dispute)
+		t.FailNow()
+	}
+	if payload := stub.Invoke(t, "FindSegments", []byte(`{"disputed":true}`)); string(payload) != "null" {
+		fmt.Println("Resolved disputes should not match, got", string(payload))
+		t.FailNow()
+	}
+	stub.Invoke(t, "OpenDispute", linkHash, []byte("still wrong"))
+}
+
+func TestPop_ResolveDisputePermission(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{
+		"admins": ["AdminMSP"],
+		"permissions": {"ResolveDispute": {"msps": ["ArbiterMSP"]}}
+	}`)})
+	stub.Creator = testutil.NewIdentity("BuyerMSP", "buyer")
+	segment := testutil.Root("main").Build()
+	stub.SaveSegment(t, segment)
+
+	dispute := &DisputeDoc{}
+	json.Unmarshal(stub.Invoke(t, "OpenDispute", []byte(segment.GetLinkHashString()), []byte("late")), dispute)
+	stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+	stub.InvokeError(t, "ResolveDispute", []byte(dispute.ID), []byte("dismissed"))
+	stub.Creator = testutil.NewIdentity("ArbiterMSP", "arbiter")
+	stub.Invoke(t, "ResolveDispute", []byte(dispute.ID), []byte("dismissed"))
+}
@@ -0,0 +1,347 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Applications can store their own documents next to segments. An admin
+// registers a document type with RegisterDocType, then documents of the
+// type are managed with SaveDoc, GetDoc and FindDocs.
+const (
+	// ObjectTypeDocType is used in CouchDB documents of document types
+	ObjectTypeDocType = "doctype"
+
+	// Types of the properties of document schemas
+	SchemaTypeString  = "string"
+	SchemaTypeNumber  = "number"
+	SchemaTypeBoolean = "boolean"
+	SchemaTypeObject  = "object"
+	SchemaTypeArray   = "array"
+)
+
+var docTypeNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]*$`)
+
+// reservedObjectTypes can't be used as names or key prefixes of document
+// types
+var reservedObjectTypes = []string{
+	ObjectTypeSegment, ObjectTypeMap, ObjectTypeValue, ObjectTypeMapCounter,
+	ObjectTypeProcessCounter, ObjectTypeHeight, ObjectTypeConfig,
+	ObjectTypeActor, ObjectTypeProcess, ObjectTypeRotation,
+	ObjectTypeAttachment, ObjectTypeColdSegment, ObjectTypeFeatures,
+	ObjectTypeTagCounter, ObjectTypeEvidence, ObjectTypeWebhook,
+	ObjectTypePendingDeletion, ObjectTypeDocType, ObjectTypeSegmentState,
+	ObjectTypeMetaAudit, ObjectTypeAnnotation, ObjectTypeDispute,
+	ObjectTypeOpenDispute, ObjectTypeAcknowledgment, ObjectTypeActivity,
+	ObjectTypeReadOnly, ObjectTypeJob, ObjectTypePin, ObjectTypeHold,
+	ObjectTypeQuota, ObjectTypeQuotaUsage, ObjectTypeMerge,
+	ObjectTypeMapAlias, ObjectTypeExternalID, ObjectTypeLabel,
+	ObjectTypeConfigVersion,
+}
+
+// DocSchema lists the required properties of documents and the types of
+// their properties. Properties that aren't listed can have any type.
+type DocSchema struct {
+	Required   []string          `json:"required,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// DocTypeDoc is used to store document types in CouchDB. Documents are
+// stored under composite keys starting with KeyPrefix, which defaults to
+// the name.
+type DocTypeDoc struct {
+	ObjectType string    `json:"docType"`
+	Name       string    `json:"name"`
+	KeyPrefix  string    `json:"keyPrefix"`
+	Schema     DocSchema `json:"schema"`
+}
+
+// AppDoc is used to store application documents in CouchDB. Selectors of
+// FindDocs match the whole document, so properties are under data.
+type AppDoc struct {
+	ObjectType string          `json:"docType"`
+	ID         string          `json:"id"`
+	Data       json.RawMessage `json:"data"`
+}
+
+func (d *DocTypeDoc) validate() error {
+	if !docTypeNamePattern.MatchString(d.Name) {
+		return errors.New("Invalid document type name " + d.Name)
+	}
+	if d.KeyPrefix == "" {
+		d.KeyPrefix = d.Name
+	}
+	if !docTypeNamePattern.MatchString(d.KeyPrefix) {
+		return errors.New("Invalid key prefix " + d.KeyPrefix)
+	}
+	if containsString(reservedObjectTypes, d.Name) || containsString(reservedObjectTypes, d.KeyPrefix) {
+		return errors.New("Document type " + d.Name + " is reserved")
+	}
+	return d.Schema.validate()
+}
+
+// validate checks the types of the properties of the schema
+func (s *DocSchema) validate() error {
+	for name, typ := range s.Properties {
+		switch typ {
+		case SchemaTypeString, SchemaTypeNumber, SchemaTypeBoolean, SchemaTypeObject, SchemaTypeArray:
+		default:
+			return errors.New("Property " + name + " has an unknown type " + typ)
+		}
+	}
+	return nil
+}
+
+// check validates the data of a document against the schema
+func (s *DocSchema) check(data map[string]interface{}) error {
+	for _, name := range s.Required {
+		if _, ok := data[name]; !ok {
+			return errors.New("Property " + name + " is required")
+		}
+	}
+	for name, typ := range s.Properties {
+		value, ok := data[name]
+		if !ok {
+			continue
+		}
+		valid := false
+		switch value.(type) {
+		case string:
+			valid = typ == SchemaTypeString
+		case float64:
+			valid = typ == SchemaTypeNumber
+		case bool:
+			valid = typ == SchemaTypeBoolean
+		case map[string]interface{}:
+			valid = typ == SchemaTypeObject
+		case []interface{}:
+			valid = typ == SchemaTypeArray
+		}
+		if !valid {
+			return errors.New("Property " + name + " should be of type " + typ)
+		}
+	}
+	return nil
+}
+
+func getDocTypeKey(stub shim.ChaincodeStubInterface, name string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeDocType, []string{name})
+}
+
+// getDocType returns a document type, nil if it isn't registered
+func getDocType(stub shim.ChaincodeStubInterface, name string) (*DocTypeDoc, error) {
+	key, err := getDocTypeKey(stub, name)
+	if err != nil {
+		return nil, err
+	}
+	docTypeBytes, err := stub.GetState(key)
+	if err != nil || docTypeBytes == nil {
+		return nil, err
+	}
+	docType := &DocTypeDoc{}
+	if err := json.Unmarshal(docTypeBytes, docType); err != nil {
+		return nil, err
+	}
+	return docType, nil
+}
+
+// keyPrefixUsed tells whether another document type uses a key prefix
+func keyPrefixUsed(stub shim.ChaincodeStubInterface, name, keyPrefix string) (bool, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ObjectTypeDocType, []string{})
+	if err != nil {
+		return false, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return false, err
+		}
+		docType := &DocTypeDoc{}
+		if err := json.Unmarshal(queryResponse.Value, docType); err != nil {
+			return false, err
+		}
+		if docType.Name != name && docType.KeyPrefix == keyPrefix {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RegisterDocType registers or updates a document type. The key prefix of
+// a type can't change once it has documents, so it is kept on updates.
+func (s *SmartContract) RegisterDocType(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 {
+		return shim.Error("Document type is required")
+	}
+	docType := &DocTypeDoc{}
+	if err := json.Unmarshal([]byte(args[0]), docType); err != nil {
+		return shim.Error("Could not parse document type")
+	}
+	if err := docType.validate(); err != nil {
+		return shim.Error(err.Error())
+	}
+	docType.ObjectType = ObjectTypeDocType
+
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	existing, err := getDocType(stub, docType.Name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		docType.KeyPrefix = existing.KeyPrefix
+	} else {
+		used, err := keyPrefixUsed(stub, docType.Name, docType.KeyPrefix)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if used {
+			return shim.Error("Key prefix " + docType.KeyPrefix + " is already used")
+		}
+	}
+
+	key, err := getDocTypeKey(stub, docType.Name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	docTypeBytes, err := json.Marshal(docType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, docTypeBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(docTypeBytes)
+}
+
+// requireDocType returns a registered document type
+func requireDocType(stub shim.ChaincodeStubInterface, name string) (*DocTypeDoc, error) {
+	docType, err := getDocType(stub, name)
+	if err != nil {
+		return nil, err
+	}
+	if docType == nil {
+		return nil, errors.New("Unknown document type " + name)
+	}
+	return docType, nil
+}
+
+// SaveDoc saves a document of a registered type. Arguments are the type,
+// the ID and the document.
+func (s *SmartContract) SaveDoc(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 3 || args[1] == "" {
+		return shim.Error("Document type, ID and document are required")
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(args[2]), &data); err != nil {
+		return shim.Error("Documents should be JSON objects")
+	}
+	docType, err := requireDocType(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := docType.Schema.check(data); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := stub.CreateCompositeKey(docType.KeyPrefix, []string{args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	docBytes, err := json.Marshal(AppDoc{docType.Name, args[1], json.RawMessage(args[2])})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, docBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// GetDoc returns the data of a document
+func (s *SmartContract) GetDoc(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 {
+		return shim.Error("Document type and ID are required")
+	}
+	docType, err := requireDocType(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := stub.CreateCompositeKey(docType.KeyPrefix, []string{args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	docBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if docBytes == nil {
+		return shim.Success(nil)
+	}
+	doc := &AppDoc{}
+	if err := json.Unmarshal(docBytes, doc); err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(doc.Data, nil)
+}
+
+// FindDocs returns a page of the documents of a type matching a CouchDB
+// selector, like RichQuery. Arguments are the type, the selector, the page
+// size and the bookmark.
+func (s *SmartContract) FindDocs(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 {
+		return shim.Error("Document type and selector are required")
+	}
+	selector := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(args[1]), &selector); err != nil {
+		return shim.Error("Could not parse selector")
+	}
+	pageSize, skip, err := parsePageArgs(args[2:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	docType, err := requireDocType(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	keyPrefix, err := stub.CreateCompositeKey(docType.KeyPrefix, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	scope := map[string]interface{}{"docType": docType.Name}
+	page, err := runPagedQuery(stub, scope, selector, pageSize, skip, func(key string) bool {
+		// Segments and values can have the same docType
+		return strings.HasPrefix(key, keyPrefix)
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	pageBytes, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(pageBytes, nil)
+}
@@ -0,0 +1,62 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_AppDocs(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Invoke(t, "RegisterDocType", []byte(`{"name":"country","schema":{"required":["code"],"properties":{"code":"string","eu":"boolean"}}}`))
+	stub.InvokeError(t, "RegisterDocType", []byte(`{"name":"segment"}`))
+	stub.InvokeError(t, "RegisterDocType", []byte(`{"name":"currency","keyPrefix":"country"}`))
+	stub.InvokeError(t, "RegisterDocType", []byte(`{"name":"currency","schema":{"properties":{"code":"date"}}}`))
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	stub.InvokeError(t, "RegisterDocType", []byte(`{"name":"currency"}`))
+	stub.Invoke(t, "SaveDoc", []byte("country"), []byte("fr"), []byte(`{"code":"FR","eu":true}`))
+	stub.Invoke(t, "SaveDoc", []byte("country"), []byte("ch"), []byte(`{"code":"CH","eu":false}`))
+	stub.InvokeError(t, "SaveDoc", []byte("country"), []byte("xx"), []byte(`{"eu":true}`))
+	stub.InvokeError(t, "SaveDoc", []byte("country"), []byte("xx"), []byte(`{"code":1}`))
+	stub.InvokeError(t, "SaveDoc", []byte("currency"), []byte("eur"), []byte(`{}`))
+
+	doc := map[string]interface{}{}
+	json.Unmarshal(stub.Invoke(t, "GetDoc", []byte("country"), []byte("fr")), &doc)
+	if doc["code"] != "FR" {
+		fmt.Println("Got document", doc)
+		t.FailNow()
+	}
+	if payload := stub.Invoke(t, "GetDoc", []byte("country"), []byte("de")); payload != nil {
+		fmt.Println("Unknown documents should not be found")
+		t.FailNow()
+	}
+
+	page := &RichQueryPage{}
+	json.Unmarshal(stub.Invoke(t, "FindDocs", []byte("country"), []byte(`{"data.eu":true}`)), page)
+	if len(page.Results) != 1 || page.Bookmark != "" {
+		fmt.Println("Got page", page)
+		t.FailNow()
+	}
+	json.Unmarshal(stub.Invoke(t, "FindDocs", []byte("country"), []byte(`{}`), []byte("1")), page)
+	if len(page.Results) != 1 || page.Bookmark != "1" {
+		fmt.Println("Got page", page)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/stratumn/sdk/cs"
+)
+
+// Segments with an embargoUntil link meta field (milliseconds since epoch)
+// are returned without their link state until the transaction timestamp
+// passes the embargo. The state is still stored in clear in the ledger:
+// combine embargoes with encryption when peers can't be trusted.
+
+// Embargo replaces the link state of embargoed segments in segment.meta
+type Embargo struct {
+	Until     int64  `json:"until"`
+	StateHash string `json:"stateHash"`
+}
+
+// getEmbargo returns the embargo of a segment in milliseconds, zero if it
+// has none
+func getEmbargo(segment *cs.Segment) (int64, error) {
+	v, ok := segment.Link.Meta["embargoUntil"]
+	if !ok {
+		return 0, nil
+	}
+	until, ok := v.(float64)
+	if !ok || until <= 0 {
+		return 0, errors.New("link.meta.embargoUntil should be a positive number")
+	}
+	return int64(until), nil
+}
+
+// applyEmbargo hides the link state of a segment if its embargo isn't over
+// and tells whether it did
+func applyEmbargo(segment *cs.Segment, now time.Time) (bool, error) {
+	until, err := getEmbargo(segment)
+	if err != nil || until == 0 {
+		return false, err
+	}
+	if now.UnixNano()/int64(time.Millisecond) >= until {
+		return false, nil
+	}
+	stateBytes, err := json.Marshal(segment.Link.State)
+	if err != nil {
+		return false, err
+	}
+	hash := sha256.Sum256(stateBytes)
+	segment.Meta["embargo"] = Embargo{
+		Until:     until,
+		StateHash: hex.EncodeToString(hash[:]),
+	}
+	segment.Link.State = map[string]interface{}{}
+	return true, nil
+}
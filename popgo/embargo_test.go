@@ -0,0 +1,69 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_Embargo(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 1000}
+	segment := testutil.Root("sealed").
+		WithState("bid", 100.0).
+		WithLinkMeta("embargoUntil", 2000000.0).
+		Build()
+	stub.SaveSegment(t, segment)
+	linkHash := []byte(segment.GetLinkHashString())
+
+	hidden := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", linkHash), hidden)
+	if len(hidden.Link.State) != 0 || hidden.Meta["embargo"] == nil {
+		fmt.Println("GetSegment should hide the state during the embargo", hidden.Link.State)
+		t.FailNow()
+	}
+	if hidden.GetLinkHashString() != segment.GetLinkHashString() || !reflect.DeepEqual(hidden.Link.Meta, segment.Link.Meta) {
+		fmt.Println("GetSegment should return the link meta and hash during the embargo")
+		t.FailNow()
+	}
+
+	var found cs.SegmentSlice
+	json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"process":"sealed"}`)), &found)
+	if len(found) != 1 || len(found[0].Link.State) != 0 {
+		fmt.Println("FindSegments should hide the state during the embargo")
+		t.FailNow()
+	}
+
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 2000}
+	revealed := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", linkHash), revealed)
+	if !reflect.DeepEqual(revealed.Link, segment.Link) || revealed.Meta["embargo"] != nil {
+		fmt.Println("GetSegment should return the state after the embargo")
+		t.FailNow()
+	}
+}
+
+func TestPop_EmbargoInvalid(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segment := testutil.Root("sealed").WithLinkMeta("embargoUntil", "tomorrow").Build()
+	stub.InvokeError(t, "SaveSegment", mustMarshal(segment))
+}
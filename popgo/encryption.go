@@ -0,0 +1,167 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Link states can be encrypted at rest. Like the encrypter entities of the
+// Fabric chaincode extensions, keys are never stored: they are passed in
+// the transient field of the proposal, which is not recorded in the ledger.
+// The link meta (process, mapId, tags...) stays in clear so segments can
+// still be queried.
+const (
+	// TransientEncryptionKey holds the key used to encrypt saved segments
+	TransientEncryptionKey = "ENCKEY"
+
+	// TransientDecryptionKey holds the key used to decrypt read segments
+	TransientDecryptionKey = "DECKEY"
+
+	// EncryptionAlgorithm is the only supported algorithm
+	EncryptionAlgorithm = "AES-256-GCM"
+)
+
+// ErrDecryption is returned when an encrypted state cannot be decrypted
+var ErrDecryption = errors.New("Could not decrypt segment state")
+
+// EncryptedState replaces the link state of encrypted segments and is
+// stored in segment.meta.encryptedState
+type EncryptedState struct {
+	Algorithm  string `json:"algorithm"`
+	KeyID      string `json:"keyId"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// stateEncrypter encrypts and decrypts link states with a symmetric key
+type stateEncrypter struct {
+	key  []byte
+	aead cipher.AEAD
+}
+
+func newStateEncrypter(key []byte) (*stateEncrypter, error) {
+	if len(key) != 32 {
+		return nil, errors.New("Encryption key should be 32 bytes long")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &stateEncrypter{key, aead}, nil
+}
+
+// getTransientEncrypter returns an encrypter for a key of the transient
+// field, or nil if the key wasn't given
+func getTransientEncrypter(stub shim.ChaincodeStubInterface, name string) (*stateEncrypter, error) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return nil, err
+	}
+	key, ok := transient[name]
+	if !ok {
+		return nil, nil
+	}
+	return newStateEncrypter(key)
+}
+
+// keyID identifies the key without revealing it
+func (e *stateEncrypter) keyID() string {
+	mac := hmac.New(sha256.New, e.key)
+	mac.Write([]byte("keyId"))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// nonce is derived from the link hash so that every endorser computes the
+// same ciphertext
+func (e *stateEncrypter) nonce(linkHash string) []byte {
+	mac := hmac.New(sha256.New, e.key)
+	mac.Write([]byte(linkHash))
+	return mac.Sum(nil)[:e.aead.NonceSize()]
+}
+
+// encrypt moves the link state of a segment into segment.meta.encryptedState
+func (e *stateEncrypter) encrypt(segment *cs.Segment) error {
+	stateBytes, err := json.Marshal(segment.Link.State)
+	if err != nil {
+		return err
+	}
+	linkHash := segment.GetLinkHashString()
+	nonce := e.nonce(linkHash)
+	segment.Meta["encryptedState"] = EncryptedState{
+		Algorithm:  EncryptionAlgorithm,
+		KeyID:      e.keyID(),
+		Nonce:      nonce,
+		Ciphertext: e.aead.Seal(nil, nonce, stateBytes, []byte(linkHash)),
+	}
+	segment.Link.State = map[string]interface{}{}
+	return nil
+}
+
+// decrypt restores the link state of an encrypted segment
+func (e *stateEncrypter) decrypt(segment *cs.Segment) error {
+	encrypted, err := getEncryptedState(segment)
+	if err != nil || encrypted == nil {
+		return err
+	}
+	if encrypted.KeyID != e.keyID() {
+		return ErrDecryption
+	}
+	stateBytes, err := e.aead.Open(nil, encrypted.Nonce, encrypted.Ciphertext, []byte(segment.GetLinkHashString()))
+	if err != nil {
+		return ErrDecryption
+	}
+	state := map[string]interface{}{}
+	if err := json.Unmarshal(stateBytes, &state); err != nil {
+		return err
+	}
+	segment.Link.State = state
+	delete(segment.Meta, "encryptedState")
+	return nil
+}
+
+// getEncryptedState returns the encrypted state of a segment, nil if the
+// segment isn't encrypted
+func getEncryptedState(segment *cs.Segment) (*EncryptedState, error) {
+	v, ok := segment.Meta["encryptedState"]
+	if !ok {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := &EncryptedState{}
+	if err := json.Unmarshal(b, encrypted); err != nil {
+		return nil, err
+	}
+	if encrypted.Algorithm != EncryptionAlgorithm {
+		return nil, errors.New("Unsupported encryption algorithm " + encrypted.Algorithm)
+	}
+	return encrypted, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/cstesting"
+)
+
+var (
+	testKey      = bytes.Repeat([]byte{1}, 32)
+	testOtherKey = bytes.Repeat([]byte{2}, 32)
+)
+
+func TestPop_SaveSegmentEncrypted(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segment := testutil.Root("main").WithTags("secret").WithState("amount", 42.0).Build()
+
+	stub.Transient = map[string][]byte{TransientEncryptionKey: testKey}
+	stub.SaveSegment(t, segment)
+	stub.Transient = nil
+
+	if bytes.Contains(stub.State[segment.GetLinkHashString()], []byte("amount")) {
+		fmt.Println("Link state stored in clear")
+		t.FailNow()
+	}
+	if bytes.Contains(stub.EventPayload, []byte("amount")) {
+		fmt.Println("Link state sent in clear")
+		t.FailNow()
+	}
+
+	stored := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(segment.GetLinkHashString())), stored)
+	if len(stored.Link.State) != 0 || stored.Meta["encryptedState"] == nil {
+		fmt.Println("GetSegment without key should return the encrypted state")
+		t.FailNow()
+	}
+	if stored.Link.GetTags()[0] != "secret" {
+		fmt.Println("Link meta should stay in clear")
+		t.FailNow()
+	}
+
+	stub.Transient = map[string][]byte{TransientDecryptionKey: testKey}
+	decrypted := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(segment.GetLinkHashString())), decrypted)
+	if !reflect.DeepEqual(decrypted.Link, segment.Link) {
+		fmt.Println("GetSegment with key should decrypt the state")
+		t.FailNow()
+	}
+	if _, ok := decrypted.Meta["encryptedState"]; ok {
+		fmt.Println("Decrypted segment should not contain the encrypted state")
+		t.FailNow()
+	}
+
+	stub.Transient = map[string][]byte{TransientDecryptionKey: testOtherKey}
+	if message := stub.InvokeError(t, "GetSegment", []byte(segment.GetLinkHashString())); message != ErrDecryption.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrDecryption.Error())
+		t.FailNow()
+	}
+}
+
+func TestPop_SaveSegmentInvalidKey(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	stub.Transient = map[string][]byte{TransientEncryptionKey: []byte("short")}
+	segmentBytes, _ := json.Marshal(testutil.Root("main").Build())
+	stub.InvokeError(t, "SaveSegment", segmentBytes)
+}
+
+func TestPop_encryptDeterministic(t *testing.T) {
+	segment := testutil.Root("main").WithState("amount", 42.0).Build()
+	a, b := cstesting.CloneSegment(segment), cstesting.CloneSegment(segment)
+
+	e, _ := newStateEncrypter(testKey)
+	e.encrypt(a)
+	e.encrypt(b)
+
+	aBytes, _ := json.Marshal(a)
+	bBytes, _ := json.Marshal(b)
+	if !bytes.Equal(aBytes, bBytes) {
+		fmt.Println("Encryption should be deterministic")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// ObjectTypeEvidence is used in CouchDB documents of evidences
+const ObjectTypeEvidence = "evidence"
+
+// Evidence is a proof of existence of a segment made by a fossilizer.
+// Segments returned by GetSegment and FindSegments list their evidences in
+// segment.meta.evidences.
+type Evidence struct {
+	Backend  string          `json:"backend"`
+	Provider string          `json:"provider"`
+	Proof    json.RawMessage `json:"proof"`
+	// ExpiresAt is the time in milliseconds after which the proof can't be
+	// verified anymore, for instance the expiry of a timestamping
+	// authority certificate
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+}
+
+// EvidenceDoc is used to store evidences in CouchDB, apart from the link
+// they are about so adding one doesn't rewrite the segment document
+type EvidenceDoc struct {
+	ObjectType string `json:"docType"`
+	LinkHash   string `json:"linkHash"`
+	Evidence
+	TransactionID string `json:"transactionId"`
+}
+
+// EvidenceEvent is the payload of the addEvidence event
+type EvidenceEvent struct {
+	LinkHash string    `json:"linkHash"`
+	Evidence *Evidence `json:"evidence"`
+}
+
+// EvidenceRenewalWindow is how long before its expiry an evidence can be
+// replaced by a new evidence of its provider
+const EvidenceRenewalWindow = 30 * 24 * time.Hour
+
+func (e *Evidence) validate() error {
+	if e.Backend == "" || e.Provider == "" {
+		return errors.New("Evidence backend and provider are required")
+	}
+	if len(e.Proof) == 0 {
+		return errors.New("Evidence proof is required")
+	}
+	if e.ExpiresAt < 0 {
+		return errors.New("Evidence expiry should be positive")
+	}
+	return nil
+}
+
+// verifyEvidence checks the proof of an evidence is about a link hash with
+// the verifier of its backend. Proofs of unknown backends are only
+// accepted if the configuration allows them, and must contain the link
+// hash.
+func verifyEvidence(config *Config, linkHash string, evidence *Evidence) error {
+	if verify, ok := evidenceVerifiers[evidence.Backend]; ok {
+		return verify(linkHash, evidence.Proof)
+	}
+	if !config.AllowUnknownEvidenceBackends {
+		return errors.New("Unknown evidence backend " + evidence.Backend)
+	}
+	var proof interface{}
+	if err := json.Unmarshal(evidence.Proof, &proof); err != nil {
+		return errors.New("Could not parse evidence proof")
+	}
+	if !referencesValue(proof, linkHash) {
+		return ErrProofMismatch
+	}
+	return nil
+}
+
+// checkRenewal checks a provider can replace its evidence: only evidences
+// that expired or expire within EvidenceRenewalWindow can be replaced, by
+// an evidence that expires later
+func checkRenewal(stub shim.ChaincodeStubInterface, existing, evidence *Evidence) error {
+	if existing.ExpiresAt == 0 {
+		return errors.New("Provider " + evidence.Provider + " already added an evidence")
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return err
+	}
+	renewableAt := existing.ExpiresAt - int64(EvidenceRenewalWindow/time.Millisecond)
+	if now.UnixNano()/int64(time.Millisecond) < renewableAt {
+		return errors.New("Evidence of provider " + evidence.Provider + " can only be renewed when it expires within " + EvidenceRenewalWindow.String())
+	}
+	if evidence.ExpiresAt != 0 && evidence.ExpiresAt <= existing.ExpiresAt {
+		return errors.New("Renewed evidence should expire after the evidence it replaces")
+	}
+	return nil
+}
+
+func getEvidenceKey(stub shim.ChaincodeStubInterface, linkHash, provider string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeEvidence, []string{linkHash, provider})
+}
+
+// getEvidences returns segment.meta.evidences, where evidences were stored
+// before they had their own documents
+func getEvidences(segment *cs.Segment) ([]*Evidence, error) {
+	v, ok := segment.Meta["evidences"]
+	if !ok {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var evidences []*Evidence
+	if err := json.Unmarshal(b, &evidences); err != nil {
+		return nil, errors.New("meta.evidences should be an array of evidences")
+	}
+	return evidences, nil
+}
+
+// getEvidenceDocs returns the evidences stored in documents for a link hash
+func getEvidenceDocs(stub shim.ChaincodeStubInterface, linkHash string) ([]*Evidence, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ObjectTypeEvidence, []string{linkHash})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var evidences []*Evidence
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		evidenceDoc := &EvidenceDoc{}
+		if err := json.Unmarshal(queryResponse.Value, evidenceDoc); err != nil {
+			return nil, err
+		}
+		evidences = append(evidences, &evidenceDoc.Evidence)
+	}
+	return evidences, nil
+}
+
+// getAllEvidences returns the evidences of a segment, legacy ones first
+func getAllEvidences(stub shim.ChaincodeStubInterface, segment *cs.Segment) ([]*Evidence, error) {
+	evidences, err := getEvidences(segment)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := getEvidenceDocs(stub, segment.GetLinkHashString())
+	if err != nil {
+		return nil, err
+	}
+	return append(evidences, docs...), nil
+}
+
+// attachEvidences sets segment.meta.evidences to all the evidences of a
+// segment. It tells whether the segment was changed.
+func attachEvidences(stub shim.ChaincodeStubInterface, segment *cs.Segment) (bool, error) {
+	docs, err := getEvidenceDocs(stub, segment.GetLinkHashString())
+	if err != nil || len(docs) == 0 {
+		return false, err
+	}
+	evidences, err := getEvidences(segment)
+	if err != nil {
+		return false, err
+	}
+	segment.Meta["evidences"] = append(evidences, docs...)
+	return true, nil
+}
+
+// deleteEvidences deletes the evidence documents of a link hash
+func deleteEvidences(stub shim.ChaincodeStubInterface, linkHash string) error {
+	evidences, err := getEvidenceDocs(stub, linkHash)
+	if err != nil {
+		return err
+	}
+	for _, evidence := range evidences {
+		key, err := getEvidenceKey(stub, linkHash, evidence.Provider)
+		if err != nil {
+			return err
+		}
+		if err := stub.DelState(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddEvidence adds an evidence to a segment. A provider can only add one
+// evidence to a segment, and its proof must be about the segment. Evidences
+// that expire are replaced by the new evidence of their provider once they
+// are about to expire, see checkRenewal.
+func (s *SmartContract) AddEvidence(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 {
+		return shim.Error("Link hash and evidence are required")
+	}
+	evidence := &Evidence{}
+	if err := json.Unmarshal([]byte(args[1]), evidence); err != nil {
+		return shim.Error("Could not parse evidence")
+	}
+	if err := evidence.validate(); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := requireFossilizer(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	segmentDocBytes, _, err := getSegmentDocBytes(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if segmentDocBytes == nil {
+		return shim.Error("Segment not found")
+	}
+	segmentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	evidences, err := getAllEvidences(stub, &segmentDoc.Segment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, e := range evidences {
+		if e.Provider == evidence.Provider {
+			if err := checkRenewal(stub, e, evidence); err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := verifyEvidence(config, args[0], evidence); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := getEvidenceKey(stub, args[0], evidence.Provider)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	evidenceBytes, err := json.Marshal(EvidenceDoc{
+		ObjectType:    ObjectTypeEvidence,
+		LinkHash:      args[0],
+		Evidence:      *evidence,
+		TransactionID: stub.GetTxID(),
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, evidenceBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eventBytes, _ := json.Marshal(EvidenceEvent{args[0], evidence})
+	if err := stub.SetEvent("addEvidence", eventBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
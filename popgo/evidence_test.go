@@ -0,0 +1,204 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_AddEvidence(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	if res := stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"fossilizers":["FossilizerMSP"]}`)}); res.Status != shim.OK {
+		fmt.Println("Init failed", res.Message)
+		t.FailNow()
+	}
+	segment := testutil.Root("main").Build()
+	segment.Meta["evidences"] = []interface{}{map[string]interface{}{"backend": "fake", "provider": "p", "proof": true}}
+	stub.SaveSegment(t, segment)
+	linkHash := segment.GetLinkHashString()
+
+	evidence := func(provider, hash string) []byte {
+		return []byte(`{"backend":"dummy","provider":"` + provider + `","proof":{"hashes":["` + hash + `"]}}`)
+	}
+	if message := stub.InvokeError(t, "AddEvidence", []byte(linkHash), evidence("a", linkHash)); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("FossilizerMSP", "fossilizer")
+	stub.Invoke(t, "AddEvidence", []byte(linkHash), evidence("a", linkHash))
+	stub.InvokeError(t, "AddEvidence", []byte(linkHash), evidence("a", linkHash))
+	stub.InvokeError(t, "AddEvidence", []byte(linkHash), evidence("b", "otherhash"))
+	stub.Invoke(t, "AddEvidence", []byte(linkHash), evidence("b", linkHash))
+
+	// Saving the segment again keeps its evidences
+	stub.SaveSegment(t, segment)
+
+	got := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(linkHash)), got)
+	evidences, err := getEvidences(got)
+	if err != nil || len(evidences) != 2 || evidences[0].Provider != "a" || evidences[1].Provider != "b" {
+		fmt.Println("Got evidences", evidences, err)
+		t.FailNow()
+	}
+
+	evidences = nil
+	json.Unmarshal(stub.Invoke(t, "GetEvidences", []byte(linkHash)), &evidences)
+	if len(evidences) != 2 || evidences[0].Provider != "a" {
+		fmt.Println("Got evidences", evidences)
+		t.FailNow()
+	}
+
+	stub.Invoke(t, "DeleteSegment", []byte(linkHash))
+	if evidences, _ := getEvidenceDocs(stub, linkHash); len(evidences) != 0 {
+		fmt.Println("Evidences should be deleted with the segment")
+		t.FailNow()
+	}
+}
+
+// testTSAProof returns a TSA proof of link hashes
+func testTSAProof(hashes ...string) string {
+	h := sha256.New()
+	for _, hash := range hashes {
+		b, _ := hex.DecodeString(hash)
+		h.Write(b)
+	}
+	proof, _ := json.Marshal(TSAProof{Hashes: hashes, MessageImprint: hex.EncodeToString(h.Sum(nil)), Token: []byte("token")})
+	return string(proof)
+}
+
+// testMerkleProof returns a Merkle proof of the first of two link hashes
+func testMerkleProof(linkHash, sibling string) *MerkleProof {
+	left, _ := hex.DecodeString(linkHash)
+	right, _ := hex.DecodeString(sibling)
+	root := sha256.Sum256(append(left, right...))
+	return &MerkleProof{
+		MerkleRoot: hex.EncodeToString(root[:]),
+		MerklePath: []MerkleNode{{Left: linkHash, Right: sibling, Parent: hex.EncodeToString(root[:])}},
+	}
+}
+
+func TestPop_EvidenceVerifiers(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	if res := stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"fossilizers":["FossilizerMSP"]}`)}); res.Status != shim.OK {
+		fmt.Println("Init failed", res.Message)
+		t.FailNow()
+	}
+	segment, other := testutil.Root("main").Build(), testutil.Root("main").Build()
+	stub.SaveSegment(t, segment, other)
+	linkHash, otherHash := segment.GetLinkHashString(), other.GetLinkHashString()
+	stub.Creator = testutil.NewIdentity("FossilizerMSP", "fossilizer")
+
+	merkle := testMerkleProof(linkHash, otherHash)
+	valid, _ := json.Marshal(merkle)
+	merkle.TxID = hex.EncodeToString(make([]byte, 32))
+	anchored, _ := json.Marshal(merkle)
+	merkle.MerklePath[0].Parent = otherHash
+	forged, _ := json.Marshal(merkle)
+	tampered := testTSAProof(linkHash, otherHash)
+	var tsa TSAProof
+	json.Unmarshal([]byte(tampered), &tsa)
+	tsa.Hashes = []string{linkHash}
+	tamperedBytes, _ := json.Marshal(tsa)
+
+	for i, test := range []struct {
+		backend, proof string
+		valid          bool
+	}{
+		{EvidenceBackendDummy, `{"hashes":["` + linkHash + `"]}`, true},
+		{EvidenceBackendDummy, `{"hashes":["` + otherHash + `"]}`, false},
+		{EvidenceBackendDummy, `{"other":["` + linkHash + `"]}`, false},
+		{EvidenceBackendTSA, testTSAProof(otherHash, linkHash), true},
+		{EvidenceBackendTSA, string(tamperedBytes), false},
+		{EvidenceBackendTSA, `{"hashes":["` + linkHash + `"]}`, false},
+		{EvidenceBackendBatch, string(valid), true},
+		{EvidenceBackendBatch, string(forged), false},
+		{EvidenceBackendBatch, string(testMustMarshal(testMerkleProof(otherHash, linkHash))), true},
+		{EvidenceBackendBatch, string(testMustMarshal(&MerkleProof{MerkleRoot: otherHash})), false},
+		{EvidenceBackendBitcoin, string(valid), false},
+		{EvidenceBackendBitcoin, string(anchored), true},
+		{"unknown", `{"hashes":["` + linkHash + `"]}`, false},
+	} {
+		provider := fmt.Sprint("p", i)
+		res := stub.Call("AddEvidence", []byte(linkHash), []byte(`{"backend":"`+test.backend+`","provider":"`+provider+`","proof":`+test.proof+`}`))
+		if (res.Status == shim.OK) != test.valid {
+			fmt.Println("Evidence", i, "of", test.backend, "should be valid:", test.valid, res.Message)
+			t.FailNow()
+		}
+	}
+
+	// Unknown backends are accepted when the configuration allows them
+	stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+	if res := stub.MockInit("config", [][]byte{[]byte("init"), []byte(`{"fossilizers":["FossilizerMSP"],"allowUnknownEvidenceBackends":true}`)}); res.Status != shim.OK {
+		fmt.Println("Init failed", res.Message)
+		t.FailNow()
+	}
+	stub.Creator = testutil.NewIdentity("FossilizerMSP", "fossilizer")
+	stub.Invoke(t, "AddEvidence", []byte(linkHash), []byte(`{"backend":"unknown","provider":"u","proof":{"hashes":["`+linkHash+`"]}}`))
+	stub.InvokeError(t, "AddEvidence", []byte(linkHash), []byte(`{"backend":"unknown","provider":"v","proof":{"hashes":["`+otherHash+`"]}}`))
+}
+
+func testMustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestPop_EvidenceRenewal(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	if res := stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"fossilizers":["FossilizerMSP"]}`)}); res.Status != shim.OK {
+		fmt.Println("Init failed", res.Message)
+		t.FailNow()
+	}
+	segment := testutil.Root("main").Build()
+	stub.SaveSegment(t, segment)
+	linkHash := segment.GetLinkHashString()
+
+	now := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	stub.Timestamp = &timestamp.Timestamp{Seconds: now.Unix()}
+	stub.Creator = testutil.NewIdentity("FossilizerMSP", "fossilizer")
+	evidence := func(expiresAt time.Time) []byte {
+		return []byte(`{"backend":"dummy","provider":"a","proof":{"hashes":["` + linkHash + `"]},"expiresAt":` + fmt.Sprint(expiresAt.UnixNano()/int64(time.Millisecond)) + `}`)
+	}
+
+	expiry := now.Add(2 * EvidenceRenewalWindow)
+	stub.Invoke(t, "AddEvidence", []byte(linkHash), evidence(expiry))
+
+	// The evidence can't be replaced before it is about to expire
+	stub.InvokeError(t, "AddEvidence", []byte(linkHash), evidence(expiry.Add(time.Hour)))
+
+	stub.Timestamp = &timestamp.Timestamp{Seconds: expiry.Add(-time.Hour).Unix()}
+	stub.InvokeError(t, "AddEvidence", []byte(linkHash), evidence(expiry))
+	stub.Invoke(t, "AddEvidence", []byte(linkHash), evidence(expiry.Add(EvidenceRenewalWindow)))
+
+	var evidences []*Evidence
+	json.Unmarshal(stub.Invoke(t, "GetEvidences", []byte(linkHash)), &evidences)
+	if len(evidences) != 1 || evidences[0].ExpiresAt != expiry.Add(EvidenceRenewalWindow).UnixNano()/int64(time.Millisecond) {
+		fmt.Println("Got evidences", evidences)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Evidences with an expiry must be refreshed before their proofs lapse.
+// Fossilizers find the segments to anchor again with
+// FindSegmentsWithExpiringEvidence, or submit NotifyExpiringEvidence
+// periodically and re-anchor the segments of its evidenceExpiring event.
+
+// EvidenceExpiry is an evidence about to expire
+type EvidenceExpiry struct {
+	LinkHash  string `json:"linkHash"`
+	Backend   string `json:"backend"`
+	Provider  string `json:"provider"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+func parseExpiryArgs(args []string) (int64, error) {
+	if len(args) < 1 || args[0] == "" {
+		return 0, errors.New("Expiry time is required")
+	}
+	before, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || before <= 0 {
+		return 0, errors.New("Expiry time should be a positive number of milliseconds")
+	}
+	return before, nil
+}
+
+// getExpiringEvidences returns the evidences expiring before a time in
+// milliseconds, sorted by expiry
+func getExpiringEvidences(stub shim.ChaincodeStubInterface, config *Config, before int64) ([]*EvidenceExpiry, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType":   ObjectTypeEvidence,
+			"expiresAt": map[string]interface{}{"$gt": 0, "$lt": before},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkQueryPlan(config, evidenceIndexes, string(queryBytes)); err != nil {
+		return nil, err
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	expiries := []*EvidenceExpiry{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		evidenceDoc := &EvidenceDoc{}
+		if err := json.Unmarshal(queryResponse.Value, evidenceDoc); err != nil {
+			return nil, err
+		}
+		expiries = append(expiries, &EvidenceExpiry{
+			LinkHash:  evidenceDoc.LinkHash,
+			Backend:   evidenceDoc.Backend,
+			Provider:  evidenceDoc.Provider,
+			ExpiresAt: evidenceDoc.ExpiresAt,
+		})
+	}
+	sort.Slice(expiries, func(i, j int) bool {
+		if expiries[i].ExpiresAt != expiries[j].ExpiresAt {
+			return expiries[i].ExpiresAt < expiries[j].ExpiresAt
+		}
+		return expiries[i].LinkHash < expiries[j].LinkHash
+	})
+	return expiries, nil
+}
+
+// FindSegmentsWithExpiringEvidence returns the segments with an evidence
+// expiring before a time in milliseconds. A segment filter can be given as
+// second argument.
+func (s *SmartContract) FindSegmentsWithExpiringEvidence(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	before, err := parseExpiryArgs(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	filter := "{}"
+	if len(args) > 1 && args[1] != "" {
+		filter = args[1]
+	}
+	segmentQuery, err := parseSegmentQuery([]byte(filter))
+	if err != nil {
+		return shim.Error("Segment filter format incorrect")
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	expiries, err := getExpiringEvidences(stub, config, before)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var linkHashes []string
+	for _, expiry := range expiries {
+		if !containsString(linkHashes, expiry.LinkHash) {
+			linkHashes = append(linkHashes, expiry.LinkHash)
+		}
+	}
+	if !segmentQuery.Selector.restrictLinkHashes(linkHashes) {
+		return successWithMeta([]byte("null"), nil)
+	}
+	return s.findSegments(stub, segmentQuery)
+}
+
+// NotifyExpiringEvidence emits an evidenceExpiring event listing the
+// evidences expiring before a time in milliseconds, and returns them.
+// Only fossilizers can call it.
+func (s *SmartContract) NotifyExpiringEvidence(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	before, err := parseExpiryArgs(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireFossilizer(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	expiries, err := getExpiringEvidences(stub, config, before)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	expiriesBytes, err := json.Marshal(expiries)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(expiries) > 0 {
+		if err := stub.SetEvent("evidenceExpiring", expiriesBytes); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success(expiriesBytes)
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_ExpiringEvidence(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	if res := stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"fossilizers":["FossilizerMSP"]}`)}); res.Status != shim.OK {
+		fmt.Println("Init failed", res.Message)
+		t.FailNow()
+	}
+	soon, later, never := testutil.Root("main").Build(), testutil.Root("main").Build(), testutil.Root("main").Build()
+	stub.SaveSegment(t, soon, later, never)
+
+	evidence := func(segment *cs.Segment, expiresAt string) []byte {
+		return []byte(`{"backend":"tsa","provider":"a","proof":` + testTSAProof(segment.GetLinkHashString()) + `,"expiresAt":` + expiresAt + `}`)
+	}
+	stub.Creator = testutil.NewIdentity("FossilizerMSP", "fossilizer")
+	stub.Invoke(t, "AddEvidence", []byte(soon.GetLinkHashString()), evidence(soon, "1000"))
+	stub.Invoke(t, "AddEvidence", []byte(later.GetLinkHashString()), evidence(later, "5000"))
+	stub.Invoke(t, "AddEvidence", []byte(never.GetLinkHashString()), evidence(never, "0"))
+	stub.InvokeError(t, "AddEvidence", []byte(never.GetLinkHashString()), evidence(never, "0"))
+
+	var found cs.SegmentSlice
+	json.Unmarshal(stub.Invoke(t, "FindSegmentsWithExpiringEvidence", []byte("2000")), &found)
+	if len(found) != 1 || found[0].GetLinkHashString() != soon.GetLinkHashString() {
+		fmt.Println("Got segments", found)
+		t.FailNow()
+	}
+	stub.InvokeError(t, "FindSegmentsWithExpiringEvidence", []byte("soon"))
+
+	var expiries []*EvidenceExpiry
+	json.Unmarshal(stub.Invoke(t, "NotifyExpiringEvidence", []byte("6000")), &expiries)
+	if len(expiries) != 2 || expiries[0].LinkHash != soon.GetLinkHashString() || stub.EventName != "evidenceExpiring" {
+		fmt.Println("Got expiries", expiries, stub.EventName)
+		t.FailNow()
+	}
+
+	// Refreshing an evidence replaces it
+	stub.Invoke(t, "AddEvidence", []byte(soon.GetLinkHashString()), evidence(soon, "9000"))
+	found = nil
+	json.Unmarshal(stub.Invoke(t, "FindSegmentsWithExpiringEvidence", []byte("2000")), &found)
+	if len(found) != 0 {
+		fmt.Println("Refreshed evidences should not expire", found)
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "NotifyExpiringEvidence", []byte("6000")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
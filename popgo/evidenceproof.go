@@ -0,0 +1,160 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+)
+
+// Evidence backends with a verifier. Evidences of other backends are
+// rejected unless Config.AllowUnknownEvidenceBackends is set.
+const (
+	EvidenceBackendDummy   = "dummy"
+	EvidenceBackendTSA     = "tsa"
+	EvidenceBackendBatch   = "batch"
+	EvidenceBackendBitcoin = "bitcoin"
+)
+
+// HashListProof is the proof of dummy evidences: the link hashes the
+// fossilizer received.
+type HashListProof struct {
+	Hashes []string `json:"hashes"`
+}
+
+// TSAProof is the proof of RFC 3161 timestamps. The authority timestamps
+// the message imprint, the SHA-256 of the concatenated link hashes of the
+// batch. The chaincode checks the imprint covers the link hash, the token
+// signature is checked by clients against the authority certificates.
+type TSAProof struct {
+	Hashes         []string `json:"hashes"`
+	MessageImprint string   `json:"messageImprint"`
+	Token          []byte   `json:"token"`
+}
+
+// MerkleNode is a step of a Merkle path, Parent is the SHA-256 of Left
+// followed by Right.
+type MerkleNode struct {
+	Left   string `json:"left"`
+	Right  string `json:"right"`
+	Parent string `json:"parent"`
+}
+
+// MerkleProof is the proof of batch evidences, and of bitcoin evidences
+// along with the ID of the transaction anchoring the Merkle root.
+type MerkleProof struct {
+	MerkleRoot string       `json:"merkleRoot"`
+	MerklePath []MerkleNode `json:"merklePath"`
+	TxID       string       `json:"txid,omitempty"`
+}
+
+// evidenceVerifier checks that the proof of an evidence is about a link hash
+type evidenceVerifier func(linkHash string, proof json.RawMessage) error
+
+// evidenceVerifiers are the verifiers of the known backends
+var evidenceVerifiers = map[string]evidenceVerifier{
+	EvidenceBackendDummy:   verifyHashListProof,
+	EvidenceBackendTSA:     verifyTSAProof,
+	EvidenceBackendBatch:   verifyBatchProof,
+	EvidenceBackendBitcoin: verifyBitcoinProof,
+}
+
+// ErrProofMismatch is returned when a proof isn't about the segment
+var ErrProofMismatch = errors.New("Evidence proof doesn't reference the segment")
+
+func verifyHashListProof(linkHash string, proofBytes json.RawMessage) error {
+	proof := &HashListProof{}
+	if err := json.Unmarshal(proofBytes, proof); err != nil {
+		return errors.New("Could not parse evidence proof")
+	}
+	if !containsString(proof.Hashes, linkHash) {
+		return ErrProofMismatch
+	}
+	return nil
+}
+
+func verifyTSAProof(linkHash string, proofBytes json.RawMessage) error {
+	proof := &TSAProof{}
+	if err := json.Unmarshal(proofBytes, proof); err != nil {
+		return errors.New("Could not parse evidence proof")
+	}
+	if len(proof.Token) == 0 {
+		return errors.New("Timestamp token is required")
+	}
+	if !containsString(proof.Hashes, linkHash) {
+		return ErrProofMismatch
+	}
+	h := sha256.New()
+	for _, hash := range proof.Hashes {
+		b, err := hex.DecodeString(hash)
+		if err != nil {
+			return errors.New("Invalid hash " + hash)
+		}
+		h.Write(b)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != proof.MessageImprint {
+		return errors.New("Message imprint doesn't match the hashes")
+	}
+	return nil
+}
+
+func verifyBatchProof(linkHash string, proofBytes json.RawMessage) error {
+	proof := &MerkleProof{}
+	if err := json.Unmarshal(proofBytes, proof); err != nil {
+		return errors.New("Could not parse evidence proof")
+	}
+	return proof.verify(linkHash)
+}
+
+func verifyBitcoinProof(linkHash string, proofBytes json.RawMessage) error {
+	proof := &MerkleProof{}
+	if err := json.Unmarshal(proofBytes, proof); err != nil {
+		return errors.New("Could not parse evidence proof")
+	}
+	if txID, err := hex.DecodeString(proof.TxID); err != nil || len(txID) != sha256.Size {
+		return errors.New("Bitcoin transaction ID is required")
+	}
+	return proof.verify(linkHash)
+}
+
+// verify checks the Merkle path goes from the link hash to the root
+func (p *MerkleProof) verify(linkHash string) error {
+	current := linkHash
+	for _, node := range p.MerklePath {
+		if node.Left != current && node.Right != current {
+			return ErrProofMismatch
+		}
+		left, err := hex.DecodeString(node.Left)
+		if err != nil {
+			return errors.New("Invalid Merkle path")
+		}
+		right, err := hex.DecodeString(node.Right)
+		if err != nil {
+			return errors.New("Invalid Merkle path")
+		}
+		parent := sha256.Sum256(append(left, right...))
+		if expected, err := hex.DecodeString(node.Parent); err != nil || !bytes.Equal(expected, parent[:]) {
+			return errors.New("Invalid Merkle path")
+		}
+		current = node.Parent
+	}
+	if current != p.MerkleRoot {
+		return ErrProofMismatch
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// MaxExistenceChecks is the maximum number of link hashes of a HasSegment
+const MaxExistenceChecks = 200
+
+// segmentExists tells whether a segment is stored, hot or cold, without
+// decoding its document
+func segmentExists(stub shim.ChaincodeStubInterface, linkHash string) (bool, error) {
+	segmentDocBytes, err := stub.GetState(linkHash)
+	if err != nil || segmentDocBytes != nil {
+		return segmentDocBytes != nil, err
+	}
+	key, err := getColdSegmentKey(stub, linkHash)
+	if err != nil {
+		return false, err
+	}
+	coldBytes, err := stub.GetState(key)
+	return coldBytes != nil, err
+}
+
+// HasSegment tells which of the given link hashes are stored segments. It
+// is cheaper than GetSegment since documents aren't decoded, unless the
+// channel is multi-tenant.
+func (s *SmartContract) HasSegment(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) == 0 || len(args) > MaxExistenceChecks {
+		return shim.Error("Between 1 and " + strconv.Itoa(MaxExistenceChecks) + " link hashes are required")
+	}
+	exists := make(map[string]bool, len(args))
+	for _, linkHash := range args {
+		ok, err := segmentExists(stub, linkHash)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		// Segments of other tenants are reported missing
+		if ok {
+			if err := checkSegmentTenant(stub, linkHash); err == ErrUnauthorized {
+				ok = false
+			} else if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		exists[linkHash] = ok
+	}
+	existsBytes, err := json.Marshal(exists)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(existsBytes, nil)
+}
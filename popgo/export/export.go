@@ -0,0 +1,77 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package export copies the maps and segments of a process out of the
+// chaincode, to move them to other Stratumn deployments.
+//
+// Segments are written either in the layout of the Stratumn file store,
+// one indented JSON file per segment named after its link hash, or in a
+// gzipped tarball of canonical JSON files.
+//
+// Handler streams the results of segment queries as NDJSON or CSV, for
+// analysts loading them in spreadsheets or BI tools.
+package export
+
+import (
+	"context"
+	"sort"
+
+	"github.com/stratumn/sdk/cs"
+)
+
+// Source fetches the maps and segments of a process from the chaincode.
+type Source interface {
+	// MapIDs returns the IDs of the maps of a process.
+	MapIDs(ctx context.Context, process string) ([]string, error)
+
+	// MapSegments returns the segments of a map.
+	MapSegments(ctx context.Context, mapID string) ([]*cs.Segment, error)
+}
+
+// Writer writes exported segments.
+type Writer interface {
+	// WriteSegment writes a segment.
+	WriteSegment(segment *cs.Segment) error
+
+	// Close flushes the segments written.
+	Close() error
+}
+
+// Process exports the segments of a process, map by map in map ID order.
+// It returns the number of segments written. The writer isn't closed.
+func Process(ctx context.Context, source Source, process string, w Writer) (int, error) {
+	mapIDs, err := source.MapIDs(ctx, process)
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(mapIDs)
+
+	n := 0
+	for _, mapID := range mapIDs {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		segments, err := source.MapSegments(ctx, mapID)
+		if err != nil {
+			return n, err
+		}
+		for _, segment := range segments {
+			if err := w.WriteSegment(segment); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
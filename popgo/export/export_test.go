@@ -0,0 +1,110 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+type mapSource map[string][]*cs.Segment
+
+func (s mapSource) MapIDs(ctx context.Context, process string) ([]string, error) {
+	var mapIDs []string
+	for mapID, segments := range s {
+		if segments[0].Link.GetProcess() == process {
+			mapIDs = append(mapIDs, mapID)
+		}
+	}
+	return mapIDs, nil
+}
+
+func (s mapSource) MapSegments(ctx context.Context, mapID string) ([]*cs.Segment, error) {
+	return s[mapID], nil
+}
+
+func testSource() (mapSource, []*cs.Segment) {
+	chain, other := testutil.Chain("main", 3), testutil.Chain("other", 1)
+	return mapSource{
+		chain[0].Link.GetMapID(): chain,
+		other[0].Link.GetMapID(): other,
+	}, chain
+}
+
+func TestFileStoreWriter(t *testing.T) {
+	source, chain := testSource()
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewFileStoreWriter(dir)
+	if err != nil {
+		t.FailNow()
+	}
+	if n, err := Process(context.Background(), source, "main", w); err != nil || n != 3 {
+		fmt.Println("Exported", n, "segments", err)
+		t.FailNow()
+	}
+	js, err := ioutil.ReadFile(filepath.Join(dir, chain[1].GetLinkHashString()+".json"))
+	segment := &cs.Segment{}
+	if err != nil || json.Unmarshal(js, segment) != nil || segment.GetLinkHashString() != chain[1].GetLinkHashString() {
+		fmt.Println("Could not read exported segment", err)
+		t.FailNow()
+	}
+}
+
+func TestTarWriter(t *testing.T) {
+	source, chain := testSource()
+	var buf bytes.Buffer
+	w := NewTarWriter(&buf)
+	if _, err := Process(context.Background(), source, "main", w); err != nil || w.Close() != nil {
+		t.FailNow()
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.FailNow()
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.FailNow()
+		}
+		names = append(names, header.Name)
+	}
+	if len(names) != 3 || names[0] != "segments/"+chain[0].GetLinkHashString()+".json" {
+		fmt.Println("Got files", names)
+		t.FailNow()
+	}
+}
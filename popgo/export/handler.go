@@ -0,0 +1,257 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/stratumn/sdk/cs"
+)
+
+// Finder runs segment queries on the chaincode.
+type Finder interface {
+	// FindSegments calls FindSegments with a segment filter. It returns
+	// a page of segments and the bookmark of the response metadata,
+	// empty on the last page.
+	FindSegments(ctx context.Context, filter json.RawMessage) ([]*cs.Segment, string, error)
+}
+
+// DefaultColumns are the CSV columns when none are requested.
+var DefaultColumns = []string{"linkHash", "meta.mapId", "meta.process", "meta.priority"}
+
+// Handler serves exports of segment queries on the /export route of an
+// HTTP server.
+//
+// Query parameters are the optional filter, a JSON segment filter like
+// FindSegments takes, format, ndjson by default or csv, and columns. The
+// pages of the query are fetched one after the other by following the
+// bookmark, starting at the pagination offset of the filter.
+//
+// CSV rows have the columns given as a comma separated list of linkHash
+// and dotted paths in the meta or state of the link, ie "meta.mapId" or
+// "state.order.amount". Values that aren't strings are written as JSON.
+//
+// An error after the first page aborts the response, so a truncated
+// export can't be mistaken for a complete one.
+func Handler(finder Finder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		format := params.Get("format")
+		if format == "" {
+			format = "ndjson"
+		}
+		if format != "ndjson" && format != "csv" {
+			http.Error(w, "format should be ndjson or csv", http.StatusBadRequest)
+			return
+		}
+		columns := DefaultColumns
+		if list := params.Get("columns"); list != "" {
+			columns = strings.Split(list, ",")
+			if err := validateColumns(columns); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		q, err := newPageQuery(params.Get("filter"))
+		if err != nil {
+			http.Error(w, "filter should be a JSON segment filter", http.StatusBadRequest)
+			return
+		}
+
+		segments, err := q.next(r.Context(), finder)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		var sw segmentWriter
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			sw, err = newCSVWriter(w, columns)
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			sw = &ndjsonWriter{encoder: json.NewEncoder(w)}
+		}
+		for err == nil {
+			for _, segment := range segments {
+				if err = sw.write(segment); err != nil {
+					break
+				}
+			}
+			if err != nil || q.done() {
+				break
+			}
+			segments, err = q.next(r.Context(), finder)
+		}
+		if err == nil {
+			err = sw.flush()
+		}
+		if err != nil {
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+// pageQuery follows the bookmarks of a segment query.
+type pageQuery struct {
+	filter map[string]interface{}
+	offset int
+	more   bool
+}
+
+func newPageQuery(filter string) (*pageQuery, error) {
+	q := &pageQuery{filter: map[string]interface{}{}, more: true}
+	if filter == "" {
+		return q, nil
+	}
+	if err := json.Unmarshal([]byte(filter), &q.filter); err != nil {
+		return nil, err
+	}
+	if q.filter == nil {
+		return nil, errors.New("filter is null")
+	}
+	if pagination, ok := q.filter["pagination"].(map[string]interface{}); ok {
+		if offset, ok := pagination["offset"].(float64); ok {
+			q.offset = int(offset)
+		}
+	}
+	return q, nil
+}
+
+// next fetches the page at the current offset and moves to the bookmark.
+func (q *pageQuery) next(ctx context.Context, finder Finder) ([]*cs.Segment, error) {
+	pagination, _ := q.filter["pagination"].(map[string]interface{})
+	if pagination == nil {
+		pagination = map[string]interface{}{}
+		q.filter["pagination"] = pagination
+	}
+	pagination["offset"] = q.offset
+	filterBytes, err := json.Marshal(q.filter)
+	if err != nil {
+		return nil, err
+	}
+	segments, bookmark, err := finder.FindSegments(ctx, filterBytes)
+	if err != nil {
+		return nil, err
+	}
+	q.more = bookmark != ""
+	if q.more {
+		offset, err := strconv.Atoi(bookmark)
+		if err != nil || offset <= q.offset {
+			return nil, fmt.Errorf("invalid bookmark %q", bookmark)
+		}
+		q.offset = offset
+	}
+	return segments, nil
+}
+
+func (q *pageQuery) done() bool {
+	return !q.more
+}
+
+type segmentWriter interface {
+	write(segment *cs.Segment) error
+	flush() error
+}
+
+// ndjsonWriter writes segments as newline delimited JSON.
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonWriter) write(segment *cs.Segment) error {
+	return w.encoder.Encode(segment)
+}
+
+func (w *ndjsonWriter) flush() error {
+	return nil
+}
+
+// csvWriter writes a row of columns per segment, after a header row.
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func newCSVWriter(out io.Writer, columns []string) (*csvWriter, error) {
+	w := &csvWriter{w: csv.NewWriter(out), columns: columns}
+	return w, w.w.Write(columns)
+}
+
+func (w *csvWriter) write(segment *cs.Segment) error {
+	row := make([]string, len(w.columns))
+	for i, column := range w.columns {
+		value, err := columnValue(segment, column)
+		if err != nil {
+			return err
+		}
+		row[i] = value
+	}
+	return w.w.Write(row)
+}
+
+func (w *csvWriter) flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func validateColumns(columns []string) error {
+	for _, column := range columns {
+		if column == "linkHash" {
+			continue
+		}
+		parts := strings.Split(column, ".")
+		if len(parts) < 2 || (parts[0] != "meta" && parts[0] != "state") {
+			return fmt.Errorf("invalid column %q, columns should be linkHash or meta or state paths", column)
+		}
+	}
+	return nil
+}
+
+// columnValue returns the value of a column of a segment, empty if the
+// segment doesn't have it.
+func columnValue(segment *cs.Segment, column string) (string, error) {
+	if column == "linkHash" {
+		return segment.GetLinkHashString(), nil
+	}
+	parts := strings.Split(column, ".")
+	var value interface{} = segment.Link.State
+	if parts[0] == "meta" {
+		value = segment.Link.Meta
+	}
+	for _, key := range parts[1:] {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", nil
+		}
+		value = object[key]
+	}
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	js, err := json.Marshal(value)
+	return string(js), err
+}
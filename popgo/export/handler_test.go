@@ -0,0 +1,161 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/store"
+)
+
+// pagedFinder returns pages of two segments like FindSegments, with the
+// offset of the next page as bookmark.
+type pagedFinder struct {
+	segments []*cs.Segment
+	filters  []*store.SegmentFilter
+
+	// Fetching the page at failAt fails when it is positive
+	failAt int
+}
+
+func (f *pagedFinder) FindSegments(ctx context.Context, filterBytes json.RawMessage) ([]*cs.Segment, string, error) {
+	filter := &store.SegmentFilter{}
+	if err := json.Unmarshal(filterBytes, filter); err != nil {
+		return nil, "", err
+	}
+	f.filters = append(f.filters, filter)
+	offset := filter.Offset
+	if f.failAt > 0 && offset == f.failAt {
+		return nil, "", errors.New("peer unavailable")
+	}
+	if offset >= len(f.segments) {
+		return nil, "", nil
+	}
+	end := offset + 2
+	if end >= len(f.segments) {
+		return f.segments[offset:], "", nil
+	}
+	return f.segments[offset:end], strconv.Itoa(end), nil
+}
+
+func TestHandler_NDJSON(t *testing.T) {
+	chain := testutil.Chain("main", 5)
+	finder := &pagedFinder{segments: chain}
+	server := httptest.NewServer(Handler(finder))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/export?filter=" + url.QueryEscape(`{"process":"main","pagination":{"offset":1}}`))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		fmt.Println("Export failed", err)
+		t.FailNow()
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 4 {
+		fmt.Println("Expected the segments after the offset, got", len(lines))
+		t.FailNow()
+	}
+	for i, line := range lines {
+		segment := &cs.Segment{}
+		if err := json.Unmarshal([]byte(line), segment); err != nil || segment.GetLinkHashString() != chain[i+1].GetLinkHashString() {
+			fmt.Println("Unexpected segment on line", i, line)
+			t.FailNow()
+		}
+	}
+
+	// The bookmarks are followed and the filter is kept
+	if len(finder.filters) != 2 || finder.filters[1].Offset != 3 || finder.filters[1].Process != "main" {
+		fmt.Println("Got filters", finder.filters)
+		t.FailNow()
+	}
+}
+
+func TestHandler_CSV(t *testing.T) {
+	chain := testutil.Chain("main", 3)
+	chain[1].Link.State["order"] = map[string]interface{}{"amount": 12, "currency": "EUR"}
+	server := httptest.NewServer(Handler(&pagedFinder{segments: chain}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/export?format=csv&columns=linkHash,meta.mapId,state.order.amount,state.order")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		fmt.Println("Export failed", err)
+		t.FailNow()
+	}
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil || len(rows) != 4 {
+		fmt.Println("Expected a header and 3 rows, got", rows, err)
+		t.FailNow()
+	}
+	if strings.Join(rows[0], ",") != "linkHash,meta.mapId,state.order.amount,state.order" {
+		fmt.Println("Got header", rows[0])
+		t.FailNow()
+	}
+	row := rows[2]
+	if row[0] != chain[1].GetLinkHashString() || row[1] != chain[1].Link.GetMapID() || row[2] != "12" || row[3] != `{"amount":12,"currency":"EUR"}` {
+		fmt.Println("Got row", row)
+		t.FailNow()
+	}
+	if rows[1][2] != "" {
+		fmt.Println("Missing values should be empty, got", rows[1][2])
+		t.FailNow()
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	chain := testutil.Chain("main", 5)
+	server := httptest.NewServer(Handler(&pagedFinder{segments: chain, failAt: 2}))
+	defer server.Close()
+
+	for query, status := range map[string]int{
+		"?format=xml":                   http.StatusBadRequest,
+		"?format=csv&columns=link.hash": http.StatusBadRequest,
+		"?filter=null":                  http.StatusBadRequest,
+		"?filter=" + url.QueryEscape(`{"pagination":{"offset":2}}`): http.StatusBadGateway,
+	} {
+		resp, err := http.Get(server.URL + "/export" + query)
+		if err != nil || resp.StatusCode != status {
+			fmt.Println("Query", query, "should have status", status)
+			t.FailNow()
+		}
+		resp.Body.Close()
+	}
+
+	// A failure after the first page aborts the response
+	resp, err := http.Get(server.URL + "/export")
+	if err == nil {
+		_, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if err == nil {
+		fmt.Println("The truncated export should be aborted")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/stratumn/sdk/cs"
+)
+
+// fileStoreWriter writes segments in a Stratumn file store directory.
+type fileStoreWriter struct {
+	dir string
+}
+
+// NewFileStoreWriter creates a writer saving segments like the Stratumn
+// file store does, so the directory can be used as the path of a file
+// store.
+func NewFileStoreWriter(dir string) (Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileStoreWriter{dir: dir}, nil
+}
+
+func (w *fileStoreWriter) WriteSegment(segment *cs.Segment) error {
+	js, err := json.MarshalIndent(segment, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(w.dir, segment.GetLinkHashString()+".json"), js, 0644)
+}
+
+func (w *fileStoreWriter) Close() error {
+	return nil
+}
+
+// tarWriter writes segments in a gzipped tarball.
+type tarWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+// NewTarWriter creates a writer adding segments to a gzipped tarball, as
+// segments/<linkHash>.json files of canonical JSON. Close must be called
+// to complete the tarball.
+func NewTarWriter(out io.Writer) Writer {
+	gz := gzip.NewWriter(out)
+	return &tarWriter{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+func (w *tarWriter) WriteSegment(segment *cs.Segment) error {
+	// Maps are marshaled with sorted keys, which makes the JSON canonical
+	js, err := json.Marshal(segment)
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Name: "segments/" + segment.GetLinkHashString() + ".json",
+		Mode: 0644,
+		Size: int64(len(js)),
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = w.tw.Write(js)
+	return err
+}
+
+func (w *tarWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
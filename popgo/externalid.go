@@ -0,0 +1,117 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Segments can be given a unique external ID in link.meta.externalId, for
+// instance an invoice number and a step, so clients look them up with
+// GetSegmentByExternalID instead of running rich queries. The external ID
+// is registered in its own key when the segment is saved.
+const (
+	// ObjectTypeExternalID is used in the keys of segment external IDs
+	ObjectTypeExternalID = "externalid"
+
+	// ExternalIDKey is the link meta key of the external ID of a segment
+	ExternalIDKey = "externalId"
+)
+
+func getExternalIDKey(stub shim.ChaincodeStubInterface, externalID string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeExternalID, []string{externalID})
+}
+
+// segmentExternalID returns the external ID of a segment, empty if it has
+// none
+func segmentExternalID(segment *cs.Segment) (string, error) {
+	value, ok := segment.Link.Meta[ExternalIDKey]
+	if !ok {
+		return "", nil
+	}
+	externalID, ok := value.(string)
+	if !ok || externalID == "" {
+		return "", errors.New("link.meta.externalId should be a non empty string")
+	}
+	if err := validateFilterValue(ExternalIDKey, externalID); err != nil {
+		return "", err
+	}
+	return externalID, nil
+}
+
+// registerExternalID points the external ID of a segment to its link hash.
+// It fails if another segment has the same external ID.
+func registerExternalID(stub shim.ChaincodeStubInterface, segment *cs.Segment) error {
+	externalID, err := segmentExternalID(segment)
+	if err != nil || externalID == "" {
+		return err
+	}
+	key, err := getExternalIDKey(stub, externalID)
+	if err != nil {
+		return err
+	}
+	existing, err := stub.GetState(key)
+	if err != nil {
+		return err
+	}
+	linkHash := segment.GetLinkHashString()
+	if existing != nil {
+		if string(existing) != linkHash {
+			return errors.New("External ID " + externalID + " is already used by segment " + string(existing))
+		}
+		return nil
+	}
+	return stub.PutState(key, []byte(linkHash))
+}
+
+// deleteExternalID frees the external ID of a deleted segment
+func deleteExternalID(stub shim.ChaincodeStubInterface, segment *cs.Segment) error {
+	externalID, err := segmentExternalID(segment)
+	if err != nil || externalID == "" {
+		return err
+	}
+	key, err := getExternalIDKey(stub, externalID)
+	if err != nil {
+		return err
+	}
+	return stub.DelState(key)
+}
+
+// GetSegmentByExternalID returns the segment with an external ID, or
+// nothing if no segment has it
+func (s *SmartContract) GetSegmentByExternalID(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("External ID is required")
+	}
+	if err := validateFilterValue(ExternalIDKey, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := getExternalIDKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	linkHash, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if linkHash == nil {
+		return shim.Success(nil)
+	}
+	return s.GetSegment(stub, []string{string(linkHash)})
+}
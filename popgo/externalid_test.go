@@ -0,0 +1,55 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_SegmentExternalIDs(t *testing.T) {
+	stub := newAdminStub(t)
+	root := testutil.Root("main").WithLinkMeta(ExternalIDKey, "INV-42/issue").Build()
+	stub.SaveSegment(t, root)
+	// Saving a segment again keeps its external ID
+	stub.SaveSegment(t, root)
+
+	duplicate := testutil.Child(root).WithLinkMeta(ExternalIDKey, "INV-42/issue").Build()
+	if message := stub.InvokeError(t, "SaveSegment", mustMarshal(duplicate)); message != "External ID INV-42/issue is already used by segment "+root.GetLinkHashString() {
+		fmt.Println("Got error", message)
+		t.FailNow()
+	}
+	stub.InvokeError(t, "SaveSegment", mustMarshal(testutil.Child(root).WithLinkMeta(ExternalIDKey, 42).Build()))
+
+	segment := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegmentByExternalID", []byte("INV-42/issue")), segment)
+	if segment.GetLinkHashString() != root.GetLinkHashString() {
+		fmt.Println("Got segment", segment)
+		t.FailNow()
+	}
+
+	// Deleting the segment frees its external ID
+	stub.Invoke(t, "DeleteSegment", []byte(root.GetLinkHashString()))
+	if res := stub.Invoke(t, "GetSegmentByExternalID", []byte("INV-42/issue")); res != nil {
+		fmt.Println("Deleted segments should not be found")
+		t.FailNow()
+	}
+	other := testutil.Root("main").WithLinkMeta(ExternalIDKey, "INV-42/issue").Build()
+	stub.SaveSegment(t, other)
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// ObjectTypeTagCounter is the composite key object type of tag counters.
+// Like process counters, they are sharded by transaction.
+const ObjectTypeTagCounter = "tagcounter"
+
+// addTagCounters adds delta to the counters of the tags of a segment
+func addTagCounters(stub shim.ChaincodeStubInterface, segment *cs.Segment, delta int) error {
+	// Duplicate tags would update the same key twice in a transaction
+	seen := map[string]bool{}
+	for _, tag := range segment.Link.GetTags() {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		if err := addShardedCounter(stub, ObjectTypeTagCounter, []string{segment.Link.GetProcess(), tag}, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTagFacets returns the number of segments of a process for each tag
+func (s *SmartContract) GetTagFacets(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Process is required")
+	}
+	if err := checkAggregateTenant(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ObjectTypeTagCounter, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	facets := map[string]int{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, attributes, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		value, err := strconv.Atoi(string(queryResponse.Value))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		facets[attributes[1]] += value
+	}
+	for tag, count := range facets {
+		if count == 0 {
+			delete(facets, tag)
+		}
+	}
+
+	facetsBytes, err := json.Marshal(facets)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(facetsBytes)
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_GetTagFacets(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	root := testutil.Root("main").WithTags("a", "b").Build()
+	child := testutil.Child(root).WithTags("a", "a").Build()
+	stub.SaveSegment(t, root, child, child)
+	stub.SaveSegment(t, testutil.Root("other").WithTags("c").Build())
+
+	facets := map[string]int{}
+	json.Unmarshal(stub.Invoke(t, "GetTagFacets", []byte("main")), &facets)
+	if expected := map[string]int{"a": 2, "b": 1}; !reflect.DeepEqual(facets, expected) {
+		fmt.Println("Got facets", facets, "expected", expected)
+		t.FailNow()
+	}
+
+	stub.Invoke(t, "DeleteSegment", []byte(root.GetLinkHashString()))
+	facets = map[string]int{}
+	json.Unmarshal(stub.Invoke(t, "GetTagFacets", []byte("main")), &facets)
+	if expected := map[string]int{"a": 1}; !reflect.DeepEqual(facets, expected) {
+		fmt.Println("Got facets", facets, "expected", expected)
+		t.FailNow()
+	}
+}
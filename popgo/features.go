@@ -0,0 +1,211 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// ObjectTypeFeatures is used in the CouchDB document of feature flags
+const ObjectTypeFeatures = "features"
+
+// Feature flags toggle behaviors per channel without redeploying the
+// chaincode. They are kept apart from the Config so upgrades don't reset
+// them.
+const (
+	// FeatureStrictLinkHash checks that meta.linkHash is the hash of the
+	// link of saved segments
+	FeatureStrictLinkHash = "strict-linkHash-verification"
+
+	// FeatureSignedOnly rejects segments without a signature of a
+	// registered actor
+	FeatureSignedOnly = "signed-only"
+
+	// FeaturePrivateData rejects segments whose state isn't encrypted
+	FeaturePrivateData = "private-data-mode"
+)
+
+var knownFeatures = []string{FeatureStrictLinkHash, FeatureSignedOnly, FeaturePrivateData}
+
+// FeaturesDoc is used to store feature flags in CouchDB
+type FeaturesDoc struct {
+	ObjectType string          `json:"docType"`
+	Flags      map[string]bool `json:"flags"`
+}
+
+// Info is returned by GetInfo
+type Info struct {
+	Features          map[string]bool `json:"features"`
+	StrictDeterminism bool            `json:"strictDeterminism"`
+	ReadOnly          bool            `json:"readOnly"`
+	ReadOnlyReason    string          `json:"readOnlyReason,omitempty"`
+}
+
+func getFeaturesKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeFeatures, []string{})
+}
+
+// getFeatures returns the feature flags, all disabled if none was set
+func getFeatures(stub shim.ChaincodeStubInterface) (*FeaturesDoc, error) {
+	features := &FeaturesDoc{ObjectType: ObjectTypeFeatures, Flags: map[string]bool{}}
+	key, err := getFeaturesKey(stub)
+	if err != nil {
+		return nil, err
+	}
+	featuresBytes, err := stub.GetState(key)
+	if err != nil || featuresBytes == nil {
+		return features, err
+	}
+	if err := json.Unmarshal(featuresBytes, features); err != nil {
+		return nil, err
+	}
+	return features, nil
+}
+
+// SetFeature enables or disables a feature flag
+func (s *SmartContract) SetFeature(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 {
+		return shim.Error("Feature name and value are required")
+	}
+	if !containsString(knownFeatures, args[0]) {
+		return shim.Error("Unknown feature " + args[0])
+	}
+	enabled, err := strconv.ParseBool(args[1])
+	if err != nil {
+		return shim.Error("Invalid feature value " + args[1])
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	features, err := getFeatures(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	features.set(args[0], enabled)
+	if err := saveFeatures(stub, features); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// set enables or disables a feature flag
+func (f *FeaturesDoc) set(name string, enabled bool) {
+	if enabled {
+		f.Flags[name] = true
+	} else {
+		delete(f.Flags, name)
+	}
+}
+
+func saveFeatures(stub shim.ChaincodeStubInterface, features *FeaturesDoc) error {
+	key, err := getFeaturesKey(stub)
+	if err != nil {
+		return err
+	}
+	featuresBytes, err := json.Marshal(features)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, featuresBytes)
+}
+
+// GetInfo reports the active feature flags and the read-only mode
+func (s *SmartContract) GetInfo(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	features, err := getFeatures(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	readOnly, err := getReadOnly(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	info := Info{
+		Features:          map[string]bool{},
+		StrictDeterminism: strictDeterminism,
+		ReadOnly:          readOnly.Enabled,
+		ReadOnlyReason:    readOnly.Reason,
+	}
+	for _, name := range knownFeatures {
+		info.Features[name] = features.Flags[name]
+	}
+	infoBytes, err := json.Marshal(info)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(infoBytes)
+}
+
+// checkFeatures rejects segments that the enabled features don't allow.
+// signed tells whether the segment was signed by an actor.
+func checkFeatures(features *FeaturesDoc, segment *cs.Segment, signed, encrypted bool) error {
+	if features.Flags[FeatureStrictLinkHash] {
+		if err := verifyLinkHash(segment); err != nil {
+			return err
+		}
+	}
+	if features.Flags[FeatureSignedOnly] && !signed {
+		return errors.New("Segments must be signed by a registered actor")
+	}
+	if features.Flags[FeaturePrivateData] && !encrypted {
+		return errors.New("Segment state must be encrypted")
+	}
+	return nil
+}
+
+// verifyLinkHash checks that meta.linkHash is the hex encoded SHA-256 of
+// the canonical link
+func verifyLinkHash(segment *cs.Segment) error {
+	linkHash, err := computeLinkHash(&segment.Link)
+	if err != nil {
+		return err
+	}
+	if segment.GetLinkHashString() != linkHash {
+		return errors.New("meta.linkHash is not the hash of the link")
+	}
+	return nil
+}
+
+// computeLinkHash returns the hex encoded SHA-256 of the canonical link
+func computeLinkHash(link *cs.Link) (string, error) {
+	linkBytes, err := canonicalLink(link)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(linkBytes)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// hasActorSignature tells whether a segment has a signature referencing a
+// DID. Such signatures are verified by validateSignatures.
+func hasActorSignature(segment *cs.Segment) bool {
+	signatures, _ := segment.Meta["signatures"].([]interface{})
+	for _, v := range signatures {
+		if sig, ok := v.(map[string]interface{}); ok {
+			if did, _ := sig["did"].(string); did != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_SetFeature(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Invoke(t, "SetFeature", []byte(FeatureSignedOnly), []byte("true"))
+	stub.InvokeError(t, "SetFeature", []byte("unknown"), []byte("true"))
+	stub.InvokeError(t, "SetFeature", []byte(FeatureSignedOnly), []byte("maybe"))
+
+	info := &Info{}
+	json.Unmarshal(stub.Invoke(t, "GetInfo"), info)
+	if len(info.Features) != 3 || !info.Features[FeatureSignedOnly] || info.Features[FeaturePrivateData] {
+		fmt.Println("Got features", info.Features)
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "SetFeature", []byte(FeatureSignedOnly), []byte("false")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
+
+func TestPop_SaveSegmentFeatures(t *testing.T) {
+	stub := newAdminStub(t)
+	alice := testutil.NewSigner()
+	stub.Invoke(t, "RegisterActor", []byte("did:example:alice"), []byte(alice.PublicKey()))
+
+	tampered := testutil.Root("main").Build()
+	tampered.Link.Meta["tampered"] = true
+	stub.SaveSegment(t, tampered)
+	stub.Invoke(t, "SetFeature", []byte(FeatureStrictLinkHash), []byte("true"))
+	tamperedBytes, _ := json.Marshal(tampered)
+	stub.InvokeError(t, "SaveSegment", tamperedBytes)
+	stub.SaveSegment(t, testutil.Root("main").Build())
+
+	stub.Invoke(t, "SetFeature", []byte(FeatureSignedOnly), []byte("true"))
+	unsigned := testutil.Root("main").Build()
+	unsignedBytes, _ := json.Marshal(unsigned)
+	stub.InvokeError(t, "SaveSegment", unsignedBytes)
+	sig := alice.Sign(&unsigned.Link)
+	sig.DID = "did:example:alice"
+	stub.SaveSegment(t, testutil.Root("main").WithMapID(unsigned.Link.GetMapID()).WithSignature(sig).Build())
+
+	stub.Invoke(t, "SetFeature", []byte(FeatureSignedOnly), []byte("false"))
+	stub.Invoke(t, "SetFeature", []byte(FeaturePrivateData), []byte("true"))
+	stub.InvokeError(t, "SaveSegment", unsignedBytes)
+	stub.Transient = map[string][]byte{TransientEncryptionKey: testKey}
+	stub.SaveSegment(t, unsigned)
+}
+
+func TestPop_SetReadOnly(t *testing.T) {
+	stub := newAdminStub(t)
+	segments := testutil.Chain("main", 2)
+	stub.SaveSegment(t, segments[0])
+	stub.Invoke(t, "SetReadOnly", []byte("true"), []byte("CouchDB maintenance"))
+
+	info := &Info{}
+	json.Unmarshal(stub.Invoke(t, "GetInfo"), info)
+	if !info.ReadOnly || info.ReadOnlyReason != "CouchDB maintenance" {
+		fmt.Println("Got info", info)
+		t.FailNow()
+	}
+
+	if message := stub.InvokeError(t, "SaveSegment", mustMarshal(segments[1])); message != "Chaincode is read-only: CouchDB maintenance" {
+		fmt.Println("Got error", message)
+		t.FailNow()
+	}
+	stub.InvokeError(t, "SetFeature", []byte(FeatureSignedOnly), []byte("true"))
+	stub.Invoke(t, "GetSegment", []byte(segments[0].GetLinkHashString()))
+	stub.Invoke(t, "GetMaps", []byte("{}"))
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "SetReadOnly", []byte("false")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+	stub.InvokeError(t, "SetReadOnly", []byte("maybe"))
+	stub.Invoke(t, "SetReadOnly", []byte("false"))
+	stub.SaveSegment(t, segments[1])
+	info = &Info{}
+	json.Unmarshal(stub.Invoke(t, "GetInfo"), info)
+	if info.ReadOnly || info.ReadOnlyReason != "" {
+		fmt.Println("Got info", info)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// MaxGCBatch is the maximum number of maps CollectOrphanedMaps scans in a
+// transaction
+const MaxGCBatch = 100
+
+// GCResult is returned by CollectOrphanedMaps
+type GCResult struct {
+	Scanned int      `json:"scanned"`
+	Deleted []string `json:"deleted"`
+	// Cursor is the map ID to resume after, empty once all maps were
+	// scanned
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// CollectOrphanedMaps deletes maps without segments, like maps whose root
+// segment was deleted. Maps are scanned by ID in batches, arguments are the
+// optional cursor returned by the previous batch and the batch size.
+func (s *SmartContract) CollectOrphanedMaps(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	cursor, batch := "", MaxGCBatch
+	if len(args) > 0 {
+		cursor = args[0]
+	}
+	if len(args) > 1 && args[1] != "" {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > MaxGCBatch {
+			return shim.Error("Batch size should be between 1 and " + strconv.Itoa(MaxGCBatch))
+		}
+		batch = n
+	}
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := collectOrphanedMaps(stub, config, cursor, batch)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(resultBytes)
+}
+
+// collectOrphanedMaps deletes the orphaned maps among the next batch of
+// maps after the cursor
+func collectOrphanedMaps(stub shim.ChaincodeStubInterface, config *Config, cursor string, batch int) (*GCResult, error) {
+	mapDocs, err := scanMaps(stub, config, cursor, batch+1)
+	if err != nil {
+		return nil, err
+	}
+	result := &GCResult{Deleted: []string{}}
+	if len(mapDocs) > batch {
+		mapDocs = mapDocs[:batch]
+		result.Cursor = mapDocs[batch-1].ID
+	}
+	result.Scanned = len(mapDocs)
+
+	// Reads don't see the writes of the transaction, so the map counters
+	// of the processes are decremented once per process
+	deletedMaps := map[string]int{}
+	for _, mapDoc := range mapDocs {
+		orphaned, err := isOrphanedMap(stub, config, mapDoc.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !orphaned {
+			continue
+		}
+		// Held maps are kept until their holds are released
+		holds, err := getMapHolds(stub, mapDoc)
+		if err != nil {
+			return nil, err
+		}
+		if len(holds) > 0 {
+			continue
+		}
+		if err := deleteMap(stub, mapDoc); err != nil {
+			return nil, err
+		}
+		result.Deleted = append(result.Deleted, mapDoc.ID)
+		deletedMaps[mapDoc.Process]++
+	}
+
+	processes := make([]string, 0, len(deletedMaps))
+	for process := range deletedMaps {
+		processes = append(processes, process)
+	}
+	sort.Strings(processes)
+	for _, process := range processes {
+		if err := addProcessCounter(stub, process, ProcessCounterMaps, -deletedMaps[process]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// scanMaps returns up to limit maps whose ID is after the cursor, sorted by
+// ID
+func scanMaps(stub shim.ChaincodeStubInterface, config *Config, cursor string, limit int) ([]*MapDoc, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": ObjectTypeMap,
+			"id":      map[string]string{"$gt": cursor},
+		},
+		"sort":  []map[string]string{{"docType": "asc"}, {"id": "asc"}},
+		"limit": limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkQueryPlan(config, mapIndexes, string(queryBytes)); err != nil {
+		return nil, err
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var mapDocs []*MapDoc
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		mapDoc := &MapDoc{}
+		if err := json.Unmarshal(queryResponse.Value, mapDoc); err != nil {
+			return nil, err
+		}
+		mapDocs = append(mapDocs, mapDoc)
+	}
+	return mapDocs, nil
+}
+
+// isOrphanedMap tells whether a map has no segment. The segment counter of
+// the map is checked first, then hot and cold segments are queried since
+// maps created before the counter existed have no count.
+func isOrphanedMap(stub shim.ChaincodeStubInterface, config *Config, mapID string) (bool, error) {
+	count, err := getMapCounter(stub, mapID, MapCounterSegments)
+	if err != nil || count > 0 {
+		return false, err
+	}
+	for _, query := range []struct {
+		selector map[string]interface{}
+		indexes  []queryIndex
+	}{
+		{map[string]interface{}{"docType": ObjectTypeSegment, "segment.link.meta.mapId": mapID}, segmentIndexes},
+		{map[string]interface{}{"docType": ObjectTypeColdSegment, "mapId": mapID}, coldSegmentIndexes},
+	} {
+		queryBytes, err := json.Marshal(map[string]interface{}{"selector": query.selector, "limit": 1})
+		if err != nil {
+			return false, err
+		}
+		if _, err := checkQueryPlan(config, query.indexes, string(queryBytes)); err != nil {
+			return false, err
+		}
+		found, err := hasQueryResult(stub, string(queryBytes))
+		if err != nil || found {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func hasQueryResult(stub shim.ChaincodeStubInterface, query string) (bool, error) {
+	resultsIterator, err := stub.GetQueryResult(query)
+	if err != nil {
+		return false, err
+	}
+	defer resultsIterator.Close()
+	return resultsIterator.HasNext(), nil
+}
+
+// deleteMap deletes a map document with its counters and annotations. The
+// map counter of its process is left to the caller.
+func deleteMap(stub shim.ChaincodeStubInterface, mapDoc *MapDoc) error {
+	if err := stub.DelState(mapDoc.ID); err != nil {
+		return err
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ObjectTypeMapCounter, []string{mapDoc.ID})
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			resultsIterator.Close()
+			return err
+		}
+		keys = append(keys, queryResponse.Key)
+	}
+	resultsIterator.Close()
+	for _, key := range keys {
+		if err := stub.DelState(key); err != nil {
+			return err
+		}
+	}
+	return deleteAnnotations(stub, AnnotationTargetMap, mapDoc.ID)
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_CollectOrphanedMaps(t *testing.T) {
+	stub := newAdminStub(t)
+	kept, orphaned, legacy := testutil.Root("main").Build(), testutil.Root("main").Build(), testutil.Root("main").Build()
+	stub.SaveSegment(t, kept, orphaned, legacy)
+	stub.Invoke(t, "AnnotateMap", []byte(orphaned.Link.GetMapID()), []byte("priority"), []byte("high"))
+	stub.Invoke(t, "DeleteSegment", []byte(orphaned.GetLinkHashString()))
+
+	// Maps saved before segment counters existed have no count
+	counterKey, _ := getMapCounterKey(stub, legacy.Link.GetMapID(), MapCounterSegments)
+	delete(stub.State, counterKey)
+
+	var deleted []string
+	cursor, batches := "", 0
+	for {
+		result := &GCResult{}
+		json.Unmarshal(stub.Invoke(t, "CollectOrphanedMaps", []byte(cursor), []byte("1")), result)
+		deleted = append(deleted, result.Deleted...)
+		batches++
+		if cursor = result.Cursor; cursor == "" {
+			break
+		}
+	}
+	if batches != 3 || len(deleted) != 1 || deleted[0] != orphaned.Link.GetMapID() {
+		fmt.Println("Deleted", deleted, "in", batches, "batches")
+		t.FailNow()
+	}
+	if stub.State[orphaned.Link.GetMapID()] != nil || stub.State[kept.Link.GetMapID()] == nil {
+		fmt.Println("Only the orphaned map should be deleted")
+		t.FailNow()
+	}
+	if payload := stub.Invoke(t, "GetAnnotations", []byte("map"), []byte(orphaned.Link.GetMapID())); string(payload) != "[]" {
+		fmt.Println("Map annotations should be deleted, got", string(payload))
+		t.FailNow()
+	}
+	stats := &ProcessStats{}
+	json.Unmarshal(stub.Invoke(t, "GetProcessStats", []byte("main")), stats)
+	if stats.Maps != 2 {
+		fmt.Println("Got stats", stats)
+		t.FailNow()
+	}
+
+	stub.InvokeError(t, "CollectOrphanedMaps", []byte(""), []byte("1000"))
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "CollectOrphanedMaps"); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
+
+func TestPop_CollectOrphanedMapsCounter(t *testing.T) {
+	stub := newAdminStub(t)
+	segments := []*cs.Segment{testutil.Root("main").Build(), testutil.Root("main").Build(), testutil.Root("main").Build()}
+	stub.SaveSegment(t, segments...)
+	for _, segment := range segments[1:] {
+		stub.Invoke(t, "DeleteSegment", []byte(segment.GetLinkHashString()))
+	}
+
+	// Reads don't see the writes of the transaction on a peer
+	stub.MockTransactionStart("gc")
+	wstub := newWriteSetStub(stub)
+	config, _ := getConfig(stub)
+	result, err := collectOrphanedMaps(wstub, config, "", MaxGCBatch)
+	if err != nil || len(result.Deleted) != 2 {
+		fmt.Println("Got result", result, err)
+		t.FailNow()
+	}
+	wstub.apply()
+	stub.MockTransactionEnd("gc")
+
+	stats := &ProcessStats{}
+	json.Unmarshal(stub.Invoke(t, "GetProcessStats", []byte("main")), stats)
+	if stats.Maps != 1 {
+		fmt.Println("Got stats", stats)
+		t.FailNow()
+	}
+}
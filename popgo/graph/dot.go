@@ -0,0 +1,57 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteDOT writes the graph in the Graphviz DOT language. Nodes are
+// labeled with their action, external nodes are dashed and reference
+// edges dotted.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "digraph %s {\n", strconv.Quote(g.MapID))
+	for _, node := range g.Nodes {
+		style := ""
+		if node.External {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(b, "  %s [label=%s%s];\n", strconv.Quote(node.LinkHash), strconv.Quote(label(node)), style)
+	}
+	for _, edge := range g.Edges {
+		style := ""
+		if edge.Type == EdgeRef {
+			style = " [style=dotted]"
+		}
+		fmt.Fprintf(b, "  %s -> %s%s;\n", strconv.Quote(edge.From), strconv.Quote(edge.To), style)
+	}
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+// label returns the action of a node, or the start of its link hash.
+func label(node *Node) string {
+	if node.Action != "" {
+		return node.Action
+	}
+	if len(node.LinkHash) > 8 {
+		return node.LinkHash[:8]
+	}
+	return node.LinkHash
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graph builds the graph of the segments of a map, ready to be
+// rendered by UIs as JSON or Graphviz DOT.
+package graph
+
+import (
+	"sort"
+
+	"github.com/stratumn/sdk/cs"
+)
+
+// Edge types.
+const (
+	// EdgeParent goes from a segment to its child.
+	EdgeParent = "parent"
+
+	// EdgeRef goes from a segment to a segment it references.
+	EdgeRef = "ref"
+)
+
+// Node is a segment of the graph.
+type Node struct {
+	LinkHash string  `json:"linkHash"`
+	Process  string  `json:"process"`
+	Action   string  `json:"action,omitempty"`
+	Priority float64 `json:"priority,omitempty"`
+
+	// External is true for referenced segments of other maps. Only their
+	// link hash and process are known.
+	External bool `json:"external,omitempty"`
+}
+
+// Edge links two nodes.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+}
+
+// Graph is the graph of a map.
+type Graph struct {
+	MapID string  `json:"mapId"`
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+}
+
+// Build creates the graph of the segments of a map. Nodes are sorted by
+// priority then link hash, followed by external nodes. Parents missing
+// from the segments, like deleted ones, have no edge.
+func Build(mapID string, segments []*cs.Segment) *Graph {
+	g := &Graph{MapID: mapID, Nodes: []*Node{}, Edges: []*Edge{}}
+	inMap := map[string]bool{}
+	for _, segment := range segments {
+		inMap[segment.GetLinkHashString()] = true
+	}
+
+	sorted := make([]*cs.Segment, len(segments))
+	copy(sorted, segments)
+	sort.Slice(sorted, func(i, j int) bool {
+		pi, pj := sorted[i].Link.GetPriority(), sorted[j].Link.GetPriority()
+		if pi != pj {
+			return pi < pj
+		}
+		return sorted[i].GetLinkHashString() < sorted[j].GetLinkHashString()
+	})
+
+	var external []*Node
+	seen := map[string]bool{}
+	for _, segment := range sorted {
+		linkHash := segment.GetLinkHashString()
+		action, _ := segment.Link.Meta["action"].(string)
+		g.Nodes = append(g.Nodes, &Node{
+			LinkHash: linkHash,
+			Process:  segment.Link.GetProcess(),
+			Action:   action,
+			Priority: segment.Link.GetPriority(),
+		})
+
+		if prev := segment.Link.GetPrevLinkHashString(); prev != "" && inMap[prev] {
+			g.Edges = append(g.Edges, &Edge{From: prev, To: linkHash, Type: EdgeParent})
+		}
+		for _, ref := range refs(segment) {
+			g.Edges = append(g.Edges, &Edge{From: linkHash, To: ref.LinkHash, Type: EdgeRef})
+			if !inMap[ref.LinkHash] && !seen[ref.LinkHash] {
+				seen[ref.LinkHash] = true
+				external = append(external, ref)
+			}
+		}
+	}
+	sort.Slice(external, func(i, j int) bool {
+		return external[i].LinkHash < external[j].LinkHash
+	})
+	g.Nodes = append(g.Nodes, external...)
+	return g
+}
+
+// refs returns the segments referenced in link.meta.refs as external
+// nodes.
+func refs(segment *cs.Segment) []*Node {
+	values, _ := segment.Link.Meta["refs"].([]interface{})
+	var nodes []*Node
+	for _, value := range values {
+		ref, _ := value.(map[string]interface{})
+		linkHash, _ := ref["linkHash"].(string)
+		if linkHash == "" {
+			continue
+		}
+		process, _ := ref["process"].(string)
+		nodes = append(nodes, &Node{LinkHash: linkHash, Process: process, External: true})
+	}
+	return nodes
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func testMap() (string, []*cs.Segment) {
+	other := testutil.Root("other").Build()
+	root := testutil.Root("main").WithAction("init").WithPriority(1).Build()
+	child := testutil.Child(root).WithAction("sign").WithPriority(2).WithRef(other).Build()
+	return root.Link.GetMapID(), []*cs.Segment{child, root}
+}
+
+func TestBuild(t *testing.T) {
+	mapID, segments := testMap()
+	g := Build(mapID, segments)
+	if len(g.Nodes) != 3 || g.Nodes[0].Action != "init" || g.Nodes[1].Action != "sign" || !g.Nodes[2].External {
+		fmt.Println("Got nodes", g.Nodes)
+		t.FailNow()
+	}
+	if len(g.Edges) != 2 || g.Edges[0].Type != EdgeParent || g.Edges[1].Type != EdgeRef {
+		fmt.Println("Got edges", g.Edges)
+		t.FailNow()
+	}
+	if g.Edges[0].From != g.Nodes[0].LinkHash || g.Edges[0].To != g.Nodes[1].LinkHash {
+		fmt.Println("Parent edge should go from the root to its child")
+		t.FailNow()
+	}
+
+	var dot bytes.Buffer
+	g.WriteDOT(&dot)
+	if !strings.HasPrefix(dot.String(), "digraph ") || !strings.Contains(dot.String(), `[label="sign"]`) || !strings.Contains(dot.String(), "style=dotted") {
+		fmt.Println("Got DOT", dot.String())
+		t.FailNow()
+	}
+}
+
+type mapSource map[string][]*cs.Segment
+
+func (s mapSource) MapSegments(ctx context.Context, mapID string) ([]*cs.Segment, error) {
+	return s[mapID], nil
+}
+
+func TestHandler(t *testing.T) {
+	mapID, segments := testMap()
+	server := httptest.NewServer(Handler(mapSource{mapID: segments}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/graph?mapId=" + mapID)
+	if err != nil {
+		t.FailNow()
+	}
+	g := &Graph{}
+	json.NewDecoder(resp.Body).Decode(g)
+	resp.Body.Close()
+	if g.MapID != mapID || len(g.Nodes) != 3 {
+		fmt.Println("Got graph", g)
+		t.FailNow()
+	}
+
+	for query, status := range map[string]int{
+		"":                                http.StatusBadRequest,
+		"?mapId=" + mapID + "&format=svg": http.StatusBadRequest,
+		"?mapId=missing":                  http.StatusNotFound,
+		"?mapId=" + mapID + "&format=dot": http.StatusOK,
+	} {
+		resp, err := http.Get(server.URL + "/graph" + query)
+		if err != nil || resp.StatusCode != status {
+			fmt.Println("Query", query, "should have status", status)
+			t.FailNow()
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/stratumn/sdk/cs"
+)
+
+// Source fetches the segments of a map from the chaincode.
+type Source interface {
+	// MapSegments returns the segments of a map, empty if it doesn't
+	// exist.
+	MapSegments(ctx context.Context, mapID string) ([]*cs.Segment, error)
+}
+
+// Handler serves map graphs on the /graph route of an HTTP server.
+//
+// Query parameters are mapId and the optional format, json by default or
+// dot.
+func Handler(source Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		mapID := params.Get("mapId")
+		if mapID == "" {
+			http.Error(w, "mapId is required", http.StatusBadRequest)
+			return
+		}
+		format := params.Get("format")
+		if format != "" && format != "json" && format != "dot" {
+			http.Error(w, "format should be json or dot", http.StatusBadRequest)
+			return
+		}
+
+		segments, err := source.MapSegments(r.Context(), mapID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if len(segments) == 0 {
+			http.Error(w, "map not found", http.StatusNotFound)
+			return
+		}
+		g := Build(mapID, segments)
+
+		if format == "dot" {
+			w.Header().Set("Content-Type", "text/vnd.graphviz")
+			g.WriteDOT(w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(g)
+	})
+}
@@ -0,0 +1,286 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// functionAliases maps deprecated function names to the functions
+// replacing them. Permissions, the read-only mode and bundles apply to the
+// replacing function, and responses carry a deprecation hint in their
+// metadata, see withDeprecation.
+var functionAliases = map[string]string{}
+
+func init() {
+	for alias, function := range map[string]string{
+		// Link and evidence functions of store.Adapter clients, before the
+		// AdapterV2 split
+		"SaveLink":      "CreateLink",
+		"LoadLink":      "GetLink",
+		"SaveEvidence":  "AddEvidence",
+		"LoadEvidences": "GetEvidences",
+
+		// Casing of the first releases
+		"GetMapIds": "GetMapIDs",
+	} {
+		registerAlias(alias, function)
+	}
+}
+
+// registerAlias makes a function callable under a deprecated name. It
+// panics if the function doesn't exist or the name is taken, since aliases
+// are registered at startup.
+func registerAlias(alias, function string) {
+	if _, ok := handlers[function]; !ok {
+		panic("alias " + alias + " of unknown function " + function)
+	}
+	if _, ok := handlers[alias]; ok {
+		panic("alias " + alias + " shadows a function")
+	}
+	if _, ok := functionAliases[alias]; ok {
+		panic("alias " + alias + " is already registered")
+	}
+	functionAliases[alias] = function
+}
+
+// resolveAlias returns the function called under a name
+func resolveAlias(function string) string {
+	if target, ok := functionAliases[function]; ok {
+		return target
+	}
+	return function
+}
+
+// requiredArgs is the minimum number of arguments of each function.
+// Calls with fewer arguments are rejected before the function runs. Every
+// function must be declared, init panics otherwise.
+var requiredArgs = map[string]int{
+	"GetSegment":             1,
+	"FindSegments":           1,
+	"FindMySegments":         0,
+	"GetMapIDs":              1,
+	"GetMaps":                1,
+	"ArchiveSegments":        0,
+	"SetFeature":             2,
+	"SetReadOnly":            1,
+	"SetQuota":               1,
+	"LegalHold":              3,
+	"ReleaseLegalHold":       3,
+	"PinSegment":             1,
+	"UnpinSegment":           1,
+	"CollectOrphanedMaps":    0,
+	"StartJob":               1,
+	"ContinueJob":            1,
+	"AddEvidence":            2,
+	"CreateLink":             1,
+	"GetLink":                1,
+	"GetEvidences":           1,
+	"RegisterWebhook":        2,
+	"DeleteWebhook":          2,
+	"GetWebhooks":            1,
+	"GetInfo":                0,
+	"GetProcessStats":        1,
+	"GetActivitySeries":      3,
+	"GetTagFacets":           1,
+	"DetectGaps":             1,
+	"GetMapDelta":            2,
+	"PutAttachmentHash":      2,
+	"GetAttachmentMeta":      2,
+	"SaveSegment":            1,
+	"SaveSegments":           1,
+	"CompensateSegment":      1,
+	"HasSegment":             1,
+	"DeleteSegment":          1,
+	"ApproveDeletion":        1,
+	"GetPendingDeletion":     1,
+	"SaveValue":              2,
+	"GetValue":               1,
+	"DeleteValue":            1,
+	"ReencryptProcess":       1,
+	"RedactSegmentState":     2,
+	"MirrorSegment":          3,
+	"RegisterActor":          2,
+	"CreateProcess":          1,
+	"GetProcess":             1,
+	"RichQuery":              1,
+	"RegisterDocType":        1,
+	"SaveDoc":                3,
+	"GetDoc":                 2,
+	"FindDocs":               2,
+	"ReadBundle":             1,
+	"GetSegmentInternal":     1,
+	"HasMapInternal":         1,
+	"TransferMapOwnership":   2,
+	"FreezeMap":              2,
+	"MergeMaps":              2,
+	"SetMapAlias":            2,
+	"GetMapByAlias":          1,
+	"GetSegmentByExternalID": 1,
+	"SetSegmentLabel":        2,
+	"UpdateSegmentMetaPatch": 2,
+	"GetSegmentMetaAudit":    1,
+	"AnnotateSegment":        3,
+	"AnnotateMap":            3,
+	"GetAnnotations":         2,
+	"OpenDispute":            2,
+	"ResolveDispute":         2,
+	"GetDispute":             1,
+	"Acknowledge":            1,
+	"GetAcknowledgments":     1,
+	"GetJobStatus":           1,
+	"GetQuota":               1,
+	"NotifyExpiringEvidence": 1,
+
+	"FindSegmentsWithExpiringEvidence": 1,
+}
+
+// MaxArgsBytes is the maximum total size of the arguments of a call.
+// Larger JSON arguments are rejected before they are decoded.
+const MaxArgsBytes = 1 << 20
+
+func init() {
+	for function := range handlers {
+		if _, ok := requiredArgs[function]; !ok {
+			panic("function " + function + " doesn't declare its required arguments")
+		}
+	}
+}
+
+// checkArgs checks a function is called with the arguments it requires and
+// that they fit in MaxArgsBytes
+func checkArgs(function string, args []string) error {
+	if required := requiredArgs[function]; len(args) < required {
+		return errors.New("Function " + function + " requires " + strconv.Itoa(required) + " arguments, got " + strconv.Itoa(len(args)))
+	}
+	size := 0
+	for _, arg := range args {
+		size += len(arg)
+	}
+	if size > MaxArgsBytes {
+		return errors.New("Arguments of " + function + " exceed " + strconv.Itoa(MaxArgsBytes) + " bytes")
+	}
+	return nil
+}
+
+// handler is a function of the chaincode
+type handler func(*SmartContract, shim.ChaincodeStubInterface, []string) sc.Response
+
+// handlers are the functions of the chaincode by name
+var handlers = map[string]handler{
+	"GetSegment":             (*SmartContract).GetSegment,
+	"FindSegments":           (*SmartContract).FindSegments,
+	"FindMySegments":         (*SmartContract).FindMySegments,
+	"GetMapIDs":              (*SmartContract).GetMapIDs,
+	"GetMaps":                (*SmartContract).GetMaps,
+	"ArchiveSegments":        (*SmartContract).ArchiveSegments,
+	"SetFeature":             (*SmartContract).SetFeature,
+	"SetReadOnly":            (*SmartContract).SetReadOnly,
+	"SetQuota":               (*SmartContract).SetQuota,
+	"LegalHold":              (*SmartContract).LegalHold,
+	"ReleaseLegalHold":       (*SmartContract).ReleaseLegalHold,
+	"PinSegment":             (*SmartContract).PinSegment,
+	"UnpinSegment":           (*SmartContract).UnpinSegment,
+	"CollectOrphanedMaps":    (*SmartContract).CollectOrphanedMaps,
+	"StartJob":               (*SmartContract).StartJob,
+	"ContinueJob":            (*SmartContract).ContinueJob,
+	"AddEvidence":            (*SmartContract).AddEvidence,
+	"CreateLink":             (*SmartContract).CreateLink,
+	"GetLink":                (*SmartContract).GetLink,
+	"GetEvidences":           (*SmartContract).GetEvidences,
+	"RegisterWebhook":        (*SmartContract).RegisterWebhook,
+	"DeleteWebhook":          (*SmartContract).DeleteWebhook,
+	"GetWebhooks":            (*SmartContract).GetWebhooks,
+	"GetInfo":                (*SmartContract).GetInfo,
+	"GetProcessStats":        (*SmartContract).GetProcessStats,
+	"GetActivitySeries":      (*SmartContract).GetActivitySeries,
+	"GetTagFacets":           (*SmartContract).GetTagFacets,
+	"DetectGaps":             (*SmartContract).DetectGaps,
+	"GetMapDelta":            (*SmartContract).GetMapDelta,
+	"PutAttachmentHash":      (*SmartContract).PutAttachmentHash,
+	"GetAttachmentMeta":      (*SmartContract).GetAttachmentMeta,
+	"SaveSegment":            (*SmartContract).SaveSegment,
+	"SaveSegments":           (*SmartContract).SaveSegments,
+	"CompensateSegment":      (*SmartContract).CompensateSegment,
+	"HasSegment":             (*SmartContract).HasSegment,
+	"DeleteSegment":          (*SmartContract).DeleteSegment,
+	"ApproveDeletion":        (*SmartContract).ApproveDeletion,
+	"GetPendingDeletion":     (*SmartContract).GetPendingDeletion,
+	"SaveValue":              (*SmartContract).SaveValue,
+	"GetValue":               (*SmartContract).GetValue,
+	"DeleteValue":            (*SmartContract).DeleteValue,
+	"ReencryptProcess":       (*SmartContract).ReencryptProcess,
+	"RedactSegmentState":     (*SmartContract).RedactSegmentState,
+	"MirrorSegment":          (*SmartContract).MirrorSegment,
+	"RegisterActor":          (*SmartContract).RegisterActor,
+	"CreateProcess":          (*SmartContract).CreateProcess,
+	"GetProcess":             (*SmartContract).GetProcess,
+	"RichQuery":              (*SmartContract).RichQuery,
+	"RegisterDocType":        (*SmartContract).RegisterDocType,
+	"SaveDoc":                (*SmartContract).SaveDoc,
+	"GetDoc":                 (*SmartContract).GetDoc,
+	"FindDocs":               (*SmartContract).FindDocs,
+	"ReadBundle":             (*SmartContract).ReadBundle,
+	"GetSegmentInternal":     (*SmartContract).GetSegmentInternal,
+	"HasMapInternal":         (*SmartContract).HasMapInternal,
+	"TransferMapOwnership":   (*SmartContract).TransferMapOwnership,
+	"FreezeMap":              (*SmartContract).FreezeMap,
+	"MergeMaps":              (*SmartContract).MergeMaps,
+	"SetMapAlias":            (*SmartContract).SetMapAlias,
+	"GetMapByAlias":          (*SmartContract).GetMapByAlias,
+	"GetSegmentByExternalID": (*SmartContract).GetSegmentByExternalID,
+	"SetSegmentLabel":        (*SmartContract).SetSegmentLabel,
+	"UpdateSegmentMetaPatch": (*SmartContract).UpdateSegmentMetaPatch,
+	"GetSegmentMetaAudit":    (*SmartContract).GetSegmentMetaAudit,
+	"AnnotateSegment":        (*SmartContract).AnnotateSegment,
+	"AnnotateMap":            (*SmartContract).AnnotateMap,
+	"GetAnnotations":         (*SmartContract).GetAnnotations,
+	"OpenDispute":            (*SmartContract).OpenDispute,
+	"ResolveDispute":         (*SmartContract).ResolveDispute,
+	"GetDispute":             (*SmartContract).GetDispute,
+	"Acknowledge":            (*SmartContract).Acknowledge,
+	"GetAcknowledgments":     (*SmartContract).GetAcknowledgments,
+	"GetJobStatus":           (*SmartContract).GetJobStatus,
+	"GetQuota":               (*SmartContract).GetQuota,
+
+	"FindSegmentsWithExpiringEvidence": (*SmartContract).FindSegmentsWithExpiringEvidence,
+	"NotifyExpiringEvidence":           (*SmartContract).NotifyExpiringEvidence,
+}
+
+// withDeprecation tells clients calling a deprecated function name which
+// function to call instead
+func withDeprecation(res sc.Response, function, replacement string) sc.Response {
+	if res.Status != shim.OK {
+		return res
+	}
+	meta := &ResponseMeta{}
+	if res.Message != "" {
+		if err := json.Unmarshal([]byte(res.Message), meta); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	meta.Deprecated = "Function " + function + " is deprecated, call " + replacement + " instead"
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	res.Message = string(metaBytes)
+	return res
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_FunctionAliases(t *testing.T) {
+	registerAlias("ArchiveSegmentsV0", "ArchiveSegments")
+	defer delete(functionAliases, "ArchiveSegmentsV0")
+
+	stub := newAdminStub(t)
+	link := testutil.Root("main").Build().Link
+	linkBytes, _ := json.Marshal(link)
+
+	// Old names dispatch to the functions replacing them
+	res := stub.Call("SaveLink", linkBytes)
+	meta := &ResponseMeta{}
+	json.Unmarshal([]byte(res.Message), meta)
+	if res.Status != shim.OK || string(res.Payload) != testutil.LinkHash(&link) || meta.Deprecated != "Function SaveLink is deprecated, call CreateLink instead" {
+		fmt.Println("Got response", res.Status, string(res.Payload), res.Message)
+		t.FailNow()
+	}
+	res = stub.Call("LoadLink", res.Payload)
+	meta = &ResponseMeta{}
+	json.Unmarshal([]byte(res.Message), meta)
+	got := cs.Link{}
+	json.Unmarshal(res.Payload, &got)
+	if res.Status != shim.OK || !reflect.DeepEqual(got, link) || meta.Deprecated == "" || meta.Checksum == "" || meta.Height == 0 {
+		fmt.Println("Got response", res.Status, res.Message)
+		t.FailNow()
+	}
+
+	// Permissions apply to the replacing function
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "ArchiveSegmentsV0"); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+	stub.InvokeError(t, "LoadLinkV1", []byte(testutil.LinkHash(&link)))
+}
+
+func TestPop_RegisterAlias(t *testing.T) {
+	for _, alias := range [][2]string{
+		{"GetSegmentV0", "Missing"},
+		{"GetLink", "GetSegment"},
+		{"SaveLink", "CreateLink"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					fmt.Println("Registering", alias, "should panic")
+					t.FailNow()
+				}
+			}()
+			registerAlias(alias[0], alias[1])
+		}()
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Legal holds block the redaction, deletion and archival of the segments
+// of a process or a map until they are released. A target can be held by
+// several cases.
+const (
+	// ObjectTypeHold is used in the CouchDB documents of legal holds
+	ObjectTypeHold = "hold"
+
+	// HoldScopeProcess holds the segments of a process
+	HoldScopeProcess = "process"
+
+	// HoldScopeMap holds the segments of a map
+	HoldScopeMap = "map"
+
+	// LegalHoldsKey is the meta key of the holds returned by GetSegment
+	LegalHoldsKey = "legalHolds"
+)
+
+// HoldDoc is used to store legal holds in CouchDB
+type HoldDoc struct {
+	ObjectType string     `json:"docType"`
+	Scope      string     `json:"scope"`
+	Target     string     `json:"target"`
+	CaseRef    string     `json:"caseRef"`
+	HeldBy     *Submitter `json:"heldBy,omitempty"`
+	HeldAt     int64      `json:"heldAt"`
+}
+
+func getHoldKey(stub shim.ChaincodeStubInterface, scope, target, caseRef string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeHold, []string{scope, target, caseRef})
+}
+
+func parseHoldArgs(args []string) error {
+	if len(args) < 3 || args[1] == "" || args[2] == "" {
+		return errors.New("Scope, target and case reference are required")
+	}
+	if args[0] != HoldScopeProcess && args[0] != HoldScopeMap {
+		return errors.New("Scope should be " + HoldScopeProcess + " or " + HoldScopeMap)
+	}
+	return nil
+}
+
+// getHolds returns the holds matching a partial key
+func getHolds(stub shim.ChaincodeStubInterface, attributes []string) ([]*HoldDoc, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ObjectTypeHold, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var holds []*HoldDoc
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		hold := &HoldDoc{}
+		if err := json.Unmarshal(queryResponse.Value, hold); err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, nil
+}
+
+// getSegmentHolds returns the holds covering a segment
+func getSegmentHolds(stub shim.ChaincodeStubInterface, segment *cs.Segment) ([]*HoldDoc, error) {
+	holds, err := getHolds(stub, []string{HoldScopeProcess, segment.Link.GetProcess()})
+	if err != nil {
+		return nil, err
+	}
+	mapHolds, err := getHolds(stub, []string{HoldScopeMap, segment.Link.GetMapID()})
+	if err != nil {
+		return nil, err
+	}
+	return append(holds, mapHolds...), nil
+}
+
+// checkNotHeld rejects changes to a segment under legal hold
+func checkNotHeld(stub shim.ChaincodeStubInterface, segment *cs.Segment) error {
+	holds, err := getSegmentHolds(stub, segment)
+	if err != nil {
+		return err
+	}
+	if len(holds) > 0 {
+		return errors.New("Segment is under legal hold for case " + holds[0].CaseRef)
+	}
+	return nil
+}
+
+// checkLinkHashNotHeld is checkNotHeld for a segment that may not exist
+func checkLinkHashNotHeld(stub shim.ChaincodeStubInterface, linkHash string) error {
+	segmentDocBytes, _, err := getSegmentDocBytes(stub, linkHash)
+	if err != nil || segmentDocBytes == nil {
+		return err
+	}
+	segmentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+		return err
+	}
+	return checkNotHeld(stub, &segmentDoc.Segment)
+}
+
+// getMapHolds returns the holds covering the segments of a map
+func getMapHolds(stub shim.ChaincodeStubInterface, mapDoc *MapDoc) ([]*HoldDoc, error) {
+	holds, err := getHolds(stub, []string{HoldScopeProcess, mapDoc.Process})
+	if err != nil {
+		return nil, err
+	}
+	mapHolds, err := getHolds(stub, []string{HoldScopeMap, mapDoc.ID})
+	if err != nil {
+		return nil, err
+	}
+	return append(holds, mapHolds...), nil
+}
+
+// checkMapNotHeld rejects changes to a map whose segments are under legal
+// hold
+func checkMapNotHeld(stub shim.ChaincodeStubInterface, mapDoc *MapDoc) error {
+	holds, err := getMapHolds(stub, mapDoc)
+	if err != nil {
+		return err
+	}
+	if len(holds) > 0 {
+		return errors.New("Map " + mapDoc.ID + " is under legal hold for case " + holds[0].CaseRef)
+	}
+	return nil
+}
+
+// heldTargets returns the held processes and maps, to exclude them from
+// archival queries
+func heldTargets(stub shim.ChaincodeStubInterface) ([]string, []string, error) {
+	holds, err := getHolds(stub, []string{})
+	if err != nil {
+		return nil, nil, err
+	}
+	processes, mapIDs := []string{}, []string{}
+	for _, hold := range holds {
+		if hold.Scope == HoldScopeProcess && !containsString(processes, hold.Target) {
+			processes = append(processes, hold.Target)
+		}
+		if hold.Scope == HoldScopeMap && !containsString(mapIDs, hold.Target) {
+			mapIDs = append(mapIDs, hold.Target)
+		}
+	}
+	return processes, mapIDs, nil
+}
+
+// attachHolds adds the holds covering a segment to its meta. It tells
+// whether the segment changed.
+func attachHolds(stub shim.ChaincodeStubInterface, segment *cs.Segment) (bool, error) {
+	holds, err := getSegmentHolds(stub, segment)
+	if err != nil || len(holds) == 0 {
+		return false, err
+	}
+	segment.Meta[LegalHoldsKey] = holds
+	return true, nil
+}
+
+// LegalHold places a legal hold on the segments of a process or a map.
+// Arguments are the scope, process or map, the process name or map ID and
+// the case reference.
+func (s *SmartContract) LegalHold(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if err := parseHoldArgs(args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := getHoldKey(stub, args[0], args[1], args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	existing, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("Case " + args[2] + " already holds " + args[0] + " " + args[1])
+	}
+
+	hold := &HoldDoc{ObjectType: ObjectTypeHold, Scope: args[0], Target: args[1], CaseRef: args[2]}
+	if hold.HeldBy, err = getSubmitter(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	hold.HeldAt = now.UnixNano() / int64(time.Millisecond)
+
+	holdBytes, err := json.Marshal(hold)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, holdBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(holdBytes)
+}
+
+// ReleaseLegalHold releases a legal hold. It takes the same arguments as
+// LegalHold.
+func (s *SmartContract) ReleaseLegalHold(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if err := parseHoldArgs(args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := getHoldKey(stub, args[0], args[1], args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	existing, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing == nil {
+		return shim.Error("Legal hold not found")
+	}
+	if err := stub.DelState(key); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_LegalHold(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"admins":["AdminMSP"],"coldAfterDays":30}`)})
+
+	day := int64(24 * 3600)
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 100 * day}
+	held, other := testutil.Root("main").WithState("name", "x").Build(), testutil.Root("main").Build()
+	stub.SaveSegment(t, held, other)
+
+	stub.Invoke(t, "LegalHold", []byte("map"), []byte(held.Link.GetMapID()), []byte("case-1"))
+	stub.InvokeError(t, "LegalHold", []byte("map"), []byte(held.Link.GetMapID()), []byte("case-1"))
+	stub.InvokeError(t, "LegalHold", []byte("tenant"), []byte("x"), []byte("case-1"))
+
+	segment := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(held.GetLinkHashString())), segment)
+	holds, _ := segment.Meta[LegalHoldsKey].([]interface{})
+	if len(holds) != 1 {
+		fmt.Println("GetSegment should return the holds, got", segment.Meta)
+		t.FailNow()
+	}
+
+	stub.Transient = map[string][]byte{TransientRedactionSalt: []byte("0123456789abcdef")}
+	for _, message := range []string{
+		stub.InvokeError(t, "DeleteSegment", []byte(held.GetLinkHashString())),
+		stub.InvokeError(t, "RedactSegmentState", []byte(held.GetLinkHashString()), []byte(`["name"]`)),
+	} {
+		if message != "Segment is under legal hold for case case-1" {
+			fmt.Println("Got error", message)
+			t.FailNow()
+		}
+	}
+
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 140 * day}
+	result := &ArchiveResult{}
+	json.Unmarshal(stub.Invoke(t, "ArchiveSegments"), result)
+	if result.Archived != 1 || result.More || stub.State[held.GetLinkHashString()] == nil {
+		fmt.Println("Held segments should not be archived", result)
+		t.FailNow()
+	}
+
+	stub.Invoke(t, "ReleaseLegalHold", []byte("map"), []byte(held.Link.GetMapID()), []byte("case-1"))
+	stub.InvokeError(t, "ReleaseLegalHold", []byte("map"), []byte(held.Link.GetMapID()), []byte("case-1"))
+	stub.Invoke(t, "DeleteSegment", []byte(held.GetLinkHashString()))
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "LegalHold", []byte("process"), []byte("main"), []byte("case-2")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
+
+func TestPop_LegalHoldMaps(t *testing.T) {
+	stub := newAdminStub(t)
+	orphaned, source, target := testutil.Root("main").Build(), testutil.Root("main").Build(), testutil.Root("main").Build()
+	stub.SaveSegment(t, orphaned, source, target)
+	stub.Invoke(t, "DeleteSegment", []byte(orphaned.GetLinkHashString()))
+
+	// Held maps are not collected
+	stub.Invoke(t, "LegalHold", []byte("map"), []byte(orphaned.Link.GetMapID()), []byte("case-1"))
+	result := &GCResult{}
+	json.Unmarshal(stub.Invoke(t, "CollectOrphanedMaps"), result)
+	if len(result.Deleted) != 0 || stub.State[orphaned.Link.GetMapID()] == nil {
+		fmt.Println("Held map should not be collected", result)
+		t.FailNow()
+	}
+	stub.Invoke(t, "ReleaseLegalHold", []byte("map"), []byte(orphaned.Link.GetMapID()), []byte("case-1"))
+	json.Unmarshal(stub.Invoke(t, "CollectOrphanedMaps"), result)
+	if len(result.Deleted) != 1 {
+		fmt.Println("Released map should be collected", result)
+		t.FailNow()
+	}
+
+	// Held maps are not merged
+	stub.Invoke(t, "LegalHold", []byte("process"), []byte("main"), []byte("case-2"))
+	if message := stub.InvokeError(t, "MergeMaps", []byte(source.Link.GetMapID()), []byte(target.Link.GetMapID())); message != "Map "+source.Link.GetMapID()+" is under legal hold for case case-2" {
+		fmt.Println("Got error", message)
+		t.FailNow()
+	}
+	stub.Invoke(t, "ReleaseLegalHold", []byte("process"), []byte("main"), []byte("case-2"))
+	stub.Invoke(t, "MergeMaps", []byte(source.Link.GetMapID()), []byte(target.Link.GetMapID()))
+}
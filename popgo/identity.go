@@ -0,0 +1,140 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Submitter identifies the creator of the transaction that saved a segment.
+// It is stored in segment.meta.submitter.
+type Submitter struct {
+	MSPID   string `json:"mspId"`
+	Subject string `json:"subject"`
+}
+
+// getCreatorIdentity returns the serialized identity of the creator of the
+// transaction
+func getCreatorIdentity(stub shim.ChaincodeStubInterface) (*msp.SerializedIdentity, error) {
+	creator, err := stub.GetCreator()
+	if err != nil {
+		return nil, err
+	}
+	identity := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(creator, identity); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// getCreatorMSPID returns the MSP ID of the creator of the transaction
+func getCreatorMSPID(stub shim.ChaincodeStubInterface) (string, error) {
+	identity, err := getCreatorIdentity(stub)
+	if err != nil {
+		return "", err
+	}
+	return identity.Mspid, nil
+}
+
+// attributesOID is the certificate extension where Fabric CA stores
+// attributes
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// getCreatorCertificate returns the certificate of the creator of the
+// transaction, or nil if the transaction has no creator
+func getCreatorCertificate(stub shim.ChaincodeStubInterface) (*x509.Certificate, string, error) {
+	identity, err := getCreatorIdentity(stub)
+	if err != nil {
+		return nil, "", err
+	}
+	if identity.Mspid == "" {
+		return nil, "", nil
+	}
+	block, _ := pem.Decode(identity.IdBytes)
+	if block == nil {
+		return nil, "", errors.New("Could not decode creator certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, "", err
+	}
+	return cert, identity.Mspid, nil
+}
+
+// getSubmitter returns the MSP ID and certificate common name of the
+// creator of the transaction, or nil if the transaction has no creator
+func getSubmitter(stub shim.ChaincodeStubInterface) (*Submitter, error) {
+	cert, mspID, err := getCreatorCertificate(stub)
+	if err != nil || cert == nil {
+		return nil, err
+	}
+	return &Submitter{MSPID: mspID, Subject: cert.Subject.CommonName}, nil
+}
+
+// getCreatorAttributes returns the Fabric CA attributes of the certificate
+// of the creator of the transaction
+func getCreatorAttributes(stub shim.ChaincodeStubInterface) (map[string]string, error) {
+	cert, _, err := getCreatorCertificate(stub)
+	if err != nil || cert == nil {
+		return nil, err
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(attributesOID) {
+			continue
+		}
+		attrs := struct {
+			Attrs map[string]string `json:"attrs"`
+		}{}
+		if err := json.Unmarshal(ext.Value, &attrs); err != nil {
+			return nil, errors.New("Could not parse certificate attributes")
+		}
+		return attrs.Attrs, nil
+	}
+	return nil, nil
+}
+
+// FindMySegments returns the segments that match the segment filter and
+// were submitted by the creator of the transaction
+func (s *SmartContract) FindMySegments(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	filter := "{}"
+	if len(args) > 0 && args[0] != "" {
+		filter = args[0]
+	}
+	segmentQuery, err := parseSegmentQuery([]byte(filter))
+	if err != nil {
+		return shim.Error("Segment filter format incorrect")
+	}
+
+	submitter, err := getSubmitter(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if submitter == nil {
+		return shim.Error(ErrUnauthorized.Error())
+	}
+	segmentQuery.Selector.SubmitterMSPID = submitter.MSPID
+	segmentQuery.Selector.SubmitterSubject = submitter.Subject
+
+	return s.findSegments(stub, segmentQuery)
+}
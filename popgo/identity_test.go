@@ -0,0 +1,76 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_SaveSegmentSubmitter(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	stub.Creator = testutil.NewIdentity("Org1MSP", "alice")
+	segment := testutil.Root("main").Build()
+	stub.SaveSegment(t, segment)
+
+	stored := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(segment.GetLinkHashString())), stored)
+	submitter, _ := stored.Meta["submitter"].(map[string]interface{})
+	if submitter["mspId"] != "Org1MSP" || submitter["subject"] != "alice" {
+		fmt.Println("Submitter not stamped", stored.Meta)
+		t.FailNow()
+	}
+}
+
+func TestPop_FindMySegments(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	alice := testutil.NewIdentity("Org1MSP", "alice")
+	bob := testutil.NewIdentity("Org1MSP", "bob")
+	carol := testutil.NewIdentity("Org2MSP", "alice")
+
+	root := testutil.Root("main").Build()
+	stub.Creator = alice
+	stub.SaveSegment(t, root, testutil.Root("other").Build())
+	stub.Creator = bob
+	stub.SaveSegment(t, testutil.Child(root).Build())
+	stub.Creator = carol
+	stub.SaveSegment(t, testutil.Root("main").Build())
+
+	for _, test := range []struct {
+		creator  []byte
+		filter   string
+		expected int
+	}{
+		{alice, "", 2},
+		{alice, `{"process":"main"}`, 1},
+		{bob, "{}", 1},
+		{carol, "{}", 1},
+	} {
+		stub.Creator = test.creator
+		var segments cs.SegmentSlice
+		json.Unmarshal(stub.Invoke(t, "FindMySegments", []byte(test.filter)), &segments)
+		if len(segments) != test.expected {
+			fmt.Println("FindMySegments returned", len(segments), "segments, expected", test.expected)
+			t.FailNow()
+		}
+	}
+
+	stub.Creator = nil
+	stub.InvokeError(t, "FindMySegments")
+}
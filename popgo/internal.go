@@ -0,0 +1,103 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// The Internal functions are meant to be called by other chaincodes of the
+// channel with InvokeChaincode, so business contracts can check provenance
+// recorded by pop before acting. Their responses are self-describing: a
+// missing segment or map is a successful response with found set to false
+// rather than an empty payload or an error message to parse.
+
+// SegmentLookup is returned by GetSegmentInternal
+type SegmentLookup struct {
+	Found    bool        `json:"found"`
+	LinkHash string      `json:"linkHash"`
+	MapID    string      `json:"mapId,omitempty"`
+	Process  string      `json:"process,omitempty"`
+	Segment  *cs.Segment `json:"segment,omitempty"`
+}
+
+// MapLookup is returned by HasMapInternal
+type MapLookup struct {
+	Found        bool   `json:"found"`
+	MapID        string `json:"mapId"`
+	Process      string `json:"process,omitempty"`
+	SegmentCount int    `json:"segmentCount"`
+}
+
+// GetSegmentInternal looks up a segment for another chaincode
+func (s *SmartContract) GetSegmentInternal(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Link hash is required")
+	}
+	res := s.GetSegment(stub, args)
+	if res.Status != shim.OK {
+		return res
+	}
+	lookup := SegmentLookup{LinkHash: args[0]}
+	if res.Payload != nil {
+		segment := &cs.Segment{}
+		if err := json.Unmarshal(res.Payload, segment); err != nil {
+			return shim.Error(err.Error())
+		}
+		lookup.Found = true
+		lookup.MapID = segment.Link.GetMapID()
+		lookup.Process = segment.Link.GetProcess()
+		lookup.Segment = segment
+	}
+	lookupBytes, err := json.Marshal(lookup)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(lookupBytes)
+}
+
+// HasMapInternal looks up a map for another chaincode
+func (s *SmartContract) HasMapInternal(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Map ID is required")
+	}
+	mapDoc, err := getMap(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// Maps of other tenants are reported missing
+	if err := checkMapTenant(stub, args[0]); err == ErrUnauthorized {
+		mapDoc = nil
+	} else if err != nil {
+		return shim.Error(err.Error())
+	}
+	lookup := MapLookup{MapID: args[0]}
+	if mapDoc != nil {
+		lookup.Found = true
+		lookup.Process = mapDoc.Process
+		if lookup.SegmentCount, err = getMapCounter(stub, args[0], MapCounterSegments); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	lookupBytes, err := json.Marshal(lookup)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(lookupBytes)
+}
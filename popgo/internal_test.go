@@ -0,0 +1,57 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_InternalReads(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segments := testutil.Chain("main", 2)
+	stub.SaveSegment(t, segments...)
+	linkHash := segments[1].GetLinkHashString()
+	mapID := segments[0].Link.GetMapID()
+
+	segmentLookup := &SegmentLookup{}
+	json.Unmarshal(stub.Invoke(t, "GetSegmentInternal", []byte(linkHash)), segmentLookup)
+	if !segmentLookup.Found || segmentLookup.MapID != mapID || segmentLookup.Segment.GetLinkHashString() != linkHash {
+		fmt.Println("Got segment lookup", segmentLookup)
+		t.FailNow()
+	}
+	segmentLookup = &SegmentLookup{}
+	json.Unmarshal(stub.Invoke(t, "GetSegmentInternal", []byte("unknown")), segmentLookup)
+	if segmentLookup.Found || segmentLookup.LinkHash != "unknown" {
+		fmt.Println("Got segment lookup", segmentLookup)
+		t.FailNow()
+	}
+
+	mapLookup := &MapLookup{}
+	json.Unmarshal(stub.Invoke(t, "HasMapInternal", []byte(mapID)), mapLookup)
+	if !mapLookup.Found || mapLookup.Process != "main" || mapLookup.SegmentCount != 2 {
+		fmt.Println("Got map lookup", mapLookup)
+		t.FailNow()
+	}
+	mapLookup = &MapLookup{}
+	json.Unmarshal(stub.Invoke(t, "HasMapInternal", []byte(linkHash)), mapLookup)
+	if mapLookup.Found {
+		fmt.Println("Segments should not be found as maps")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ObjectTypeJob is used in the CouchDB documents of jobs
+const ObjectTypeJob = "job"
+
+// Jobs run operations that can't finish in one transaction. StartJob
+// persists the job with an empty cursor and every ContinueJob transaction
+// processes the next bounded chunk, until the job is done.
+const (
+	// DefaultJobChunkSize is the number of items processed by ContinueJob
+	// when no chunk size is given
+	DefaultJobChunkSize = 50
+
+	// MaxJobChunkSize is the maximum number of items processed by a
+	// ContinueJob transaction
+	MaxJobChunkSize = 100
+)
+
+// JobDoc is used to store jobs in CouchDB
+type JobDoc struct {
+	ObjectType string     `json:"docType"`
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Args       []string   `json:"args"`
+	Cursor     string     `json:"cursor,omitempty"`
+	Processed  int        `json:"processed"`
+	Chunks     int        `json:"chunks"`
+	Done       bool       `json:"done"`
+	StartedBy  *Submitter `json:"startedBy,omitempty"`
+	StartedAt  int64      `json:"startedAt"`
+	UpdatedAt  int64      `json:"updatedAt"`
+}
+
+// jobKind runs the chunks of a kind of job
+type jobKind struct {
+	// args is the number of arguments required by StartJob
+	args int
+
+	// step processes up to chunkSize items after the cursor of the job. It
+	// returns the next cursor, how many items were processed and whether
+	// the job is done.
+	step func(stub shim.ChaincodeStubInterface, job *JobDoc, chunkSize int) (string, int, bool, error)
+}
+
+var jobKinds = map[string]jobKind{
+	"CollectOrphanedMaps": {args: 0, step: collectOrphanedMapsStep},
+	"ReencryptProcess":    {args: 1, step: reencryptProcessStep},
+	"MarkMergedSegments":  {args: 2, step: markMergedSegmentsStep},
+}
+
+func collectOrphanedMapsStep(stub shim.ChaincodeStubInterface, job *JobDoc, chunkSize int) (string, int, bool, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return "", 0, false, err
+	}
+	result, err := collectOrphanedMaps(stub, config, job.Cursor, chunkSize)
+	if err != nil {
+		return "", 0, false, err
+	}
+	return result.Cursor, result.Scanned, result.Cursor == "", nil
+}
+
+// reencryptProcessStep needs the DECKEY and ENCKEY transient keys in every
+// ContinueJob transaction. Re-encrypted segments no longer match the query
+// so it doesn't use the cursor.
+func reencryptProcessStep(stub shim.ChaincodeStubInterface, job *JobDoc, chunkSize int) (string, int, bool, error) {
+	rotation, n, err := reencryptProcess(stub, job.Args[0], chunkSize)
+	if err != nil {
+		return "", 0, false, err
+	}
+	return "", n, rotation.Done, nil
+}
+
+func getJobKey(stub shim.ChaincodeStubInterface, id string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeJob, []string{id})
+}
+
+func getJob(stub shim.ChaincodeStubInterface, id string) (*JobDoc, error) {
+	key, err := getJobKey(stub, id)
+	if err != nil {
+		return nil, err
+	}
+	jobBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if jobBytes == nil {
+		return nil, errors.New("Job " + id + " not found")
+	}
+	job := &JobDoc{}
+	if err := json.Unmarshal(jobBytes, job); err != nil {
+		return nil, errors.New("Could not parse job")
+	}
+	return job, nil
+}
+
+func saveJob(stub shim.ChaincodeStubInterface, job *JobDoc) ([]byte, error) {
+	key, err := getJobKey(stub, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	jobBytes, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	return jobBytes, stub.PutState(key, jobBytes)
+}
+
+// StartJob creates a job. Arguments are the kind of job, like
+// CollectOrphanedMaps or ReencryptProcess, and its arguments. The ID of the
+// job is the transaction ID.
+func (s *SmartContract) StartJob(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Job kind is required")
+	}
+	kind, ok := jobKinds[args[0]]
+	if !ok {
+		return shim.Error("Unknown job kind " + args[0])
+	}
+	if len(args)-1 != kind.args {
+		return shim.Error("Job " + args[0] + " requires " + strconv.Itoa(kind.args) + " arguments")
+	}
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	job, err := startJob(stub, args[0], args[1:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	jobBytes, err := json.Marshal(job)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(jobBytes)
+}
+
+// startJob saves a new job with the transaction ID as ID
+func startJob(stub shim.ChaincodeStubInterface, kind string, args []string) (*JobDoc, error) {
+	now, err := txTime(stub)
+	if err != nil {
+		return nil, err
+	}
+	job := &JobDoc{
+		ObjectType: ObjectTypeJob,
+		ID:         stub.GetTxID(),
+		Kind:       kind,
+		Args:       append([]string{}, args...),
+		StartedAt:  now.UnixNano() / int64(time.Millisecond),
+	}
+	job.UpdatedAt = job.StartedAt
+	if job.StartedBy, err = getSubmitter(stub); err != nil {
+		return nil, err
+	}
+	if _, err := saveJob(stub, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ContinueJob processes the next chunk of a job. Arguments are the job ID
+// and an optional chunk size. It sets a jobProgress event so runners can
+// continue the job until it is done.
+func (s *SmartContract) ContinueJob(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Job ID is required")
+	}
+	chunkSize := DefaultJobChunkSize
+	if len(args) > 1 && args[1] != "" {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > MaxJobChunkSize {
+			return shim.Error("Chunk size should be between 1 and " + strconv.Itoa(MaxJobChunkSize))
+		}
+		chunkSize = n
+	}
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	job, err := getJob(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if job.Done {
+		return shim.Error("Job " + job.ID + " is done")
+	}
+	cursor, n, done, err := jobKinds[job.Kind].step(stub, job, chunkSize)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	job.Cursor = cursor
+	job.Processed += n
+	job.Chunks++
+	job.Done = done
+	job.UpdatedAt = now.UnixNano() / int64(time.Millisecond)
+
+	jobBytes, err := saveJob(stub, job)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.SetEvent("jobProgress", jobBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(jobBytes)
+}
+
+// GetJobStatus returns a job with its progress
+func (s *SmartContract) GetJobStatus(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Job ID is required")
+	}
+	job, err := getJob(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	jobBytes, err := json.Marshal(job)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(jobBytes, nil)
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_Jobs(t *testing.T) {
+	stub := newAdminStub(t)
+	kept, orphaned := testutil.Root("main").Build(), testutil.Root("main").Build()
+	stub.SaveSegment(t, kept, orphaned)
+	stub.Invoke(t, "DeleteSegment", []byte(orphaned.GetLinkHashString()))
+
+	job := &JobDoc{}
+	json.Unmarshal(stub.Invoke(t, "StartJob", []byte("CollectOrphanedMaps")), job)
+	if job.ID == "" || job.Done || job.StartedBy == nil {
+		fmt.Println("Got job", job)
+		t.FailNow()
+	}
+	for i := 0; !job.Done; i++ {
+		if i > 2 {
+			fmt.Println("Job should be done after 2 chunks")
+			t.FailNow()
+		}
+		json.Unmarshal(stub.Invoke(t, "ContinueJob", []byte(job.ID), []byte("1")), job)
+		if stub.EventName != "jobProgress" {
+			fmt.Println("Got event", stub.EventName)
+			t.FailNow()
+		}
+	}
+	status := &JobDoc{}
+	json.Unmarshal(stub.Invoke(t, "GetJobStatus", []byte(job.ID)), status)
+	if status.Processed != 2 || status.Chunks != 2 || !status.Done {
+		fmt.Println("Got status", status)
+		t.FailNow()
+	}
+	if stub.State[orphaned.Link.GetMapID()] != nil || stub.State[kept.Link.GetMapID()] == nil {
+		fmt.Println("Only the orphaned map should be deleted")
+		t.FailNow()
+	}
+
+	stub.InvokeError(t, "ContinueJob", []byte(job.ID))
+	stub.InvokeError(t, "ContinueJob", []byte("missing"))
+	stub.InvokeError(t, "StartJob", []byte("RepairEverything"))
+	stub.InvokeError(t, "StartJob", []byte("ReencryptProcess"))
+
+	json.Unmarshal(stub.Invoke(t, "StartJob", []byte("ReencryptProcess"), []byte("main")), job)
+	if message := stub.InvokeError(t, "ContinueJob", []byte(job.ID)); message != "Both DECKEY and ENCKEY are required" {
+		fmt.Println("Got error", message)
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "StartJob", []byte("CollectOrphanedMaps")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
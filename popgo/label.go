@@ -0,0 +1,227 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Segments can be given a sensitivity label with SetSegmentLabel. The
+// classification of the config tells, for each label, which clearances
+// see the segments in full and which see them without their link state.
+// Other callers are denied: GetSegment fails and FindSegments leaves the
+// segments out. Admins always see segments in full.
+//
+// Fabric 1.0 has no key level metadata (SetStateMetadata came with 1.2),
+// so labels are stored in their own keys.
+const (
+	// ObjectTypeLabel is used in the CouchDB documents of segment labels
+	ObjectTypeLabel = "label"
+
+	// AttributeClearance is the certificate attribute holding the
+	// clearance of the caller
+	AttributeClearance = "pop.clearance"
+
+	// ClassifiedKey is the meta key replacing the link state of redacted
+	// segments
+	ClassifiedKey = "classified"
+)
+
+// Access levels of a caller to a labeled segment
+const (
+	AccessFull     = "full"
+	AccessRedacted = "redacted"
+	AccessDenied   = "denied"
+)
+
+// LabelPolicy lists the clearances that can read the segments with a label
+type LabelPolicy struct {
+	Full     []string `json:"full,omitempty"`
+	Redacted []string `json:"redacted,omitempty"`
+}
+
+// LabelDoc is used to store segment labels in CouchDB
+type LabelDoc struct {
+	ObjectType string     `json:"docType"`
+	LinkHash   string     `json:"linkHash"`
+	Label      string     `json:"label"`
+	LabeledBy  *Submitter `json:"labeledBy,omitempty"`
+	LabeledAt  int64      `json:"labeledAt"`
+}
+
+// Classified replaces the link state of segments returned redacted
+type Classified struct {
+	Label     string `json:"label"`
+	StateHash string `json:"stateHash"`
+}
+
+func validateClassification(classification map[string]*LabelPolicy) error {
+	for label, policy := range classification {
+		if label == "" || policy == nil {
+			return errors.New("Classification labels should have a name and a policy")
+		}
+	}
+	return nil
+}
+
+func getLabelKey(stub shim.ChaincodeStubInterface, linkHash string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeLabel, []string{linkHash})
+}
+
+// labelAccess decides what a caller sees of labeled segments
+type labelAccess struct {
+	classification map[string]*LabelPolicy
+	clearance      string
+}
+
+// newLabelAccess returns the label access of the caller, nil if it sees
+// every segment in full
+func newLabelAccess(stub shim.ChaincodeStubInterface, config *Config) (*labelAccess, error) {
+	if len(config.Classification) == 0 || requireCreatorIn(stub, config.Admins) == nil {
+		return nil, nil
+	}
+	attrs, err := getCreatorAttributes(stub)
+	if err != nil {
+		return nil, err
+	}
+	return &labelAccess{classification: config.Classification, clearance: attrs[AttributeClearance]}, nil
+}
+
+// check returns the access level of the caller to a segment and its label
+func (a *labelAccess) check(stub shim.ChaincodeStubInterface, linkHash string) (string, string, error) {
+	if a == nil {
+		return AccessFull, "", nil
+	}
+	key, err := getLabelKey(stub, linkHash)
+	if err != nil {
+		return "", "", err
+	}
+	labelBytes, err := stub.GetState(key)
+	if err != nil {
+		return "", "", err
+	}
+	if labelBytes == nil {
+		return AccessFull, "", nil
+	}
+	labelDoc := &LabelDoc{}
+	if err := json.Unmarshal(labelBytes, labelDoc); err != nil {
+		return "", "", err
+	}
+	policy := a.classification[labelDoc.Label]
+	switch {
+	case policy != nil && containsString(policy.Full, a.clearance):
+		return AccessFull, labelDoc.Label, nil
+	case policy != nil && containsString(policy.Redacted, a.clearance):
+		return AccessRedacted, labelDoc.Label, nil
+	}
+	return AccessDenied, labelDoc.Label, nil
+}
+
+// classifyRows flags the query rows the caller can't see in full
+func classifyRows(stub shim.ChaincodeStubInterface, config *Config, rows segmentRows) error {
+	access, err := newLabelAccess(stub, config)
+	if err != nil || access == nil {
+		return err
+	}
+	for _, row := range rows {
+		level, label, err := access.check(stub, row.ID)
+		if err != nil {
+			return err
+		}
+		switch level {
+		case AccessRedacted:
+			row.label = label
+		case AccessDenied:
+			row.denied = true
+		}
+	}
+	return nil
+}
+
+// redactClassified replaces the link state of a segment by its hash
+func redactClassified(segment *cs.Segment, label string) error {
+	stateBytes, err := json.Marshal(segment.Link.State)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(stateBytes)
+	segment.Meta[ClassifiedKey] = Classified{
+		Label:     label,
+		StateHash: hex.EncodeToString(hash[:]),
+	}
+	segment.Link.State = map[string]interface{}{}
+	return nil
+}
+
+// SetSegmentLabel labels a segment. Arguments are the link hash and a label
+// of the classification, an empty label removes the label.
+func (s *SmartContract) SetSegmentLabel(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 || args[0] == "" {
+		return shim.Error("Link hash and label are required")
+	}
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := getLabelKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if args[1] == "" {
+		if err := stub.DelState(key); err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(nil)
+	}
+	if _, ok := config.Classification[args[1]]; !ok {
+		return shim.Error("Label " + args[1] + " is not in the classification")
+	}
+	segmentDocBytes, _, err := getSegmentDocBytes(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if segmentDocBytes == nil {
+		return shim.Error("Segment not found")
+	}
+
+	labelDoc := &LabelDoc{ObjectType: ObjectTypeLabel, LinkHash: args[0], Label: args[1]}
+	if labelDoc.LabeledBy, err = getSubmitter(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	labelDoc.LabeledAt = now.UnixNano() / int64(time.Millisecond)
+	labelBytes, err := json.Marshal(labelDoc)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, labelBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(labelBytes)
+}
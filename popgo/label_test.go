@@ -0,0 +1,97 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_SegmentLabels(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"admins":["AdminMSP"],"classification":{"secret":{"full":["high"],"redacted":["low"]}}}`)})
+	secret := testutil.Root("main").WithState("amount", 42.0).Build()
+	stub.SaveSegment(t, secret, testutil.Root("main").Build())
+	linkHash := []byte(secret.GetLinkHashString())
+
+	stub.InvokeError(t, "SetSegmentLabel", linkHash, []byte("unknown"))
+	stub.Invoke(t, "SetSegmentLabel", linkHash, []byte("secret"))
+
+	for _, test := range []struct {
+		clearance string
+		level     string
+	}{
+		{"high", AccessFull},
+		{"low", AccessRedacted},
+		{"", AccessDenied},
+	} {
+		stub.Creator = testutil.NewIdentityWithAttributes("UserMSP", "user", map[string]string{AttributeClearance: test.clearance})
+
+		var found cs.SegmentSlice
+		json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"process":"main"}`)), &found)
+		if test.level == AccessDenied {
+			if message := stub.InvokeError(t, "GetSegment", linkHash); message != ErrUnauthorized.Error() || len(found) != 1 {
+				fmt.Println("Clearance", test.clearance, "should not see the segment", message, len(found))
+				t.FailNow()
+			}
+			continue
+		}
+
+		segment := &cs.Segment{}
+		json.Unmarshal(stub.Invoke(t, "GetSegment", linkHash), segment)
+		_, classified := segment.Meta[ClassifiedKey]
+		if len(found) != 2 || classified != (test.level == AccessRedacted) || (segment.Link.State["amount"] == nil) == (test.level == AccessFull) {
+			fmt.Println("Clearance", test.clearance, "got", segment.Link.State, segment.Meta[ClassifiedKey], len(found))
+			t.FailNow()
+		}
+	}
+
+	if message := stub.InvokeError(t, "SetSegmentLabel", linkHash, []byte("")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+	stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+	stub.Invoke(t, "GetSegment", linkHash)
+	stub.Invoke(t, "SetSegmentLabel", linkHash, []byte(""))
+}
+
+func TestPop_SegmentLabelsMapDelta(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"admins":["AdminMSP"],"classification":{"secret":{"full":["high"],"redacted":["low"]}}}`)})
+	secret := testutil.Root("main").WithState("amount", 42.0).Build()
+	stub.SaveSegment(t, secret)
+	stub.Invoke(t, "SetSegmentLabel", []byte(secret.GetLinkHashString()), []byte("secret"))
+	mapID := []byte(secret.Link.GetMapID())
+
+	stub.Creator = testutil.NewIdentityWithAttributes("UserMSP", "user", map[string]string{AttributeClearance: ""})
+	delta := &MapDelta{}
+	json.Unmarshal(stub.Invoke(t, "GetMapDelta", mapID, []byte("0")), delta)
+	if len(delta.Segments) != 0 {
+		fmt.Println("Denied caller got", len(delta.Segments), "segments")
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentityWithAttributes("UserMSP", "user", map[string]string{AttributeClearance: "low"})
+	delta = &MapDelta{}
+	json.Unmarshal(stub.Invoke(t, "GetMapDelta", mapID, []byte("0")), delta)
+	if len(delta.Segments) != 1 || delta.Segments[0].Segment.Link.State["amount"] != nil || delta.Segments[0].Segment.Meta[ClassifiedKey] == nil {
+		fmt.Println("Redacted caller got", delta.Segments)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// The link API follows store.AdapterV2 of newer SDKs, where links and
+// evidences are separate: CreateLink saves a link, AddEvidence adds an
+// evidence to it and GetEvidences returns them. Links are stored in segment
+// documents and evidences in their own documents, so the segment functions
+// keep working on top of them.
+
+// CreateLink saves a link and returns its hash. It takes the same optional
+// actor and options arguments as SaveSegment.
+func (s *SmartContract) CreateLink(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 {
+		return shim.Error("Link is required")
+	}
+	link := cs.Link{}
+	if err := json.Unmarshal([]byte(args[0]), &link); err != nil {
+		return shim.Error("Could not parse link")
+	}
+	linkHash, err := computeLinkHash(&link)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	segment := &cs.Segment{
+		Link: link,
+		Meta: map[string]interface{}{"linkHash": linkHash},
+	}
+	if res := s.saveSegment(stub, segment, args); res.Status != shim.OK {
+		return res
+	}
+	return shim.Success([]byte(linkHash))
+}
+
+// GetLink returns the link of a segment
+func (s *SmartContract) GetLink(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	res := s.GetSegment(stub, args)
+	if res.Status != shim.OK || res.Payload == nil {
+		return res
+	}
+	segment := &cs.Segment{}
+	if err := json.Unmarshal(res.Payload, segment); err != nil {
+		return shim.Error(err.Error())
+	}
+	linkBytes, err := json.Marshal(segment.Link)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(linkBytes, nil)
+}
+
+// GetEvidences returns the evidences of a segment
+func (s *SmartContract) GetEvidences(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 {
+		return shim.Error("Link hash is required")
+	}
+	if err := checkSegmentTenant(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	segmentDocBytes, _, err := getSegmentDocBytes(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if segmentDocBytes == nil {
+		return shim.Success(nil)
+	}
+	segmentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	evidences, err := getAllEvidences(stub, &segmentDoc.Segment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if evidences == nil {
+		evidences = []*Evidence{}
+	}
+	evidencesBytes, err := json.Marshal(evidences)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(evidencesBytes, nil)
+}
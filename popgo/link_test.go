@@ -0,0 +1,57 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_CreateLink(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	link := testutil.Root("main").Build().Link
+	linkBytes, _ := json.Marshal(link)
+
+	linkHash := string(stub.Invoke(t, "CreateLink", linkBytes))
+	if linkHash != testutil.LinkHash(&link) {
+		fmt.Println("Got link hash", linkHash)
+		t.FailNow()
+	}
+	stub.InvokeError(t, "CreateLink", []byte("{"))
+
+	got := cs.Link{}
+	json.Unmarshal(stub.Invoke(t, "GetLink", []byte(linkHash)), &got)
+	if !reflect.DeepEqual(got, link) {
+		fmt.Println("Got link", got)
+		t.FailNow()
+	}
+
+	segment := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(linkHash)), segment)
+	if segment.GetLinkHashString() != linkHash {
+		fmt.Println("Links should be readable as segments")
+		t.FailNow()
+	}
+
+	if payload := stub.Invoke(t, "GetEvidences", []byte(linkHash)); string(payload) != "[]" {
+		fmt.Println("Got evidences", string(payload))
+		t.FailNow()
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package linkbuilder builds and signs segments accepted by the pop
+// chaincode.
+//
+// Link hashes and signatures are computed on the JSON encoded link, exactly
+// like the chaincode does, so clients don't have to hand-roll segments.
+package linkbuilder
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/stratumn/sdk/cs"
+)
+
+// Builder builds a segment.
+type Builder struct {
+	link    cs.Link
+	signers []signerEntry
+}
+
+type signerEntry struct {
+	signer Signer
+	did    string
+}
+
+// New starts building the first segment of a new map. The map ID is
+// random.
+func New(process string) (*Builder, error) {
+	mapID, err := randomMapID()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithMapID(process, mapID), nil
+}
+
+// NewWithMapID starts building the first segment of a map.
+func NewWithMapID(process, mapID string) *Builder {
+	return &Builder{
+		link: cs.Link{
+			State: map[string]interface{}{},
+			Meta: map[string]interface{}{
+				"process": process,
+				"mapId":   mapID,
+			},
+		},
+	}
+}
+
+// Child starts building a segment appended to parent. When the parent has
+// a priority, the child gets the next one.
+func Child(parent *cs.Segment) *Builder {
+	b := NewWithMapID(parent.Link.GetProcess(), parent.Link.GetMapID())
+	b.link.Meta["prevLinkHash"] = parent.GetLinkHashString()
+	if _, ok := parent.Link.Meta["priority"].(float64); ok {
+		b.link.Meta["priority"] = parent.Link.GetPriority() + 1
+	}
+	return b
+}
+
+// WithAction sets link.meta.action.
+func (b *Builder) WithAction(action string) *Builder {
+	return b.WithLinkMeta("action", action)
+}
+
+// WithPriority sets link.meta.priority.
+func (b *Builder) WithPriority(priority float64) *Builder {
+	return b.WithLinkMeta("priority", priority)
+}
+
+// WithTags sets link.meta.tags.
+func (b *Builder) WithTags(tags ...string) *Builder {
+	t := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		t[i] = tag
+	}
+	return b.WithLinkMeta("tags", t)
+}
+
+// WithRef adds a reference to another segment in link.meta.refs.
+func (b *Builder) WithRef(ref *cs.Segment) *Builder {
+	refs, _ := b.link.Meta["refs"].([]interface{})
+	refs = append(refs, map[string]interface{}{
+		"process":  ref.Link.GetProcess(),
+		"linkHash": ref.GetLinkHashString(),
+	})
+	return b.WithLinkMeta("refs", refs)
+}
+
+// WithState sets a value of the link state.
+func (b *Builder) WithState(key string, value interface{}) *Builder {
+	b.link.State[key] = value
+	return b
+}
+
+// WithLinkMeta sets a value of the link meta.
+func (b *Builder) WithLinkMeta(key string, value interface{}) *Builder {
+	b.link.Meta[key] = value
+	return b
+}
+
+// SignWith adds a signer. Signatures are added to segment.meta.signatures
+// by Build, in the order signers were added.
+func (b *Builder) SignWith(signer Signer) *Builder {
+	b.signers = append(b.signers, signerEntry{signer: signer})
+	return b
+}
+
+// SignAs adds a signer for a DID registered on the chaincode. The signer
+// must hold the registered key of the DID.
+func (b *Builder) SignAs(did string, signer Signer) *Builder {
+	b.signers = append(b.signers, signerEntry{signer: signer, did: did})
+	return b
+}
+
+// Build computes the link hash, signs the link and returns the segment.
+// The builder can be reused to build variations of the segment.
+func (b *Builder) Build() (*cs.Segment, error) {
+	if b.link.GetProcess() == "" {
+		return nil, errors.New("process is required")
+	}
+	if b.link.GetMapID() == "" {
+		return nil, errors.New("map ID is required")
+	}
+
+	// The link is normalized like the chaincode will decode it, so numbers
+	// and nested values hash the same on both sides.
+	linkBytes, err := json.Marshal(b.link)
+	if err != nil {
+		return nil, err
+	}
+	segment := &cs.Segment{Meta: map[string]interface{}{}}
+	if err := json.Unmarshal(linkBytes, &segment.Link); err != nil {
+		return nil, err
+	}
+	linkBytes, err = json.Marshal(segment.Link)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(linkBytes)
+	segment.Meta["linkHash"] = hex.EncodeToString(digest[:])
+
+	if len(b.signers) > 0 {
+		signatures := make([]interface{}, 0, len(b.signers))
+		for _, entry := range b.signers {
+			signature, err := sign(entry.signer, digest[:])
+			if err != nil {
+				return nil, err
+			}
+			if entry.did != "" {
+				signature["did"] = entry.did
+			}
+			signatures = append(signatures, signature)
+		}
+		segment.Meta["signatures"] = signatures
+	}
+
+	if err := segment.Validate(); err != nil {
+		return nil, err
+	}
+	return segment, nil
+}
+
+// LinkHash returns the hex encoded SHA-256 of the JSON encoded link.
+func LinkHash(link *cs.Link) (string, error) {
+	linkBytes, err := json.Marshal(link)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(linkBytes)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+func randomMapID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
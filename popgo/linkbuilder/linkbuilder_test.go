@@ -0,0 +1,139 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linkbuilder
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stratumn/sdk/cs"
+)
+
+type nested struct {
+	Count int `json:"count"`
+}
+
+func TestBuilder_Build(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	signer, err := NewKeySigner(key)
+	if err != nil {
+		t.FailNow()
+	}
+
+	b, err := New("main")
+	if err != nil {
+		t.FailNow()
+	}
+	root, err := b.WithAction("init").WithPriority(1).WithState("item", nested{3}).SignAs("did:example:a", signer).Build()
+	if err != nil {
+		fmt.Println("Build failed", err)
+		t.FailNow()
+	}
+
+	// The chaincode decodes the segment before hashing it
+	segmentBytes, _ := json.Marshal(root)
+	decoded := &cs.Segment{}
+	json.Unmarshal(segmentBytes, decoded)
+	linkHash, _ := LinkHash(&decoded.Link)
+	if linkHash != root.GetLinkHashString() || len(root.Link.GetMapID()) != 32 {
+		fmt.Println("Got link hash", root.GetLinkHashString(), "expected", linkHash)
+		t.FailNow()
+	}
+
+	signatures := root.Meta["signatures"].([]interface{})
+	entry := signatures[0].(map[string]interface{})
+	if len(signatures) != 1 || entry["did"] != "did:example:a" || entry["publicKey"] != signer.PublicKey() {
+		fmt.Println("Got signatures", signatures)
+		t.FailNow()
+	}
+	sigBytes, _ := base64.StdEncoding.DecodeString(entry["signature"].(string))
+	sig := struct{ R, S *big.Int }{}
+	asn1.Unmarshal(sigBytes, &sig)
+	linkBytes, _ := json.Marshal(decoded.Link)
+	digest := sha256.Sum256(linkBytes)
+	if !ecdsa.Verify(&key.PublicKey, digest[:], sig.R, sig.S) {
+		fmt.Println("Signature should verify")
+		t.FailNow()
+	}
+
+	child, err := Child(root).WithAction("update").Build()
+	if err != nil {
+		t.FailNow()
+	}
+	if child.Link.GetPrevLinkHashString() != root.GetLinkHashString() || child.Link.GetMapID() != root.Link.GetMapID() || child.Link.GetPriority() != 2 {
+		fmt.Println("Got child", child.Link.Meta)
+		t.FailNow()
+	}
+
+	if _, err := NewWithMapID("main", "").Build(); err == nil {
+		fmt.Println("A map ID should be required")
+		t.FailNow()
+	}
+}
+
+func TestNewKeySigner(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	if _, err := NewKeySigner(key); err == nil {
+		fmt.Println("RSA keys should be rejected")
+		t.FailNow()
+	}
+}
+
+func TestRemoteSigner(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	// PKCS#11 modules return R and S padded to the key size
+	hsm := func(digest []byte) ([]byte, error) {
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			return nil, err
+		}
+		raw := make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(raw[32-len(rb):32], rb)
+		copy(raw[64-len(sb):], sb)
+		return raw, nil
+	}
+	signer, err := NewRemoteSigner(&key.PublicKey, hsm, FormatRaw)
+	if err != nil {
+		t.FailNow()
+	}
+
+	digest := sha256.Sum256([]byte("link"))
+	sigBytes, err := signer.Sign(digest[:])
+	if err != nil {
+		fmt.Println("Sign failed", err)
+		t.FailNow()
+	}
+	sig := struct{ R, S *big.Int }{}
+	if _, err := asn1.Unmarshal(sigBytes, &sig); err != nil || !ecdsa.Verify(&key.PublicKey, digest[:], sig.R, sig.S) {
+		fmt.Println("Signature should verify", err)
+		t.FailNow()
+	}
+
+	broken, _ := NewRemoteSigner(&key.PublicKey, func([]byte) ([]byte, error) { return []byte{1, 2, 3}, nil }, FormatRaw)
+	if _, err := broken.Sign(digest[:]); err == nil {
+		fmt.Println("Odd raw signatures should be rejected")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linkbuilder
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+// SignFunc signs a SHA-256 digest with a key that never leaves its device,
+// usually by calling a PKCS#11 module or a cloud KMS.
+type SignFunc func(digest []byte) ([]byte, error)
+
+// SignatureFormat is the encoding of the signatures returned by a SignFunc.
+type SignatureFormat int
+
+const (
+	// FormatASN1 is the ASN.1 DER encoding returned by most cloud KMS.
+	FormatASN1 SignatureFormat = iota
+
+	// FormatRaw is the concatenation of R and S returned by the PKCS#11
+	// CKM_ECDSA mechanism.
+	FormatRaw
+)
+
+// RemoteSigner is a Signer delegating signatures to a SignFunc.
+type RemoteSigner struct {
+	sign      SignFunc
+	format    SignatureFormat
+	publicKey string
+}
+
+// NewRemoteSigner creates a signer for an ECDSA key held by a device. The
+// public key is usually read from the device or from the certificate of
+// the key.
+func NewRemoteSigner(publicKey crypto.PublicKey, sign SignFunc, format SignatureFormat) (*RemoteSigner, error) {
+	if _, ok := publicKey.(*ecdsa.PublicKey); !ok {
+		return nil, errors.New("key should be an ECDSA key")
+	}
+	if format != FormatASN1 && format != FormatRaw {
+		return nil, errors.New("unknown signature format")
+	}
+	keyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteSigner{
+		sign:      sign,
+		format:    format,
+		publicKey: base64.StdEncoding.EncodeToString(keyBytes),
+	}, nil
+}
+
+// Type implements Signer.Type.
+func (s *RemoteSigner) Type() string {
+	return SignatureTypeECDSA
+}
+
+// PublicKey implements Signer.PublicKey.
+func (s *RemoteSigner) PublicKey() string {
+	return s.publicKey
+}
+
+// Sign implements Signer.Sign.
+func (s *RemoteSigner) Sign(digest []byte) ([]byte, error) {
+	signature, err := s.sign(digest)
+	if err != nil {
+		return nil, err
+	}
+	if s.format == FormatASN1 {
+		return signature, nil
+	}
+	if len(signature) == 0 || len(signature)%2 != 0 {
+		return nil, errors.New("raw signature should have two halves of the same size")
+	}
+	n := len(signature) / 2
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		new(big.Int).SetBytes(signature[:n]),
+		new(big.Int).SetBytes(signature[n:]),
+	})
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linkbuilder
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+)
+
+// SignatureTypeECDSA is an ECDSA signature of the SHA-256 of the JSON
+// encoded link, the type verified by the chaincode.
+const SignatureTypeECDSA = "ecdsa-sha256"
+
+// Signer signs link digests. The private key can be held in memory or by
+// a device that never exposes it.
+type Signer interface {
+	// Type returns the signature type.
+	Type() string
+
+	// PublicKey returns the base64 encoded PKIX public key.
+	PublicKey() string
+
+	// Sign signs the SHA-256 digest of a link and returns the ASN.1
+	// encoded signature.
+	Sign(digest []byte) ([]byte, error)
+}
+
+// KeySigner is a Signer using a crypto.Signer with an ECDSA key, like an
+// *ecdsa.PrivateKey.
+type KeySigner struct {
+	key       crypto.Signer
+	publicKey string
+}
+
+// NewKeySigner creates a signer from an ECDSA key.
+func NewKeySigner(key crypto.Signer) (*KeySigner, error) {
+	if _, ok := key.Public().(*ecdsa.PublicKey); !ok {
+		return nil, errors.New("key should be an ECDSA key")
+	}
+	keyBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &KeySigner{
+		key:       key,
+		publicKey: base64.StdEncoding.EncodeToString(keyBytes),
+	}, nil
+}
+
+// Type implements Signer.Type.
+func (s *KeySigner) Type() string {
+	return SignatureTypeECDSA
+}
+
+// PublicKey implements Signer.PublicKey.
+func (s *KeySigner) PublicKey() string {
+	return s.publicKey
+}
+
+// Sign implements Signer.Sign.
+func (s *KeySigner) Sign(digest []byte) ([]byte, error) {
+	return s.key.Sign(rand.Reader, digest, crypto.SHA256)
+}
+
+// sign returns the meta.signatures entry of a signer.
+func sign(signer Signer, digest []byte) (map[string]interface{}, error) {
+	signature, err := signer.Sign(digest)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"type":      signer.Type(),
+		"publicKey": signer.PublicKey(),
+		"signature": base64.StdEncoding.EncodeToString(signature),
+	}, nil
+}
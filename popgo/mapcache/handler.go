@@ -0,0 +1,76 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapcache
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Handler serves cached map IDs on the /mapids route of an HTTP server.
+//
+// The query parameter filter is a JSON map filter like GetMapIDs takes.
+// The Cache-Control header of the request controls the cache: no-cache
+// fetches the page again and max-age=<seconds> only accepts younger
+// entries. The Age header of the response is the age of the page.
+func Handler(cache *Cache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		options, ok := parseCacheControl(r.Header.Get("Cache-Control"))
+		if !ok {
+			http.Error(w, "invalid Cache-Control header", http.StatusBadRequest)
+			return
+		}
+		filter := json.RawMessage(r.URL.Query().Get("filter"))
+		if _, _, err := filterKey(filter); err != nil {
+			http.Error(w, "filter should be a JSON map filter", http.StatusBadRequest)
+			return
+		}
+
+		page, age, err := cache.MapIDs(r.Context(), filter, options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Age", strconv.Itoa(int(age/time.Second)))
+		w.Write(page)
+	})
+}
+
+// parseCacheControl reads the no-cache and max-age directives of a
+// Cache-Control header, other directives are ignored.
+func parseCacheControl(header string) (*Options, bool) {
+	options := &Options{}
+	for _, directive := range strings.Split(header, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-cache":
+			options.NoCache = true
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(directive[len("max-age="):])
+			if err != nil || seconds < 0 {
+				return nil, false
+			}
+			if seconds == 0 {
+				options.NoCache = true
+			}
+			options.MaxAge = time.Duration(seconds) * time.Second
+		}
+	}
+	return options, true
+}
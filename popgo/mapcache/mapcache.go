@@ -0,0 +1,238 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mapcache caches the results of GetMapIDs, which are expensive on
+// large channels and rarely change.
+//
+// Entries are keyed by map filter and expire after a TTL. A Cache can also
+// watch chaincode events from a relay.Source and drop the entries a new
+// map belongs to as soon as it is committed. Other changes, like deleted
+// or merged maps, are only seen once entries expire.
+//
+// GetMapIDs results depend on the tenant of the caller, so a cache must
+// only be shared by callers using the same chaincode identity.
+package mapcache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/piedup/chaincode/popgo/relay"
+)
+
+// DefaultTTL is the default time entries are kept.
+const DefaultTTL = time.Minute
+
+// Fetcher calls GetMapIDs on the chaincode.
+type Fetcher interface {
+	// MapIDs returns the page of map IDs of a map filter.
+	MapIDs(ctx context.Context, filter json.RawMessage) (json.RawMessage, error)
+}
+
+// Options control the cache for a request.
+type Options struct {
+	// NoCache fetches the page again, and caches the new one.
+	NoCache bool
+
+	// MaxAge only accepts entries younger than MaxAge when it is positive.
+	MaxAge time.Duration
+}
+
+type entry struct {
+	process  string
+	page     json.RawMessage
+	cachedAt time.Time
+}
+
+// Cache caches the pages of map IDs of map filters.
+type Cache struct {
+	fetcher Fetcher
+	ttl     time.Duration
+
+	// now returns the current time, it is replaced by tests
+	now func() time.Time
+
+	mutex   sync.Mutex
+	entries map[string]*entry
+
+	// created counts map creations, a page fetched while a map was
+	// created may miss it and isn't cached
+	created uint64
+}
+
+// New creates a cache keeping pages for ttl, DefaultTTL if it isn't
+// positive.
+func New(fetcher Fetcher, ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Cache{
+		fetcher: fetcher,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]*entry{},
+	}
+}
+
+// MapIDs returns the page of map IDs of a map filter and its age, zero if
+// it was just fetched.
+func (c *Cache) MapIDs(ctx context.Context, filter json.RawMessage, options *Options) (json.RawMessage, time.Duration, error) {
+	key, process, err := filterKey(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if options == nil {
+		options = &Options{}
+	}
+
+	if !options.NoCache {
+		c.mutex.Lock()
+		e, ok := c.entries[key]
+		c.mutex.Unlock()
+		if ok {
+			age := c.now().Sub(e.cachedAt)
+			if age < c.ttl && (options.MaxAge <= 0 || age < options.MaxAge) {
+				return e.page, age, nil
+			}
+		}
+	}
+
+	c.mutex.Lock()
+	created := c.created
+	c.mutex.Unlock()
+	cachedAt := c.now()
+
+	page, err := c.fetcher.MapIDs(ctx, json.RawMessage(key))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	c.mutex.Lock()
+	if c.created == created {
+		c.entries[key] = &entry{process: process, page: page, cachedAt: cachedAt}
+	}
+	c.mutex.Unlock()
+	return page, 0, nil
+}
+
+// MapCreated drops the entries a new map of a process belongs to, the
+// entries of the process and of filters without process.
+func (c *Cache) MapCreated(process string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.created++
+	for key, e := range c.entries {
+		if e.process == "" || e.process == process {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Purge drops expired entries.
+func (c *Cache) Purge() {
+	now := c.now()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, e := range c.entries {
+		if now.Sub(e.cachedAt) >= c.ttl {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Watch drops entries when maps are created until the context is done or
+// the source fails. It starts at block from, usually the height of the
+// channel when the cache is created. Expired entries are purged on every
+// block.
+func (c *Cache) Watch(ctx context.Context, source relay.Source, from uint64) error {
+	blocks, err := source.Blocks(ctx, from)
+	if err != nil {
+		return err
+	}
+	for block := range blocks {
+		for _, event := range block.Events {
+			processes, err := CreatedMaps(event)
+			if err != nil {
+				return err
+			}
+			for _, process := range processes {
+				c.MapCreated(process)
+			}
+		}
+		c.Purge()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return source.Err()
+}
+
+// CreatedMaps returns the processes of the maps created by an event, one
+// per map. A map is created by the first segment saved in it.
+func CreatedMaps(event *relay.Event) ([]string, error) {
+	var segments []json.RawMessage
+	switch event.Name {
+	case "saveSegment", "mirrorSegment":
+		segments = []json.RawMessage{event.Payload}
+	case "saveSegments":
+		if err := json.Unmarshal(event.Payload, &segments); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	var processes []string
+	for _, segmentJSON := range segments {
+		var segment struct {
+			Link struct {
+				Meta struct {
+					Process      string `json:"process"`
+					PrevLinkHash string `json:"prevLinkHash"`
+				} `json:"meta"`
+			} `json:"link"`
+		}
+		if err := json.Unmarshal(segmentJSON, &segment); err != nil {
+			return nil, err
+		}
+		if segment.Link.Meta.PrevLinkHash == "" {
+			processes = append(processes, segment.Link.Meta.Process)
+		}
+	}
+	return processes, nil
+}
+
+// filterKey returns the canonical JSON of a map filter, which keys its
+// entry, and the process of the filter.
+func filterKey(filter json.RawMessage) (string, string, error) {
+	if len(filter) == 0 {
+		filter = json.RawMessage("{}")
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(filter, &fields); err != nil {
+		return "", "", err
+	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	// Maps are marshaled with sorted keys
+	key, err := json.Marshal(fields)
+	if err != nil {
+		return "", "", err
+	}
+	process, _ := fields["process"].(string)
+	return string(key), process, nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapcache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/piedup/chaincode/popgo/relay"
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+// countingFetcher returns the filter and the number of calls as page.
+type countingFetcher struct {
+	mutex sync.Mutex
+	calls int
+
+	// created is called during the fetch when it is set
+	created func()
+}
+
+func (f *countingFetcher) MapIDs(ctx context.Context, filter json.RawMessage) (json.RawMessage, error) {
+	f.mutex.Lock()
+	f.calls++
+	calls := f.calls
+	f.mutex.Unlock()
+	if f.created != nil {
+		f.created()
+	}
+	return json.RawMessage(fmt.Sprintf(`{"filter":%s,"call":%d}`, filter, calls)), nil
+}
+
+func (f *countingFetcher) getCalls() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.calls
+}
+
+type mockSource struct {
+	blocks []*relay.Block
+}
+
+func (s *mockSource) Blocks(ctx context.Context, from uint64) (<-chan *relay.Block, error) {
+	c := make(chan *relay.Block)
+	go func() {
+		defer close(c)
+		for _, b := range s.blocks {
+			if b.Number < from {
+				continue
+			}
+			select {
+			case c <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (s *mockSource) Err() error {
+	return nil
+}
+
+func TestCache_MapIDs(t *testing.T) {
+	fetcher := &countingFetcher{}
+	cache := New(fetcher, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	page, _, err := cache.MapIDs(context.Background(), json.RawMessage(`{"process":"main", "pagination":{"limit":5}}`), nil)
+	if err != nil || string(page) != `{"filter":{"pagination":{"limit":5},"process":"main"},"call":1}` {
+		fmt.Println("Got page", string(page), err)
+		t.FailNow()
+	}
+
+	// Equivalent filters share their entry
+	now = now.Add(10 * time.Second)
+	_, age, _ := cache.MapIDs(context.Background(), json.RawMessage(`{"pagination":{"limit":5},"process":"main"}`), nil)
+	if fetcher.getCalls() != 1 || age != 10*time.Second {
+		fmt.Println("The page should be cached, got", fetcher.getCalls(), "calls and age", age)
+		t.FailNow()
+	}
+
+	filter := json.RawMessage(`{"process":"main","pagination":{"limit":5}}`)
+	if cache.MapIDs(context.Background(), filter, &Options{MaxAge: 5 * time.Second}); fetcher.getCalls() != 2 {
+		fmt.Println("Entries older than MaxAge should be fetched again")
+		t.FailNow()
+	}
+	if cache.MapIDs(context.Background(), filter, &Options{NoCache: true}); fetcher.getCalls() != 3 {
+		fmt.Println("NoCache should fetch the page again")
+		t.FailNow()
+	}
+	now = now.Add(time.Minute)
+	if cache.MapIDs(context.Background(), filter, nil); fetcher.getCalls() != 4 {
+		fmt.Println("Expired entries should be fetched again")
+		t.FailNow()
+	}
+
+	if _, _, err := cache.MapIDs(context.Background(), json.RawMessage(`[]`), nil); err == nil {
+		fmt.Println("Invalid filters should be rejected")
+		t.FailNow()
+	}
+}
+
+func TestCache_MapCreated(t *testing.T) {
+	fetcher := &countingFetcher{}
+	cache := New(fetcher, time.Minute)
+	for _, filter := range []string{`{"process":"main"}`, `{"process":"other"}`, `{}`} {
+		cache.MapIDs(context.Background(), json.RawMessage(filter), nil)
+	}
+
+	cache.MapCreated("main")
+	for _, test := range []struct {
+		filter string
+		calls  int
+	}{
+		{`{"process":"main"}`, 4},
+		{`{"process":"other"}`, 4},
+		{`{}`, 5},
+	} {
+		if cache.MapIDs(context.Background(), json.RawMessage(test.filter), nil); fetcher.getCalls() != test.calls {
+			fmt.Println("Unexpected fetch for filter", test.filter)
+			t.FailNow()
+		}
+	}
+
+	// A page fetched while a map was created isn't cached
+	fetcher.created = func() { cache.MapCreated("main") }
+	cache.MapIDs(context.Background(), json.RawMessage(`{"process":"main"}`), &Options{NoCache: true})
+	fetcher.created = nil
+	if cache.MapIDs(context.Background(), json.RawMessage(`{"process":"main"}`), nil); fetcher.getCalls() != 7 {
+		fmt.Println("The page fetched during a map creation should not be cached")
+		t.FailNow()
+	}
+}
+
+func TestCache_Watch(t *testing.T) {
+	chain := testutil.Chain("main", 2)
+	root, _ := json.Marshal(chain[0])
+	child, _ := json.Marshal(chain[1])
+	batch, _ := json.Marshal([]json.RawMessage{child, root})
+
+	for _, test := range []struct {
+		event   *relay.Event
+		created bool
+	}{
+		{&relay.Event{Name: "saveSegment", Payload: root}, true},
+		{&relay.Event{Name: "saveSegment", Payload: child}, false},
+		{&relay.Event{Name: "mirrorSegment", Payload: root}, true},
+		{&relay.Event{Name: "saveSegments", Payload: batch}, true},
+		{&relay.Event{Name: "addEvidence", Payload: []byte(`{}`)}, false},
+	} {
+		fetcher := &countingFetcher{}
+		cache := New(fetcher, time.Minute)
+		cache.MapIDs(context.Background(), json.RawMessage(`{"process":"main"}`), nil)
+
+		source := &mockSource{blocks: []*relay.Block{{Number: 1, Events: []*relay.Event{test.event}}}}
+		if err := cache.Watch(context.Background(), source, 1); err != nil {
+			fmt.Println("Watch failed", err)
+			t.FailNow()
+		}
+		cache.MapIDs(context.Background(), json.RawMessage(`{"process":"main"}`), nil)
+		if created := fetcher.getCalls() == 2; created != test.created {
+			fmt.Println("Event", test.event.Name, "should drop the entry:", test.created)
+			t.FailNow()
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	fetcher := &countingFetcher{}
+	server := httptest.NewServer(Handler(New(fetcher, time.Minute)))
+	defer server.Close()
+
+	get := func(filter, cacheControl string) (*http.Response, string) {
+		req, _ := http.NewRequest("GET", server.URL+"/mapids?filter="+filter, nil)
+		if cacheControl != "" {
+			req.Header.Set("Cache-Control", cacheControl)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fmt.Println("Request failed", err)
+			t.FailNow()
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp, string(body)
+	}
+
+	resp, body := get(`{"process":"main"}`, "")
+	if resp.StatusCode != http.StatusOK || body != `{"filter":{"process":"main"},"call":1}` || resp.Header.Get("Age") != "0" {
+		fmt.Println("Got response", resp.StatusCode, body)
+		t.FailNow()
+	}
+	if get(`{"process":"main"}`, ""); fetcher.getCalls() != 1 {
+		fmt.Println("The page should be cached")
+		t.FailNow()
+	}
+	if get(`{"process":"main"}`, "no-cache"); fetcher.getCalls() != 2 {
+		fmt.Println("no-cache should fetch the page again")
+		t.FailNow()
+	}
+	if get(`{"process":"main"}`, "max-age=0"); fetcher.getCalls() != 3 {
+		fmt.Println("max-age=0 should fetch the page again")
+		t.FailNow()
+	}
+
+	for filter, cacheControl := range map[string]string{`[`: "", `{}`: "max-age=soon"} {
+		if resp, _ := get(filter, cacheControl); resp.StatusCode != http.StatusBadRequest {
+			fmt.Println("Request should be rejected", filter, cacheControl)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,372 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Maps found to represent the same case are merged into one: links are
+// immutable so segments of the source map keep their map ID, but they get
+// the target in meta.mergedInto and segment queries for the source map
+// return the segments of the target and of every map merged into it. The
+// source map is frozen and a marker segment is appended to the target.
+const (
+	// ObjectTypeMerge is used in the keys of the reverse index of merges
+	ObjectTypeMerge = "merge"
+
+	// MergedIntoKey is the meta key of the map a segment was merged into
+	MergedIntoKey = "mergedInto"
+
+	// MergeAction is the action of merge marker segments
+	MergeAction = "_merge"
+
+	// MergedMapIDKey is the link meta key of the source map of a merge
+	// marker segment
+	MergedMapIDKey = "mergedMapId"
+)
+
+// MergeDoc is used to store merges in CouchDB
+type MergeDoc struct {
+	ObjectType string     `json:"docType"`
+	Source     string     `json:"source"`
+	Target     string     `json:"target"`
+	Marker     string     `json:"marker"`
+	MergedBy   *Submitter `json:"mergedBy,omitempty"`
+	MergedAt   int64      `json:"mergedAt"`
+	// Job is the job marking the segments of the source map when there
+	// are too many to mark in the merge transaction
+	Job string `json:"job,omitempty"`
+}
+
+func getMergeKey(stub shim.ChaincodeStubInterface, target, source string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeMerge, []string{target, source})
+}
+
+// mergedSources returns the maps merged into a map, directly or not
+func mergedSources(stub shim.ChaincodeStubInterface, target string) ([]string, error) {
+	var sources []string
+	pending := []string{target}
+	for len(pending) > 0 {
+		resultsIterator, err := stub.GetStateByPartialCompositeKey(ObjectTypeMerge, []string{pending[0]})
+		if err != nil {
+			return nil, err
+		}
+		pending = pending[1:]
+		for resultsIterator.HasNext() {
+			queryResponse, err := resultsIterator.Next()
+			if err != nil {
+				resultsIterator.Close()
+				return nil, err
+			}
+			merge := &MergeDoc{}
+			if err := json.Unmarshal(queryResponse.Value, merge); err != nil {
+				resultsIterator.Close()
+				return nil, err
+			}
+			sources = append(sources, merge.Source)
+			pending = append(pending, merge.Source)
+		}
+		resultsIterator.Close()
+	}
+	return sources, nil
+}
+
+// redirectMapIDs replaces the maps of a segment filter with the maps they
+// were merged into and the maps merged into those
+func redirectMapIDs(stub shim.ChaincodeStubInterface, mapIDs []string) ([]string, error) {
+	var redirected []string
+	for _, mapID := range mapIDs {
+		target := mapID
+		for {
+			mapDoc, err := getMap(stub, target)
+			if err != nil {
+				return nil, err
+			}
+			if mapDoc == nil || mapDoc.MergedInto == "" {
+				break
+			}
+			target = mapDoc.MergedInto
+		}
+		if containsString(redirected, target) {
+			continue
+		}
+		sources, err := mergedSources(stub, target)
+		if err != nil {
+			return nil, err
+		}
+		redirected = append(redirected, target)
+		for _, source := range sources {
+			if !containsString(redirected, source) {
+				redirected = append(redirected, source)
+			}
+		}
+	}
+	return redirected, nil
+}
+
+// markMergedSegments sets meta.mergedInto on up to limit segments of a map
+// that don't have it yet, hot segments first then cold ones. Marked
+// segments no longer match the queries, so no cursor is needed. It returns
+// how many segments were marked and whether some are left.
+func markMergedSegments(stub shim.ChaincodeStubInterface, config *Config, source, target string, limit int) (int, bool, error) {
+	hotQuery := map[string]interface{}{
+		"docType":                       ObjectTypeSegment,
+		"segment.link.meta.mapId":       source,
+		"segment.meta." + MergedIntoKey: map[string]bool{"$exists": false},
+	}
+	n, more, err := markMergedDocs(stub, config, segmentIndexes, hotQuery, limit, func(docBytes []byte) error {
+		segmentDoc := &SegmentDoc{}
+		if err := json.Unmarshal(docBytes, segmentDoc); err != nil {
+			return err
+		}
+		if err := loadSegmentState(stub, segmentDoc); err != nil {
+			return err
+		}
+		if segmentDoc.Segment.Meta == nil {
+			segmentDoc.Segment.Meta = map[string]interface{}{}
+		}
+		segmentDoc.Segment.Meta[MergedIntoKey] = target
+		return putSegmentDoc(stub, *segmentDoc)
+	})
+	if err != nil || more || n == limit {
+		return n, more || n == limit, err
+	}
+
+	// Cold segments are decompressed, marked and archived again
+	coldQuery := map[string]interface{}{
+		"docType":     ObjectTypeColdSegment,
+		"mapId":       source,
+		MergedIntoKey: map[string]bool{"$exists": false},
+	}
+	cold, more, err := markMergedDocs(stub, config, coldSegmentIndexes, coldQuery, limit-n, func(docBytes []byte) error {
+		coldDoc := &ColdSegmentDoc{}
+		if err := json.Unmarshal(docBytes, coldDoc); err != nil {
+			return err
+		}
+		segmentDocBytes, _, err := getSegmentDocBytes(stub, coldDoc.ID)
+		if err != nil {
+			return err
+		}
+		segmentDoc := &SegmentDoc{}
+		if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+			return err
+		}
+		if segmentDoc.Segment.Meta == nil {
+			segmentDoc.Segment.Meta = map[string]interface{}{}
+		}
+		segmentDoc.Segment.Meta[MergedIntoKey] = target
+		if segmentDocBytes, err = json.Marshal(segmentDoc); err != nil {
+			return err
+		}
+		return archiveSegment(stub, coldDoc.ID, segmentDocBytes)
+	})
+	return n + cold, more, err
+}
+
+// markMergedDocs marks up to limit documents matching a selector. It tells
+// whether more documents match.
+func markMergedDocs(stub shim.ChaincodeStubInterface, config *Config, indexes []queryIndex, selector map[string]interface{}, limit int, mark func([]byte) error) (int, bool, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": selector,
+		"limit":    limit + 1,
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if _, err := checkQueryPlan(config, indexes, string(queryBytes)); err != nil {
+		return 0, false, err
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return 0, false, err
+	}
+	defer resultsIterator.Close()
+
+	n := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, false, err
+		}
+		if n == limit {
+			return n, true, nil
+		}
+		if err := mark(queryResponse.Value); err != nil {
+			return 0, false, err
+		}
+		n++
+	}
+	return n, false, nil
+}
+
+// markMergedSegmentsStep marks the segments of a merged map left by
+// MergeMaps. Arguments of the job are the source and target map IDs.
+func markMergedSegmentsStep(stub shim.ChaincodeStubInterface, job *JobDoc, chunkSize int) (string, int, bool, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return "", 0, false, err
+	}
+	n, more, err := markMergedSegments(stub, config, job.Args[0], job.Args[1], chunkSize)
+	if err != nil {
+		return "", 0, false, err
+	}
+	return "", n, !more, nil
+}
+
+// newMergeMarker returns the segment recording the merge of a map. Its
+// parent is the root of the target map.
+func newMergeMarker(stub shim.ChaincodeStubInterface, source, target *MapDoc) (*cs.Segment, error) {
+	link := cs.Link{
+		State: map[string]interface{}{},
+		Meta: map[string]interface{}{
+			"mapId":        target.ID,
+			"process":      target.Process,
+			"prevLinkHash": target.RootLinkHash,
+			"action":       MergeAction,
+			MergedMapIDKey: source.ID,
+			"txId":         stub.GetTxID(),
+		},
+	}
+	linkHash, err := computeLinkHash(&link)
+	if err != nil {
+		return nil, err
+	}
+	segment := &cs.Segment{
+		Link: link,
+		Meta: map[string]interface{}{"linkHash": linkHash},
+	}
+	segment.SetEvidence(
+		map[string]interface{}{
+			"state":        cs.PendingEvidence,
+			"transactions": map[string]string{"transactionID": stub.GetTxID()},
+		})
+	submitter, err := getSubmitter(stub)
+	if err != nil {
+		return nil, err
+	}
+	if submitter != nil {
+		segment.Meta["submitter"] = submitter
+	}
+	return segment, nil
+}
+
+func getMergeMaps(stub shim.ChaincodeStubInterface, args []string) (*MapDoc, *MapDoc, error) {
+	if len(args) < 2 || args[0] == "" || args[1] == "" {
+		return nil, nil, errors.New("Source and target map IDs are required")
+	}
+	if args[0] == args[1] {
+		return nil, nil, errors.New("A map cannot be merged into itself")
+	}
+	var maps [2]*MapDoc
+	for i, mapID := range args[:2] {
+		mapDoc, err := getMap(stub, mapID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if mapDoc == nil {
+			return nil, nil, errors.New("Map " + mapID + " not found")
+		}
+		if mapDoc.MergedInto != "" {
+			return nil, nil, errors.New("Map " + mapID + " was already merged into " + mapDoc.MergedInto)
+		}
+		maps[i] = mapDoc
+	}
+	return maps[0], maps[1], nil
+}
+
+// MergeMaps merges a map into another one. Arguments are the source and
+// target map IDs. The link hash of the merge marker segment is returned.
+// The mergeMaps event has the ID of the job to continue when segments are
+// left to mark.
+func (s *SmartContract) MergeMaps(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	source, target, err := getMergeMaps(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkMapNotHeld(stub, source); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marker, err := newMergeMarker(stub, source, target)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := s.putSegment(stub, marker); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Segments are marked in chunks, a job marks the segments left
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, more, err := markMergedSegments(stub, config, source.ID, target.ID, DefaultJobChunkSize)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	source.MergedInto = target.ID
+	source.Frozen = true
+	if err := putMap(stub, source); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	merge := &MergeDoc{
+		ObjectType: ObjectTypeMerge,
+		Source:     source.ID,
+		Target:     target.ID,
+		Marker:     marker.GetLinkHashString(),
+	}
+	if merge.MergedBy, err = getSubmitter(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	merge.MergedAt = now.UnixNano() / int64(time.Millisecond)
+	if more {
+		job, err := startJob(stub, "MarkMergedSegments", []string{source.ID, target.ID})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		merge.Job = job.ID
+	}
+	key, err := getMergeKey(stub, target.ID, source.ID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	mergeBytes, err := json.Marshal(merge)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, mergeBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.SetEvent("mergeMaps", mergeBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(marker.GetLinkHashString()))
+}
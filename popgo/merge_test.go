@@ -0,0 +1,116 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_MergeMaps(t *testing.T) {
+	stub := newAdminStub(t)
+	source, target, other := testutil.Root("main").Build(), testutil.Root("main").Build(), testutil.Root("main").Build()
+	sourceChild := testutil.Child(source).Build()
+	stub.SaveSegment(t, source, sourceChild, target, other)
+	sourceID, targetID := source.Link.GetMapID(), target.Link.GetMapID()
+
+	stub.InvokeError(t, "MergeMaps", []byte(sourceID), []byte(sourceID))
+	stub.InvokeError(t, "MergeMaps", []byte(sourceID), []byte("missing"))
+	marker := string(stub.Invoke(t, "MergeMaps", []byte(sourceID), []byte(targetID)))
+	stub.InvokeError(t, "MergeMaps", []byte(sourceID), []byte(other.Link.GetMapID()))
+
+	segment := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(marker)), segment)
+	if segment.Link.GetMapID() != targetID || segment.Link.Meta[MergedMapIDKey] != sourceID {
+		fmt.Println("Got marker", segment)
+		t.FailNow()
+	}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(sourceChild.GetLinkHashString())), segment)
+	if segment.Link.GetMapID() != sourceID || segment.Meta[MergedIntoKey] != targetID {
+		fmt.Println("Got merged segment", segment)
+		t.FailNow()
+	}
+
+	// Queries for either map return both
+	for _, mapID := range []string{sourceID, targetID} {
+		var found cs.SegmentSlice
+		json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"mapIds":["`+mapID+`"]}`)), &found)
+		if len(found) != 4 {
+			fmt.Println("Map", mapID, "returned", len(found), "segments, expected 4")
+			t.FailNow()
+		}
+	}
+
+	// The source map is frozen and keeps its metadata
+	if message := stub.InvokeError(t, "SaveSegment", mustMarshal(testutil.Child(sourceChild).Build())); message != "Map "+sourceID+" is frozen" {
+		fmt.Println("Got error", message)
+		t.FailNow()
+	}
+	stub.Invoke(t, "FreezeMap", []byte(sourceID), []byte("false"))
+	stub.SaveSegment(t, sourceChild)
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(sourceChild.GetLinkHashString())), segment)
+	if segment.Meta[MergedIntoKey] != targetID {
+		fmt.Println("Saving a merged segment again should keep mergedInto")
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "MergeMaps", []byte(targetID), []byte(other.Link.GetMapID())); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
+
+func TestPop_MergeMapsJob(t *testing.T) {
+	stub := newAdminStub(t)
+	segments := testutil.Chain("main", DefaultJobChunkSize+2)
+	target := testutil.Root("main").Build()
+	stub.SaveSegment(t, append(segments, target)...)
+
+	// Cold segments are marked too
+	cold := segments[1].GetLinkHashString()
+	stub.MockTransactionStart("archive")
+	segmentDocBytes, _, _ := getSegmentDocBytes(stub, cold)
+	if err := archiveSegment(stub, cold, segmentDocBytes); err != nil {
+		fmt.Println("Could not archive segment", err)
+		t.FailNow()
+	}
+	stub.MockTransactionEnd("archive")
+
+	stub.Invoke(t, "MergeMaps", []byte(segments[0].Link.GetMapID()), []byte(target.Link.GetMapID()))
+	merge := &MergeDoc{}
+	json.Unmarshal(stub.EventPayload, merge)
+	if merge.Job == "" {
+		fmt.Println("Merge should start a job")
+		t.FailNow()
+	}
+	job := &JobDoc{}
+	for !job.Done {
+		json.Unmarshal(stub.Invoke(t, "ContinueJob", []byte(merge.Job)), job)
+	}
+
+	for _, segment := range segments {
+		merged := &cs.Segment{}
+		json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(segment.GetLinkHashString())), merged)
+		if merged.Meta[MergedIntoKey] != target.Link.GetMapID() || len(merged.Link.State) != len(segment.Link.State) {
+			fmt.Println("Segment", segment.GetLinkHashString(), "was not marked")
+			t.FailNow()
+		}
+	}
+}
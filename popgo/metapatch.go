@@ -0,0 +1,304 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ObjectTypeMetaAudit is used in CouchDB documents of the audit logs of
+// segment meta updates
+const ObjectTypeMetaAudit = "metaaudit"
+
+// MaxPatchOperations is the maximum number of operations of a meta patch
+const MaxPatchOperations = 50
+
+// patchableMetaFields are the segment meta fields UpdateSegmentMetaPatch
+// can change. Other fields, like evidences or redactions, are managed by
+// the chaincode.
+var patchableMetaFields = []string{"labels", "externalIds"}
+
+// PatchOperation is an RFC 6902 operation. Move and copy aren't supported
+// since they could read values outside of the patchable fields.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MetaAuditEntry records a patch applied to the meta of a segment
+type MetaAuditEntry struct {
+	Patch         []PatchOperation `json:"patch"`
+	Submitter     *Submitter       `json:"submitter"`
+	TransactionID string           `json:"transactionId"`
+	Timestamp     int64            `json:"timestamp"`
+}
+
+// MetaAuditDoc is the audit log of the meta updates of a segment
+type MetaAuditDoc struct {
+	ObjectType string           `json:"docType"`
+	LinkHash   string           `json:"linkHash"`
+	Entries    []MetaAuditEntry `json:"entries"`
+}
+
+func getMetaAuditKey(stub shim.ChaincodeStubInterface, linkHash string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeMetaAudit, []string{linkHash})
+}
+
+// parsePatchPath splits a JSON pointer into unescaped tokens and checks it
+// points in a patchable field
+func parsePatchPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, errors.New("Path " + path + " should start with /")
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	if !containsString(patchableMetaFields, tokens[0]) {
+		return nil, errors.New("Path " + path + " cannot be patched")
+	}
+	return tokens, nil
+}
+
+// applyPatch applies the operations of a patch to the meta of a segment
+func applyPatch(meta map[string]interface{}, patch []PatchOperation) error {
+	for _, operation := range patch {
+		tokens, err := parsePatchPath(operation.Path)
+		if err != nil {
+			return err
+		}
+		var value interface{}
+		switch operation.Op {
+		case "add", "replace", "test":
+			if len(operation.Value) == 0 {
+				return errors.New("Operation " + operation.Op + " requires a value")
+			}
+			if err := json.Unmarshal(operation.Value, &value); err != nil {
+				return err
+			}
+		case "remove":
+		default:
+			return errors.New("Unsupported operation " + operation.Op)
+		}
+		if _, err := patchNode(meta, tokens, operation.Op, value); err != nil {
+			return errors.New(err.Error() + " at " + operation.Path)
+		}
+	}
+	return nil
+}
+
+// patchNode applies an operation at the path below a node and returns the
+// node, which is a new one when an array grows or shrinks
+func patchNode(node interface{}, tokens []string, op string, value interface{}) (interface{}, error) {
+	token, last := tokens[0], len(tokens) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok && (op != "add" || !last) {
+			return nil, errors.New("Value not found")
+		}
+		if !last {
+			child, err := patchNode(child, tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			n[token] = child
+			return n, nil
+		}
+		switch op {
+		case "add", "replace":
+			n[token] = value
+		case "remove":
+			delete(n, token)
+		case "test":
+			if !reflect.DeepEqual(child, value) {
+				return nil, errors.New("Test failed")
+			}
+		}
+		return n, nil
+
+	case []interface{}:
+		if last && op == "add" && token == "-" {
+			return append(n, value), nil
+		}
+		index, err := strconv.Atoi(token)
+		max := len(n) - 1
+		if last && op == "add" {
+			max = len(n)
+		}
+		if err != nil || index < 0 || index > max {
+			return nil, errors.New("Invalid array index " + token)
+		}
+		if !last {
+			child, err := patchNode(n[index], tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			n[index] = child
+			return n, nil
+		}
+		switch op {
+		case "add":
+			n = append(n, nil)
+			copy(n[index+1:], n[index:])
+			n[index] = value
+		case "remove":
+			n = append(n[:index], n[index+1:]...)
+		case "replace":
+			n[index] = value
+		case "test":
+			if !reflect.DeepEqual(n[index], value) {
+				return nil, errors.New("Test failed")
+			}
+		}
+		return n, nil
+	}
+	return nil, errors.New("Value not found")
+}
+
+// UpdateSegmentMetaPatch applies an RFC 6902 JSON Patch to the meta of a
+// segment and records it in the audit log of the segment. Only the labels
+// and externalIds fields can be patched, by the owner of the map of the
+// segment or an admin. Arguments are the link hash and the patch.
+func (s *SmartContract) UpdateSegmentMetaPatch(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 {
+		return shim.Error("Link hash and patch are required")
+	}
+	var patch []PatchOperation
+	if err := json.Unmarshal([]byte(args[1]), &patch); err != nil {
+		return shim.Error("Could not parse patch")
+	}
+	if len(patch) == 0 || len(patch) > MaxPatchOperations {
+		return shim.Error("A patch should have between 1 and " + strconv.Itoa(MaxPatchOperations) + " operations")
+	}
+
+	segmentDocBytes, cold, err := getSegmentDocBytes(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if segmentDocBytes == nil {
+		return shim.Error("Segment not found")
+	}
+	segmentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	segment := &segmentDoc.Segment
+
+	mapDoc, err := getMap(stub, segment.Link.GetMapID())
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if mapDoc != nil {
+		err = requireMapOwner(stub, mapDoc)
+	} else {
+		err = requireAdmin(stub)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if segment.Meta == nil {
+		segment.Meta = map[string]interface{}{}
+	}
+	if err := applyPatch(segment.Meta, patch); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := putSegmentDoc(stub, *segmentDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	if cold {
+		if err := deleteColdSegment(stub, args[0]); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	submitter, err := getSubmitter(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := addMetaAuditEntry(stub, args[0], MetaAuditEntry{
+		Patch:         patch,
+		Submitter:     submitter,
+		TransactionID: stub.GetTxID(),
+		Timestamp:     now.UnixNano() / int64(time.Millisecond),
+	}); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	segmentBytes, err := json.Marshal(segment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(segmentBytes)
+}
+
+// addMetaAuditEntry appends an entry to the audit log of a segment
+func addMetaAuditEntry(stub shim.ChaincodeStubInterface, linkHash string, entry MetaAuditEntry) error {
+	key, err := getMetaAuditKey(stub, linkHash)
+	if err != nil {
+		return err
+	}
+	auditBytes, err := stub.GetState(key)
+	if err != nil {
+		return err
+	}
+	audit := &MetaAuditDoc{ObjectType: ObjectTypeMetaAudit, LinkHash: linkHash}
+	if auditBytes != nil {
+		if err := json.Unmarshal(auditBytes, audit); err != nil {
+			return err
+		}
+	}
+	audit.Entries = append(audit.Entries, entry)
+	auditBytes, err = json.Marshal(audit)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, auditBytes)
+}
+
+// GetSegmentMetaAudit returns the audit log of the meta updates of a
+// segment
+func (s *SmartContract) GetSegmentMetaAudit(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 {
+		return shim.Error("Link hash is required")
+	}
+	if err := checkSegmentTenant(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := getMetaAuditKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	auditBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(auditBytes, nil)
+}
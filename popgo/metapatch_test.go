@@ -0,0 +1,91 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_UpdateSegmentMetaPatch(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Creator = testutil.NewIdentity("SellerMSP", "seller")
+	segment := testutil.Root("main").Build()
+	stub.SaveSegment(t, segment)
+	linkHash := []byte(segment.GetLinkHashString())
+
+	stub.Invoke(t, "UpdateSegmentMetaPatch", linkHash, []byte(`[
+		{"op":"add","path":"/labels","value":["reviewed"]},
+		{"op":"add","path":"/labels/-","value":"disputed"},
+		{"op":"add","path":"/externalIds","value":{"crm":"41","a/b":"x"}}
+	]`))
+	stub.Invoke(t, "UpdateSegmentMetaPatch", linkHash, []byte(`[
+		{"op":"test","path":"/externalIds/crm","value":"41"},
+		{"op":"replace","path":"/externalIds/crm","value":"42"},
+		{"op":"remove","path":"/externalIds/a~1b"},
+		{"op":"add","path":"/labels/0","value":"urgent"},
+		{"op":"remove","path":"/labels/1"}
+	]`))
+
+	got := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", linkHash), got)
+	if !reflect.DeepEqual(got.Meta["labels"], []interface{}{"urgent", "disputed"}) ||
+		!reflect.DeepEqual(got.Meta["externalIds"], map[string]interface{}{"crm": "42"}) {
+		fmt.Println("Got meta", got.Meta)
+		t.FailNow()
+	}
+
+	for _, patch := range []string{
+		`[{"op":"add","path":"/evidences","value":[]}]`,
+		`[{"op":"add","path":"","value":{}}]`,
+		`[{"op":"add","path":"labels","value":[]}]`,
+		`[{"op":"move","from":"/evidences","path":"/labels"}]`,
+		`[{"op":"replace","path":"/labels/5","value":"x"}]`,
+		`[{"op":"add","path":"/labels/0"}]`,
+		`[{"op":"test","path":"/externalIds/crm","value":"41"}]`,
+		`[{"op":"add","path":"/externalIds/crm/x","value":1}]`,
+		`[]`,
+	} {
+		stub.InvokeError(t, "UpdateSegmentMetaPatch", linkHash, []byte(patch))
+	}
+
+	stub.Creator = testutil.NewIdentity("BuyerMSP", "buyer")
+	patch := []byte(`[{"op":"add","path":"/labels/-","value":"x"}]`)
+	if message := stub.InvokeError(t, "UpdateSegmentMetaPatch", linkHash, patch); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("SellerMSP", "seller")
+	stub.SaveSegment(t, segment)
+	got = &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", linkHash), got)
+	if got.Meta["labels"] == nil {
+		fmt.Println("Saving a segment again should keep its labels")
+		t.FailNow()
+	}
+
+	audit := &MetaAuditDoc{}
+	json.Unmarshal(stub.Invoke(t, "GetSegmentMetaAudit", linkHash), audit)
+	if len(audit.Entries) != 2 || len(audit.Entries[1].Patch) != 5 || audit.Entries[0].Submitter.MSPID != "SellerMSP" {
+		fmt.Println("Got audit log", audit)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Mirror is stored in segment.meta.mirror of segments copied from
+// another channel
+type Mirror struct {
+	Channel       string `json:"channel"`
+	Chaincode     string `json:"chaincode"`
+	TransactionID string `json:"transactionId"`
+}
+
+// MirrorSegment copies a segment and its evidence from a chaincode of
+// another channel. Arguments are the channel, the chaincode name and the
+// link hash. The origin chaincode is only queried: Fabric doesn't commit
+// writes made on another channel.
+func (s *SmartContract) MirrorSegment(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 3 || args[0] == "" || args[1] == "" || args[2] == "" {
+		return shim.Error("Channel, chaincode and link hash are required")
+	}
+	channel, chaincode, linkHash := args[0], args[1], args[2]
+
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	res := stub.InvokeChaincode(chaincode, [][]byte{[]byte("GetSegment"), []byte(linkHash)}, channel)
+	if res.Status != shim.OK {
+		return shim.Error("Could not get segment from channel " + channel + ": " + res.Message)
+	}
+	if res.Payload == nil {
+		return shim.Error("Segment not found on channel " + channel)
+	}
+
+	segment := &cs.Segment{}
+	if err := json.Unmarshal(res.Payload, segment); err != nil {
+		return shim.Error("Could not parse segment")
+	}
+	if err := segment.Validate(); err != nil {
+		return shim.Error(err.Error())
+	}
+	if segment.GetLinkHashString() != linkHash {
+		return shim.Error("Mirrored segment has a different link hash")
+	}
+
+	segment.Meta["mirror"] = Mirror{
+		Channel:       channel,
+		Chaincode:     chaincode,
+		TransactionID: stub.GetTxID(),
+	}
+
+	if err := s.putSegment(stub, segment); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	segmentBytes, err := json.Marshal(segment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.SetEvent("mirrorSegment", segmentBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(segmentBytes)
+}
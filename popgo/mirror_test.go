@@ -0,0 +1,76 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_MirrorSegment(t *testing.T) {
+	origin := testutil.NewStub("pop", new(SmartContract))
+	segment := testutil.Root("main").WithState("amount", 42.0).Build()
+	origin.SaveSegment(t, segment)
+	linkHash := []byte(segment.GetLinkHashString())
+
+	stub := newAdminStub(t)
+	stub.MockPeerChaincode("pop", "other", origin)
+
+	mirrored := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "MirrorSegment", []byte("other"), []byte("pop"), linkHash), mirrored)
+	mirror, _ := mirrored.Meta["mirror"].(map[string]interface{})
+	if mirror["channel"] != "other" || mirror["chaincode"] != "pop" {
+		fmt.Println("Segment not marked as mirrored", mirrored.Meta)
+		t.FailNow()
+	}
+
+	stored := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", linkHash), stored)
+	if !reflect.DeepEqual(stored.Link, segment.Link) {
+		fmt.Println("Mirrored segment not stored")
+		t.FailNow()
+	}
+	original := &cs.Segment{}
+	json.Unmarshal(origin.Invoke(t, "GetSegment", linkHash), original)
+	if !reflect.DeepEqual(stored.Meta["evidence"], original.Meta["evidence"]) {
+		fmt.Println("Evidence of the origin channel should be kept")
+		t.FailNow()
+	}
+	if segments, _ := getMapCounter(stub, segment.Link.GetMapID(), MapCounterSegments); segments != 1 {
+		fmt.Println("Mirrored segment not counted")
+		t.FailNow()
+	}
+}
+
+func TestPop_MirrorSegmentInvalid(t *testing.T) {
+	origin := testutil.NewStub("pop", new(SmartContract))
+	stub := newAdminStub(t)
+	stub.MockPeerChaincode("pop", "other", origin)
+
+	stub.InvokeError(t, "MirrorSegment", []byte("other"), []byte("pop"), []byte("missing"))
+	stub.InvokeError(t, "MirrorSegment", []byte("unknown"), []byte("pop"), []byte("missing"))
+	stub.InvokeError(t, "MirrorSegment", []byte("other"), []byte("pop"))
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "MirrorSegment", []byte("other"), []byte("pop"), []byte("missing")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// AttributeDID is the certificate attribute identifying the actor a user
+// acts as. Users with it can manage the maps owned by the DID.
+const AttributeDID = "pop.did"
+
+// segmentOwner returns the DID of the actor a segment was submitted for, or
+// the MSP ID of its submitter
+func segmentOwner(segment *cs.Segment) string {
+	switch actor := segment.Meta["actor"].(type) {
+	case *Actor:
+		if actor.DID != "" {
+			return actor.DID
+		}
+	case map[string]interface{}:
+		if did, _ := actor["did"].(string); did != "" {
+			return did
+		}
+	}
+	return segmentTenant(segment)
+}
+
+// getMap returns the document of a map, nil if it doesn't exist
+func getMap(stub shim.ChaincodeStubInterface, mapID string) (*MapDoc, error) {
+	mapDocBytes, err := stub.GetState(mapID)
+	if err != nil || mapDocBytes == nil {
+		return nil, err
+	}
+	mapDoc := &MapDoc{}
+	if err := json.Unmarshal(mapDocBytes, mapDoc); err != nil {
+		return nil, err
+	}
+	// Segments and maps share the key space
+	if mapDoc.ObjectType != ObjectTypeMap {
+		return nil, nil
+	}
+	return mapDoc, nil
+}
+
+func putMap(stub shim.ChaincodeStubInterface, mapDoc *MapDoc) error {
+	mapDocBytes, err := json.Marshal(mapDoc)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(mapDoc.ID, mapDocBytes)
+}
+
+// requireMapOwner checks the creator of the transaction is an admin or the
+// owner of a map
+func requireMapOwner(stub shim.ChaincodeStubInterface, mapDoc *MapDoc) error {
+	if mapDoc.Owner != "" {
+		if strings.HasPrefix(mapDoc.Owner, "did:") {
+			attrs, err := getCreatorAttributes(stub)
+			if err != nil {
+				return err
+			}
+			if attrs[AttributeDID] == mapDoc.Owner {
+				return nil
+			}
+		} else if requireCreatorIn(stub, []string{mapDoc.Owner}) == nil {
+			return nil
+		}
+	}
+	return requireAdmin(stub)
+}
+
+// checkMapNotFrozen rejects segments of frozen maps
+func checkMapNotFrozen(stub shim.ChaincodeStubInterface, mapID string) error {
+	mapDoc, err := getMap(stub, mapID)
+	if err != nil {
+		return err
+	}
+	if mapDoc != nil && mapDoc.Frozen {
+		return errors.New("Map " + mapID + " is frozen")
+	}
+	return nil
+}
+
+// TransferMapOwnership gives a map to another DID or MSP ID
+func (s *SmartContract) TransferMapOwnership(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 || args[0] == "" || args[1] == "" {
+		return shim.Error("Map ID and new owner are required")
+	}
+	mapDoc, err := getMap(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if mapDoc == nil {
+		return shim.Error("Map not found")
+	}
+	if err := requireMapOwner(stub, mapDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	mapDoc.Owner = args[1]
+	if err := putMap(stub, mapDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// FreezeMap freezes or unfreezes a map
+func (s *SmartContract) FreezeMap(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 || args[0] == "" {
+		return shim.Error("Map ID and frozen state are required")
+	}
+	frozen, err := strconv.ParseBool(args[1])
+	if err != nil {
+		return shim.Error("Invalid frozen state " + args[1])
+	}
+	mapDoc, err := getMap(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if mapDoc == nil {
+		return shim.Error("Map not found")
+	}
+	if err := requireMapOwner(stub, mapDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	mapDoc.Frozen = frozen
+	if err := putMap(stub, mapDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// getOwnedMapIDs returns the IDs of the maps of an owner, restricted to a
+// list of map IDs if one is given
+func getOwnedMapIDs(stub shim.ChaincodeStubInterface, config *Config, owner string, in *MapIdsIn) ([]string, error) {
+	queryBytes, err := json.Marshal(MapQuery{Selector: MapSelector{ObjectType: ObjectTypeMap, Owner: owner}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkQueryPlan(config, mapIndexes, string(queryBytes)); err != nil {
+		return nil, err
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var mapIDs []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if in == nil || containsString(in.MapIds, queryResponse.Key) {
+			mapIDs = append(mapIDs, queryResponse.Key)
+		}
+	}
+	return mapIDs, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_MapOwnership(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Creator = testutil.NewIdentity("SellerMSP", "seller")
+	segments := testutil.Chain("main", 2)
+	stub.SaveSegment(t, segments...)
+	other := testutil.Root("main").Build()
+	stub.Creator = testutil.NewIdentity("BuyerMSP", "buyer")
+	stub.SaveSegment(t, other)
+	mapID := []byte(segments[0].Link.GetMapID())
+
+	var found cs.SegmentSlice
+	json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"owner":"SellerMSP"}`)), &found)
+	if len(found) != 2 {
+		fmt.Println("Expected 2 segments, got", len(found))
+		t.FailNow()
+	}
+
+	if message := stub.InvokeError(t, "TransferMapOwnership", mapID, []byte("BuyerMSP")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+	stub.Creator = testutil.NewIdentity("SellerMSP", "seller")
+	stub.Invoke(t, "TransferMapOwnership", mapID, []byte("did:example:buyer"))
+	stub.InvokeError(t, "FreezeMap", mapID, []byte("true"))
+
+	stub.Creator = testutil.NewIdentityWithAttributes("BuyerMSP", "buyer", map[string]string{AttributeDID: "did:example:buyer"})
+	stub.Invoke(t, "FreezeMap", mapID, []byte("true"))
+	segmentBytes, _ := json.Marshal(testutil.Child(segments[1]).Build())
+	stub.InvokeError(t, "SaveSegment", segmentBytes)
+
+	found = nil
+	json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"owner":"SellerMSP"}`)), &found)
+	if len(found) != 0 {
+		fmt.Println("Transferred maps should not be found, got", len(found))
+		t.FailNow()
+	}
+	json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"owner":"did:example:buyer"}`)), &found)
+	if len(found) != 2 {
+		fmt.Println("Expected 2 segments, got", len(found))
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+	stub.Invoke(t, "FreezeMap", mapID, []byte("false"))
+	stub.Invoke(t, "SaveSegment", segmentBytes)
+}
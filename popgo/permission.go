@@ -0,0 +1,75 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Permission lists the roles allowed to call a function. The creator of the
+// transaction must match every field that is set: its MSP ID must be one of
+// MSPs, one of its certificate OUs must be in OUs and it must have all the
+// Attributes.
+//
+// Permissions are checked before the function's own checks, so they can
+// only restrict access further.
+type Permission struct {
+	MSPs       []string          `json:"msps,omitempty"`
+	OUs        []string          `json:"ous,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// checkPermission checks the creator of the transaction may call a
+// function. Functions missing from the configured permissions are allowed.
+func checkPermission(stub shim.ChaincodeStubInterface, config *Config, function string) error {
+	permission, ok := config.Permissions[function]
+	if !ok || permission == nil {
+		return nil
+	}
+	cert, mspID, err := getCreatorCertificate(stub)
+	if err != nil {
+		return err
+	}
+	if cert == nil {
+		return ErrUnauthorized
+	}
+	if len(permission.MSPs) > 0 && !containsString(permission.MSPs, mspID) {
+		return ErrUnauthorized
+	}
+	if len(permission.OUs) > 0 {
+		found := false
+		for _, ou := range cert.Subject.OrganizationalUnit {
+			if containsString(permission.OUs, ou) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrUnauthorized
+		}
+	}
+	if len(permission.Attributes) > 0 {
+		attrs, err := getCreatorAttributes(stub)
+		if err != nil {
+			return err
+		}
+		for name, value := range permission.Attributes {
+			if attrs[name] != value {
+				return ErrUnauthorized
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_Permissions(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	config := []byte(`{"permissions":{
+		"SaveSegment":{"msps":["WriterMSP"],"ous":["operations"]},
+		"DeleteSegment":{"attributes":{"pop.role":"auditor"}},
+		"GetSegment":{"msps":["ReaderMSP"]}
+	}}`)
+	if res := stub.MockInit("init", [][]byte{[]byte("init"), config}); res.Status != shim.OK {
+		fmt.Println("Init failed", res.Message)
+		t.FailNow()
+	}
+	segment := testutil.Root("main").Build()
+	segmentBytes, _ := json.Marshal(segment)
+	linkHash := []byte(segment.GetLinkHashString())
+
+	stub.Creator = testutil.NewIdentity("WriterMSP", "writer")
+	if message := stub.InvokeError(t, "SaveSegment", segmentBytes); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+	stub.Creator = testutil.NewIdentityWithOUs("OtherMSP", "writer", "operations")
+	stub.InvokeError(t, "SaveSegment", segmentBytes)
+	stub.Creator = testutil.NewIdentityWithOUs("WriterMSP", "writer", "operations")
+	stub.Invoke(t, "SaveSegment", segmentBytes)
+
+	// Functions missing from the matrix are open
+	stub.Invoke(t, "FindSegments", []byte(`{}`))
+	stub.InvokeError(t, "ReadBundle", []byte(`[{"function":"GetSegment","args":["`+string(linkHash)+`"]}]`))
+
+	stub.InvokeError(t, "DeleteSegment", linkHash)
+	stub.Creator = testutil.NewIdentityWithAttributes("AuditMSP", "auditor", map[string]string{"pop.role": "auditor"})
+	stub.Invoke(t, "DeleteSegment", linkHash)
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ObjectTypePin is used in the CouchDB documents of segment pins
+const ObjectTypePin = "pin"
+
+// PinDoc records who pinned a segment and why. The segment document is
+// flagged too, so ArchiveSegments can skip it in its query.
+type PinDoc struct {
+	ObjectType string     `json:"docType"`
+	LinkHash   string     `json:"linkHash"`
+	Reason     string     `json:"reason,omitempty"`
+	PinnedBy   *Submitter `json:"pinnedBy,omitempty"`
+	PinnedAt   int64      `json:"pinnedAt"`
+}
+
+func getPinKey(stub shim.ChaincodeStubInterface, linkHash string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypePin, []string{linkHash})
+}
+
+// deletePin removes the pin of a deleted segment
+func deletePin(stub shim.ChaincodeStubInterface, linkHash string) error {
+	key, err := getPinKey(stub, linkHash)
+	if err != nil {
+		return err
+	}
+	return stub.DelState(key)
+}
+
+// setPinned flags a hot segment document as pinned or not
+func setPinned(stub shim.ChaincodeStubInterface, linkHash string, pinned bool) error {
+	segmentDocBytes, cold, err := getSegmentDocBytes(stub, linkHash)
+	if err != nil {
+		return err
+	}
+	if segmentDocBytes == nil {
+		return errors.New("Segment not found")
+	}
+	if cold && pinned {
+		return errors.New("Cold segments should be saved again before being pinned")
+	}
+	if cold {
+		return errors.New("Segment is not pinned")
+	}
+	segmentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+		return err
+	}
+	if segmentDoc.Pinned == pinned {
+		if pinned {
+			return errors.New("Segment is already pinned")
+		}
+		return errors.New("Segment is not pinned")
+	}
+	segmentDoc.Pinned = pinned
+	return putSegmentDoc(stub, *segmentDoc)
+}
+
+// PinSegment exempts a segment from archival, for instance while it is
+// under legal hold. Arguments are the link hash and an optional reason.
+// Cold segments must be saved again before being pinned.
+func (s *SmartContract) PinSegment(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Link hash is required")
+	}
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := setPinned(stub, args[0], true); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	pin := &PinDoc{ObjectType: ObjectTypePin, LinkHash: args[0]}
+	if len(args) > 1 {
+		pin.Reason = args[1]
+	}
+	var err error
+	if pin.PinnedBy, err = getSubmitter(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	pin.PinnedAt = now.UnixNano() / int64(time.Millisecond)
+
+	key, err := getPinKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	pinBytes, err := json.Marshal(pin)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, pinBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(pinBytes)
+}
+
+// UnpinSegment lets a pinned segment be archived again
+func (s *SmartContract) UnpinSegment(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Link hash is required")
+	}
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := setPinned(stub, args[0], false); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := deletePin(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_PinSegment(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"admins":["AdminMSP"],"coldAfterDays":30}`)})
+
+	day := int64(24 * 3600)
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 100 * day}
+	pinned, other := testutil.Root("main").Build(), testutil.Root("main").Build()
+	stub.SaveSegment(t, pinned, other)
+
+	pin := &PinDoc{}
+	json.Unmarshal(stub.Invoke(t, "PinSegment", []byte(pinned.GetLinkHashString()), []byte("case 42")), pin)
+	if pin.Reason != "case 42" || pin.PinnedBy == nil || pin.PinnedBy.MSPID != "AdminMSP" {
+		fmt.Println("Got pin", pin)
+		t.FailNow()
+	}
+	stub.InvokeError(t, "PinSegment", []byte(pinned.GetLinkHashString()))
+
+	// Saving a pinned segment again keeps it pinned
+	stub.SaveSegment(t, pinned)
+
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 140 * day}
+	result := &ArchiveResult{}
+	json.Unmarshal(stub.Invoke(t, "ArchiveSegments"), result)
+	if result.Archived != 1 || stub.State[pinned.GetLinkHashString()] == nil {
+		fmt.Println("Only the unpinned segment should be archived", result)
+		t.FailNow()
+	}
+	if message := stub.InvokeError(t, "PinSegment", []byte(other.GetLinkHashString())); message != "Cold segments should be saved again before being pinned" {
+		fmt.Println("Got error", message)
+		t.FailNow()
+	}
+
+	stub.Invoke(t, "UnpinSegment", []byte(pinned.GetLinkHashString()))
+	stub.InvokeError(t, "UnpinSegment", []byte(pinned.GetLinkHashString()))
+	json.Unmarshal(stub.Invoke(t, "ArchiveSegments"), result)
+	if result.Archived != 1 {
+		fmt.Println("Unpinned segments should be archived", result)
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "PinSegment", []byte(pinned.GetLinkHashString())); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
@@ -15,11 +15,13 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
-
-	"github.com/stratumn/sdk/store"
+	"strconv"
+	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	sc "github.com/hyperledger/fabric/protos/peer"
@@ -28,11 +30,13 @@ import (
 )
 
 // Pagination functionality (limit & skip) is implemented in CouchDB but not in Hyperledger Fabric (FAB-2809 and FAB-5369).
+// The indexes used by queries are packaged in META-INF/statedb/couchdb/indexes, Fabric 1.0 doesn't deploy them.
 // Creating an index in CouchDB:
 // curl -i -X POST -H "Content-Type: application/json" -d "{\"index\":{\"fields\":[\"chaincodeid\",\"data.docType\",\"data.id\"]},\"name\":\"indexOwner\",\"ddoc\":\"indexOwnerDoc\",\"type\":\"json\"}" http://localhost:5984/mychannel/_index
 
 // SmartContract defines chaincode logic
 type SmartContract struct {
+	configCache configCache
 }
 
 // ObjectType used in CouchDB documents
@@ -40,13 +44,37 @@ const (
 	ObjectTypeSegment = "segment"
 	ObjectTypeMap     = "map"
 	ObjectTypeValue   = "value"
+
+	ObjectTypeMapCounter     = "mapcounter"
+	ObjectTypeProcessCounter = "processcounter"
+	ObjectTypeHeight         = "height"
 )
 
 // MapDoc is used to store maps in CouchDB
 type MapDoc struct {
-	ObjectType string `json:"docType"`
-	ID         string `json:"id"`
-	Process    string `json:"process"`
+	ObjectType   string `json:"docType"`
+	ID           string `json:"id"`
+	Process      string `json:"process"`
+	RootLinkHash string `json:"rootLinkHash,omitempty"`
+	Tenant       string `json:"tenant,omitempty"`
+	// Owner is the DID of the actor or the MSP ID of the submitter of the
+	// first root segment, until ownership is transferred
+	Owner string `json:"owner,omitempty"`
+	// Frozen maps don't accept new segments
+	Frozen bool `json:"frozen,omitempty"`
+	// MergedInto is the map this map was merged into, see MergeMaps
+	MergedInto string `json:"mergedInto,omitempty"`
+}
+
+// MapSummary is returned by GetMaps
+type MapSummary struct {
+	ID           string `json:"id"`
+	Process      string `json:"process"`
+	SegmentCount int    `json:"segmentCount"`
+	// LastActivity is the timestamp in milliseconds of the transaction
+	// that saved the last segment of the map
+	LastActivity int64  `json:"lastActivity,omitempty"`
+	RootLinkHash string `json:"rootLinkHash,omitempty"`
 }
 
 // SegmentDoc is used to store segments in CouchDB
@@ -54,163 +82,166 @@ type SegmentDoc struct {
 	ObjectType string     `json:"docType"`
 	ID         string     `json:"id"`
 	Segment    cs.Segment `json:"segment"`
+	Sequence   int        `json:"sequence,omitempty"`
+	// SavedAt is the timestamp in milliseconds of the transaction that
+	// first saved the segment
+	SavedAt int64 `json:"savedAt,omitempty"`
+	// Tenant is the MSP ID of the submitter of the segment
+	Tenant string `json:"tenant,omitempty"`
+	// Priority is link.meta.priority, stored at the top level to be
+	// indexed
+	Priority float64 `json:"priority"`
+	// SplitState is set when the link state is stored apart, see
+	// SegmentStateDoc
+	SplitState bool `json:"splitState,omitempty"`
+	// Residency is the jurisdiction the state of the segment must stay
+	// in, stored at the top level to be indexed
+	Residency string `json:"residency,omitempty"`
+	// Pinned segments are never archived, see PinSegment
+	Pinned bool `json:"pinned,omitempty"`
 }
 
-// MapSelector used in MapQuery
-type MapSelector struct {
-	ObjectType string `json:"docType"`
-	Process    string `json:"process,omitempty"`
-}
-
-// MapQuery used in CouchDB rich queries
-type MapQuery struct {
-	Selector MapSelector `json:"selector,omitempty"`
-	Limit    int         `json:"limit,omitempty"`
-	Skip     int         `json:"skip,omitempty"`
-}
-
-func newMapQuery(filterBytes []byte) (string, error) {
-	filter := &store.MapFilter{}
-	if err := json.Unmarshal(filterBytes, filter); err != nil {
-		return "", err
+// Init method is called when the Smart Contract "pop" is instantiated by the blockchain network
+func (s *SmartContract) Init(APIstub shim.ChaincodeStubInterface) sc.Response {
+	_, args := APIstub.GetFunctionAndParameters()
+	if len(args) == 0 || args[0] == "" {
+		return shim.Success(nil)
 	}
-
-	mapSelector := MapSelector{}
-	mapSelector.ObjectType = ObjectTypeMap
-
-	if filter.Process != "" {
-		mapSelector.Process = filter.Process
+	APIstub, err := s.withConfigCache(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-
-	mapQuery := MapQuery{
-		Selector: mapSelector,
-		Limit:    filter.Pagination.Limit,
-		Skip:     filter.Pagination.Offset,
+	config := &Config{}
+	if err := json.Unmarshal([]byte(args[0]), config); err != nil {
+		return shim.Error("Could not parse config")
 	}
-
-	queryBytes, err := json.Marshal(mapQuery)
-	if err != nil {
-		return "", err
+	if err := config.validate(); err != nil {
+		return shim.Error(err.Error())
 	}
-
-	return string(queryBytes), nil
-}
-
-// SegmentSelector used in SegmentQuery
-type SegmentSelector struct {
-	ObjectType   string    `json:"docType"`
-	LinkHash     string    `json:"id,omitempty"`
-	PrevLinkHash string    `json:"segment.link.meta.prevLinkHash,omitempty"`
-	Process      string    `json:"segment.link.meta.process,omitempty"`
-	MapIds       *MapIdsIn `json:"segment.link.meta.mapId,omitempty"`
-	Tags         *TagsAll  `json:"segment.link.meta.tags,omitempty"`
-}
-
-// MapIdsIn specifies that segment mapId should be in specified list
-type MapIdsIn struct {
-	MapIds []string `json:"$in,omitempty"`
-}
-
-// TagsAll specifies all tags in specified list should be in segment tags
-type TagsAll struct {
-	Tags []string `json:"$all,omitempty"`
+	bootstrap := &Bootstrap{}
+	if err := json.Unmarshal([]byte(args[0]), bootstrap); err != nil {
+		return shim.Error("Could not parse bootstrap")
+	}
+	if err := bootstrap.validate(); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := saveConfig(APIstub, config); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := bootstrap.apply(APIstub); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
 }
 
-// SegmentQuery used in CouchDB rich queries
-type SegmentQuery struct {
-	Selector SegmentSelector `json:"selector,omitempty"`
-	Limit    int             `json:"limit,omitempty"`
-	Skip     int             `json:"skip,omitempty"`
-}
+// Invoke method is called as a result of an application request to run the Smart Contract "pop"
+func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) (res sc.Response) {
+	function, args := APIstub.GetFunctionAndParameters()
+	function = resolveAlias(function)
+	defer recoverInternalError(APIstub, function, &res)
 
-func newSegmentQuery(filterBytes []byte) (string, error) {
-	filter := &store.SegmentFilter{}
-	if err := json.Unmarshal(filterBytes, filter); err != nil {
-		return "", err
+	// Arguments are checked before any state is read
+	if err := checkArgs(function, args); err != nil {
+		return shim.Error(err.Error())
 	}
 
-	segmentSelector := SegmentSelector{}
-	segmentSelector.ObjectType = ObjectTypeSegment
-
-	if filter.PrevLinkHash != nil {
-		segmentSelector.PrevLinkHash = *filter.PrevLinkHash
+	APIstub, err := s.withConfigCache(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	if filter.Process != "" {
-		segmentSelector.Process = filter.Process
+	config, err := getConfig(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	if len(filter.MapIDs) > 0 {
-		segmentSelector.MapIds = &MapIdsIn{filter.MapIDs}
-	} else {
-		segmentSelector.Tags = nil
+	if err := checkPermission(APIstub, config, function); err != nil {
+		return shim.Error(err.Error())
 	}
-	if len(filter.Tags) > 0 {
-		segmentSelector.Tags = &TagsAll{filter.Tags}
-	} else {
-		segmentSelector.Tags = nil
+	if err := s.checkReadOnly(APIstub, function); err != nil {
+		return shim.Error(err.Error())
 	}
 
-	segmentQuery := SegmentQuery{
-		Selector: segmentSelector,
-		Limit:    filter.Pagination.Limit,
-		Skip:     filter.Pagination.Offset,
+	if strictDeterminism {
+		res = s.invokeTwice(APIstub)
+	} else {
+		res = s.dispatch(APIstub)
 	}
-
-	queryBytes, err := json.Marshal(segmentQuery)
-	if err != nil {
-		return "", err
+	if _, ok := s.readFunctions()[function]; ok {
+		return withHeight(APIstub, res)
 	}
-
-	return string(queryBytes), nil
+	return res
 }
 
-// Init method is called when the Smart Contract "pop" is instantiated by the blockchain network
-func (s *SmartContract) Init(APIstub shim.ChaincodeStubInterface) sc.Response {
-	return shim.Success(nil)
-}
-
-// Invoke method is called as a result of an application request to run the Smart Contract "pop"
-func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) sc.Response {
+// dispatch calls the Smart Contract function requested by the transaction.
+// Deprecated function names are forwarded to the function replacing them
+// with a hint in the response metadata.
+func (s *SmartContract) dispatch(APIstub shim.ChaincodeStubInterface) sc.Response {
 	// Retrieve the requested Smart Contract function and arguments
 	function, args := APIstub.GetFunctionAndParameters()
 
-	switch function {
-	case "GetSegment":
-		return s.GetSegment(APIstub, args)
-	case "FindSegments":
-		return s.FindSegments(APIstub, args)
-	case "GetMapIDs":
-		return s.GetMapIDs(APIstub, args)
-	case "SaveSegment":
-		return s.SaveSegment(APIstub, args)
-	case "DeleteSegment":
-		return s.DeleteSegment(APIstub, args)
-	case "SaveValue":
-		return s.SaveValue(APIstub, args)
-	case "GetValue":
-		return s.GetValue(APIstub, args)
-	case "DeleteValue":
-		return s.DeleteValue(APIstub, args)
-	default:
+	name := resolveAlias(function)
+	handler, ok := handlers[name]
+	if !ok {
 		return shim.Error("Invalid Smart Contract function name: " + function)
 	}
+	res := handler(s, APIstub, args)
+	if name != function {
+		return withDeprecation(res, function, name)
+	}
+	return res
 }
 
-// SaveMap saves map into CouchDB using map document
+// SaveMap saves map into CouchDB using map document.
+// The document is only written if its content changed, so concurrent root
+// segments of a map don't all rewrite it. Values that change with every
+// segment are kept in map counters instead.
 func (s *SmartContract) SaveMap(stub shim.ChaincodeStubInterface, segment *cs.Segment) error {
 	mapDoc := MapDoc{
-		ObjectTypeMap,
-		segment.Link.GetMapID(),
-		segment.Link.GetProcess(),
+		ObjectType:   ObjectTypeMap,
+		ID:           segment.Link.GetMapID(),
+		Process:      segment.Link.GetProcess(),
+		RootLinkHash: segment.GetLinkHashString(),
+		Tenant:       segmentTenant(segment),
+		Owner:        segmentOwner(segment),
+	}
+
+	existing, err := stub.GetState(segment.Link.GetMapID())
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		// The first root saved stays the root of the map
+		existingDoc := &MapDoc{}
+		if err := json.Unmarshal(existing, existingDoc); err != nil {
+			return err
+		}
+		if existingDoc.RootLinkHash != "" {
+			mapDoc.RootLinkHash = existingDoc.RootLinkHash
+			mapDoc.Tenant = existingDoc.Tenant
+			mapDoc.Owner = existingDoc.Owner
+		}
+		mapDoc.Frozen = existingDoc.Frozen
+		mapDoc.MergedInto = existingDoc.MergedInto
 	}
 	mapDocBytes, err := json.Marshal(mapDoc)
 	if err != nil {
 		return err
 	}
+	if bytes.Equal(existing, mapDocBytes) {
+		return nil
+	}
+	if existing == nil {
+		if err := addProcessCounter(stub, segment.Link.GetProcess(), ProcessCounterMaps, 1); err != nil {
+			return err
+		}
+	}
 
 	return stub.PutState(segment.Link.GetMapID(), mapDocBytes)
 }
 
-// SaveSegment saves segment into CouchDB using segment document
+// SaveSegment saves segment into CouchDB using segment document.
+// Gateways can pass the Actor the segment is submitted for as second
+// argument, with the actor's signature of the link. SaveOptions can be
+// passed as third argument.
 func (s *SmartContract) SaveSegment(stub shim.ChaincodeStubInterface, args []string) sc.Response {
 	// Parse segment
 	byteArgs := stub.GetArgs()
@@ -218,11 +249,37 @@ func (s *SmartContract) SaveSegment(stub shim.ChaincodeStubInterface, args []str
 	if err := json.Unmarshal(byteArgs[1], segment); err != nil {
 		return shim.Error("Could not parse segment")
 	}
+	if err := rejectCompensation(segment); err != nil {
+		return shim.Error(err.Error())
+	}
+	return s.saveSegment(stub, segment, args)
+}
+
+// saveSegment validates, stamps and stores a parsed segment. The arguments
+// are the ones of SaveSegment.
+func (s *SmartContract) saveSegment(stub shim.ChaincodeStubInterface, segment *cs.Segment, args []string) sc.Response {
+	options, err := parseSaveOptions(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	encrypter, err := getTransientEncrypter(stub, TransientEncryptionKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	// Validate segment
-	if err := segment.Validate(); err != nil {
+	actorJSON := ""
+	if len(args) > 1 {
+		actorJSON = args[1]
+	}
+	actor, err := validateSegment(stub, segment, actorJSON, encrypter != nil, options.ValidateAll)
+	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if actor != nil {
+		segment.Meta["actor"] = actor
+	}
+
 	// Set pending evidence
 	segment.SetEvidence(
 		map[string]interface{}{
@@ -230,26 +287,26 @@ func (s *SmartContract) SaveSegment(stub shim.ChaincodeStubInterface, args []str
 			"transactions": map[string]string{"transactionID": stub.GetTxID()},
 		})
 
-	// Check has prevLinkHash if not create map else check prevLinkHash exists
-	prevLinkHash := segment.Link.GetPrevLinkHashString()
-	if prevLinkHash == "" {
-		// Create map
-		if err := s.SaveMap(stub, segment); err != nil {
-			return shim.Error(err.Error())
-		}
+	// Stamp the submitter of the segment
+	submitter, err := getSubmitter(stub)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-
-	//  Save segment
-	segmentDoc := SegmentDoc{
-		ObjectTypeSegment,
-		segment.GetLinkHashString(),
-		*segment,
+	if submitter != nil {
+		segment.Meta["submitter"] = submitter
 	}
-	segmentDocBytes, err := json.Marshal(segmentDoc)
-	if err != nil {
+	if err := checkWriteTenant(stub, segment); err != nil {
 		return shim.Error(err.Error())
 	}
-	if err := stub.PutState(segment.GetLinkHashString(), segmentDocBytes); err != nil {
+
+	// Encrypt link state if a key was given
+	if encrypter != nil {
+		if err := encrypter.encrypt(segment); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	if err := s.putSegment(stub, segment); err != nil {
 		return shim.Error(err.Error())
 	}
 
@@ -262,26 +319,218 @@ func (s *SmartContract) SaveSegment(stub shim.ChaincodeStubInterface, args []str
 	return shim.Success(nil)
 }
 
+// putSegment stores a segment document, creating its map if the segment
+// is a root, and updates the counters
+func (s *SmartContract) putSegment(stub shim.ChaincodeStubInterface, segment *cs.Segment) error {
+	// Check has prevLinkHash if not create map else check prevLinkHash exists
+	prevLinkHash := segment.Link.GetPrevLinkHashString()
+	if prevLinkHash == "" {
+		// Create map
+		if err := s.SaveMap(stub, segment); err != nil {
+			return err
+		}
+	}
+
+	if err := checkMapNotFrozen(stub, segment.Link.GetMapID()); err != nil {
+		return err
+	}
+
+	existing, cold, err := getSegmentDocBytes(stub, segment.GetLinkHashString())
+	if err != nil {
+		return err
+	}
+
+	//  Save segment
+	segmentDoc := SegmentDoc{
+		ObjectType: ObjectTypeSegment,
+		ID:         segment.GetLinkHashString(),
+		Segment:    *segment,
+		Tenant:     segmentTenant(segment),
+	}
+	// GetPriority returns -Inf without priority, which isn't valid JSON
+	segmentDoc.Priority, _ = segment.Link.Meta["priority"].(float64)
+	if segmentDoc.Residency, err = segmentResidency(stub, segment); err != nil {
+		return err
+	}
+	// Evidences are only added by AddEvidence
+	delete(segmentDoc.Segment.Meta, "evidences")
+	delete(segmentDoc.Segment.Meta, CompensatedByKey)
+	delete(segmentDoc.Segment.Meta, LegalHoldsKey)
+	delete(segmentDoc.Segment.Meta, MergedIntoKey)
+	if existing != nil {
+		existingDoc := &SegmentDoc{}
+		if err := json.Unmarshal(existing, existingDoc); err != nil {
+			return err
+		}
+		if isRedacted(&existingDoc.Segment) {
+			return errors.New("Redacted segments cannot be saved again")
+		}
+		if evidences, ok := existingDoc.Segment.Meta["evidences"]; ok {
+			segmentDoc.Segment.Meta["evidences"] = evidences
+		}
+		// Patched fields are only changed by UpdateSegmentMetaPatch,
+		// compensatedBy by CompensateSegment and mergedInto by MergeMaps
+		for _, field := range append(patchableMetaFields, CompensatedByKey, MergedIntoKey) {
+			delete(segmentDoc.Segment.Meta, field)
+			if value, ok := existingDoc.Segment.Meta[field]; ok {
+				segmentDoc.Segment.Meta[field] = value
+			}
+		}
+		segmentDoc.Sequence = existingDoc.Sequence
+		segmentDoc.SavedAt = existingDoc.SavedAt
+		segmentDoc.Pinned = existingDoc.Pinned
+	} else {
+		if segmentDoc.Sequence, err = nextSequence(stub, segment.Link.GetMapID()); err != nil {
+			return err
+		}
+		now, err := txTime(stub)
+		if err != nil {
+			return err
+		}
+		segmentDoc.SavedAt = now.UnixNano() / int64(time.Millisecond)
+	}
+	if err := registerExternalID(stub, segment); err != nil {
+		return err
+	}
+	if err := putSegmentDoc(stub, segmentDoc); err != nil {
+		return err
+	}
+	if cold {
+		if err := deleteColdSegment(stub, segment.GetLinkHashString()); err != nil {
+			return err
+		}
+	}
+	if err := addHeight(stub); err != nil {
+		return err
+	}
+	if existing == nil {
+		if err := consumeQuota(stub, segment); err != nil {
+			return err
+		}
+		if err := addMapCounter(stub, segment.Link.GetMapID(), MapCounterSegments, 1); err != nil {
+			return err
+		}
+		if err := setLastActivity(stub, segment.Link.GetMapID()); err != nil {
+			return err
+		}
+		if err := addProcessCounter(stub, segment.Link.GetProcess(), ProcessCounterSegments, 1); err != nil {
+			return err
+		}
+		if err := addActivity(stub, segment.Link.GetProcess()); err != nil {
+			return err
+		}
+		if err := addTagCounters(stub, segment, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetSegment gets segment for given linkHash
 func (s *SmartContract) GetSegment(stub shim.ChaincodeStubInterface, args []string) sc.Response {
-	segmentDocBytes, err := stub.GetState(args[0])
+	if err := checkSegmentTenant(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	segmentDocBytes, _, err := getSegmentDocBytes(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 	if segmentDocBytes == nil {
 		return shim.Success(nil)
 	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	access, err := newLabelAccess(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	level, label, err := access.check(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if level == AccessDenied {
+		return shim.Error(ErrUnauthorized.Error())
+	}
 
 	segmentBytes, err := extractSegment(segmentDocBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	return shim.Success(segmentBytes)
+	segment := &cs.Segment{}
+	if err := json.Unmarshal(segmentBytes, segment); err != nil {
+		return shim.Error(err.Error())
+	}
+	changed, err := attachEvidences(stub, segment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	held, err := attachHolds(stub, segment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	changed = changed || held
+
+	// Decrypt link state if a key was given
+	decrypter, err := getTransientEncrypter(stub, TransientDecryptionKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if decrypter != nil {
+		if err := decrypter.decrypt(segment); err != nil {
+			return shim.Error(err.Error())
+		}
+		changed = true
+	}
+
+	// Hide link state until the embargo is over
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	embargoed, err := applyEmbargo(segment, now)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if level == AccessRedacted {
+		if err := redactClassified(segment, label); err != nil {
+			return shim.Error(err.Error())
+		}
+		changed = true
+	}
+
+	if changed || embargoed {
+		if segmentBytes, err = json.Marshal(segment); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	return successWithMeta(segmentBytes, nil)
 }
 
-// DeleteSegment deletes segment from CouchDB
+// DeleteSegment deletes segment from CouchDB. When dual approval of
+// deletions is configured, it only proposes the deletion and takes the
+// reason as second argument.
 func (s *SmartContract) DeleteSegment(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args) > 0 {
+		if err := checkLinkHashNotHeld(stub, args[0]); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if config.DeleteApproval != nil {
+		return proposeDeletion(stub, config.DeleteApproval, args)
+	}
+	return s.deleteSegment(stub, args)
+}
+
+// deleteSegment deletes a segment and updates the counters
+func (s *SmartContract) deleteSegment(stub shim.ChaincodeStubInterface, args []string) sc.Response {
 	shimResponse := s.GetSegment(stub, args)
 	if shimResponse.Status == shim.ERROR {
 		return shimResponse
@@ -291,71 +540,338 @@ func (s *SmartContract) DeleteSegment(stub shim.ChaincodeStubInterface, args []s
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if err := deleteSegmentState(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := deleteColdSegment(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := deleteEvidences(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := deleteAnnotations(stub, AnnotationTargetSegment, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := deletePin(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := deleteAcknowledgments(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := addHeight(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if segmentBytes != nil {
+		segment := &cs.Segment{}
+		if err := json.Unmarshal(segmentBytes, segment); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := addMapCounter(stub, segment.Link.GetMapID(), MapCounterSegments, -1); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := addProcessCounter(stub, segment.Link.GetProcess(), ProcessCounterSegments, -1); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := addTagCounters(stub, segment, -1); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := deleteExternalID(stub, segment); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
 	return shim.Success(segmentBytes)
 }
 
 // FindSegments returns segments that match specified segment filter
 func (s *SmartContract) FindSegments(stub shim.ChaincodeStubInterface, args []string) sc.Response {
-	queryString, err := newSegmentQuery([]byte(args[0]))
+	segmentQuery, err := parseSegmentQuery([]byte(args[0]))
 	if err != nil {
 		return shim.Error("Segment filter format incorrect")
 	}
+	return s.findSegments(stub, segmentQuery)
+}
+
+// findSegments runs a segment query. Results are sorted by priority unless
+// the query has its own sort order.
+func (s *SmartContract) findSegments(stub shim.ChaincodeStubInterface, segmentQuery *SegmentQuery) sc.Response {
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if segmentQuery.Selector.Tenant, err = getTenantScope(stub, config); err != nil {
+		return shim.Error(err.Error())
+	}
+	if segmentQuery.Selector.MapIds != nil {
+		mapIDs, err := redirectMapIDs(stub, segmentQuery.Selector.MapIds.MapIds)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		segmentQuery.Selector.MapIds = &MapIdsIn{mapIDs}
+	}
+	if segmentQuery.owner != "" {
+		mapIDs, err := getOwnedMapIDs(stub, config, segmentQuery.owner, segmentQuery.Selector.MapIds)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if len(mapIDs) == 0 {
+			return successWithMeta([]byte("null"), nil)
+		}
+		segmentQuery.Selector.MapIds = &MapIdsIn{mapIDs}
+	}
+	if len(segmentQuery.mapAnnotations) > 0 {
+		mapIDs, err := getAnnotatedIDs(stub, config, AnnotationTargetMap, segmentQuery.mapAnnotations)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if segmentQuery.Selector.MapIds != nil {
+			mapIDs = intersectStrings(mapIDs, segmentQuery.Selector.MapIds.MapIds)
+		}
+		if len(mapIDs) == 0 {
+			return successWithMeta([]byte("null"), nil)
+		}
+		segmentQuery.Selector.MapIds = &MapIdsIn{mapIDs}
+	}
+	if len(segmentQuery.annotations) > 0 {
+		linkHashes, err := getAnnotatedIDs(stub, config, AnnotationTargetSegment, segmentQuery.annotations)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !segmentQuery.Selector.restrictLinkHashes(linkHashes) {
+			return successWithMeta([]byte("null"), nil)
+		}
+	}
+	if segmentQuery.disputed != nil {
+		linkHashes, err := getDisputedLinkHashes(stub, config)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if *segmentQuery.disputed {
+			if !segmentQuery.Selector.restrictLinkHashes(linkHashes) {
+				return successWithMeta([]byte("null"), nil)
+			}
+		} else {
+			segmentQuery.Selector.excludeLinkHashes(linkHashes)
+		}
+	}
+	if segmentQuery.notAcknowledgedBy != "" {
+		linkHashes, err := getAcknowledgedLinkHashes(stub, config, segmentQuery.notAcknowledgedBy)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		segmentQuery.Selector.excludeLinkHashes(linkHashes)
+	}
+
+	// Fetch one more segment than the page size to know if there are more
+	limit := config.pageLimit(segmentQuery.Limit)
+	segmentQuery.Limit = limit + 1
+
+	queryBytes, err := json.Marshal(segmentQuery)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	meta, err := checkQueryPlan(config, segmentIndexes, string(queryBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if meta == nil {
+		meta = &ResponseMeta{}
+	}
+
+	resultsIterator, degraded, err := getQueryResult(stub, string(queryBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+	meta.Degraded = degraded
 
-	resultsIterator, err := stub.GetQueryResult(queryString)
+	now, err := txTime(stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	var segments cs.SegmentSlice
+	var rows segmentRows
 
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-		segmentDoc := &SegmentDoc{}
-		if err := json.Unmarshal(queryResponse.Value, segmentDoc); err != nil {
+		row := &segmentRow{}
+		if err := json.Unmarshal(queryResponse.Value, row); err != nil {
 			return shim.Error(err.Error())
 		}
-		segments = append(segments, &segmentDoc.Segment)
+		rows = append(rows, row)
+	}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		meta.Truncated = true
+	}
+	if err := classifyRows(stub, config, rows); err != nil {
+		return shim.Error(err.Error())
 	}
-	sort.Sort(segments)
 
-	resultBytes, err := json.Marshal(segments)
+	// Segments are rendered in query order so that the bookmark is an
+	// offset, sorting happens afterwards
+	n, err := rows.render(stub, now, config.responseBudget(segmentQuery.maxResponseBytes))
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if n < len(rows) {
+		rows = rows[:n]
+		meta.Truncated = true
+	}
+	if meta.Truncated {
+		meta.Bookmark = strconv.Itoa(segmentQuery.Skip + len(rows))
+	}
+	if len(segmentQuery.Sort) == 0 {
+		sort.Sort(rows)
+	}
 
-	return shim.Success(resultBytes)
+	resultBytes := rows.marshal()
+
+	return successWithMeta(resultBytes, meta)
 }
 
-// GetMapIDs returns mapIDs for maps that match specified map filter
+// GetMapIDs returns mapIDs for maps that match specified map filter, in a
+// Page
 func (s *SmartContract) GetMapIDs(stub shim.ChaincodeStubInterface, args []string) sc.Response {
-	queryString, err := newMapQuery([]byte(args[0]))
+	mapDocs, meta, err := findMaps(stub, []byte(args[0]))
 	if err != nil {
-		return shim.Error("Map filter format incorrect")
+		return shim.Error(err.Error())
 	}
 
-	resultsIterator, err := stub.GetQueryResult(queryString)
+	mapIDs := []string{}
+	for _, mapDoc := range mapDocs {
+		mapIDs = append(mapIDs, mapDoc.ID)
+	}
+	total, err := estimateMapCount(stub, []byte(args[0]), len(mapIDs), meta.Truncated)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	resultBytes, err := newPage(mapIDs, meta, total)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(resultBytes, meta)
+}
 
-	var mapIDs []string
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
+// estimateMapCount returns the number of maps matching a map filter. It is
+// exact on the last page. Otherwise it is the map counter of the process
+// of the filter, which isn't available to tenants since it counts the maps
+// of all tenants.
+func estimateMapCount(stub shim.ChaincodeStubInterface, filterBytes []byte, found int, hasMore bool) (int, error) {
+	mapQuery, err := parseMapQuery(filterBytes)
+	if err != nil {
+		return 0, err
+	}
+	if !hasMore {
+		return mapQuery.Skip + found, nil
+	}
+	if mapQuery.Selector.Process == "" {
+		return 0, nil
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return 0, err
+	}
+	tenant, err := getTenantScope(stub, config)
+	if err != nil || tenant != "" {
+		return 0, err
+	}
+	return getProcessCounter(stub, mapQuery.Selector.Process, ProcessCounterMaps)
+}
+
+// GetMaps returns summaries of the maps that match a map filter
+func (s *SmartContract) GetMaps(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	mapDocs, meta, err := findMaps(stub, []byte(args[0]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	summaries := []MapSummary{}
+	for _, mapDoc := range mapDocs {
+		summary := MapSummary{
+			ID:           mapDoc.ID,
+			Process:      mapDoc.Process,
+			RootLinkHash: mapDoc.RootLinkHash,
+		}
+		if summary.SegmentCount, err = getMapCounter(stub, mapDoc.ID, MapCounterSegments); err != nil {
+			return shim.Error(err.Error())
+		}
+		lastActivity, err := getMapCounter(stub, mapDoc.ID, MapCounterLastActivity)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-		mapIDs = append(mapIDs, queryResponse.Key)
+		summary.LastActivity = int64(lastActivity)
+		summaries = append(summaries, summary)
 	}
-
-	sort.Strings(mapIDs)
-	resultBytes, err := json.Marshal(mapIDs)
+	resultBytes, err := json.Marshal(summaries)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	return shim.Success(resultBytes)
+	return successWithMeta(resultBytes, meta)
+}
+
+// findMaps returns the map documents that match a map filter, sorted by ID
+func findMaps(stub shim.ChaincodeStubInterface, filterBytes []byte) ([]*MapDoc, *ResponseMeta, error) {
+	mapQuery, err := parseMapQuery(filterBytes)
+	if err != nil {
+		return nil, nil, errors.New("Map filter format incorrect")
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if mapQuery.Selector.Tenant, err = getTenantScope(stub, config); err != nil {
+		return nil, nil, err
+	}
+
+	// Fetch one more map than the page size to know if there are more
+	limit := config.pageLimit(mapQuery.Limit)
+	mapQuery.Limit = limit + 1
+
+	queryBytes, err := json.Marshal(mapQuery)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta, err := checkQueryPlan(config, mapIndexes, string(queryBytes))
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta == nil {
+		meta = &ResponseMeta{}
+	}
+
+	resultsIterator, degraded, err := getQueryResult(stub, string(queryBytes))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultsIterator.Close()
+	meta.Degraded = degraded
+
+	var mapDocs []*MapDoc
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		mapDoc := &MapDoc{}
+		if err := json.Unmarshal(queryResponse.Value, mapDoc); err != nil {
+			return nil, nil, err
+		}
+		mapDoc.ID = queryResponse.Key
+		mapDocs = append(mapDocs, mapDoc)
+	}
+	if len(mapDocs) > limit {
+		mapDocs = mapDocs[:limit]
+		meta.Truncated = true
+		meta.Bookmark = strconv.Itoa(mapQuery.Skip + limit)
+	}
+
+	sort.Slice(mapDocs, func(i, j int) bool { return mapDocs[i].ID < mapDocs[j].ID })
+	return mapDocs, meta, nil
 }
 
 // SaveValue saves key, value in CouchDB
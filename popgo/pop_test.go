@@ -24,9 +24,10 @@ import (
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/piedup/chaincode/popgo/testutil"
 	"github.com/stratumn/sdk/cs"
 	"github.com/stratumn/sdk/cs/cstesting"
-	"github.com/stratumn/sdk/testutil"
+	sdktestutil "github.com/stratumn/sdk/testutil"
 )
 
 func checkQuery(t *testing.T, stub *shim.MockStub, args [][]byte) []byte {
@@ -153,6 +154,31 @@ func TestPop_GetMapIDs(t *testing.T) {
 	}
 }
 
+func TestPop_GetMapIDsPage(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.SaveSegment(t, testutil.Root("main").Build(), testutil.Root("main").Build(), testutil.Root("main").Build(), testutil.Root("other").Build())
+
+	for _, test := range []struct {
+		filter   string
+		expected Page
+		found    int
+	}{
+		{`{"process":"main","pagination":{"limit":2}}`, Page{Bookmark: "2", HasMore: true, TotalEstimated: 3}, 2},
+		{`{"process":"main","pagination":{"offset":2,"limit":2}}`, Page{TotalEstimated: 3}, 1},
+		{`{"pagination":{"limit":2}}`, Page{Bookmark: "2", HasMore: true}, 2},
+		{`{"process":"missing"}`, Page{}, 0},
+	} {
+		page := &Page{}
+		json.Unmarshal(stub.Invoke(t, "GetMapIDs", []byte(test.filter)), page)
+		var mapIDs []string
+		json.Unmarshal(page.Data, &mapIDs)
+		if page.Bookmark != test.expected.Bookmark || page.HasMore != test.expected.HasMore || page.TotalEstimated != test.expected.TotalEstimated || len(mapIDs) != test.found {
+			fmt.Println("Filter", test.filter, "returned", string(page.Data), page.Bookmark, page.HasMore, page.TotalEstimated)
+			t.FailNow()
+		}
+	}
+}
+
 func TestPop_SaveSegmentIncorrect(t *testing.T) {
 	cc := new(SmartContract)
 	stub := shim.NewMockStub("pop", cc)
@@ -169,6 +195,52 @@ func TestPop_SaveSegmentIncorrect(t *testing.T) {
 	}
 }
 
+func TestPop_SaveSegmentInvalid(t *testing.T) {
+	root := testutil.Root("main").Build()
+
+	tests := []struct {
+		name    string
+		segment *cs.Segment
+		message string
+	}{
+		{"missing process", testutil.Root("").Build(), "link.meta.process should be a non empty string"},
+		{"missing mapId", testutil.Root("main").WithMapID("").Build(), "link.meta.mapId should be a non empty string"},
+		{"empty prevLinkHash", testutil.Child(root).WithLinkMeta("prevLinkHash", "").Build(), "link.meta.prevLinkHash should be a non empty string"},
+		{"invalid tags", testutil.Root("main").WithLinkMeta("tags", "tag").Build(), "link.meta.tags should be an array of non empty string"},
+		{"empty tag", testutil.Root("main").WithTags("").Build(), "link.meta.tags should be an array of non empty string"},
+		{"invalid priority", testutil.Root("main").WithLinkMeta("priority", "high").Build(), "link.meta.priority should be a float64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := testutil.NewStub("pop", new(SmartContract))
+			segmentBytes, _ := json.Marshal(tt.segment)
+			if message := stub.InvokeError(t, "SaveSegment", segmentBytes); message != tt.message {
+				fmt.Println("Failed with error", message, "expected", tt.message)
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestPop_SaveSegmentChain(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segments := testutil.Chain("main", 3)
+	stub.SaveSegment(t, segments...)
+
+	for _, segment := range segments {
+		payload := stub.Invoke(t, "GetSegment", []byte(segment.GetLinkHashString()))
+		saved := &cs.Segment{}
+		if err := json.Unmarshal(payload, saved); err != nil {
+			t.FailNow()
+		}
+		if saved.Link.GetPrevLinkHashString() != segment.Link.GetPrevLinkHashString() {
+			fmt.Println("Segment not saved into database")
+			t.FailNow()
+		}
+	}
+}
+
 func TestPop_GetSegmentDoesNotExist(t *testing.T) {
 	cc := new(SmartContract)
 	stub := shim.NewMockStub("pop", cc)
@@ -180,6 +252,21 @@ func TestPop_GetSegmentDoesNotExist(t *testing.T) {
 	}
 }
 
+func TestPop_HasSegment(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segment := testutil.Root("main").Build()
+	stub.SaveSegment(t, segment)
+	linkHash := segment.GetLinkHashString()
+
+	exists := map[string]bool{}
+	json.Unmarshal(stub.Invoke(t, "HasSegment", []byte(linkHash), []byte("unknown")), &exists)
+	if len(exists) != 2 || !exists[linkHash] || exists["unknown"] {
+		fmt.Println("Got existence", exists)
+		t.FailNow()
+	}
+	stub.InvokeError(t, "HasSegment")
+}
+
 func TestPop_SaveValue(t *testing.T) {
 	cc := new(SmartContract)
 	stub := shim.NewMockStub("pop", cc)
@@ -254,7 +341,7 @@ type GetMapIDsMockStub struct {
 func (p *GetMapIDsMockStub) GetQueryResult(querystring string) (shim.StateQueryIteratorInterface, error) {
 	mapDoc := &MapDoc{
 		ObjectType: ObjectTypeMap,
-		ID:         testutil.RandomString(24),
+		ID:         sdktestutil.RandomString(24),
 		Process:    "main",
 	}
 	iterator := mapIterator{
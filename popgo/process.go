@@ -0,0 +1,400 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// ObjectTypeProcess is used in CouchDB documents of process templates
+const ObjectTypeProcess = "process"
+
+// SchemaVersionKey is the link meta key of the state schema version
+const SchemaVersionKey = "schemaVersion"
+
+// ProcessDoc is a process template. Segments of processes that have a
+// template must follow it: root segments must have one of the initial
+// actions and child segments an action allowed after the action of their
+// parent by the transition table.
+//
+// Templates with rules are evaluated by the rules engine instead: every
+// transition must match a rule and the caller must have one of the roles
+// of the rule.
+type ProcessDoc struct {
+	ObjectType     string              `json:"docType"`
+	Name           string              `json:"name"`
+	InitialActions []string            `json:"initialActions,omitempty"`
+	Transitions    map[string][]string `json:"transitions,omitempty"`
+
+	Steps []string         `json:"steps,omitempty"`
+	Rules []TransitionRule `json:"rules,omitempty"`
+
+	// Owners are the MSP IDs allowed to manage the webhooks of the process
+	Owners []string `json:"owners,omitempty"`
+
+	// Acknowledgers are the MSP IDs expected to acknowledge the segments
+	// of the process
+	Acknowledgers []string `json:"acknowledgers,omitempty"`
+
+	// Residency is the default jurisdiction of the segments of the
+	// process, segments can override it with link.meta.residency
+	Residency string `json:"residency,omitempty"`
+
+	// Private processes are assigned a collection of the private data
+	// collections pool when they are created
+	Private    bool   `json:"private,omitempty"`
+	Collection string `json:"collection,omitempty"`
+
+	// Schemas are the versions of the link state schema. Segments declare
+	// their version in link.meta.schemaVersion.
+	Schemas map[string]DocSchema `json:"schemas,omitempty"`
+
+	// Tenant is the MSP ID owning the process in multi-tenant channels,
+	// see tenant.go
+	Tenant string `json:"tenant,omitempty"`
+
+	// Conventions constrain the tags and map IDs of the segments
+	Conventions *Conventions `json:"conventions,omitempty"`
+}
+
+// TransitionRule allows a transition between two steps. From is empty for
+// root segments. Any caller can perform transitions without roles.
+type TransitionRule struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Roles  []Role  `json:"roles,omitempty"`
+	Quorum *Quorum `json:"quorum,omitempty"`
+}
+
+// Quorum requires the parent segment to be acknowledged by Required of the
+// MSPs before the transition. MSPs default to the acknowledgers of the
+// process.
+type Quorum struct {
+	Required int      `json:"required"`
+	MSPIDs   []string `json:"mspIds,omitempty"`
+}
+
+// Role matches callers by MSP ID and/or certificate attribute
+type Role struct {
+	MSPID     string `json:"mspId,omitempty"`
+	Attribute string `json:"attribute,omitempty"`
+	Value     string `json:"value,omitempty"`
+}
+
+// validate checks the steps of the rules are declared
+func (p *ProcessDoc) validate() error {
+	if p.Name == "" {
+		return errors.New("Process name is required")
+	}
+	if err := validateResidency(p.Residency); err != nil {
+		return err
+	}
+	if p.Collection != "" {
+		return errors.New("Collections are assigned to private processes")
+	}
+	for version, schema := range p.Schemas {
+		if version == "" {
+			return errors.New("Schema versions should not be empty")
+		}
+		if err := schema.validate(); err != nil {
+			return errors.New("Schema " + version + ": " + err.Error())
+		}
+	}
+	if p.Conventions != nil {
+		if err := p.Conventions.validate(); err != nil {
+			return err
+		}
+	}
+	if len(p.Rules) == 0 {
+		if len(p.InitialActions) == 0 {
+			return errors.New("Process template should have initial actions or rules")
+		}
+		return nil
+	}
+	for _, rule := range p.Rules {
+		if rule.To == "" {
+			return errors.New("Rules should have a target step")
+		}
+		for _, step := range []string{rule.From, rule.To} {
+			if step != "" && len(p.Steps) > 0 && !containsString(p.Steps, step) {
+				return errors.New("Step " + step + " is not declared")
+			}
+		}
+		for _, role := range rule.Roles {
+			if role.MSPID == "" && role.Attribute == "" {
+				return errors.New("Roles should have an MSP ID or an attribute")
+			}
+		}
+		if rule.Quorum != nil {
+			if rule.From == "" {
+				return errors.New("Rules starting a map cannot have a quorum")
+			}
+			mspIDs := p.quorumMSPs(rule.Quorum)
+			if rule.Quorum.Required < 1 || rule.Quorum.Required > len(mspIDs) {
+				return errors.New("Quorum of " + rule.To + " should require between 1 and " + strconv.Itoa(len(mspIDs)) + " acknowledgments")
+			}
+		}
+	}
+	return nil
+}
+
+// quorumMSPs returns the MSP IDs that count toward a quorum
+func (p *ProcessDoc) quorumMSPs(quorum *Quorum) []string {
+	if len(quorum.MSPIDs) > 0 {
+		return quorum.MSPIDs
+	}
+	return p.Acknowledgers
+}
+
+// checkQuorum checks enough MSPs of a quorum acknowledged the parent segment
+func (p *ProcessDoc) checkQuorum(stub shim.ChaincodeStubInterface, quorum *Quorum, parentLinkHash, to string) error {
+	acknowledged, err := getAcknowledgingMSPs(stub, parentLinkHash)
+	if err != nil {
+		return err
+	}
+	count := len(intersectStrings(p.quorumMSPs(quorum), acknowledged))
+	if count < quorum.Required {
+		return errors.New("Action " + to + " requires " + strconv.Itoa(quorum.Required) + " acknowledgments of the parent segment, got " + strconv.Itoa(count))
+	}
+	return nil
+}
+
+// matches tells whether the caller has the role
+func (r *Role) matches(mspID string, attributes map[string]string) bool {
+	if r.MSPID != "" && r.MSPID != mspID {
+		return false
+	}
+	if r.Attribute != "" {
+		value, ok := attributes[r.Attribute]
+		if !ok || (r.Value != "" && value != r.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluate checks a transition is allowed for the caller. The quorums of
+// the matching rules must all be met.
+func (p *ProcessDoc) evaluate(stub shim.ChaincodeStubInterface, parentLinkHash, from, to string) error {
+	var roles []Role
+	found, open := false, false
+	for _, rule := range p.Rules {
+		if rule.From != from || rule.To != to {
+			continue
+		}
+		found = true
+		if rule.Quorum != nil {
+			if err := p.checkQuorum(stub, rule.Quorum, parentLinkHash, to); err != nil {
+				return err
+			}
+		}
+		if len(rule.Roles) == 0 {
+			open = true
+		}
+		roles = append(roles, rule.Roles...)
+	}
+	if !found {
+		if from == "" {
+			return errors.New("Action " + to + " cannot start a map of process " + p.Name)
+		}
+		return errors.New("Action " + to + " cannot follow " + from + " in process " + p.Name)
+	}
+	if open {
+		return nil
+	}
+
+	identity, err := getCreatorIdentity(stub)
+	if err != nil {
+		return err
+	}
+	attributes, err := getCreatorAttributes(stub)
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if role.matches(identity.Mspid, attributes) {
+			return nil
+		}
+	}
+	return ErrUnauthorized
+}
+
+func getProcessKey(stub shim.ChaincodeStubInterface, name string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeProcess, []string{name})
+}
+
+// getProcess returns the template of a process, nil if it has none
+func getProcess(stub shim.ChaincodeStubInterface, name string) (*ProcessDoc, error) {
+	key, err := getProcessKey(stub, name)
+	if err != nil {
+		return nil, err
+	}
+	processBytes, err := stub.GetState(key)
+	if err != nil || processBytes == nil {
+		return nil, err
+	}
+	process := &ProcessDoc{}
+	if err := json.Unmarshal(processBytes, process); err != nil {
+		return nil, err
+	}
+	return process, nil
+}
+
+// CreateProcess creates the template of a process
+func (s *SmartContract) CreateProcess(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 {
+		return shim.Error("Process template is required")
+	}
+	process := &ProcessDoc{}
+	if err := json.Unmarshal([]byte(args[0]), process); err != nil {
+		return shim.Error("Could not parse process template")
+	}
+	if err := process.validate(); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	existing, err := getProcess(stub, process.Name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("Process " + process.Name + " already exists")
+	}
+	if process.Private {
+		config, err := getConfig(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if process.Collection, err = assignCollection(config, process.Name); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	processBytes, err := putProcess(stub, process)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(processBytes)
+}
+
+// putProcess stores the template of a process and returns its document
+func putProcess(stub shim.ChaincodeStubInterface, process *ProcessDoc) ([]byte, error) {
+	process.ObjectType = ObjectTypeProcess
+	key, err := getProcessKey(stub, process.Name)
+	if err != nil {
+		return nil, err
+	}
+	processBytes, err := json.Marshal(process)
+	if err != nil {
+		return nil, err
+	}
+	if err := stub.PutState(key, processBytes); err != nil {
+		return nil, err
+	}
+	return processBytes, nil
+}
+
+// GetProcess returns the template of a process
+func (s *SmartContract) GetProcess(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if err := checkProcessTenant(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := getProcessKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	processBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(processBytes)
+}
+
+// validateStateSchema checks the link state against the schema version
+// declared by a segment, when its process has schemas
+func validateStateSchema(stub shim.ChaincodeStubInterface, segment *cs.Segment) error {
+	process, err := getProcess(stub, segment.Link.GetProcess())
+	if err != nil || process == nil || len(process.Schemas) == 0 {
+		return err
+	}
+	version, _ := segment.Link.Meta[SchemaVersionKey].(string)
+	if version == "" {
+		return errors.New("link.meta." + SchemaVersionKey + " is required by process " + process.Name)
+	}
+	schema, ok := process.Schemas[version]
+	if !ok {
+		return errors.New("Unknown schema version " + version + " of process " + process.Name)
+	}
+	return schema.check(segment.Link.State)
+}
+
+// validateTransition checks a segment follows the template of its process
+func validateTransition(stub shim.ChaincodeStubInterface, segment *cs.Segment) error {
+	process, err := getProcess(stub, segment.Link.GetProcess())
+	if err != nil || process == nil {
+		return err
+	}
+	action, _ := segment.Link.Meta["action"].(string)
+
+	prevLinkHash := segment.Link.GetPrevLinkHashString()
+	if prevLinkHash == "" {
+		if len(process.Rules) > 0 {
+			return process.evaluate(stub, "", "", action)
+		}
+		if !containsString(process.InitialActions, action) {
+			return errors.New("Action " + action + " cannot start a map of process " + process.Name)
+		}
+		return nil
+	}
+
+	parentDocBytes, _, err := getSegmentDocBytes(stub, prevLinkHash)
+	if err != nil {
+		return err
+	}
+	if parentDocBytes == nil {
+		return errors.New("Parent segment not found")
+	}
+	parentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(parentDocBytes, parentDoc); err != nil {
+		return err
+	}
+	parentAction, _ := parentDoc.Segment.Link.Meta["action"].(string)
+	if len(process.Rules) > 0 {
+		return process.evaluate(stub, prevLinkHash, parentAction, action)
+	}
+	if !containsString(process.Transitions[parentAction], action) {
+		return errors.New("Action " + action + " cannot follow " + parentAction + " in process " + process.Name)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+var testProcess = []byte(`{
+	"name": "auction",
+	"initialActions": ["open"],
+	"transitions": {
+		"open": ["bid", "close"],
+		"bid": ["bid", "close"]
+	}
+}`)
+
+func TestPop_CreateProcess(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Invoke(t, "CreateProcess", testProcess)
+	stub.InvokeError(t, "CreateProcess", testProcess)
+	stub.InvokeError(t, "CreateProcess", []byte(`{"name":"empty"}`))
+
+	process := &ProcessDoc{}
+	json.Unmarshal(stub.Invoke(t, "GetProcess", []byte("auction")), process)
+	if process.Name != "auction" || len(process.Transitions["open"]) != 2 {
+		fmt.Println("Process template not stored", process)
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "CreateProcess", []byte(`{"name":"other","initialActions":["a"]}`)); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
+
+func TestPop_SaveSegmentTransitions(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Invoke(t, "CreateProcess", testProcess)
+
+	open := testutil.Root("auction").WithAction("open").Build()
+	bid := testutil.Child(open).WithAction("bid").Build()
+	stub.SaveSegment(t, open, bid, testutil.Child(bid).WithAction("close").Build())
+
+	// Processes without template are not checked
+	stub.SaveSegment(t, testutil.Root("free").WithAction("anything").Build())
+
+	for _, invalid := range [][]byte{
+		mustMarshal(testutil.Root("auction").WithAction("bid").Build()),
+		mustMarshal(testutil.Root("auction").Build()),
+		mustMarshal(testutil.Child(open).WithAction("open").Build()),
+		mustMarshal(testutil.Child(testutil.Root("auction").WithAction("open").Build()).WithAction("bid").Build()),
+	} {
+		stub.InvokeError(t, "SaveSegment", invalid)
+	}
+}
+
+func TestPop_SaveSegmentRules(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Invoke(t, "CreateProcess", []byte(`{
+		"name": "shipment",
+		"steps": ["create", "ship", "receive"],
+		"rules": [
+			{"from": "", "to": "create", "roles": [{"mspId": "SellerMSP"}]},
+			{"from": "create", "to": "ship", "roles": [{"attribute": "role", "value": "carrier"}]},
+			{"from": "ship", "to": "receive"}
+		]
+	}`))
+
+	seller := testutil.NewIdentity("SellerMSP", "seller")
+	carrier := testutil.NewIdentityWithAttributes("CarrierMSP", "carrier", map[string]string{"role": "carrier"})
+	buyer := testutil.NewIdentity("BuyerMSP", "buyer")
+
+	create := testutil.Root("shipment").WithAction("create").Build()
+	ship := testutil.Child(create).WithAction("ship").Build()
+	receive := testutil.Child(ship).WithAction("receive").Build()
+
+	stub.Creator = buyer
+	if message := stub.InvokeError(t, "SaveSegment", mustMarshal(create)); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+	stub.Creator = seller
+	stub.SaveSegment(t, create)
+	stub.InvokeError(t, "SaveSegment", mustMarshal(ship))
+	stub.InvokeError(t, "SaveSegment", mustMarshal(testutil.Child(create).WithAction("receive").Build()))
+	stub.Creator = carrier
+	stub.SaveSegment(t, ship)
+	stub.Creator = buyer
+	stub.SaveSegment(t, receive)
+}
+
+func TestPop_CreateProcessInvalidRules(t *testing.T) {
+	stub := newAdminStub(t)
+	for _, process := range []string{
+		`{"name":"a","steps":["x"],"rules":[{"from":"","to":"y"}]}`,
+		`{"name":"b","rules":[{"from":"x"}]}`,
+		`{"name":"c","rules":[{"from":"","to":"x","roles":[{}]}]}`,
+		`{"name":"d","rules":[{"from":"","to":"x","quorum":{"required":1,"mspIds":["A"]}}]}`,
+		`{"name":"e","rules":[{"from":"x","to":"y","quorum":{"required":2,"mspIds":["A"]}}]}`,
+		`{"name":"f","rules":[{"from":"x","to":"y","quorum":{"required":1}}]}`,
+	} {
+		stub.InvokeError(t, "CreateProcess", []byte(process))
+	}
+}
+
+func TestPop_TransitionQuorum(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Invoke(t, "CreateProcess", []byte(`{
+		"name": "approval",
+		"acknowledgers": ["BuyerMSP", "SellerMSP", "BankMSP"],
+		"rules": [
+			{"from": "", "to": "request"},
+			{"from": "request", "to": "approve", "quorum": {"required": 2}},
+			{"from": "request", "to": "amend"}
+		]
+	}`))
+	request := testutil.Root("approval").WithAction("request").Build()
+	approve := testutil.Child(request).WithAction("approve").Build()
+	stub.SaveSegment(t, request)
+	stub.SaveSegment(t, testutil.Child(request).WithAction("amend").Build())
+
+	linkHash := []byte(request.GetLinkHashString())
+	stub.Creator = testutil.NewIdentity("BuyerMSP", "buyer")
+	stub.Invoke(t, "Acknowledge", linkHash)
+	stub.InvokeError(t, "SaveSegment", mustMarshal(approve))
+	stub.Creator = testutil.NewIdentity("BankMSP", "bank")
+	stub.Invoke(t, "Acknowledge", linkHash)
+	stub.SaveSegment(t, approve)
+}
+
+func TestPop_SchemaVersions(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.InvokeError(t, "CreateProcess", []byte(`{"name":"bad","initialActions":["a"],"schemas":{"1":{"properties":{"x":"date"}}}}`))
+	stub.Invoke(t, "CreateProcess", []byte(`{
+		"name": "invoice",
+		"initialActions": ["issue"],
+		"schemas": {
+			"1": {"required": ["amount"], "properties": {"amount": "number"}},
+			"2": {"required": ["amount", "currency"], "properties": {"amount": "number", "currency": "string"}}
+		}
+	}`))
+
+	v1 := testutil.Root("invoice").WithAction("issue").WithLinkMeta("schemaVersion", "1").WithState("amount", 10).Build()
+	v2 := testutil.Root("invoice").WithAction("issue").WithLinkMeta("schemaVersion", "2").WithState("amount", 10).WithState("currency", "EUR").Build()
+	stub.SaveSegment(t, v1, v2)
+
+	for _, segment := range []*cs.Segment{
+		testutil.Root("invoice").WithAction("issue").WithState("amount", 10).Build(),
+		testutil.Root("invoice").WithAction("issue").WithLinkMeta("schemaVersion", "3").WithState("amount", 10).Build(),
+		testutil.Root("invoice").WithAction("issue").WithLinkMeta("schemaVersion", "2").WithState("amount", 10).Build(),
+	} {
+		stub.InvokeError(t, "SaveSegment", mustMarshal(segment))
+	}
+
+	var found cs.SegmentSlice
+	json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"process":"invoice","schemaVersion":"2"}`)), &found)
+	if len(found) != 1 || found[0].GetLinkHashString() != v2.GetLinkHashString() {
+		fmt.Println("FindSegments returned", len(found), "segments")
+		t.FailNow()
+	}
+}
+
+func TestPop_ProcessConventions(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.InvokeError(t, "CreateProcess", []byte(`{"name":"bad","initialActions":["a"],"conventions":{"mapIdPattern":"("}}`))
+	stub.InvokeError(t, "CreateProcess", []byte(`{"name":"bad","initialActions":["a"],"conventions":{"allowedTags":["x"],"requiredTags":{"a":["y"]}}}`))
+	stub.Invoke(t, "CreateProcess", []byte(`{
+		"name": "shipment",
+		"initialActions": ["ship"],
+		"conventions": {
+			"allowedTags": ["fragile", "express", "customs"],
+			"mapIdPattern": "SHP-[0-9]+",
+			"requiredTags": {"ship": ["customs"]}
+		}
+	}`))
+
+	stub.SaveSegment(t, testutil.Root("shipment").WithMapID("SHP-42").WithAction("ship").WithTags("customs", "fragile").Build())
+
+	for _, segment := range []*cs.Segment{
+		testutil.Root("shipment").WithMapID("SHP-43").WithAction("ship").WithTags("customs", "heavy").Build(),
+		testutil.Root("shipment").WithMapID("XSHP-44").WithAction("ship").WithTags("customs").Build(),
+		testutil.Root("shipment").WithMapID("SHP-45").WithAction("ship").WithTags("express").Build(),
+	} {
+		stub.InvokeError(t, "SaveSegment", mustMarshal(segment))
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stratumn/sdk/store"
+)
+
+const (
+	// MaxFilterValueLength is the maximum length of the string values of a
+	// filter
+	MaxFilterValueLength = 256
+
+	// MaxFilterValues is the maximum number of map IDs or tags of a filter
+	MaxFilterValues = 100
+)
+
+// Store filters are translated to CouchDB queries by filling typed
+// selectors: caller values are only ever JSON string values of known
+// fields, so they can't add operators or change the docType of a query.
+// findSegments and findMaps add the tenant scope to the selectors.
+//
+// Filters are also validated before translation so that values which look
+// like operators, malformed hashes and oversized values are rejected
+// instead of reaching CouchDB.
+
+// validateFilterKeys rejects filters with operator keys
+func validateFilterKeys(filterBytes []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(filterBytes, &fields); err != nil {
+		return err
+	}
+	for key := range fields {
+		if strings.HasPrefix(key, "$") {
+			return errors.New("Filter key " + key + " is not allowed")
+		}
+	}
+	return nil
+}
+
+// validateFilterValue checks the length of a value and that it doesn't look
+// like an operator
+func validateFilterValue(name, value string) error {
+	if len(value) > MaxFilterValueLength {
+		return errors.New("Filter " + name + " should not exceed " + strconv.Itoa(MaxFilterValueLength) + " characters")
+	}
+	if strings.HasPrefix(value, "$") {
+		return errors.New("Filter " + name + " cannot start with $")
+	}
+	return nil
+}
+
+func validateFilterValues(name string, values []string) error {
+	if len(values) > MaxFilterValues {
+		return errors.New("Filter " + name + " should not have more than " + strconv.Itoa(MaxFilterValues) + " values")
+	}
+	for _, value := range values {
+		if err := validateFilterValue(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateLinkHash checks a link hash is a hex encoded SHA-256 hash
+func validateLinkHash(name, linkHash string) error {
+	if _, err := hex.DecodeString(linkHash); err != nil || len(linkHash) != 2*32 {
+		return errors.New("Filter " + name + " should be a hex encoded hash")
+	}
+	return nil
+}
+
+// MapSelector used in MapQuery
+type MapSelector struct {
+	ObjectType string `json:"docType"`
+	Process    string `json:"process,omitempty"`
+	Tenant     string `json:"tenant,omitempty"`
+	Owner      string `json:"owner,omitempty"`
+}
+
+// MapQuery used in CouchDB rich queries
+type MapQuery struct {
+	Selector MapSelector `json:"selector,omitempty"`
+	Limit    int         `json:"limit,omitempty"`
+	Skip     int         `json:"skip,omitempty"`
+}
+
+func newMapQuery(filterBytes []byte) (string, error) {
+	mapQuery, err := parseMapQuery(filterBytes)
+	if err != nil {
+		return "", err
+	}
+
+	queryBytes, err := json.Marshal(mapQuery)
+	if err != nil {
+		return "", err
+	}
+
+	return string(queryBytes), nil
+}
+
+func parseMapQuery(filterBytes []byte) (*MapQuery, error) {
+	filter := &store.MapFilter{}
+	if err := json.Unmarshal(filterBytes, filter); err != nil {
+		return nil, err
+	}
+	if err := validateFilterKeys(filterBytes); err != nil {
+		return nil, err
+	}
+	if err := validateFilterValue("process", filter.Process); err != nil {
+		return nil, err
+	}
+
+	mapSelector := MapSelector{}
+	mapSelector.ObjectType = ObjectTypeMap
+
+	if filter.Process != "" {
+		mapSelector.Process = filter.Process
+	}
+
+	mapQuery := &MapQuery{
+		Selector: mapSelector,
+		Limit:    filter.Pagination.Limit,
+		Skip:     filter.Pagination.Offset,
+	}
+
+	return mapQuery, nil
+}
+
+// SegmentSelector used in SegmentQuery
+type SegmentSelector struct {
+	ObjectType   string        `json:"docType"`
+	LinkHashes   *LinkHashesIn `json:"id,omitempty"`
+	PrevLinkHash string        `json:"segment.link.meta.prevLinkHash,omitempty"`
+	Process      string        `json:"segment.link.meta.process,omitempty"`
+	MapIds       *MapIdsIn     `json:"segment.link.meta.mapId,omitempty"`
+	Tags         *TagsAll      `json:"segment.link.meta.tags,omitempty"`
+
+	SubmitterMSPID   string `json:"segment.meta.submitter.mspId,omitempty"`
+	SubmitterSubject string `json:"segment.meta.submitter.subject,omitempty"`
+
+	Sequence  *SequenceGt  `json:"sequence,omitempty"`
+	Priority  *PriorityGte `json:"priority,omitempty"`
+	Tenant    string       `json:"tenant,omitempty"`
+	Residency string       `json:"residency,omitempty"`
+
+	SchemaVersion string `json:"segment.link.meta.schemaVersion,omitempty"`
+}
+
+// LinkHashesIn specifies that segment link hash should be in specified list
+// and not in the excluded one
+type LinkHashesIn struct {
+	LinkHashes []string `json:"$in,omitempty"`
+	Excluded   []string `json:"$nin,omitempty"`
+}
+
+// restrictLinkHashes only keeps segments with one of the link hashes. It
+// returns false when no segment can match.
+func (s *SegmentSelector) restrictLinkHashes(linkHashes []string) bool {
+	if s.LinkHashes == nil {
+		s.LinkHashes = &LinkHashesIn{}
+	}
+	if s.LinkHashes.LinkHashes != nil {
+		linkHashes = intersectStrings(s.LinkHashes.LinkHashes, linkHashes)
+	}
+	s.LinkHashes.LinkHashes = linkHashes
+	return len(linkHashes) > 0
+}
+
+// excludeLinkHashes filters out segments with one of the link hashes
+func (s *SegmentSelector) excludeLinkHashes(linkHashes []string) {
+	if len(linkHashes) == 0 {
+		return
+	}
+	if s.LinkHashes == nil {
+		s.LinkHashes = &LinkHashesIn{}
+	}
+	for _, linkHash := range linkHashes {
+		if !containsString(s.LinkHashes.Excluded, linkHash) {
+			s.LinkHashes.Excluded = append(s.LinkHashes.Excluded, linkHash)
+		}
+	}
+	sort.Strings(s.LinkHashes.Excluded)
+}
+
+// MapIdsIn specifies that segment mapId should be in specified list
+type MapIdsIn struct {
+	MapIds []string `json:"$in,omitempty"`
+}
+
+// SequenceGt specifies that segment sequence should be greater than a number
+type SequenceGt struct {
+	Sequence int `json:"$gt"`
+}
+
+// PriorityGte specifies that segment priority should be at least a number
+type PriorityGte struct {
+	Priority float64 `json:"$gte"`
+}
+
+// TagsAll specifies all tags in specified list should be in segment tags
+type TagsAll struct {
+	Tags []string `json:"$all,omitempty"`
+}
+
+// SegmentQuery used in CouchDB rich queries
+type SegmentQuery struct {
+	Selector SegmentSelector     `json:"selector,omitempty"`
+	Sort     []map[string]string `json:"sort,omitempty"`
+	Limit    int                 `json:"limit,omitempty"`
+	Skip     int                 `json:"skip,omitempty"`
+
+	// owner restricts the query to the maps of an owner, it is resolved
+	// to map IDs by findSegments
+	owner string
+
+	// maxResponseBytes is the response size budget requested by the
+	// caller, zero for the budget of the configuration
+	maxResponseBytes int
+
+	// annotations and mapAnnotations are resolved to link hashes and map
+	// IDs by findSegments
+	annotations    map[string]string
+	mapAnnotations map[string]string
+
+	// disputed keeps segments with, or without, an open dispute
+	disputed *bool
+
+	// notAcknowledgedBy filters out segments acknowledged by an MSP
+	notAcknowledgedBy string
+}
+
+func newSegmentQuery(filterBytes []byte) (string, error) {
+	segmentQuery, err := parseSegmentQuery(filterBytes)
+	if err != nil {
+		return "", err
+	}
+
+	queryBytes, err := json.Marshal(segmentQuery)
+	if err != nil {
+		return "", err
+	}
+
+	return string(queryBytes), nil
+}
+
+func parseSegmentQuery(filterBytes []byte) (*SegmentQuery, error) {
+	filter := &store.SegmentFilter{}
+	if err := json.Unmarshal(filterBytes, filter); err != nil {
+		return nil, err
+	}
+	if err := validateSegmentFilter(filterBytes, filter); err != nil {
+		return nil, err
+	}
+
+	segmentSelector := SegmentSelector{}
+	segmentSelector.ObjectType = ObjectTypeSegment
+
+	if filter.PrevLinkHash != nil {
+		segmentSelector.PrevLinkHash = *filter.PrevLinkHash
+	}
+	if filter.Process != "" {
+		segmentSelector.Process = filter.Process
+	}
+	if len(filter.MapIDs) > 0 {
+		segmentSelector.MapIds = &MapIdsIn{filter.MapIDs}
+	} else {
+		segmentSelector.Tags = nil
+	}
+	if len(filter.Tags) > 0 {
+		segmentSelector.Tags = &TagsAll{filter.Tags}
+	} else {
+		segmentSelector.Tags = nil
+	}
+
+	segmentQuery := &SegmentQuery{
+		Selector: segmentSelector,
+		Limit:    filter.Pagination.Limit,
+		Skip:     filter.Pagination.Offset,
+	}
+
+	// Sorting by sequence or priority requires an index on the field.
+	// Without sort order, a page is sorted by priority after the query.
+	options, err := parseSegmentFilterOptions(filterBytes)
+	if err != nil {
+		return nil, err
+	}
+	switch options.SortBy {
+	case SortBySequence:
+		segmentQuery.Sort = []map[string]string{{"sequence": "asc"}}
+	case SortByPriority:
+		segmentQuery.Sort = []map[string]string{{"docType": "desc"}, {"priority": "desc"}}
+	}
+	if err := validateFilterValue("owner", options.Owner); err != nil {
+		return nil, err
+	}
+	if err := validateResidency(options.Residency); err != nil {
+		return nil, err
+	}
+	segmentQuery.Selector.Residency = options.Residency
+	if err := validateFilterValue("schemaVersion", options.SchemaVersion); err != nil {
+		return nil, err
+	}
+	segmentQuery.Selector.SchemaVersion = options.SchemaVersion
+	if options.MinPriority != nil {
+		segmentQuery.Selector.Priority = &PriorityGte{*options.MinPriority}
+	}
+	segmentQuery.owner = options.Owner
+	segmentQuery.maxResponseBytes = options.MaxResponseBytes
+	if err := validateAnnotationFilter("annotations", options.Annotations); err != nil {
+		return nil, err
+	}
+	if err := validateAnnotationFilter("mapAnnotations", options.MapAnnotations); err != nil {
+		return nil, err
+	}
+	segmentQuery.annotations = options.Annotations
+	segmentQuery.mapAnnotations = options.MapAnnotations
+	segmentQuery.disputed = options.Disputed
+	if err := validateFilterValue("notAcknowledgedBy", options.NotAcknowledgedBy); err != nil {
+		return nil, err
+	}
+	segmentQuery.notAcknowledgedBy = options.NotAcknowledgedBy
+
+	return segmentQuery, nil
+}
+
+// validateSegmentFilter checks the keys and values of a segment filter
+func validateSegmentFilter(filterBytes []byte, filter *store.SegmentFilter) error {
+	if err := validateFilterKeys(filterBytes); err != nil {
+		return err
+	}
+	if err := validateFilterValue("process", filter.Process); err != nil {
+		return err
+	}
+	if filter.PrevLinkHash != nil && *filter.PrevLinkHash != "" {
+		if err := validateLinkHash("prevLinkHash", *filter.PrevLinkHash); err != nil {
+			return err
+		}
+	}
+	if err := validateFilterValues("mapIds", filter.MapIDs); err != nil {
+		return err
+	}
+	return validateFilterValues("tags", filter.Tags)
+}
@@ -0,0 +1,240 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// selectorFields are the fields translated selectors can filter on, with
+// the operators allowed on each of them
+var selectorFields = map[string][]string{
+	"docType":                         nil,
+	"id":                              {"$in", "$nin"},
+	"segment.link.meta.prevLinkHash":  nil,
+	"segment.link.meta.process":       nil,
+	"segment.link.meta.mapId":         {"$in"},
+	"segment.link.meta.tags":          {"$all"},
+	"segment.meta.submitter.mspId":    nil,
+	"segment.meta.submitter.subject":  nil,
+	"sequence":                        {"$gt"},
+	"priority":                        {"$gte"},
+	"tenant":                          nil,
+	"residency":                       nil,
+	"segment.link.meta.schemaVersion": nil,
+	"process":                         nil,
+	"owner":                           nil,
+}
+
+// checkTranslation checks a translated query only has known fields and
+// operators and is scoped to a docType
+func checkTranslation(queryString, docType string) error {
+	var query struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	if err := json.Unmarshal([]byte(queryString), &query); err != nil {
+		return err
+	}
+	if query.Selector["docType"] != docType {
+		return fmt.Errorf("docType is %v", query.Selector["docType"])
+	}
+	for field, value := range query.Selector {
+		operators, ok := selectorFields[field]
+		if !ok {
+			return fmt.Errorf("unknown field %s", field)
+		}
+		switch v := value.(type) {
+		case string:
+		case map[string]interface{}:
+			for operator, operand := range v {
+				if !containsString(operators, operator) {
+					return fmt.Errorf("operator %s not allowed on %s", operator, field)
+				}
+				if err := checkOperand(operand); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unexpected value of %s: %v", field, value)
+		}
+	}
+	return nil
+}
+
+// checkOperand checks an operand is a number or a list of strings
+func checkOperand(operand interface{}) error {
+	switch v := operand.(type) {
+	case float64:
+		return nil
+	case []interface{}:
+		for _, item := range v {
+			if _, ok := item.(string); !ok {
+				return fmt.Errorf("unexpected operand %v", item)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unexpected operand %v", operand)
+}
+
+// rejectable tells whether validation may reject one of the values
+func rejectable(values ...string) bool {
+	for _, value := range values {
+		if strings.HasPrefix(value, "$") || len(value) > MaxFilterValueLength {
+			return true
+		}
+	}
+	return false
+}
+
+func TestQuery_segmentProperties(t *testing.T) {
+	check := func(process string, prevLinkHash [32]byte, owner string, mapIDs, tags []string, minPriority float64, limit, offset int) bool {
+		filter := map[string]interface{}{
+			"process":      process,
+			"prevLinkHash": hex.EncodeToString(prevLinkHash[:]),
+			"owner":        owner,
+			"mapIds":       mapIDs,
+			"tags":         tags,
+			"minPriority":  minPriority,
+			"sortBy":       SortByPriority,
+			"pagination":   map[string]int{"limit": limit, "offset": offset},
+		}
+		filterBytes, _ := json.Marshal(filter)
+		queryString, err := newSegmentQuery(filterBytes)
+		if err != nil {
+			values := append([]string{process, owner}, append(mapIDs, tags...)...)
+			if rejectable(values...) {
+				return true
+			}
+			fmt.Println("Translation failed", string(filterBytes), err)
+			return false
+		}
+		if err := checkTranslation(queryString, ObjectTypeSegment); err != nil {
+			fmt.Println(queryString, err)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(check, nil); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+}
+
+func TestQuery_mapProperties(t *testing.T) {
+	check := func(process string, limit, offset int) bool {
+		filter := map[string]interface{}{
+			"process":    process,
+			"pagination": map[string]int{"limit": limit, "offset": offset},
+		}
+		filterBytes, _ := json.Marshal(filter)
+		queryString, err := newMapQuery(filterBytes)
+		if err != nil {
+			if rejectable(process) {
+				return true
+			}
+			fmt.Println("Translation failed", string(filterBytes), err)
+			return false
+		}
+		if err := checkTranslation(queryString, ObjectTypeMap); err != nil {
+			fmt.Println(queryString, err)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(check, nil); err != nil {
+		fmt.Println(err)
+		t.FailNow()
+	}
+}
+
+func TestQuery_crafted(t *testing.T) {
+	for _, filter := range []string{
+		`{"process":{"$gt":""}}`,
+		`{"prevLinkHash":{"$ne":null}}`,
+		`{"mapIds":{"$regex":".*"}}`,
+		`{"mapIds":[{"$gt":""}]}`,
+		`{"tags":["a",{"$exists":true}]}`,
+		`{"owner":{"$ne":""}}`,
+		`{"minPriority":{"$lt":1}}`,
+		`{"sortBy":"docType"}`,
+		`{"pagination":{"limit":{"$gt":0}}}`,
+		`{"$or":[{"docType":"map"}],"process":"main"}`,
+		`{"process":"$gt"}`,
+		`{"mapIds":["map1","$regex"]}`,
+		`{"tags":["$exists"]}`,
+		`{"owner":"$ne"}`,
+		`{"prevLinkHash":"abc"}`,
+		`{"prevLinkHash":"` + strings.Repeat("z", 64) + `"}`,
+		`{"process":"` + strings.Repeat("a", MaxFilterValueLength+1) + `"}`,
+		`{"tags":["` + strings.Repeat(`a","`, MaxFilterValues) + `a"]}`,
+	} {
+		if _, err := newSegmentQuery([]byte(filter)); err == nil {
+			fmt.Println("Segment filter should be rejected", filter)
+			t.FailNow()
+		}
+	}
+	for _, filter := range []string{
+		`{"process":{"$gt":""}}`,
+		`{"process":"$gt"}`,
+		`{"$or":[{"docType":"map"}]}`,
+	} {
+		if _, err := newMapQuery([]byte(filter)); err == nil {
+			fmt.Println("Map filter should be rejected", filter)
+			t.FailNow()
+		}
+	}
+
+	for _, filter := range []string{
+		`{"docType":"map"}`,
+		`{"selector":{"docType":"config"}}`,
+		`{"tenant":"Org2MSP","id":"x"}`,
+		`{"prevLinkHash":""}`,
+		`{"process":"main\",\"docType\":\"map"}`,
+	} {
+		queryString, err := newSegmentQuery([]byte(filter))
+		if err != nil {
+			fmt.Println(err)
+			t.FailNow()
+		}
+		if err := checkTranslation(queryString, ObjectTypeSegment); err != nil {
+			fmt.Println(filter, queryString, err)
+			t.FailNow()
+		}
+		var query struct {
+			Selector map[string]interface{} `json:"selector"`
+		}
+		json.Unmarshal([]byte(queryString), &query)
+		if _, ok := query.Selector["tenant"]; ok {
+			fmt.Println("Callers should not set the tenant", filter)
+			t.FailNow()
+		}
+
+		queryString, err = newMapQuery([]byte(filter))
+		if err != nil {
+			fmt.Println(err)
+			t.FailNow()
+		}
+		if err := checkTranslation(queryString, ObjectTypeMap); err != nil {
+			fmt.Println(filter, queryString, err)
+			t.FailNow()
+		}
+	}
+}
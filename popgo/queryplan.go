@@ -0,0 +1,132 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// queryIndex is a CouchDB index packaged with the chaincode in
+// META-INF/statedb/couchdb/indexes. Fabric 1.0 doesn't deploy them, create
+// them with the CouchDB API (see pop.go).
+type queryIndex struct {
+	Name   string
+	Fields []string
+}
+
+// Indexes of segment, map, cold segment, annotation, dispute,
+// acknowledgment and evidence queries. Keep in sync with the index files.
+var (
+	segmentIndexes = []queryIndex{
+		{"indexSegmentProcess", []string{"docType", "segment.link.meta.process"}},
+		{"indexSegmentMapId", []string{"docType", "segment.link.meta.mapId"}},
+		{"indexSegmentPrevLinkHash", []string{"docType", "segment.link.meta.prevLinkHash"}},
+		{"indexSegmentSequence", []string{"docType", "segment.link.meta.mapId", "sequence"}},
+		{"indexSegmentSubmitter", []string{"docType", "segment.meta.submitter.mspId", "segment.meta.submitter.subject"}},
+		{"indexSegmentSavedAt", []string{"docType", "savedAt"}},
+		{"indexSegmentPriority", []string{"docType", "priority"}},
+		{"indexSegmentId", []string{"docType", "id"}},
+		{"indexSegmentResidency", []string{"docType", "residency"}},
+		{"indexSegmentSchemaVersion", []string{"docType", "segment.link.meta.schemaVersion"}},
+	}
+	mapIndexes = []queryIndex{
+		{"indexMap", []string{"docType"}},
+		{"indexMapProcess", []string{"docType", "process"}},
+		{"indexMapOwner", []string{"docType", "owner"}},
+		{"indexMapId", []string{"docType", "id"}},
+	}
+	coldSegmentIndexes = []queryIndex{
+		{"indexColdSegmentMapId", []string{"docType", "mapId"}},
+	}
+	annotationIndexes = []queryIndex{
+		{"indexAnnotation", []string{"docType", "target", "key", "value"}},
+	}
+	disputeIndexes = []queryIndex{
+		{"indexDispute", []string{"docType", "status"}},
+	}
+	acknowledgmentIndexes = []queryIndex{
+		{"indexAcknowledgment", []string{"docType", "mspId"}},
+	}
+	evidenceIndexes = []queryIndex{
+		{"indexEvidenceExpiresAt", []string{"docType", "expiresAt"}},
+	}
+)
+
+// ErrUnindexedQuery is returned instead of running queries that no index
+// covers when the strictQueries option is set
+var ErrUnindexedQuery = errors.New("Query is not covered by an index")
+
+// findIndex returns the index CouchDB can use for a query, nil if the
+// query would scan every document. An index can be used when the selector
+// has all its fields and the sort fields are part of it.
+func findIndex(indexes []queryIndex, queryString string) (*queryIndex, error) {
+	query := struct {
+		Selector map[string]interface{}   `json:"selector"`
+		Sort     []map[string]interface{} `json:"sort"`
+	}{}
+	if err := json.Unmarshal([]byte(queryString), &query); err != nil {
+		return nil, err
+	}
+	var sortFields []string
+	for _, s := range query.Sort {
+		for field := range s {
+			sortFields = append(sortFields, field)
+		}
+	}
+
+	for i, index := range indexes {
+		usable := true
+		for _, field := range index.Fields {
+			if _, ok := query.Selector[field]; !ok && !containsString(sortFields, field) {
+				usable = false
+			}
+		}
+		for _, field := range sortFields {
+			if !containsString(index.Fields, field) {
+				usable = false
+			}
+		}
+		if usable {
+			return &indexes[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// checkQueryPlan refuses queries that no index covers if the configuration
+// says so, otherwise it returns a warning
+func checkQueryPlan(config *Config, indexes []queryIndex, queryString string) (*ResponseMeta, error) {
+	index, err := findIndex(indexes, queryString)
+	if err != nil || index != nil {
+		return nil, err
+	}
+	if config.StrictQueries {
+		return nil, ErrUnindexedQuery
+	}
+	return &ResponseMeta{Warnings: []string{ErrUnindexedQuery.Error() + ", " + describeIndexes(indexes)}}, nil
+}
+
+// describeIndexes lists the field combinations of indexes
+func describeIndexes(indexes []queryIndex) string {
+	var combinations []string
+	for _, index := range indexes {
+		combinations = append(combinations, "["+strings.Join(index.Fields, ", ")+"]")
+	}
+	sort.Strings(combinations)
+	return "indexed fields are " + strings.Join(combinations, ", ")
+}
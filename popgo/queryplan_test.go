@@ -0,0 +1,141 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_findIndex(t *testing.T) {
+	tests := []struct {
+		filter   string
+		expected string
+	}{
+		{`{"process":"main"}`, "indexSegmentProcess"},
+		{`{"mapIds":["m"],"sortBy":"sequence"}`, "indexSegmentSequence"},
+		{`{"process":"main","sortBy":"sequence"}`, ""},
+		{`{"tags":["a"]}`, ""},
+		{`{}`, ""},
+	}
+	for _, test := range tests {
+		queryString, err := newSegmentQuery([]byte(test.filter))
+		if err != nil {
+			fmt.Println("Invalid filter", test.filter, err)
+			t.FailNow()
+		}
+		index, err := findIndex(segmentIndexes, queryString)
+		if err != nil {
+			fmt.Println("findIndex failed", err)
+			t.FailNow()
+		}
+		name := ""
+		if index != nil {
+			name = index.Name
+		}
+		if name != test.expected {
+			fmt.Println("Filter", test.filter, "uses index", name, "expected", test.expected)
+			t.FailNow()
+		}
+	}
+}
+
+func TestPop_FindSegmentsUnindexed(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	stub.SaveSegment(t, testutil.Root("main").WithTags("a").Build())
+
+	res := stub.Call("FindSegments", []byte(`{"process":"main"}`))
+	meta := &ResponseMeta{}
+	if res.Status != shim.OK || json.Unmarshal([]byte(res.Message), meta) != nil || len(meta.Warnings) != 0 {
+		fmt.Println("Indexed query should not have warnings", res.Message)
+		t.FailNow()
+	}
+
+	res = stub.Call("FindSegments", []byte(`{"tags":["a"]}`))
+	meta = &ResponseMeta{}
+	if res.Status != shim.OK || json.Unmarshal([]byte(res.Message), meta) != nil || len(meta.Warnings) != 1 {
+		fmt.Println("Unindexed query should return a warning", res.Message)
+		t.FailNow()
+	}
+
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"strictQueries":true}`)})
+	if message := stub.InvokeError(t, "FindSegments", []byte(`{"tags":["a"]}`)); message != ErrUnindexedQuery.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnindexedQuery.Error())
+		t.FailNow()
+	}
+	stub.Invoke(t, "GetMapIDs", []byte(`{}`))
+}
+
+func TestPop_DegradedQuery(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.SaveSegment(t, testutil.Chain("main", 3)...)
+	stub.SaveSegment(t, testutil.Root("other").Build())
+	stub.QueryError = errors.New("error handling CouchDB request. Error:no_usable_index,  Status Code:400,  Reason:No index exists for this sort")
+
+	res := stub.Call("FindSegments", []byte(`{"process":"main","sortBy":"sequence","pagination":{"limit":2}}`))
+	meta := &ResponseMeta{}
+	json.Unmarshal([]byte(res.Message), meta)
+	var segments []interface{}
+	json.Unmarshal(res.Payload, &segments)
+	if res.Status != shim.OK || !meta.Degraded || !meta.Truncated || len(segments) != 2 {
+		fmt.Println("Got response", res.Status, res.Message, len(segments))
+		t.FailNow()
+	}
+
+	// Other errors are returned
+	stub.QueryError = errors.New("CouchDB is down")
+	stub.InvokeError(t, "FindSegments", []byte(`{"process":"main","sortBy":"sequence"}`))
+}
+
+func TestPop_indexFiles(t *testing.T) {
+	files, _ := filepath.Glob("META-INF/statedb/couchdb/indexes/*.json")
+	indexes := append(append(append(segmentIndexes, mapIndexes...), coldSegmentIndexes...), annotationIndexes...)
+	indexes = append(indexes, disputeIndexes...)
+	indexes = append(indexes, acknowledgmentIndexes...)
+	indexes = append(indexes, evidenceIndexes...)
+	if len(files) != len(indexes) {
+		fmt.Println("Found", len(files), "index files")
+		t.FailNow()
+	}
+	for _, index := range indexes {
+		indexBytes, err := ioutil.ReadFile(filepath.Join("META-INF/statedb/couchdb/indexes", index.Name+".json"))
+		if err != nil {
+			fmt.Println("Missing index file", err)
+			t.FailNow()
+		}
+		def := struct {
+			Index struct {
+				Fields []string `json:"fields"`
+			} `json:"index"`
+			Name string `json:"name"`
+		}{}
+		if err := json.Unmarshal(indexBytes, &def); err != nil {
+			fmt.Println("Invalid index file", index.Name, err)
+			t.FailNow()
+		}
+		if def.Name != index.Name || !reflect.DeepEqual(def.Index.Fields, index.Fields) {
+			fmt.Println("Index file", index.Name, "doesn't match the registry")
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Quotas limit the segments each organization writes, so one member of a
+// shared channel can't bloat the state. Usage is kept in sharded counters
+// keyed by MSP ID. The default quota is in the config and admins can
+// override it per organization with SetQuota.
+const (
+	// ObjectTypeQuota is used in the CouchDB documents of quota overrides
+	ObjectTypeQuota = "quota"
+
+	// ObjectTypeQuotaUsage is used in the keys of quota usage counters
+	ObjectTypeQuotaUsage = "quotausage"
+)
+
+// Quota limits the writes of an organization. Zero values are unlimited.
+type Quota struct {
+	SegmentsPerDay int `json:"segmentsPerDay,omitempty"`
+	// MaxStateBytes caps the total size of the JSON encoded segments
+	// saved by the organization
+	MaxStateBytes int `json:"maxStateBytes,omitempty"`
+}
+
+// QuotaDoc is used to store the quota override of an organization
+type QuotaDoc struct {
+	ObjectType string `json:"docType"`
+	MSPID      string `json:"mspId"`
+	Quota      Quota  `json:"quota"`
+}
+
+// QuotaUsage is returned by GetQuota
+type QuotaUsage struct {
+	MSPID         string `json:"mspId"`
+	Quota         *Quota `json:"quota,omitempty"`
+	SegmentsToday int    `json:"segmentsToday"`
+	StateBytes    int    `json:"stateBytes"`
+}
+
+func (q *Quota) validate() error {
+	if q.SegmentsPerDay < 0 || q.MaxStateBytes < 0 {
+		return errors.New("Quota limits should be positive")
+	}
+	return nil
+}
+
+func getQuotaKey(stub shim.ChaincodeStubInterface, mspID string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeQuota, []string{mspID})
+}
+
+// getQuota returns the quota of an organization, nil if it is unlimited
+func getQuota(stub shim.ChaincodeStubInterface, config *Config, mspID string) (*Quota, error) {
+	key, err := getQuotaKey(stub, mspID)
+	if err != nil {
+		return nil, err
+	}
+	quotaBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if quotaBytes == nil {
+		return config.DefaultQuota, nil
+	}
+	quotaDoc := &QuotaDoc{}
+	if err := json.Unmarshal(quotaBytes, quotaDoc); err != nil {
+		return nil, err
+	}
+	return &quotaDoc.Quota, nil
+}
+
+// getQuotaUsage returns the segments saved today and the state bytes
+// written by an organization
+func getQuotaUsage(stub shim.ChaincodeStubInterface, mspID string) (*QuotaUsage, error) {
+	now, err := txTime(stub)
+	if err != nil {
+		return nil, err
+	}
+	day := now.UTC().Format(ActivityDayLayout)
+	usage := &QuotaUsage{MSPID: mspID}
+	if usage.SegmentsToday, err = getShardedCounter(stub, ObjectTypeQuotaUsage, []string{mspID, "segments", day}); err != nil {
+		return nil, err
+	}
+	if usage.StateBytes, err = getShardedCounter(stub, ObjectTypeQuotaUsage, []string{mspID, "bytes"}); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// consumeQuota counts a new segment against the quota of the submitter
+// and rejects it when the quota is exceeded. Transactions without
+// certificate aren't counted.
+func consumeQuota(stub shim.ChaincodeStubInterface, segment *cs.Segment) error {
+	submitter, err := getSubmitter(stub)
+	if err != nil || submitter == nil {
+		return err
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	quota, err := getQuota(stub, config, submitter.MSPID)
+	if err != nil {
+		return err
+	}
+	segmentBytes, err := json.Marshal(segment)
+	if err != nil {
+		return err
+	}
+
+	if quota != nil && (quota.SegmentsPerDay > 0 || quota.MaxStateBytes > 0) {
+		usage, err := getQuotaUsage(stub, submitter.MSPID)
+		if err != nil {
+			return err
+		}
+		if quota.SegmentsPerDay > 0 && usage.SegmentsToday+1 > quota.SegmentsPerDay {
+			return errors.New("Daily segment quota of " + submitter.MSPID + " (" + strconv.Itoa(quota.SegmentsPerDay) + ") exceeded")
+		}
+		if quota.MaxStateBytes > 0 && usage.StateBytes+len(segmentBytes) > quota.MaxStateBytes {
+			return errors.New("State quota of " + submitter.MSPID + " (" + strconv.Itoa(quota.MaxStateBytes) + " bytes) exceeded")
+		}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return err
+	}
+	day := now.UTC().Format(ActivityDayLayout)
+	if err := addShardedCounter(stub, ObjectTypeQuotaUsage, []string{submitter.MSPID, "segments", day}, 1); err != nil {
+		return err
+	}
+	return addShardedCounter(stub, ObjectTypeQuotaUsage, []string{submitter.MSPID, "bytes"}, len(segmentBytes))
+}
+
+// SetQuota overrides the default quota of an organization. Arguments are
+// the MSP ID and the JSON encoded quota, an empty quota removes the
+// limits. Without quota, the override is removed.
+func (s *SmartContract) SetQuota(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("MSP ID is required")
+	}
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := getQuotaKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args) < 2 || args[1] == "" {
+		if err := stub.DelState(key); err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(nil)
+	}
+
+	quotaDoc := &QuotaDoc{ObjectType: ObjectTypeQuota, MSPID: args[0]}
+	if err := json.Unmarshal([]byte(args[1]), &quotaDoc.Quota); err != nil {
+		return shim.Error("Could not parse quota")
+	}
+	if err := quotaDoc.Quota.validate(); err != nil {
+		return shim.Error(err.Error())
+	}
+	quotaBytes, err := json.Marshal(quotaDoc)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, quotaBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(quotaBytes)
+}
+
+// GetQuota returns the quota of an organization and its usage
+func (s *SmartContract) GetQuota(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("MSP ID is required")
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	usage, err := getQuotaUsage(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if usage.Quota, err = getQuota(stub, config, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	usageBytes, err := json.Marshal(usage)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(usageBytes, nil)
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_Quota(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"admins":["AdminMSP"],"defaultQuota":{"segmentsPerDay":2}}`)})
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 100 * 24 * 3600}
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+
+	segments := testutil.Chain("main", 3)
+	stub.SaveSegment(t, segments[:2]...)
+	if message := stub.InvokeError(t, "SaveSegment", mustMarshal(segments[2])); message != "Daily segment quota of UserMSP (2) exceeded" {
+		fmt.Println("Got error", message)
+		t.FailNow()
+	}
+
+	// Re-saving a segment doesn't count
+	stub.SaveSegment(t, segments[1])
+
+	usage := &QuotaUsage{}
+	json.Unmarshal(stub.Invoke(t, "GetQuota", []byte("UserMSP")), usage)
+	if usage.SegmentsToday != 2 || usage.StateBytes == 0 || usage.Quota == nil || usage.Quota.SegmentsPerDay != 2 {
+		fmt.Println("Got usage", usage)
+		t.FailNow()
+	}
+
+	// Quotas reset every day
+	stub.Timestamp = &timestamp.Timestamp{Seconds: 101 * 24 * 3600}
+	stub.SaveSegment(t, segments[2])
+	stub.InvokeError(t, "SetQuota", []byte("UserMSP"), []byte(`{}`))
+
+	stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+	stub.Invoke(t, "SetQuota", []byte("UserMSP"), []byte(`{"maxStateBytes":1}`))
+	stub.InvokeError(t, "SetQuota", []byte("UserMSP"), []byte(`{"segmentsPerDay":-1}`))
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "SaveSegment", mustMarshal(testutil.Root("main").Build())); message != "State quota of UserMSP (1 bytes) exceeded" {
+		fmt.Println("Got error", message)
+		t.FailNow()
+	}
+
+	// Admins can lift the quota of an organization
+	stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+	stub.Invoke(t, "SetQuota", []byte("UserMSP"), []byte(`{}`))
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	stub.SaveSegment(t, testutil.Root("main").Build(), testutil.Root("main").Build())
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ObjectTypeReadOnly is used in the CouchDB document of the read-only mode
+const ObjectTypeReadOnly = "readonly"
+
+// The read-only mode quiesces writes during maintenance windows, like
+// chaincode upgrades or CouchDB maintenance. Like feature flags, it is kept
+// apart from the Config so upgrades don't reset it.
+
+// readOnlyFunctions can be called in read-only mode on top of the
+// functions that can be bundled. Functions missing from both lists are
+// rejected, so new functions are considered writes.
+var readOnlyFunctions = []string{
+	"GetMaps", "GetPendingDeletion", "RichQuery", "ReadBundle",
+	"GetSegmentInternal", "HasMapInternal", "SetReadOnly",
+}
+
+// ReadOnlyDoc is used to store the read-only mode in CouchDB
+type ReadOnlyDoc struct {
+	ObjectType string     `json:"docType"`
+	Enabled    bool       `json:"enabled"`
+	Reason     string     `json:"reason,omitempty"`
+	SetBy      *Submitter `json:"setBy,omitempty"`
+	SetAt      int64      `json:"setAt,omitempty"`
+}
+
+func getReadOnlyKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeReadOnly, []string{})
+}
+
+// getReadOnly returns the read-only mode, disabled if it was never set
+func getReadOnly(stub shim.ChaincodeStubInterface) (*ReadOnlyDoc, error) {
+	readOnly := &ReadOnlyDoc{ObjectType: ObjectTypeReadOnly}
+	key, err := getReadOnlyKey(stub)
+	if err != nil {
+		return nil, err
+	}
+	readOnlyBytes, err := stub.GetState(key)
+	if err != nil || readOnlyBytes == nil {
+		return readOnly, err
+	}
+	if err := json.Unmarshal(readOnlyBytes, readOnly); err != nil {
+		return nil, err
+	}
+	return readOnly, nil
+}
+
+// checkReadOnly rejects writes in read-only mode
+func (s *SmartContract) checkReadOnly(stub shim.ChaincodeStubInterface, function string) error {
+	if _, ok := s.readFunctions()[function]; ok || containsString(readOnlyFunctions, function) {
+		return nil
+	}
+	readOnly, err := getReadOnly(stub)
+	if err != nil {
+		return err
+	}
+	if !readOnly.Enabled {
+		return nil
+	}
+	if readOnly.Reason != "" {
+		return errors.New("Chaincode is read-only: " + readOnly.Reason)
+	}
+	return errors.New("Chaincode is read-only")
+}
+
+// SetReadOnly enables or disables the read-only mode. Arguments are true or
+// false and an optional reason.
+func (s *SmartContract) SetReadOnly(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 {
+		return shim.Error("Read-only value is required")
+	}
+	enabled, err := strconv.ParseBool(args[0])
+	if err != nil {
+		return shim.Error("Invalid read-only value " + args[0])
+	}
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	readOnly := &ReadOnlyDoc{ObjectType: ObjectTypeReadOnly, Enabled: enabled}
+	if enabled && len(args) > 1 {
+		readOnly.Reason = args[1]
+	}
+	if readOnly.SetBy, err = getSubmitter(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	readOnly.SetAt = now.UnixNano() / int64(time.Millisecond)
+
+	key, err := getReadOnlyKey(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	readOnlyBytes, err := json.Marshal(readOnly)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, readOnlyBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(readOnlyBytes)
+}
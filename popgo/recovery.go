@@ -0,0 +1,53 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"runtime/debug"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+var logger = shim.NewLogger("pop")
+
+// InternalError is the message of the responses of functions that
+// panicked. The correlation ID is the transaction ID, it finds the stack
+// trace in the logs of the chaincode container.
+type InternalError struct {
+	Error         string `json:"error"`
+	Function      string `json:"function"`
+	CorrelationID string `json:"correlationId"`
+}
+
+// recoverInternalError turns a panic of a function into an internal error
+// response so the chaincode container doesn't crash during endorsement.
+// It must be deferred.
+func recoverInternalError(stub shim.ChaincodeStubInterface, function string, res *sc.Response) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	txID := stub.GetTxID()
+	logger.Errorf("Function %s panicked in transaction %s: %v\n%s", function, txID, r, debug.Stack())
+	internalErr := InternalError{Error: "Internal error", Function: function, CorrelationID: txID}
+	messageBytes, err := json.Marshal(internalErr)
+	if err != nil {
+		*res = shim.Error(internalErr.Error)
+		return
+	}
+	*res = shim.Error(string(messageBytes))
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestPop_RecoverInternalError(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.MockTransactionStart("tx1")
+	defer stub.MockTransactionEnd("tx1")
+
+	res := func() (res sc.Response) {
+		defer recoverInternalError(stub, "GetSegment", &res)
+		var segments []string
+		return shim.Success([]byte(segments[0]))
+	}()
+
+	internalErr := &InternalError{}
+	if err := json.Unmarshal([]byte(res.Message), internalErr); err != nil || res.Status != shim.ERROR {
+		fmt.Println("Got response", res.Status, res.Message)
+		t.FailNow()
+	}
+	if internalErr.CorrelationID != "tx1" || internalErr.Function != "GetSegment" {
+		fmt.Println("Got internal error", internalErr)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Redaction answers right-to-erasure requests: the values of state fields
+// are replaced by salted hashes, so the original value can still be proven
+// by whoever holds it and the salt, while the link hash and evidences are
+// left untouched. The salt is passed in the transient field so it is never
+// recorded in the ledger.
+const (
+	// TransientRedactionSalt holds the salt used to hash redacted values
+	TransientRedactionSalt = "REDACTSALT"
+
+	// RedactedPrefix starts every redacted value
+	RedactedPrefix = "redacted:sha256:"
+)
+
+// Redaction is appended to segment.meta.redactions
+type Redaction struct {
+	Fields        []string `json:"fields"`
+	TransactionID string   `json:"transactionId"`
+	Timestamp     int64    `json:"timestamp"`
+}
+
+// RedactionEvent is the payload of the redactSegment event
+type RedactionEvent struct {
+	LinkHash string   `json:"linkHash"`
+	Fields   []string `json:"fields"`
+}
+
+// RedactSegmentState replaces the given state fields of a segment with
+// salted hashes. Fields are dotted paths in the link state.
+func (s *SmartContract) RedactSegmentState(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 {
+		return shim.Error("Link hash and fields are required")
+	}
+	var fields []string
+	if err := json.Unmarshal([]byte(args[1]), &fields); err != nil || len(fields) == 0 {
+		return shim.Error("Fields should be a non-empty array of strings")
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	salt := transient[TransientRedactionSalt]
+	if len(salt) < 16 {
+		return shim.Error(TransientRedactionSalt + " should be at least 16 bytes long")
+	}
+
+	segmentDocBytes, cold, err := getSegmentDocBytes(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if segmentDocBytes == nil {
+		return shim.Error("Segment not found")
+	}
+	segmentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	segment := &segmentDoc.Segment
+	if err := checkNotHeld(stub, segment); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, ok := segment.Meta["encryptedState"]; ok {
+		return shim.Error("Encrypted segments cannot be redacted")
+	}
+
+	for _, field := range fields {
+		if err := redactField(segment.Link.State, field, salt); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	redactions, _ := segment.Meta["redactions"].([]interface{})
+	segment.Meta["redactions"] = append(redactions, Redaction{
+		Fields:        fields,
+		TransactionID: stub.GetTxID(),
+		Timestamp:     now.UnixNano() / int64(time.Millisecond),
+	})
+
+	if err := putSegmentDoc(stub, *segmentDoc); err != nil {
+		return shim.Error(err.Error())
+	}
+	if cold {
+		if err := deleteColdSegment(stub, args[0]); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	eventBytes, _ := json.Marshal(RedactionEvent{args[0], fields})
+	if err := stub.SetEvent("redactSegment", eventBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	segmentBytes, err := json.Marshal(segment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(segmentBytes)
+}
+
+// redactField replaces the value at a dotted path of the state
+func redactField(state map[string]interface{}, field string, salt []byte) error {
+	parts := strings.Split(field, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := state[part].(map[string]interface{})
+		if !ok {
+			return errors.New("Field " + field + " not found")
+		}
+		state = next
+	}
+	last := parts[len(parts)-1]
+	value, ok := state[last]
+	if !ok {
+		return errors.New("Field " + field + " not found")
+	}
+	if str, ok := value.(string); ok && strings.HasPrefix(str, RedactedPrefix) {
+		return nil
+	}
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	state[last] = RedactedPrefix + hashRedactedValue(salt, valueBytes)
+	return nil
+}
+
+// hashRedactedValue returns the hex sha256 of the salt followed by the
+// JSON encoded value
+func hashRedactedValue(salt, valueBytes []byte) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write(valueBytes)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// isRedacted tells whether a segment had fields redacted
+func isRedacted(segment *cs.Segment) bool {
+	_, ok := segment.Meta["redactions"]
+	return ok
+}
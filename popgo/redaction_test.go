@@ -0,0 +1,107 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+var testSalt = []byte("0123456789abcdef")
+
+func TestPop_RedactSegmentState(t *testing.T) {
+	stub := newAdminStub(t)
+	segment := testutil.Root("main").
+		WithState("name", "Alice").
+		WithState("address", map[string]interface{}{"city": "Paris", "zip": "75001"}).
+		WithState("amount", 42.0).
+		Build()
+	stub.SaveSegment(t, segment)
+	linkHash := segment.GetLinkHashString()
+
+	stub.Transient = map[string][]byte{TransientRedactionSalt: testSalt}
+	redacted := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "RedactSegmentState", []byte(linkHash), []byte(`["name","address.city"]`)), redacted)
+
+	nameBytes, _ := json.Marshal("Alice")
+	if redacted.Link.State["name"] != RedactedPrefix+hashRedactedValue(testSalt, nameBytes) {
+		fmt.Println("Field not replaced by its salted hash", redacted.Link.State["name"])
+		t.FailNow()
+	}
+	address := redacted.Link.State["address"].(map[string]interface{})
+	if address["zip"] != "75001" || address["city"] == "Paris" || redacted.Link.State["amount"] != 42.0 {
+		fmt.Println("Only designated fields should be redacted", redacted.Link.State)
+		t.FailNow()
+	}
+	if redacted.GetLinkHashString() != linkHash || !reflect.DeepEqual(redacted.Link.Meta, segment.Link.Meta) {
+		fmt.Println("Link structure should be preserved")
+		t.FailNow()
+	}
+	if _, ok := redacted.Meta["evidence"]; !ok {
+		fmt.Println("Evidence should be preserved")
+		t.FailNow()
+	}
+	if redactions, _ := redacted.Meta["redactions"].([]interface{}); len(redactions) != 1 {
+		fmt.Println("Redaction not recorded", redacted.Meta)
+		t.FailNow()
+	}
+	if stub.EventName != "redactSegment" {
+		fmt.Println("Redaction event not sent")
+		t.FailNow()
+	}
+
+	stored := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(linkHash)), stored)
+	if !reflect.DeepEqual(stored.Link.State, redacted.Link.State) {
+		fmt.Println("Redacted segment not stored")
+		t.FailNow()
+	}
+
+	stub.Transient = nil
+	stub.InvokeError(t, "SaveSegment", mustMarshal(segment))
+}
+
+func TestPop_RedactSegmentStateInvalid(t *testing.T) {
+	stub := newAdminStub(t)
+	segment := testutil.Root("main").WithState("name", "Alice").Build()
+	stub.SaveSegment(t, segment)
+	linkHash := []byte(segment.GetLinkHashString())
+
+	stub.InvokeError(t, "RedactSegmentState", linkHash, []byte(`["name"]`))
+
+	stub.Transient = map[string][]byte{TransientRedactionSalt: testSalt}
+	stub.InvokeError(t, "RedactSegmentState", linkHash, []byte(`["unknown"]`))
+	stub.InvokeError(t, "RedactSegmentState", linkHash, []byte(`[]`))
+	stub.InvokeError(t, "RedactSegmentState", []byte("missing"), []byte(`["name"]`))
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "RedactSegmentState", linkHash, []byte(`["name"]`)); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
+
+func mustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+
+	"github.com/piedup/chaincode/popgo/relay"
+)
+
+// Config contains configuration options for the event hub source.
+type Config struct {
+	// The address of the event hub of the peer, ie "peer0:7053".
+	PeerAddress string
+
+	// The chaincode whose events are relayed. Events of all chaincodes are
+	// relayed if it is empty.
+	ChaincodeID string
+
+	// The time allowed to register with the event hub.
+	RegTimeout time.Duration
+
+	// By default the source fails when the first block it receives is
+	// after the requested one. If SkipMissed is set, the missed blocks are
+	// skipped instead.
+	SkipMissed bool
+}
+
+// DefaultRegTimeout is the default value of Config.RegTimeout.
+const DefaultRegTimeout = 10 * time.Second
+
+// ErrDisconnected is returned by Source.Err when the peer closed the
+// event stream.
+var ErrDisconnected = errors.New("the event hub closed the stream")
+
+// MissedBlocksError is returned by Source.Err when blocks were committed
+// before the source registered with the event hub.
+type MissedBlocksError struct {
+	From, To uint64
+}
+
+// Error implements error.Error.
+func (e *MissedBlocksError) Error() string {
+	return fmt.Sprintf("blocks %d to %d were committed before the event hub source registered", e.From, e.To)
+}
+
+// adapter implements the event adapter of the Fabric events client. It
+// converts block events and sends them to the block channel in order.
+type adapter struct {
+	ctx    context.Context
+	config *Config
+	next   uint64
+	first  bool
+	blocks chan *relay.Block
+
+	once  sync.Once
+	mutex sync.Mutex
+	err   error
+}
+
+func newAdapter(ctx context.Context, config *Config, from uint64) *adapter {
+	return &adapter{
+		ctx:    ctx,
+		config: config,
+		next:   from,
+		first:  true,
+		blocks: make(chan *relay.Block),
+	}
+}
+
+// GetInterestedEvents registers for block events. Chaincode events don't
+// carry the block number the relay checkpoints.
+func (a *adapter) GetInterestedEvents() ([]*pb.Interest, error) {
+	return []*pb.Interest{{EventType: pb.EventType_BLOCK}}, nil
+}
+
+// Recv handles an event. Returning false stops the events client.
+func (a *adapter) Recv(msg *pb.Event) (bool, error) {
+	blockEvent, ok := msg.Event.(*pb.Event_Block)
+	if !ok {
+		return true, nil
+	}
+	block, err := BlockEvents(blockEvent.Block, a.config.ChaincodeID)
+	if err != nil {
+		a.close(err)
+		return false, err
+	}
+	if block.Number < a.next {
+		return true, nil
+	}
+	if block.Number > a.next && (!a.first || !a.config.SkipMissed) {
+		err := &MissedBlocksError{a.next, block.Number - 1}
+		a.close(err)
+		return false, err
+	}
+	a.first = false
+
+	select {
+	case a.blocks <- block:
+		a.next = block.Number + 1
+		return true, nil
+	case <-a.ctx.Done():
+		a.close(a.ctx.Err())
+		return false, a.ctx.Err()
+	}
+}
+
+// Disconnected is called when the event stream ends.
+func (a *adapter) Disconnected(err error) {
+	if err == nil {
+		err = ErrDisconnected
+	}
+	a.close(err)
+}
+
+func (a *adapter) close(err error) {
+	a.once.Do(func() {
+		a.mutex.Lock()
+		a.err = err
+		a.mutex.Unlock()
+		close(a.blocks)
+	})
+}
+
+func (a *adapter) getErr() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.err
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package eventhub reads chaincode events from the event hub of a Fabric
+// peer. It provides a relay.Source.
+//
+// The Source itself depends on the Fabric events client and is only built
+// with the eventhub build tag, ie:
+//
+//	go build -tags eventhub
+//
+// The event hub only streams blocks committed after the source registered.
+// Blocks committed while the relay was stopped are not replayed, see
+// Config.SkipMissed.
+package eventhub
+
+import (
+	"errors"
+
+	"github.com/hyperledger/fabric/core/ledger/util"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric/protos/utils"
+
+	"github.com/piedup/chaincode/popgo/relay"
+)
+
+// BlockEvents returns the chaincode events of the valid transactions of a
+// block. If chaincodeID isn't empty, events emitted by other chaincodes are
+// left out.
+func BlockEvents(block *common.Block, chaincodeID string) (*relay.Block, error) {
+	if block.Header == nil || block.Data == nil {
+		return nil, errors.New("block has no header or data")
+	}
+	var flags util.TxValidationFlags
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		flags = util.TxValidationFlags(block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER])
+	}
+
+	b := &relay.Block{Number: block.Header.Number}
+	for i, data := range block.Data.Data {
+		if i < len(flags) && !flags.IsValid(i) {
+			continue
+		}
+		txID, events, err := transactionEvents(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			if chaincodeID != "" && event.ChaincodeId != chaincodeID {
+				continue
+			}
+			b.Events = append(b.Events, &relay.Event{
+				BlockNumber: b.Number,
+				TxID:        txID,
+				ChaincodeID: event.ChaincodeId,
+				Name:        event.EventName,
+				Payload:     event.Payload,
+			})
+		}
+	}
+	return b, nil
+}
+
+// transactionEvents returns the ID and the chaincode events of an endorser
+// transaction. Other transactions, ie configuration updates, have no
+// events.
+func transactionEvents(data []byte) (string, []*pb.ChaincodeEvent, error) {
+	env, err := utils.GetEnvelopeFromBlock(data)
+	if err != nil {
+		return "", nil, err
+	}
+	payload, err := utils.GetPayload(env)
+	if err != nil {
+		return "", nil, err
+	}
+	if payload.Header == nil {
+		return "", nil, errors.New("transaction has no header")
+	}
+	header, err := utils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return "", nil, err
+	}
+	if common.HeaderType(header.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+		return header.TxId, nil, nil
+	}
+
+	tx, err := utils.GetTransaction(payload.Data)
+	if err != nil {
+		return "", nil, err
+	}
+	var events []*pb.ChaincodeEvent
+	for _, action := range tx.Actions {
+		actionPayload, err := utils.GetChaincodeActionPayload(action.Payload)
+		if err != nil {
+			return "", nil, err
+		}
+		if actionPayload.Action == nil {
+			continue
+		}
+		responsePayload, err := utils.GetProposalResponsePayload(actionPayload.Action.ProposalResponsePayload)
+		if err != nil {
+			return "", nil, err
+		}
+		chaincodeAction, err := utils.GetChaincodeAction(responsePayload.Extension)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(chaincodeAction.Events) == 0 {
+			continue
+		}
+		event, err := utils.GetChaincodeEvents(chaincodeAction.Events)
+		if err != nil {
+			return "", nil, err
+		}
+		events = append(events, event)
+	}
+	return header.TxId, events, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/util"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric/protos/utils"
+)
+
+func testTx(txID, chaincodeID, name string) []byte {
+	event := &pb.ChaincodeEvent{ChaincodeId: chaincodeID, TxId: txID, EventName: name, Payload: []byte(txID)}
+	action := &pb.ChaincodeAction{Events: utils.MarshalOrPanic(event)}
+	responsePayload := &pb.ProposalResponsePayload{Extension: utils.MarshalOrPanic(action)}
+	actionPayload := &pb.ChaincodeActionPayload{
+		Action: &pb.ChaincodeEndorsedAction{ProposalResponsePayload: utils.MarshalOrPanic(responsePayload)},
+	}
+	tx := &pb.Transaction{Actions: []*pb.TransactionAction{{Payload: utils.MarshalOrPanic(actionPayload)}}}
+	header := &common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: txID}
+	payload := &common.Payload{
+		Header: &common.Header{ChannelHeader: utils.MarshalOrPanic(header)},
+		Data:   utils.MarshalOrPanic(tx),
+	}
+	return utils.MarshalOrPanic(&common.Envelope{Payload: utils.MarshalOrPanic(payload)})
+}
+
+func testConfigTx() []byte {
+	header := &common.ChannelHeader{Type: int32(common.HeaderType_CONFIG), TxId: "config"}
+	payload := &common.Payload{Header: &common.Header{ChannelHeader: utils.MarshalOrPanic(header)}}
+	return utils.MarshalOrPanic(&common.Envelope{Payload: utils.MarshalOrPanic(payload)})
+}
+
+func testBlock(number uint64, txs ...[]byte) *common.Block {
+	block := common.NewBlock(number, nil)
+	block.Data.Data = txs
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = util.NewTxValidationFlags(len(txs))
+	return block
+}
+
+func TestBlockEvents(t *testing.T) {
+	block := testBlock(3, testTx("a", "pop", "saveSegment"), testConfigTx(), testTx("b", "pop", "saveSegment"), testTx("c", "other", "saveSegment"))
+	flags := util.TxValidationFlags(block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER])
+	flags.SetFlag(2, pb.TxValidationCode_MVCC_READ_CONFLICT)
+
+	b, err := BlockEvents(block, "pop")
+	if err != nil {
+		fmt.Println("BlockEvents failed", err)
+		t.FailNow()
+	}
+	if b.Number != 3 || len(b.Events) != 1 {
+		fmt.Println("Expected the event of the valid pop transaction, got", b.Number, len(b.Events))
+		t.FailNow()
+	}
+	event := b.Events[0]
+	if event.BlockNumber != 3 || event.TxID != "a" || event.ChaincodeID != "pop" || event.Name != "saveSegment" || string(event.Payload) != "a" {
+		fmt.Println("Got event", event)
+		t.FailNow()
+	}
+
+	if b, _ := BlockEvents(block, ""); len(b.Events) != 2 {
+		fmt.Println("Events of all chaincodes should be returned without chaincode ID")
+		t.FailNow()
+	}
+}
+
+func blockEvent(number uint64) *pb.Event {
+	return &pb.Event{Event: &pb.Event_Block{Block: testBlock(number, testTx(fmt.Sprint(number), "pop", "saveSegment"))}}
+}
+
+func TestAdapter_Recv(t *testing.T) {
+	a := newAdapter(context.Background(), &Config{}, 2)
+	go func() {
+		for _, n := range []uint64{1, 2, 3} {
+			if ok, err := a.Recv(blockEvent(n)); !ok {
+				fmt.Println("Recv failed", err)
+				return
+			}
+		}
+		a.Disconnected(nil)
+	}()
+
+	var numbers []uint64
+	for block := range a.blocks {
+		numbers = append(numbers, block.Number)
+	}
+	if len(numbers) != 2 || numbers[0] != 2 || numbers[1] != 3 {
+		fmt.Println("Expected blocks 2 and 3, got", numbers)
+		t.FailNow()
+	}
+	if a.getErr() != ErrDisconnected {
+		fmt.Println("Got error", a.getErr())
+		t.FailNow()
+	}
+}
+
+func TestAdapter_MissedBlocks(t *testing.T) {
+	a := newAdapter(context.Background(), &Config{}, 2)
+	if ok, _ := a.Recv(blockEvent(5)); ok {
+		fmt.Println("Missed blocks should stop the source")
+		t.FailNow()
+	}
+	if _, ok := <-a.blocks; ok {
+		t.FailNow()
+	}
+	if err, ok := a.getErr().(*MissedBlocksError); !ok || err.From != 2 || err.To != 4 {
+		fmt.Println("Got error", a.getErr())
+		t.FailNow()
+	}
+
+	a = newAdapter(context.Background(), &Config{SkipMissed: true}, 2)
+	done := make(chan bool)
+	go func() {
+		ok, _ := a.Recv(blockEvent(5))
+		done <- ok
+	}()
+	if block := <-a.blocks; block.Number != 5 {
+		fmt.Println("Missed blocks should be skipped, got", block.Number)
+		t.FailNow()
+	}
+	if !<-done {
+		t.FailNow()
+	}
+
+	// Only blocks missed before the first one can be skipped
+	if ok, _ := a.Recv(blockEvent(7)); ok {
+		fmt.Println("A gap in the stream should stop the source")
+		t.FailNow()
+	}
+}
+
+func TestAdapter_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := newAdapter(ctx, &Config{}, 0)
+	cancel()
+	if ok, _ := a.Recv(blockEvent(0)); ok {
+		t.FailNow()
+	}
+	if a.getErr() != context.Canceled {
+		fmt.Println("Got error", a.getErr())
+		t.FailNow()
+	}
+}
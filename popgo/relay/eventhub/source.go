@@ -0,0 +1,76 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build eventhub
+// +build eventhub
+
+package eventhub
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hyperledger/fabric/events/consumer"
+
+	"github.com/piedup/chaincode/popgo/relay"
+)
+
+// Source reads blocks from the event hub of a peer.
+//
+// The events client registers with the identity of the local MSP, which
+// must be loaded beforehand, ie with mspmgmt.LoadLocalMsp. TLS is enabled
+// by the peer.tls.enabled viper setting, like for the peer CLI.
+type Source struct {
+	config  *Config
+	adapter *adapter
+}
+
+// NewSource creates an event hub source.
+func NewSource(config *Config) *Source {
+	c := *config
+	if c.RegTimeout <= 0 {
+		c.RegTimeout = DefaultRegTimeout
+	}
+	return &Source{config: &c}
+}
+
+// Blocks implements relay.Source.Blocks. It must only be called once.
+func (s *Source) Blocks(ctx context.Context, from uint64) (<-chan *relay.Block, error) {
+	if s.adapter != nil {
+		return nil, errors.New("the event hub source is already started")
+	}
+	s.adapter = newAdapter(ctx, s.config, from)
+	client, err := consumer.NewEventsClient(s.config.PeerAddress, s.config.RegTimeout, s.adapter)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Start(); err != nil {
+		return nil, err
+	}
+	go func() {
+		// Closing the stream makes the peer end it, which closes the block
+		// channel.
+		<-ctx.Done()
+		client.Stop()
+	}()
+	return s.adapter.blocks, nil
+}
+
+// Err implements relay.Source.Err.
+func (s *Source) Err() error {
+	if s.adapter == nil {
+		return nil
+	}
+	return s.adapter.getErr()
+}
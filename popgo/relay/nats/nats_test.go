@@ -0,0 +1,188 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/piedup/chaincode/popgo/relay"
+)
+
+type message struct {
+	subject string
+	payload []byte
+}
+
+// mockServer accepts connections and answers publications with reply,
+// which is "PONG" for a healthy server.
+type mockServer struct {
+	listener net.Listener
+	messages chan message
+
+	mutex    sync.Mutex
+	connects []string
+	reply    string
+}
+
+func newMockServer(t *testing.T, reply string) *mockServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.FailNow()
+	}
+	s := &mockServer{listener: listener, messages: make(chan message, 10), reply: reply}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *mockServer) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.Write([]byte(`INFO {"server_id":"mock","max_payload":1048576}` + "\r\n"))
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "CONNECT":
+			s.mutex.Lock()
+			s.connects = append(s.connects, line)
+			s.mutex.Unlock()
+		case "PUB":
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.messages <- message{fields[1], payload[:size]}
+		case "PING":
+			s.mutex.Lock()
+			reply := s.reply
+			s.mutex.Unlock()
+			conn.Write([]byte("PING\r\n" + reply + "\r\n"))
+		}
+	}
+}
+
+func (s *mockServer) getConnects() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.connects...)
+}
+
+func TestSink_Publish(t *testing.T) {
+	server := newMockServer(t, "PONG")
+	defer server.listener.Close()
+
+	sink, err := relay.NewSink("nats", json.RawMessage(`{"url":"nats://relay:secret@`+server.listener.Addr().String()+`","subject":"pop"}`))
+	if err != nil {
+		fmt.Println("NewSink failed", err)
+		t.FailNow()
+	}
+	defer sink.Close()
+
+	event := &relay.Event{BlockNumber: 3, TxID: "a", Name: "saveSegment", Payload: []byte("{}")}
+	for i := 0; i < 2; i++ {
+		if err := sink.Publish(context.Background(), event); err != nil {
+			fmt.Println("Publish failed", err)
+			t.FailNow()
+		}
+		msg := <-server.messages
+		published := &relay.Event{}
+		json.Unmarshal(msg.payload, published)
+		if msg.subject != "pop.saveSegment" || published.TxID != "a" || published.BlockNumber != 3 {
+			fmt.Println("Got message", msg.subject, string(msg.payload))
+			t.FailNow()
+		}
+	}
+
+	// The connection is reused
+	if connects := server.getConnects(); len(connects) != 1 || !strings.Contains(connects[0], `"user":"relay","pass":"secret"`) {
+		fmt.Println("Got connects", connects)
+		t.FailNow()
+	}
+}
+
+func TestSink_Error(t *testing.T) {
+	server := newMockServer(t, "-ERR 'Authorization Violation'")
+	defer server.listener.Close()
+
+	sink, _ := NewSink(&Config{URL: "nats://" + server.listener.Addr().String(), Subject: "pop"})
+	defer sink.Close()
+
+	err := sink.Publish(context.Background(), &relay.Event{Name: "saveSegment"})
+	if err == nil || err.Error() != "NATS server error: Authorization Violation" {
+		fmt.Println("Got error", err)
+		t.FailNow()
+	}
+	<-server.messages
+
+	// The sink reconnects after a failure
+	server.mutex.Lock()
+	server.reply = "PONG"
+	server.mutex.Unlock()
+	if err := sink.Publish(context.Background(), &relay.Event{Name: "saveSegment"}); err != nil {
+		fmt.Println("Publish failed", err)
+		t.FailNow()
+	}
+	if connects := server.getConnects(); len(connects) != 2 {
+		fmt.Println("Expected 2 connections, got", len(connects))
+		t.FailNow()
+	}
+}
+
+func TestNewSink_Timeout(t *testing.T) {
+	sink, err := relay.NewSink("nats", json.RawMessage(`{"url":"nats://localhost","subject":"pop","timeout":"250ms"}`))
+	if err != nil || time.Duration(sink.(*Sink).config.Timeout) != 250*time.Millisecond {
+		fmt.Println("Timeout not configured", err)
+		t.FailNow()
+	}
+	if _, err := relay.NewSink("nats", json.RawMessage(`{"url":"nats://localhost","subject":"pop","timeout":"soon"}`)); err == nil {
+		fmt.Println("Invalid timeouts should be rejected")
+		t.FailNow()
+	}
+}
+
+func TestNewSink_Invalid(t *testing.T) {
+	for _, config := range []*Config{
+		{URL: "http://localhost", Subject: "pop"},
+		{URL: "nats://localhost"},
+		{URL: "nats://localhost", Subject: "pop events"},
+	} {
+		if _, err := NewSink(config); err == nil {
+			fmt.Println("Config should be rejected", config)
+			t.FailNow()
+		}
+	}
+}
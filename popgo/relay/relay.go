@@ -0,0 +1,205 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package relay republishes events emitted by the pop chaincode to message
+// brokers.
+//
+// Events are read block by block from a Source and handed to every
+// configured Sink. The number of the last block whose events were accepted
+// by all sinks is persisted by a Checkpointer, so a restarted relay resumes
+// where it stopped. Delivery is at-least-once: events of a block that was
+// only partially published are sent again after a restart.
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Event is a chaincode event.
+type Event struct {
+	// Number of the block containing the transaction.
+	BlockNumber uint64 `json:"blockNumber"`
+
+	// ID of the transaction that emitted the event.
+	TxID string `json:"txId"`
+
+	// ID of the chaincode that emitted the event.
+	ChaincodeID string `json:"chaincodeId"`
+
+	// Name of the event, ie "saveSegment".
+	Name string `json:"name"`
+
+	// Payload of the event.
+	Payload []byte `json:"payload"`
+}
+
+// Block contains the chaincode events of a committed block.
+type Block struct {
+	Number uint64
+	Events []*Event
+}
+
+// Source must be implemented by event providers, typically a Fabric event
+// hub client, see package eventhub.
+type Source interface {
+	// Blocks sends committed blocks, starting at block number from, to the
+	// returned channel in increasing order. The channel must be closed when
+	// the context is done or the source fails, in which case Err returns
+	// the reason.
+	Blocks(ctx context.Context, from uint64) (<-chan *Block, error)
+
+	// Err returns the error that caused the block channel to be closed.
+	Err() error
+}
+
+// Checkpointer persists the number of the last processed block.
+type Checkpointer interface {
+	// Load returns the last saved block number. The boolean is false if no
+	// checkpoint was saved yet.
+	Load() (uint64, bool, error)
+
+	// Save stores the number of the last processed block.
+	Save(blockNumber uint64) error
+}
+
+// Config contains configuration options for the relay.
+type Config struct {
+	// The block to start from when no checkpoint exists.
+	StartBlock uint64
+
+	// The delay before the first retry of a failed publication.
+	RetryDelay time.Duration
+
+	// The maximum delay between two retries.
+	MaxRetryDelay time.Duration
+}
+
+const (
+	// DefaultRetryDelay is the default value of Config.RetryDelay.
+	DefaultRetryDelay = 100 * time.Millisecond
+
+	// DefaultMaxRetryDelay is the default value of Config.MaxRetryDelay.
+	DefaultMaxRetryDelay = 30 * time.Second
+)
+
+// Duration is a time.Duration read from JSON strings like "10s".
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ErrNoSink is returned when a relay is created without sinks.
+var ErrNoSink = errors.New("at least one sink is required")
+
+// Relay forwards events from a source to sinks.
+type Relay struct {
+	config     *Config
+	source     Source
+	sinks      []Sink
+	checkpoint Checkpointer
+}
+
+// New creates a relay.
+func New(config *Config, source Source, checkpoint Checkpointer, sinks ...Sink) (*Relay, error) {
+	if len(sinks) == 0 {
+		return nil, ErrNoSink
+	}
+	c := *config
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = DefaultRetryDelay
+	}
+	if c.MaxRetryDelay <= 0 {
+		c.MaxRetryDelay = DefaultMaxRetryDelay
+	}
+	return &Relay{
+		config:     &c,
+		source:     source,
+		sinks:      sinks,
+		checkpoint: checkpoint,
+	}, nil
+}
+
+// Start forwards events until the context is done or the source fails.
+func (r *Relay) Start(ctx context.Context) error {
+	from := r.config.StartBlock
+	last, ok, err := r.checkpoint.Load()
+	if err != nil {
+		return err
+	}
+	if ok {
+		from = last + 1
+	}
+
+	blocks, err := r.source.Blocks(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	for block := range blocks {
+		for _, event := range block.Events {
+			for _, sink := range r.sinks {
+				if err := r.publish(ctx, sink, event); err != nil {
+					return err
+				}
+			}
+		}
+		if err := r.checkpoint.Save(block.Number); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.source.Err()
+}
+
+// publish retries with an exponential backoff until the sink accepts the
+// event or the context is done.
+func (r *Relay) publish(ctx context.Context, sink Sink, event *Event) error {
+	delay := r.config.RetryDelay
+	for {
+		err := sink.Publish(ctx, event)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > r.config.MaxRetryDelay {
+			delay = r.config.MaxRetryDelay
+		}
+	}
+}
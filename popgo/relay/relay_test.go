@@ -0,0 +1,293 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockSource struct {
+	blocks []*Block
+	from   uint64
+}
+
+func (s *mockSource) Blocks(ctx context.Context, from uint64) (<-chan *Block, error) {
+	s.from = from
+	c := make(chan *Block)
+	go func() {
+		defer close(c)
+		for _, b := range s.blocks {
+			if b.Number < from {
+				continue
+			}
+			select {
+			case c <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (s *mockSource) Err() error {
+	return nil
+}
+
+type memoryCheckpoint struct {
+	saved []uint64
+}
+
+func (c *memoryCheckpoint) Load() (uint64, bool, error) {
+	if len(c.saved) == 0 {
+		return 0, false, nil
+	}
+	return c.saved[len(c.saved)-1], true, nil
+}
+
+func (c *memoryCheckpoint) Save(blockNumber uint64) error {
+	c.saved = append(c.saved, blockNumber)
+	return nil
+}
+
+type flakySink struct {
+	failures  int
+	published []*Event
+}
+
+func (s *flakySink) Publish(ctx context.Context, event *Event) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	s.published = append(s.published, event)
+	return nil
+}
+
+func (s *flakySink) Close() error {
+	return nil
+}
+
+func testBlocks() []*Block {
+	return []*Block{
+		{Number: 1, Events: []*Event{{BlockNumber: 1, TxID: "a", Name: "saveSegment"}}},
+		{Number: 2, Events: []*Event{{BlockNumber: 2, TxID: "b", Name: "saveSegment"}, {BlockNumber: 2, TxID: "c", Name: "saveSegment"}}},
+	}
+}
+
+func TestRelay_Start(t *testing.T) {
+	source := &mockSource{blocks: testBlocks()}
+	checkpoint := &memoryCheckpoint{}
+	sink := &flakySink{failures: 2}
+
+	r, err := New(&Config{RetryDelay: time.Millisecond}, source, checkpoint, sink)
+	if err != nil {
+		t.FailNow()
+	}
+	if err := r.Start(context.Background()); err != nil {
+		fmt.Println("Start failed", err)
+		t.FailNow()
+	}
+
+	if len(sink.published) != 3 {
+		fmt.Println("Expected 3 events, got", len(sink.published))
+		t.FailNow()
+	}
+	if len(checkpoint.saved) != 2 || checkpoint.saved[1] != 2 {
+		fmt.Println("Checkpoint not saved", checkpoint.saved)
+		t.FailNow()
+	}
+}
+
+func TestRelay_Resume(t *testing.T) {
+	source := &mockSource{blocks: testBlocks()}
+	checkpoint := &memoryCheckpoint{saved: []uint64{1}}
+	sink := &flakySink{}
+
+	r, _ := New(&Config{}, source, checkpoint, sink)
+	if err := r.Start(context.Background()); err != nil {
+		t.FailNow()
+	}
+
+	if source.from != 2 {
+		fmt.Println("Relay should resume after checkpoint, started at", source.from)
+		t.FailNow()
+	}
+	if len(sink.published) != 2 {
+		fmt.Println("Expected 2 events, got", len(sink.published))
+		t.FailNow()
+	}
+}
+
+func TestRelay_Cancel(t *testing.T) {
+	source := &mockSource{blocks: testBlocks()}
+	checkpoint := &memoryCheckpoint{}
+	sink := &flakySink{failures: 1 << 30}
+
+	r, _ := New(&Config{RetryDelay: time.Millisecond}, source, checkpoint, sink)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := r.Start(ctx); err != context.DeadlineExceeded {
+		fmt.Println("Expected deadline error, got", err)
+		t.FailNow()
+	}
+	if len(checkpoint.saved) != 0 {
+		fmt.Println("Checkpoint should not advance when publication fails")
+		t.FailNow()
+	}
+}
+
+func TestRelay_NoSink(t *testing.T) {
+	if _, err := New(&Config{}, &mockSource{}, &memoryCheckpoint{}); err != ErrNoSink {
+		t.FailNow()
+	}
+}
+
+func TestFileCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "relay")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	c := NewFileCheckpoint(filepath.Join(dir, "checkpoint"))
+	if _, ok, err := c.Load(); ok || err != nil {
+		fmt.Println("Empty checkpoint should not load", err)
+		t.FailNow()
+	}
+	if err := c.Save(42); err != nil {
+		t.FailNow()
+	}
+	n, ok, err := c.Load()
+	if !ok || err != nil || n != 42 {
+		fmt.Println("Checkpoint not saved", n, err)
+		t.FailNow()
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	config, _ := json.Marshal(HTTPSinkConfig{URL: server.URL})
+	sink, err := NewSink("http", config)
+	if err != nil {
+		t.FailNow()
+	}
+	if err := sink.Publish(context.Background(), &Event{TxID: "a"}); err != nil {
+		fmt.Println("Publish failed", err)
+		t.FailNow()
+	}
+	if received.TxID != "a" {
+		fmt.Println("Event not received")
+		t.FailNow()
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := NewWriterSink(buf)
+	sink.Publish(context.Background(), &Event{TxID: "a"})
+	sink.Publish(context.Background(), &Event{TxID: "b"})
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 {
+		fmt.Println("Expected 2 lines, got", len(lines))
+		t.FailNow()
+	}
+}
+
+func TestNewSink_Unknown(t *testing.T) {
+	if _, err := NewSink("carrier-pigeon", nil); err == nil {
+		t.FailNow()
+	}
+}
+
+type mockRegistry map[string][]*Webhook
+
+func (r mockRegistry) Webhooks(ctx context.Context, process string) ([]*Webhook, error) {
+	return r[process], nil
+}
+
+func testWebhook(id, url, secret string, events ...string) *Webhook {
+	hash := sha256.Sum256([]byte("salt\x00" + secret))
+	return &Webhook{ID: id, URL: url, Events: events, SecretSalt: "salt", SecretVerifier: hex.EncodeToString(hash[:])}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var signatures []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign([]byte("0123456789abcdef"), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		signatures = append(signatures, r.Header.Get(SignatureHeader))
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(&WebhookSinkConfig{
+		Secrets:     map[string]string{"a": "0123456789abcdef", "b": "0123456789abcdef", "dead": "0123456789abcdef", "forged": "fedcba9876543210"},
+		MaxAttempts: 2,
+	}, mockRegistry{
+		"main": {
+			testWebhook("dead", "http://127.0.0.1:1", "0123456789abcdef"),
+			testWebhook("a", server.URL, "0123456789abcdef"),
+			testWebhook("b", server.URL, "0123456789abcdef", "addEvidence"),
+			testWebhook("forged", server.URL, "0123456789abcdef"),
+			testWebhook("missing", server.URL, "0123456789abcdef"),
+		},
+	}, nil)
+
+	// A failing webhook doesn't prevent the delivery to the others
+	event := &Event{Name: "saveSegment", Payload: []byte(`{"link":{"meta":{"process":"main"}}}`)}
+	err := sink.Publish(context.Background(), event)
+	errs, ok := err.(WebhookErrors)
+	if !ok || len(errs) != 3 || errs["dead"] == nil || errs["forged"] == nil || errs["missing"] == nil {
+		fmt.Println("Got error", err)
+		t.FailNow()
+	}
+	if len(signatures) != 1 {
+		fmt.Println("Expected 1 delivery, got", len(signatures))
+		t.FailNow()
+	}
+
+	// Retries skip delivered webhooks and give up after MaxAttempts
+	if err := sink.Publish(context.Background(), event); err != nil || len(signatures) != 1 {
+		fmt.Println("Retry failed", err, len(signatures))
+		t.FailNow()
+	}
+
+	other := []byte(`{"link":{"meta":{"process":"other"}}}`)
+	if err := sink.Publish(context.Background(), &Event{Name: "saveSegment", Payload: other}); err != nil || len(signatures) != 1 {
+		fmt.Println("Events of other processes should not be delivered")
+		t.FailNow()
+	}
+}
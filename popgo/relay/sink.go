@@ -0,0 +1,173 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Sink must be implemented by event publishers.
+//
+// Broker specific sinks live in their own packages and make themselves
+// available with RegisterSink, so the relay doesn't depend on every broker
+// client. See package nats for a NATS sink.
+type Sink interface {
+	// Publish sends an event. It must only return nil once the broker
+	// acknowledged the event.
+	Publish(ctx context.Context, event *Event) error
+
+	// Close releases the resources used by the sink.
+	Close() error
+}
+
+// SinkFactory creates a sink from its JSON configuration.
+type SinkFactory func(config json.RawMessage) (Sink, error)
+
+var (
+	sinkFactoriesMutex sync.RWMutex
+	sinkFactories      = map[string]SinkFactory{
+		"http": newHTTPSinkFromConfig,
+		"file": newFileSinkFromConfig,
+	}
+)
+
+// RegisterSink makes a sink kind available to NewSink.
+func RegisterSink(kind string, factory SinkFactory) {
+	sinkFactoriesMutex.Lock()
+	defer sinkFactoriesMutex.Unlock()
+	sinkFactories[kind] = factory
+}
+
+// NewSink creates a sink of a registered kind.
+func NewSink(kind string, config json.RawMessage) (Sink, error) {
+	sinkFactoriesMutex.RLock()
+	factory, ok := sinkFactories[kind]
+	sinkFactoriesMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sink kind %q", kind)
+	}
+	return factory(config)
+}
+
+// HTTPSinkConfig contains configuration options for the HTTP sink.
+type HTTPSinkConfig struct {
+	// The URL events are posted to.
+	URL string `json:"url"`
+}
+
+// HTTPSink posts events as JSON to a URL.
+type HTTPSink struct {
+	config *HTTPSinkConfig
+	client *http.Client
+}
+
+// NewHTTPSink creates an HTTP sink.
+func NewHTTPSink(config *HTTPSinkConfig, client *http.Client) *HTTPSink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPSink{config, client}
+}
+
+func newHTTPSinkFromConfig(raw json.RawMessage) (Sink, error) {
+	config := &HTTPSinkConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, err
+	}
+	return NewHTTPSink(config, nil), nil
+}
+
+// Publish implements Sink.Publish.
+func (s *HTTPSink) Publish(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with status %d", s.config.URL, res.StatusCode)
+	}
+	return nil
+}
+
+// Close implements Sink.Close.
+func (s *HTTPSink) Close() error {
+	return nil
+}
+
+// FileSinkConfig contains configuration options for the file sink.
+type FileSinkConfig struct {
+	// The path of the file events are appended to.
+	Path string `json:"path"`
+}
+
+// WriterSink writes events as newline delimited JSON.
+type WriterSink struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+// NewWriterSink creates a sink writing to w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func newFileSinkFromConfig(raw json.RawMessage) (Sink, error) {
+	config := &FileSinkConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterSink(f), nil
+}
+
+// Publish implements Sink.Publish.
+func (s *WriterSink) Publish(ctx context.Context, event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close implements Sink.Close.
+func (s *WriterSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SignatureHeader is the HTTP header containing the signature of webhook
+// payloads.
+const SignatureHeader = "X-Pop-Signature"
+
+// DefaultWebhookAttempts is the default value of
+// WebhookSinkConfig.MaxAttempts.
+const DefaultWebhookAttempts = 5
+
+// Webhook is a webhook registered on-chain with RegisterWebhook.
+type Webhook struct {
+	ID             string   `json:"id"`
+	Process        string   `json:"process"`
+	URL            string   `json:"url"`
+	Events         []string `json:"events,omitempty"`
+	SecretSalt     string   `json:"secretSalt"`
+	SecretVerifier string   `json:"secretVerifier"`
+}
+
+// WebhookRegistry must be implemented by webhook providers, typically a
+// client calling GetWebhooks on the chaincode as a process owner.
+type WebhookRegistry interface {
+	// Webhooks returns the webhooks registered for a process.
+	Webhooks(ctx context.Context, process string) ([]*Webhook, error)
+}
+
+// WebhookSinkConfig contains configuration options for the webhook sink.
+type WebhookSinkConfig struct {
+	// The shared secrets of the webhooks by webhook ID. They aren't stored
+	// on-chain and must be given to the relay out of band.
+	Secrets map[string]string `json:"secrets"`
+
+	// The number of failed deliveries of an event to a webhook after which
+	// the webhook is skipped for that event, so an unreachable webhook
+	// doesn't hold back the others forever.
+	MaxAttempts int `json:"maxAttempts"`
+}
+
+// WebhookSink posts the events of a process to its registered webhooks.
+//
+// Payloads are signed with HMAC-SHA256, using the shared secret of the
+// webhook as key. The hex encoded signature is sent in the SignatureHeader
+// header.
+//
+// Webhooks are delivered independently: when Publish is retried for the
+// same event, webhooks that already accepted it are skipped.
+type WebhookSink struct {
+	config   *WebhookSinkConfig
+	registry WebhookRegistry
+	client   *http.Client
+
+	mutex     sync.Mutex
+	event     *Event
+	delivered map[string]bool
+	attempts  map[string]int
+}
+
+// NewWebhookSink creates a webhook sink.
+func NewWebhookSink(config *WebhookSinkConfig, registry WebhookRegistry, client *http.Client) *WebhookSink {
+	c := *config
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = DefaultWebhookAttempts
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &WebhookSink{config: &c, registry: registry, client: client}
+}
+
+// WebhookErrors contains the errors of the webhooks an event couldn't be
+// delivered to, by webhook ID.
+type WebhookErrors map[string]error
+
+// Error implements error.Error.
+func (e WebhookErrors) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	messages := make([]string, len(ids))
+	for i, id := range ids {
+		messages[i] = fmt.Sprintf("webhook %s: %s", id, e[id])
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Publish implements Sink.Publish. Events whose payload isn't a segment are
+// ignored.
+func (s *WebhookSink) Publish(ctx context.Context, event *Event) error {
+	process := eventProcess(event)
+	if process == "" {
+		return nil
+	}
+	webhooks, err := s.registry.Webhooks(ctx, process)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.event != event {
+		s.event, s.delivered, s.attempts = event, map[string]bool{}, map[string]int{}
+	}
+
+	errs := WebhookErrors{}
+	for _, w := range webhooks {
+		if len(w.Events) > 0 && !containsString(w.Events, event.Name) {
+			continue
+		}
+		if s.delivered[w.ID] || s.attempts[w.ID] >= s.config.MaxAttempts {
+			continue
+		}
+		if err := s.post(ctx, w, body); err != nil {
+			s.attempts[w.ID]++
+			if s.attempts[w.ID] < s.config.MaxAttempts {
+				errs[w.ID] = err
+			}
+			continue
+		}
+		s.delivered[w.ID] = true
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *WebhookSink) post(ctx context.Context, w *Webhook, body []byte) error {
+	secret, ok := s.config.Secrets[w.ID]
+	if !ok {
+		return errors.New("no secret was given for the webhook")
+	}
+	if !VerifySecret(w.SecretSalt, w.SecretVerifier, secret) {
+		return errors.New("the secret doesn't match the registration")
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign([]byte(secret), body))
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with status %d", w.URL, res.StatusCode)
+	}
+	return nil
+}
+
+// Close implements Sink.Close.
+func (s *WebhookSink) Close() error {
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of a webhook payload.
+// Receivers compute it with their shared secret as key.
+func Sign(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySecret checks a shared secret against the salted hash stored
+// on-chain when the webhook was registered.
+func VerifySecret(salt, verifier, secret string) bool {
+	hash := sha256.New()
+	hash.Write([]byte(salt))
+	hash.Write([]byte{0})
+	hash.Write([]byte(secret))
+	return hmac.Equal([]byte(hex.EncodeToString(hash.Sum(nil))), []byte(verifier))
+}
+
+// eventProcess returns the process of the segment in the payload of an
+// event, or an empty string.
+func eventProcess(event *Event) string {
+	var payload struct {
+		Link struct {
+			Meta struct {
+				Process string `json:"process"`
+			} `json:"meta"`
+		} `json:"link"`
+	}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return ""
+	}
+	return payload.Link.Meta.Process
+}
+
+func containsString(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
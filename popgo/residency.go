@@ -0,0 +1,57 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stratumn/sdk/cs"
+)
+
+// MaxResidencyLength is the maximum length of a residency
+const MaxResidencyLength = 32
+
+// validateResidency checks a residency is a jurisdiction code made of
+// letters, digits and dashes, like "EU" or "US-CA"
+func validateResidency(residency string) error {
+	if len(residency) > MaxResidencyLength {
+		return errors.New("Residency should not be longer than " + strconv.Itoa(MaxResidencyLength) + " characters")
+	}
+	for _, c := range residency {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return errors.New("Residency " + residency + " should only have letters, digits and dashes")
+		}
+	}
+	return nil
+}
+
+// segmentResidency returns the jurisdiction the state of a segment must
+// stay in: link.meta.residency, or the residency of its process
+func segmentResidency(stub shim.ChaincodeStubInterface, segment *cs.Segment) (string, error) {
+	if value, ok := segment.Link.Meta["residency"]; ok {
+		residency, ok := value.(string)
+		if !ok {
+			return "", errors.New("link.meta.residency should be a string")
+		}
+		return residency, validateResidency(residency)
+	}
+	process, err := getProcess(stub, segment.Link.GetProcess())
+	if err != nil || process == nil {
+		return "", err
+	}
+	return process.Residency, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_Residency(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Invoke(t, "CreateProcess", []byte(`{
+		"name": "claims",
+		"rules": [{"from": "", "to": "file"}, {"from": "file", "to": "file"}],
+		"residency": "EU"
+	}`))
+	stub.InvokeError(t, "CreateProcess", []byte(`{"name":"x","initialActions":["a"],"residency":"E U"}`))
+
+	root := testutil.Root("claims").WithAction("file").Build()
+	child := testutil.Child(root).WithAction("file").WithLinkMeta("residency", "US-CA").Build()
+	other := testutil.Root("main").Build()
+	stub.SaveSegment(t, root, child, other)
+	stub.InvokeError(t, "SaveSegment", mustMarshal(testutil.Child(root).WithAction("file").WithLinkMeta("residency", 1).Build()))
+
+	for _, test := range []struct {
+		filter   string
+		expected int
+	}{
+		{`{"residency":"EU"}`, 1},
+		{`{"residency":"US-CA"}`, 1},
+		{`{"residency":"JP"}`, 0},
+		{`{}`, 3},
+	} {
+		var found cs.SegmentSlice
+		json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(test.filter)), &found)
+		if len(found) != test.expected {
+			fmt.Println("Filter", test.filter, "returned", len(found), "segments, expected", test.expected)
+			t.FailNow()
+		}
+	}
+	stub.InvokeError(t, "FindSegments", []byte(`{"residency":"$gt"}`))
+
+	doc := &SegmentDoc{}
+	json.Unmarshal(stub.State[root.GetLinkHashString()], doc)
+	if doc.Residency != "EU" {
+		fmt.Println("Got residency", doc.Residency, "expected EU")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ResponseMeta is returned as JSON in the message of successful query
+// responses
+type ResponseMeta struct {
+	// Checksum is the hex encoded SHA-256 of the payload, so clients can
+	// detect payloads corrupted or truncated by gateways
+	Checksum string `json:"checksum,omitempty"`
+
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Truncated is set when results were limited to the page size or the
+	// response size budget. Bookmark is then the offset of the next page.
+	Truncated bool   `json:"truncated,omitempty"`
+	Bookmark  string `json:"bookmark,omitempty"`
+
+	// Height is the number of segment writes the peer had committed when
+	// it executed the query. It only grows, so a client getting a lower
+	// height than it saw before is talking to a lagging peer.
+	Height int `json:"height,omitempty"`
+
+	// Degraded is set when CouchDB had no index for the query and the
+	// results come from a scan of the state, see getQueryResult
+	Degraded bool `json:"degraded,omitempty"`
+
+	// Deprecated is set when the function was called under a deprecated
+	// name
+	Deprecated string `json:"deprecated,omitempty"`
+}
+
+// Page is the payload of paginated functions. Its fields mirror the
+// pagination fields of the metadata, which FindSegments returns along with
+// a bare segment slice for the store adapters.
+type Page struct {
+	Data json.RawMessage `json:"data"`
+	// Bookmark is the offset of the next page when HasMore is set
+	Bookmark string `json:"bookmark,omitempty"`
+	HasMore  bool   `json:"hasMore"`
+	// TotalEstimated is the number of results of all pages, it is only
+	// set when it can be computed without scanning the results
+	TotalEstimated int `json:"totalEstimated,omitempty"`
+}
+
+// newPage wraps the results of a query in a page
+func newPage(data interface{}, meta *ResponseMeta, totalEstimated int) ([]byte, error) {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Page{
+		Data:           dataBytes,
+		Bookmark:       meta.Bookmark,
+		HasMore:        meta.Truncated,
+		TotalEstimated: totalEstimated,
+	})
+}
+
+func (m *ResponseMeta) empty() bool {
+	return m.Checksum == "" && len(m.Warnings) == 0 && !m.Truncated && m.Bookmark == "" && m.Height == 0 && !m.Degraded && m.Deprecated == ""
+}
+
+// successWithMeta returns a successful response with metadata and the
+// checksum of the payload
+func successWithMeta(payload []byte, meta *ResponseMeta) sc.Response {
+	if meta == nil {
+		meta = &ResponseMeta{}
+	}
+	if payload != nil {
+		hash := sha256.Sum256(payload)
+		meta.Checksum = hex.EncodeToString(hash[:])
+	}
+	if meta.empty() {
+		return shim.Success(payload)
+	}
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return sc.Response{
+		Status:  shim.OK,
+		Message: string(metaBytes),
+		Payload: payload,
+	}
+}
+
+// withHeight adds the height to the metadata of a successful response.
+// Like the checksum, it isn't added to empty responses.
+func withHeight(stub shim.ChaincodeStubInterface, res sc.Response) sc.Response {
+	if res.Status != shim.OK || res.Payload == nil {
+		return res
+	}
+	height, err := getHeight(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if height == 0 {
+		return res
+	}
+	meta := &ResponseMeta{}
+	if res.Message != "" {
+		if err := json.Unmarshal([]byte(res.Message), meta); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	meta.Height = height
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	res.Message = string(metaBytes)
+	return res
+}
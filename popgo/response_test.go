@@ -0,0 +1,69 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_ResponseChecksum(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segment := testutil.Root("main").Build()
+	stub.SaveSegment(t, segment)
+
+	for _, call := range []struct {
+		function string
+		arg      []byte
+	}{
+		{"GetSegment", []byte(segment.GetLinkHashString())},
+		{"FindSegments", []byte(`{"process":"main"}`)},
+		{"GetMapIDs", []byte(`{"process":"main"}`)},
+	} {
+		res := stub.Call(call.function, call.arg)
+		meta := &ResponseMeta{}
+		if err := json.Unmarshal([]byte(res.Message), meta); err != nil {
+			fmt.Println(call.function, "returned invalid metadata", res.Message)
+			t.FailNow()
+		}
+		hash := sha256.Sum256(res.Payload)
+		if meta.Checksum != hex.EncodeToString(hash[:]) {
+			fmt.Println(call.function, "returned a wrong checksum")
+			t.FailNow()
+		}
+	}
+
+	res := stub.Call("GetSegment", []byte(segment.GetLinkHashString()))
+	meta := &ResponseMeta{}
+	json.Unmarshal([]byte(res.Message), meta)
+	stub.SaveSegment(t, testutil.Root("main").Build())
+	res = stub.Call("GetSegment", []byte(segment.GetLinkHashString()))
+	next := &ResponseMeta{}
+	json.Unmarshal([]byte(res.Message), next)
+	if meta.Height == 0 || next.Height <= meta.Height {
+		fmt.Println("Height should grow with writes", meta.Height, next.Height)
+		t.FailNow()
+	}
+
+	if res := stub.Call("GetSegment", []byte("missing")); res.Message != "" {
+		fmt.Println("Empty responses should not have metadata")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Page sizes of RichQuery
+const (
+	DefaultRichQueryPageSize = 25
+	MaxRichQueryPageSize     = 100
+)
+
+// richQueryObjectTypes are the document types RichQuery can return
+var richQueryObjectTypes = []string{
+	ObjectTypeSegment,
+	ObjectTypeMap,
+	ObjectTypeActor,
+	ObjectTypeProcess,
+	ObjectTypeRotation,
+	ObjectTypeAttachment,
+}
+
+// RichQueryResult is a document returned by RichQuery
+type RichQueryResult struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// RichQueryPage is returned by RichQuery. Bookmark is empty on the last
+// page.
+type RichQueryPage struct {
+	Results  []RichQueryResult `json:"results"`
+	Bookmark string            `json:"bookmark"`
+}
+
+// RichQuery runs a CouchDB selector given by an admin, restricted to the
+// documents of the chaincode. Arguments are the selector, the page size and
+// the bookmark returned with the previous page. Fabric 1.0 has no query
+// bookmarks, so the bookmark is the number of documents to skip.
+func (s *SmartContract) RichQuery(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 {
+		return shim.Error("Selector is required")
+	}
+	selector := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(args[0]), &selector); err != nil {
+		return shim.Error("Could not parse selector")
+	}
+	pageSize, skip, err := parsePageArgs(args[1:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	valuePrefix, err := stub.CreateCompositeKey(ObjectTypeValue, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	docType := map[string]interface{}{"docType": map[string]interface{}{"$in": richQueryObjectTypes}}
+	page, err := runPagedQuery(stub, docType, selector, pageSize, skip, func(key string) bool {
+		// Values are arbitrary documents that can have any docType
+		return !strings.HasPrefix(key, valuePrefix)
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	pageBytes, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(pageBytes)
+}
+
+// parsePageArgs parses the optional page size and bookmark arguments of
+// paginated queries
+func parsePageArgs(args []string) (int, int, error) {
+	pageSize := DefaultRichQueryPageSize
+	if len(args) > 0 && args[0] != "" {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 || n > MaxRichQueryPageSize {
+			return 0, 0, errors.New("Page size should be between 1 and " + strconv.Itoa(MaxRichQueryPageSize))
+		}
+		pageSize = n
+	}
+	skip := 0
+	if len(args) > 1 && args[1] != "" {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("Invalid bookmark")
+		}
+		skip = n
+	}
+	return pageSize, skip, nil
+}
+
+// runPagedQuery returns a page of the documents matching both selectors.
+// Documents whose key is rejected by keep are skipped but still count in
+// the page size, so bookmarks stay valid.
+func runPagedQuery(stub shim.ChaincodeStubInterface, scope, selector map[string]interface{}, pageSize, skip int, keep func(string) bool) (*RichQueryPage, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"$and": []interface{}{scope, selector},
+		},
+		"limit": pageSize + 1,
+		"skip":  skip,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	page := &RichQueryPage{Results: []RichQueryResult{}}
+	scanned := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if scanned == pageSize {
+			page.Bookmark = strconv.Itoa(skip + pageSize)
+			break
+		}
+		scanned++
+
+		if keep != nil && !keep(queryResponse.Key) {
+			continue
+		}
+		page.Results = append(page.Results, RichQueryResult{queryResponse.Key, queryResponse.Value})
+	}
+	return page, nil
+}
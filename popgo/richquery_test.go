@@ -0,0 +1,65 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_RichQuery(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.SaveSegment(t, testutil.Chain("main", 5)...)
+	stub.Invoke(t, "SaveValue", []byte("key"), []byte(`{"docType":"segment"}`))
+
+	selector := []byte(`{"docType":"segment","segment.link.meta.process":"main"}`)
+	var keys []string
+	bookmark := ""
+	for i := 0; i < 3; i++ {
+		page := &RichQueryPage{}
+		json.Unmarshal(stub.Invoke(t, "RichQuery", selector, []byte("2"), []byte(bookmark)), page)
+		for _, result := range page.Results {
+			keys = append(keys, result.Key)
+		}
+		if bookmark = page.Bookmark; bookmark == "" {
+			break
+		}
+	}
+	if len(keys) != 5 || bookmark != "" {
+		fmt.Println("RichQuery returned", keys, "bookmark", bookmark)
+		t.FailNow()
+	}
+
+	// Documents of other types are never returned
+	page := &RichQueryPage{}
+	json.Unmarshal(stub.Invoke(t, "RichQuery", []byte(`{"docType":{"$exists":true}}`), []byte("100")), page)
+	if len(page.Results) != 6 {
+		fmt.Println("RichQuery returned", len(page.Results), "documents")
+		t.FailNow()
+	}
+
+	stub.InvokeError(t, "RichQuery", []byte("{"))
+	stub.InvokeError(t, "RichQuery", selector, []byte("1000"))
+	stub.InvokeError(t, "RichQuery", selector, []byte("2"), []byte("x"))
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "RichQuery", selector); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
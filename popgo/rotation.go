@@ -0,0 +1,201 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// ObjectTypeRotation is the composite key object type of rotation documents
+const ObjectTypeRotation = "rotation"
+
+// DefaultRotationPageSize is the number of segments re-encrypted by a
+// ReencryptProcess transaction when no page size is given
+const DefaultRotationPageSize = 100
+
+// RotationDoc records the progress of a key rotation for a process
+type RotationDoc struct {
+	ObjectType  string `json:"docType"`
+	Process     string `json:"process"`
+	OldKeyID    string `json:"oldKeyId"`
+	NewKeyID    string `json:"newKeyId"`
+	Reencrypted int    `json:"reencrypted"`
+	Done        bool   `json:"done"`
+}
+
+func getRotationKey(stub shim.ChaincodeStubInterface, process string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeRotation, []string{process})
+}
+
+// ReencryptProcess re-encrypts a page of the segments of a process that
+// are encrypted with the old key (DECKEY) using the new key (ENCKEY).
+// Re-encrypted segments no longer match the query, so the rotation is
+// resumed by calling ReencryptProcess until the returned document is done.
+func (s *SmartContract) ReencryptProcess(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Process is required")
+	}
+	process := args[0]
+	pageSize := DefaultRotationPageSize
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return shim.Error("Page size should be a positive integer")
+		}
+		pageSize = n
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	rotation, _, err := reencryptProcess(stub, process, pageSize)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rotationBytes, err := json.Marshal(rotation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(rotationBytes)
+}
+
+// reencryptProcess re-encrypts the next page of a process with the
+// transient keys and saves the progress of the rotation. It also returns
+// how many segments were re-encrypted.
+func reencryptProcess(stub shim.ChaincodeStubInterface, process string, pageSize int) (*RotationDoc, int, error) {
+	decrypter, err := getTransientEncrypter(stub, TransientDecryptionKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	encrypter, err := getTransientEncrypter(stub, TransientEncryptionKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	if decrypter == nil || encrypter == nil {
+		return nil, 0, errors.New("Both " + TransientDecryptionKey + " and " + TransientEncryptionKey + " are required")
+	}
+
+	rotation, err := getRotation(stub, process)
+	if err != nil {
+		return nil, 0, err
+	}
+	if rotation == nil || rotation.Done {
+		rotation = &RotationDoc{
+			ObjectType: ObjectTypeRotation,
+			Process:    process,
+		}
+	} else if rotation.OldKeyID != decrypter.keyID() || rotation.NewKeyID != encrypter.keyID() {
+		return nil, 0, errors.New("Another key rotation is in progress for process " + process)
+	}
+	rotation.OldKeyID, rotation.NewKeyID = decrypter.keyID(), encrypter.keyID()
+
+	n, err := reencryptPage(stub, process, decrypter, encrypter, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	rotation.Reencrypted += n
+	rotation.Done = n < pageSize
+
+	if _, err := saveRotation(stub, rotation); err != nil {
+		return nil, 0, err
+	}
+	return rotation, n, nil
+}
+
+// reencryptPage re-encrypts at most pageSize segments and returns how many
+// were re-encrypted
+func reencryptPage(stub shim.ChaincodeStubInterface, process string, decrypter, encrypter *stateEncrypter, pageSize int) (int, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType":                           ObjectTypeSegment,
+			"segment.link.meta.process":         process,
+			"segment.meta.encryptedState.keyId": decrypter.keyID(),
+		},
+		"limit": pageSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	n := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		segmentDoc := &SegmentDoc{}
+		if err := json.Unmarshal(queryResponse.Value, segmentDoc); err != nil {
+			return 0, err
+		}
+		if err := loadSegmentState(stub, segmentDoc); err != nil {
+			return 0, err
+		}
+		if err := reencrypt(&segmentDoc.Segment, decrypter, encrypter); err != nil {
+			return 0, err
+		}
+		if err := putSegmentDoc(stub, *segmentDoc); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func reencrypt(segment *cs.Segment, decrypter, encrypter *stateEncrypter) error {
+	if err := decrypter.decrypt(segment); err != nil {
+		return err
+	}
+	return encrypter.encrypt(segment)
+}
+
+func getRotation(stub shim.ChaincodeStubInterface, process string) (*RotationDoc, error) {
+	key, err := getRotationKey(stub, process)
+	if err != nil {
+		return nil, err
+	}
+	rotationBytes, err := stub.GetState(key)
+	if err != nil || rotationBytes == nil {
+		return nil, err
+	}
+	rotation := &RotationDoc{}
+	if err := json.Unmarshal(rotationBytes, rotation); err != nil {
+		return nil, errors.New("Could not parse rotation document")
+	}
+	return rotation, nil
+}
+
+func saveRotation(stub shim.ChaincodeStubInterface, rotation *RotationDoc) ([]byte, error) {
+	key, err := getRotationKey(stub, rotation.Process)
+	if err != nil {
+		return nil, err
+	}
+	rotationBytes, err := json.Marshal(rotation)
+	if err != nil {
+		return nil, err
+	}
+	return rotationBytes, stub.PutState(key, rotationBytes)
+}
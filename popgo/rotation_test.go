@@ -0,0 +1,94 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_ReencryptProcess(t *testing.T) {
+	stub := newAdminStub(t)
+	segments := testutil.Chain("main", 5)
+	other := testutil.Root("other").Build()
+
+	stub.Transient = map[string][]byte{TransientEncryptionKey: testKey}
+	stub.SaveSegment(t, segments...)
+	stub.SaveSegment(t, other)
+
+	stub.Transient = map[string][]byte{
+		TransientDecryptionKey: testKey,
+		TransientEncryptionKey: testOtherKey,
+	}
+	for i, expected := range []RotationDoc{
+		{Reencrypted: 2, Done: false},
+		{Reencrypted: 4, Done: false},
+		{Reencrypted: 5, Done: true},
+	} {
+		rotation := &RotationDoc{}
+		json.Unmarshal(stub.Invoke(t, "ReencryptProcess", []byte("main"), []byte("2")), rotation)
+		if rotation.Reencrypted != expected.Reencrypted || rotation.Done != expected.Done {
+			fmt.Println("Unexpected progress after page", i, rotation)
+			t.FailNow()
+		}
+	}
+
+	stub.Transient = map[string][]byte{TransientDecryptionKey: testOtherKey}
+	for _, segment := range segments {
+		decrypted := &cs.Segment{}
+		json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(segment.GetLinkHashString())), decrypted)
+		if !reflect.DeepEqual(decrypted.Link, segment.Link) {
+			fmt.Println("Segment was not re-encrypted with the new key")
+			t.FailNow()
+		}
+	}
+	stub.InvokeError(t, "GetSegment", []byte(other.GetLinkHashString()))
+}
+
+func TestPop_ReencryptProcessInProgress(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Transient = map[string][]byte{TransientEncryptionKey: testKey}
+	stub.SaveSegment(t, testutil.Chain("main", 3)...)
+
+	stub.Transient = map[string][]byte{
+		TransientDecryptionKey: testKey,
+		TransientEncryptionKey: testOtherKey,
+	}
+	stub.Invoke(t, "ReencryptProcess", []byte("main"), []byte("1"))
+
+	stub.Transient = map[string][]byte{
+		TransientDecryptionKey: testKey,
+		TransientEncryptionKey: testKey,
+	}
+	stub.InvokeError(t, "ReencryptProcess", []byte("main"), []byte("1"))
+}
+
+func TestPop_ReencryptProcessUnauthorized(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	stub.Transient = map[string][]byte{
+		TransientDecryptionKey: testKey,
+		TransientEncryptionKey: testOtherKey,
+	}
+	if message := stub.InvokeError(t, "ReencryptProcess", []byte("main")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultSearchLimit is the number of results of queries without limit.
+const DefaultSearchLimit = 20
+
+// ElasticsearchConfig contains configuration options for the Elasticsearch
+// index.
+type ElasticsearchConfig struct {
+	// URL of the cluster, ie "http://localhost:9200".
+	URL string `json:"url"`
+
+	// Name of the index.
+	Index string `json:"index"`
+}
+
+// Elasticsearch is an index stored in Elasticsearch or OpenSearch. It only
+// uses the bulk and search REST APIs, which both implement.
+type Elasticsearch struct {
+	config *ElasticsearchConfig
+	client *http.Client
+}
+
+// NewElasticsearch creates an Elasticsearch index.
+func NewElasticsearch(config *ElasticsearchConfig) *Elasticsearch {
+	return &Elasticsearch{config: config, client: &http.Client{}}
+}
+
+func (e *Elasticsearch) url(path string) string {
+	return strings.TrimRight(e.config.URL, "/") + "/" + e.config.Index + path
+}
+
+// Index implements Index.Index.
+func (e *Elasticsearch) Index(ctx context.Context, docs []*Document) error {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	for _, doc := range docs {
+		action := map[string]interface{}{"index": map[string]string{"_id": doc.LinkHash}}
+		if err := encoder.Encode(action); err != nil {
+			return err
+		}
+		if err := encoder.Encode(doc); err != nil {
+			return err
+		}
+	}
+	return e.bulk(ctx, buf)
+}
+
+// Delete implements Index.Delete.
+func (e *Elasticsearch) Delete(ctx context.Context, linkHashes []string) error {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	for _, linkHash := range linkHashes {
+		action := map[string]interface{}{"delete": map[string]string{"_id": linkHash}}
+		if err := encoder.Encode(action); err != nil {
+			return err
+		}
+	}
+	return e.bulk(ctx, buf)
+}
+
+// bulk sends a bulk request. Deleting missing documents isn't an error.
+func (e *Elasticsearch) bulk(ctx context.Context, body io.Reader) error {
+	var res struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := e.do(ctx, "/_bulk", "application/x-ndjson", body, &res); err != nil {
+		return err
+	}
+	if !res.Errors {
+		return nil
+	}
+	for _, item := range res.Items {
+		for action, result := range item {
+			if action == "delete" && result.Status == http.StatusNotFound {
+				continue
+			}
+			if len(result.Error) > 0 {
+				return fmt.Errorf("bulk %s failed: %s", action, result.Error)
+			}
+		}
+	}
+	return nil
+}
+
+// Search implements Index.Search.
+func (e *Elasticsearch) Search(ctx context.Context, query *Query) ([]string, error) {
+	match := map[string]interface{}{"query": query.Text}
+	if query.Fuzzy {
+		match["fuzziness"] = "AUTO"
+	}
+	boolQuery := map[string]interface{}{
+		"must": map[string]interface{}{"match": map[string]interface{}{"text": match}},
+	}
+	if query.Process != "" {
+		boolQuery["filter"] = map[string]interface{}{"term": map[string]string{"process": query.Process}}
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"query":   map[string]interface{}{"bool": boolQuery},
+		"size":    limit,
+		"_source": false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Hits struct {
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := e.do(ctx, "/_search", "application/json", bytes.NewReader(body), &res); err != nil {
+		return nil, err
+	}
+	linkHashes := make([]string, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		linkHashes = append(linkHashes, hit.ID)
+	}
+	return linkHashes, nil
+}
+
+func (e *Elasticsearch) do(ctx context.Context, path, contentType string, body io.Reader, res interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, e.url(path), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// MaxSearchLimit is the maximum number of results of a search.
+const MaxSearchLimit = 100
+
+// Resolver fetches segments from the chaincode.
+type Resolver interface {
+	// Segment returns the JSON encoded segment with a link hash, nil if
+	// it doesn't exist.
+	Segment(ctx context.Context, linkHash string) (json.RawMessage, error)
+}
+
+// Handler serves searches on the /search route of an HTTP server.
+//
+// Query parameters are q, the searched text, and the optional process,
+// fuzzy and limit. The response is a JSON array of the matching segments,
+// as returned by the resolver. Segments that are indexed but no longer on
+// chain are skipped.
+func Handler(index Index, resolver Resolver) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		query := &Query{
+			Text:    params.Get("q"),
+			Process: params.Get("process"),
+			Fuzzy:   params.Get("fuzzy") == "true",
+		}
+		if query.Text == "" {
+			http.Error(w, "q is required", http.StatusBadRequest)
+			return
+		}
+		if limit := params.Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil || n <= 0 || n > MaxSearchLimit {
+				http.Error(w, "limit should be between 1 and "+strconv.Itoa(MaxSearchLimit), http.StatusBadRequest)
+				return
+			}
+			query.Limit = n
+		}
+
+		linkHashes, err := index.Search(r.Context(), query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		segments := []json.RawMessage{}
+		for _, linkHash := range linkHashes {
+			segment, err := resolver.Segment(r.Context(), linkHash)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			if segment != nil {
+				segments = append(segments, segment)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(segments)
+	})
+}
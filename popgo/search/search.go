@@ -0,0 +1,241 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package search mirrors the link state of segments into a full-text index
+// and serves searches resolved back to on-chain segments.
+//
+// An Indexer reads chaincode events from a relay.Source and keeps an Index,
+// typically Elasticsearch or OpenSearch, up to date. The index is only used
+// to find link hashes: Handler fetches the matching segments from the
+// chaincode through a Resolver, so results are always authoritative.
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/piedup/chaincode/popgo/relay"
+)
+
+// Document is the indexed form of a segment.
+type Document struct {
+	LinkHash string `json:"linkHash"`
+	Process  string `json:"process"`
+	MapID    string `json:"mapId"`
+
+	// Text contains the string and number values of the link state.
+	Text string `json:"text"`
+}
+
+// Query is a full-text search.
+type Query struct {
+	Text string
+
+	// Process restricts the search to the segments of a process.
+	Process string
+
+	// Fuzzy matches terms within an edit distance.
+	Fuzzy bool
+
+	Limit int
+}
+
+// Index must be implemented by full-text indexes.
+type Index interface {
+	// Index adds or replaces documents.
+	Index(ctx context.Context, docs []*Document) error
+
+	// Delete removes the documents of segments.
+	Delete(ctx context.Context, linkHashes []string) error
+
+	// Search returns the link hashes of the best matching segments.
+	Search(ctx context.Context, query *Query) ([]string, error)
+}
+
+// Indexer mirrors segments from a source to an index.
+type Indexer struct {
+	source     relay.Source
+	index      Index
+	checkpoint relay.Checkpointer
+	startBlock uint64
+}
+
+// NewIndexer creates an indexer. It starts at startBlock when the
+// checkpoint is empty.
+func NewIndexer(source relay.Source, index Index, checkpoint relay.Checkpointer, startBlock uint64) *Indexer {
+	return &Indexer{
+		source:     source,
+		index:      index,
+		checkpoint: checkpoint,
+		startBlock: startBlock,
+	}
+}
+
+// Start indexes segments until the context is done or the source fails.
+// Documents are keyed by link hash, so indexing a block again after a
+// restart is harmless.
+func (i *Indexer) Start(ctx context.Context) error {
+	from := i.startBlock
+	last, ok, err := i.checkpoint.Load()
+	if err != nil {
+		return err
+	}
+	if ok {
+		from = last + 1
+	}
+
+	blocks, err := i.source.Blocks(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	for block := range blocks {
+		var docs []*Document
+		var deleted []string
+		for _, event := range block.Events {
+			eventDocs, eventDeleted, err := changes(event)
+			if err != nil {
+				return err
+			}
+			docs = append(docs, eventDocs...)
+			deleted = append(deleted, eventDeleted...)
+		}
+		if len(docs) > 0 {
+			if err := i.index.Index(ctx, docs); err != nil {
+				return err
+			}
+		}
+		// Redacted segments are removed so the index doesn't keep the
+		// original values.
+		if len(deleted) > 0 {
+			if err := i.index.Delete(ctx, deleted); err != nil {
+				return err
+			}
+		}
+		if err := i.checkpoint.Save(block.Number); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return i.source.Err()
+}
+
+// changes returns the documents indexed and the link hashes deleted by an
+// event.
+func changes(event *relay.Event) ([]*Document, []string, error) {
+	switch event.Name {
+	case "saveSegment", "mirrorSegment":
+		doc, err := NewDocument(event.Payload)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*Document{doc}, nil, nil
+
+	case "saveSegments":
+		var segments []json.RawMessage
+		if err := json.Unmarshal(event.Payload, &segments); err != nil {
+			return nil, nil, err
+		}
+		docs := make([]*Document, 0, len(segments))
+		for _, segment := range segments {
+			doc, err := NewDocument(segment)
+			if err != nil {
+				return nil, nil, err
+			}
+			docs = append(docs, doc)
+		}
+		return docs, nil, nil
+
+	case "redactSegment":
+		var redaction struct {
+			LinkHash string `json:"linkHash"`
+		}
+		if err := json.Unmarshal(event.Payload, &redaction); err != nil {
+			return nil, nil, err
+		}
+		return nil, []string{redaction.LinkHash}, nil
+	}
+	return nil, nil, nil
+}
+
+// NewDocument creates the document of a JSON encoded segment.
+func NewDocument(segmentJSON []byte) (*Document, error) {
+	var segment struct {
+		Link struct {
+			State json.RawMessage `json:"state"`
+			Meta  struct {
+				Process string `json:"process"`
+				MapID   string `json:"mapId"`
+			} `json:"meta"`
+		} `json:"link"`
+		Meta struct {
+			LinkHash string `json:"linkHash"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(segmentJSON, &segment); err != nil {
+		return nil, err
+	}
+	if segment.Meta.LinkHash == "" {
+		return nil, errors.New("segment has no link hash")
+	}
+
+	var state interface{}
+	if len(segment.Link.State) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(segment.Link.State))
+		decoder.UseNumber()
+		if err := decoder.Decode(&state); err != nil {
+			return nil, err
+		}
+	}
+	var values []string
+	collectText(state, &values)
+
+	return &Document{
+		LinkHash: segment.Meta.LinkHash,
+		Process:  segment.Link.Meta.Process,
+		MapID:    segment.Link.Meta.MapID,
+		Text:     strings.Join(values, " "),
+	}, nil
+}
+
+// collectText appends the string and number values of a JSON value, in
+// key order.
+func collectText(value interface{}, values *[]string) {
+	switch v := value.(type) {
+	case string:
+		*values = append(*values, v)
+	case json.Number:
+		*values = append(*values, v.String())
+	case []interface{}:
+		for _, item := range v {
+			collectText(item, values)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			collectText(v[key], values)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/relay"
+)
+
+type mockSource struct {
+	blocks []*relay.Block
+}
+
+func (s *mockSource) Blocks(ctx context.Context, from uint64) (<-chan *relay.Block, error) {
+	c := make(chan *relay.Block)
+	go func() {
+		defer close(c)
+		for _, b := range s.blocks {
+			if b.Number < from {
+				continue
+			}
+			select {
+			case c <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (s *mockSource) Err() error {
+	return nil
+}
+
+type memoryCheckpoint struct {
+	saved []uint64
+}
+
+func (c *memoryCheckpoint) Load() (uint64, bool, error) {
+	if len(c.saved) == 0 {
+		return 0, false, nil
+	}
+	return c.saved[len(c.saved)-1], true, nil
+}
+
+func (c *memoryCheckpoint) Save(blockNumber uint64) error {
+	c.saved = append(c.saved, blockNumber)
+	return nil
+}
+
+type memoryIndex struct {
+	docs map[string]*Document
+}
+
+func (i *memoryIndex) Index(ctx context.Context, docs []*Document) error {
+	for _, doc := range docs {
+		i.docs[doc.LinkHash] = doc
+	}
+	return nil
+}
+
+func (i *memoryIndex) Delete(ctx context.Context, linkHashes []string) error {
+	for _, linkHash := range linkHashes {
+		delete(i.docs, linkHash)
+	}
+	return nil
+}
+
+func (i *memoryIndex) Search(ctx context.Context, query *Query) ([]string, error) {
+	var linkHashes []string
+	for linkHash, doc := range i.docs {
+		if strings.Contains(doc.Text, query.Text) {
+			linkHashes = append(linkHashes, linkHash)
+		}
+	}
+	return linkHashes, nil
+}
+
+func testSegment(linkHash, text string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"link": {"state": {"b": {"note": %q}, "a": 42}, "meta": {"process": "main", "mapId": "m"}},
+		"meta": {"linkHash": %q}
+	}`, text, linkHash))
+}
+
+func TestNewDocument(t *testing.T) {
+	doc, err := NewDocument(testSegment("a", "damaged box"))
+	if err != nil || doc.Text != "42 damaged box" || doc.Process != "main" || doc.MapID != "m" {
+		fmt.Println("Got document", doc, err)
+		t.FailNow()
+	}
+	if _, err := NewDocument([]byte(`{"link":{}}`)); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestIndexer_Start(t *testing.T) {
+	batch, _ := json.Marshal([]json.RawMessage{testSegment("b", "late"), testSegment("c", "late again")})
+	source := &mockSource{blocks: []*relay.Block{
+		{Number: 1, Events: []*relay.Event{{Name: "saveSegment", Payload: testSegment("a", "damaged")}}},
+		{Number: 2, Events: []*relay.Event{{Name: "saveSegments", Payload: batch}}},
+		{Number: 3, Events: []*relay.Event{{Name: "redactSegment", Payload: []byte(`{"linkHash":"c"}`)}}},
+	}}
+	index := &memoryIndex{docs: map[string]*Document{}}
+	checkpoint := &memoryCheckpoint{}
+
+	if err := NewIndexer(source, index, checkpoint, 0).Start(context.Background()); err != nil {
+		fmt.Println("Start failed", err)
+		t.FailNow()
+	}
+	if len(index.docs) != 2 || index.docs["c"] != nil || len(checkpoint.saved) != 3 {
+		fmt.Println("Got documents", index.docs, "and checkpoints", checkpoint.saved)
+		t.FailNow()
+	}
+}
+
+func TestElasticsearch(t *testing.T) {
+	var bulk, search string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/segments/_bulk":
+			bulk = string(body)
+			w.Write([]byte(`{"errors":true,"items":[{"delete":{"status":404,"error":{"type":"not_found"}}}]}`))
+		case "/segments/_search":
+			search = string(body)
+			w.Write([]byte(`{"hits":{"hits":[{"_id":"a"},{"_id":"b"}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	es := NewElasticsearch(&ElasticsearchConfig{URL: server.URL, Index: "segments"})
+	if err := es.Index(context.Background(), []*Document{{LinkHash: "a", Text: "x"}}); err != nil {
+		fmt.Println("Index failed", err)
+		t.FailNow()
+	}
+	if lines := strings.Split(strings.TrimSpace(bulk), "\n"); len(lines) != 2 || !strings.Contains(lines[0], `"_id":"a"`) {
+		fmt.Println("Got bulk request", bulk)
+		t.FailNow()
+	}
+	if err := es.Delete(context.Background(), []string{"missing"}); err != nil {
+		fmt.Println("Deleting missing documents should succeed", err)
+		t.FailNow()
+	}
+
+	linkHashes, err := es.Search(context.Background(), &Query{Text: "damaged", Process: "main", Fuzzy: true})
+	if err != nil || len(linkHashes) != 2 || linkHashes[0] != "a" {
+		fmt.Println("Got link hashes", linkHashes, err)
+		t.FailNow()
+	}
+	if !strings.Contains(search, `"fuzziness":"AUTO"`) || !strings.Contains(search, `"process":"main"`) {
+		fmt.Println("Got search request", search)
+		t.FailNow()
+	}
+}
+
+type mapResolver map[string]json.RawMessage
+
+func (r mapResolver) Segment(ctx context.Context, linkHash string) (json.RawMessage, error) {
+	return r[linkHash], nil
+}
+
+func TestHandler(t *testing.T) {
+	index := &memoryIndex{docs: map[string]*Document{
+		"a": {LinkHash: "a", Text: "damaged"},
+		"b": {LinkHash: "b", Text: "damaged"},
+	}}
+	resolver := mapResolver{"a": json.RawMessage(`{"meta":{"linkHash":"a"}}`)}
+	server := httptest.NewServer(Handler(index, resolver))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/search?q=damaged")
+	if err != nil {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+	var segments []json.RawMessage
+	json.NewDecoder(resp.Body).Decode(&segments)
+	if len(segments) != 1 {
+		fmt.Println("Segments missing on chain should be skipped, got", len(segments))
+		t.FailNow()
+	}
+
+	for _, query := range []string{"", "?q=x&limit=0", "?q=x&limit=1000"} {
+		resp, err := http.Get(server.URL + "/search" + query)
+		if err != nil || resp.StatusCode != http.StatusBadRequest {
+			fmt.Println("Query", query, "should be rejected")
+			t.FailNow()
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stratumn/sdk/cs"
+)
+
+// segmentRow is a segment document returned by a query. The segment is
+// kept as raw JSON: decoding and encoding it again for every row doubled
+// the cost of large queries, and most segments are returned unchanged.
+type segmentRow struct {
+	ID         string          `json:"id"`
+	Priority   float64         `json:"priority"`
+	Sequence   int             `json:"sequence"`
+	Segment    json.RawMessage `json:"segment"`
+	SplitState bool            `json:"splitState"`
+
+	// label is set when the caller only sees the segment redacted and
+	// denied when it doesn't see it, see classifyRows
+	label  string
+	denied bool
+
+	// rendered is the segment as it is returned, set by render
+	rendered []byte
+}
+
+// embargoMarker is only found in segments that may have an embargo
+var embargoMarker = []byte(`"embargoUntil"`)
+
+// segmentBytes returns the segment of a row as it should be returned to the
+// caller. Segments under embargo, redacted or with evidence documents are
+// decoded to be changed, other segments are spliced as they were stored.
+func (r *segmentRow) segmentBytes(stub shim.ChaincodeStubInterface, now time.Time) ([]byte, error) {
+	segmentBytes := []byte(r.Segment)
+	if r.SplitState {
+		var err error
+		if segmentBytes, err = spliceSegmentState(stub, r.ID, segmentBytes); err != nil {
+			return nil, err
+		}
+	}
+	if !bytes.Contains(r.Segment, embargoMarker) && r.label == "" {
+		evidences, err := getEvidenceDocs(stub, r.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(evidences) == 0 {
+			return segmentBytes, nil
+		}
+	}
+
+	segment := &cs.Segment{}
+	if err := json.Unmarshal(segmentBytes, segment); err != nil {
+		return nil, err
+	}
+	if _, err := applyEmbargo(segment, now); err != nil {
+		return nil, err
+	}
+	if r.label != "" {
+		if err := redactClassified(segment, r.label); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := attachEvidences(stub, segment); err != nil {
+		return nil, err
+	}
+	return json.Marshal(segment)
+}
+
+// segmentRows sorts rows like cs.SegmentSlice, by priority then link hash,
+// using the priority stored in the documents
+type segmentRows []*segmentRow
+
+func (s segmentRows) Len() int {
+	return len(s)
+}
+
+func (s segmentRows) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s segmentRows) Less(i, j int) bool {
+	if s[i].Priority != s[j].Priority {
+		return s[i].Priority > s[j].Priority
+	}
+	return s[i].ID < s[j].ID
+}
+
+// render renders the segments of the rows in order until their JSON array
+// would exceed maxBytes, and returns how many were rendered, denied rows
+// included. The first segment is always rendered so that pagination can go
+// past it.
+func (s segmentRows) render(stub shim.ChaincodeStubInterface, now time.Time, maxBytes int) (int, error) {
+	size := len("[]")
+	first := true
+	for i, row := range s {
+		if row.denied {
+			continue
+		}
+		segmentBytes, err := row.segmentBytes(stub, now)
+		if err != nil {
+			return 0, err
+		}
+		size += len(segmentBytes)
+		if !first {
+			size += len(",")
+		}
+		if !first && size > maxBytes {
+			return i, nil
+		}
+		row.rendered = segmentBytes
+		first = false
+	}
+	return len(s), nil
+}
+
+// marshal returns the JSON array of the rendered segments of the rows,
+// null when there are none like an empty cs.SegmentSlice. Denied rows are
+// left out.
+func (s segmentRows) marshal() []byte {
+	var buffer bytes.Buffer
+	for _, row := range s {
+		if row.denied {
+			continue
+		}
+		if buffer.Len() == 0 {
+			buffer.WriteByte('[')
+		} else {
+			buffer.WriteByte(',')
+		}
+		buffer.Write(row.rendered)
+	}
+	if buffer.Len() == 0 {
+		return []byte("null")
+	}
+	buffer.WriteByte(']')
+	return buffer.Bytes()
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+// segmentDocs returns the stored documents of n segments
+func segmentDocs(n int) [][]byte {
+	docs := make([][]byte, n)
+	for i := range docs {
+		segment := testutil.Root("main").
+			WithLinkMeta("priority", float64(i%7)).
+			WithLinkMeta("tags", []interface{}{"a", "b"}).
+			Build()
+		doc := SegmentDoc{
+			ObjectType: ObjectTypeSegment,
+			ID:         segment.GetLinkHashString(),
+			Segment:    *segment,
+			Priority:   float64(i % 7),
+		}
+		docs[i], _ = json.Marshal(doc)
+	}
+	return docs
+}
+
+// decodeSegmentDocs is how query results were read before segment rows
+func decodeSegmentDocs(stub shim.ChaincodeStubInterface, docs [][]byte) ([]byte, error) {
+	var segments cs.SegmentSlice
+	now := time.Now()
+	for _, docBytes := range docs {
+		segmentDoc := &SegmentDoc{}
+		if err := json.Unmarshal(docBytes, segmentDoc); err != nil {
+			return nil, err
+		}
+		if _, err := applyEmbargo(&segmentDoc.Segment, now); err != nil {
+			return nil, err
+		}
+		if _, err := attachEvidences(stub, &segmentDoc.Segment); err != nil {
+			return nil, err
+		}
+		segments = append(segments, &segmentDoc.Segment)
+	}
+	sort.Sort(segments)
+	return json.Marshal(segments)
+}
+
+func spliceSegmentDocs(stub shim.ChaincodeStubInterface, docs [][]byte) ([]byte, error) {
+	var rows segmentRows
+	for _, docBytes := range docs {
+		row := &segmentRow{}
+		if err := json.Unmarshal(docBytes, row); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	if _, err := rows.render(stub, time.Now(), DefaultMaxResponseBytes<<10); err != nil {
+		return nil, err
+	}
+	sort.Sort(rows)
+	return rows.marshal(), nil
+}
+
+func TestSegmentRows_marshal(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	for _, n := range []int{0, 1, 20} {
+		docs := segmentDocs(n)
+		want, err := decodeSegmentDocs(stub, docs)
+		if err != nil {
+			fmt.Println(err)
+			t.FailNow()
+		}
+		got, err := spliceSegmentDocs(stub, docs)
+		if err != nil {
+			fmt.Println(err)
+			t.FailNow()
+		}
+		if !bytes.Equal(got, want) {
+			fmt.Println("Spliced segments differ from decoded segments", n)
+			t.FailNow()
+		}
+	}
+}
+
+func BenchmarkSegmentRows_decode(b *testing.B) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	docs := segmentDocs(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodeSegmentDocs(stub, docs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSegmentRows_splice(b *testing.B) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	docs := segmentDocs(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := spliceSegmentDocs(stub, docs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
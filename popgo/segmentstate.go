@@ -0,0 +1,155 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ObjectTypeSegmentState is used in CouchDB documents of link states
+const ObjectTypeSegmentState = "segmentstate"
+
+// SegmentStateDoc holds the link state of a segment. Link states are stored
+// apart from segment documents so that rich queries, which only select on
+// the link meta, scan small documents. Segment documents stored before
+// states were split keep their state inline and don't set SplitState.
+type SegmentStateDoc struct {
+	ObjectType string          `json:"docType"`
+	ID         string          `json:"id"`
+	State      json.RawMessage `json:"state"`
+}
+
+// rawSegment is a cs.Segment of which the fields are kept as raw JSON, to
+// put a link state back without decoding the segment
+type rawSegment struct {
+	Link struct {
+		State json.RawMessage `json:"state"`
+		Meta  json.RawMessage `json:"meta"`
+	} `json:"link"`
+	Meta json.RawMessage `json:"meta"`
+}
+
+func getSegmentStateKey(stub shim.ChaincodeStubInterface, linkHash string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeSegmentState, []string{linkHash})
+}
+
+// putSegmentDoc stores the link state of a segment and its document without
+// the state
+func putSegmentDoc(stub shim.ChaincodeStubInterface, segmentDoc SegmentDoc) error {
+	stateBytes, err := json.Marshal(segmentDoc.Segment.Link.State)
+	if err != nil {
+		return err
+	}
+	stateDocBytes, err := json.Marshal(SegmentStateDoc{
+		ObjectType: ObjectTypeSegmentState,
+		ID:         segmentDoc.ID,
+		State:      stateBytes,
+	})
+	if err != nil {
+		return err
+	}
+	key, err := getSegmentStateKey(stub, segmentDoc.ID)
+	if err != nil {
+		return err
+	}
+	if err := stub.PutState(key, stateDocBytes); err != nil {
+		return err
+	}
+
+	segmentDoc.Segment.Link.State = nil
+	segmentDoc.SplitState = true
+	segmentDocBytes, err := json.Marshal(segmentDoc)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(segmentDoc.ID, segmentDocBytes)
+}
+
+// getSegmentStateBytes returns the link state of a segment stored apart
+func getSegmentStateBytes(stub shim.ChaincodeStubInterface, linkHash string) (json.RawMessage, error) {
+	key, err := getSegmentStateKey(stub, linkHash)
+	if err != nil {
+		return nil, err
+	}
+	stateDocBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if stateDocBytes == nil {
+		return nil, errors.New("State of segment " + linkHash + " not found")
+	}
+	stateDoc := &SegmentStateDoc{}
+	if err := json.Unmarshal(stateDocBytes, stateDoc); err != nil {
+		return nil, err
+	}
+	return stateDoc.State, nil
+}
+
+// withSegmentState returns a segment document with its link state
+func withSegmentState(stub shim.ChaincodeStubInterface, segmentDocBytes []byte) ([]byte, error) {
+	segmentDoc := &SegmentDoc{}
+	if err := json.Unmarshal(segmentDocBytes, segmentDoc); err != nil {
+		return nil, err
+	}
+	if !segmentDoc.SplitState {
+		return segmentDocBytes, nil
+	}
+	if err := loadSegmentState(stub, segmentDoc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(segmentDoc)
+}
+
+// loadSegmentState puts the link state of a segment document back in it
+func loadSegmentState(stub shim.ChaincodeStubInterface, segmentDoc *SegmentDoc) error {
+	if !segmentDoc.SplitState {
+		return nil
+	}
+	stateBytes, err := getSegmentStateBytes(stub, segmentDoc.ID)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(stateBytes, &segmentDoc.Segment.Link.State); err != nil {
+		return err
+	}
+	segmentDoc.SplitState = false
+	return nil
+}
+
+// spliceSegmentState puts the link state of a segment back in its JSON
+func spliceSegmentState(stub shim.ChaincodeStubInterface, linkHash string, segmentBytes []byte) ([]byte, error) {
+	stateBytes, err := getSegmentStateBytes(stub, linkHash)
+	if err != nil {
+		return nil, err
+	}
+	segment := &rawSegment{}
+	if err := json.Unmarshal(segmentBytes, segment); err != nil {
+		return nil, err
+	}
+	segment.Link.State = stateBytes
+	return json.Marshal(segment)
+}
+
+// deleteSegmentState deletes the link state of a segment
+func deleteSegmentState(stub shim.ChaincodeStubInterface, linkHash string) error {
+	key, err := getSegmentStateKey(stub, linkHash)
+	if err != nil {
+		return err
+	}
+	return stub.DelState(key)
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_SplitState(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segment := testutil.Root("main").WithState("amount", float64(42)).Build()
+	stub.SaveSegment(t, segment)
+	linkHash := segment.GetLinkHashString()
+
+	segmentDoc := &SegmentDoc{}
+	json.Unmarshal(stub.State[linkHash], segmentDoc)
+	if !segmentDoc.SplitState || segmentDoc.Segment.Link.State != nil {
+		fmt.Println("Segment documents should not have the link state")
+		t.FailNow()
+	}
+	key, _ := getSegmentStateKey(stub, linkHash)
+	if stub.State[key] == nil {
+		fmt.Println("Link state should be stored apart")
+		t.FailNow()
+	}
+
+	got := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(linkHash)), got)
+	if !reflect.DeepEqual(got.Link, segment.Link) {
+		fmt.Println("GetSegment returned", got.Link)
+		t.FailNow()
+	}
+
+	var found cs.SegmentSlice
+	json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"process":"main"}`)), &found)
+	if len(found) != 1 || !reflect.DeepEqual(found[0].Link, segment.Link) {
+		fmt.Println("FindSegments returned", found)
+		t.FailNow()
+	}
+
+	stub.Invoke(t, "DeleteSegment", []byte(linkHash))
+	if stub.State[key] != nil {
+		fmt.Println("Link state should be deleted with the segment")
+		t.FailNow()
+	}
+}
+
+func TestPop_InlineState(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segment := testutil.Root("main").WithState("amount", float64(42)).Build()
+	linkHash := segment.GetLinkHashString()
+	segmentDocBytes, _ := json.Marshal(SegmentDoc{
+		ObjectType: ObjectTypeSegment,
+		ID:         linkHash,
+		Segment:    *segment,
+	})
+	stub.MockTransactionStart("1")
+	stub.PutState(linkHash, segmentDocBytes)
+	stub.MockTransactionEnd("1")
+
+	got := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(linkHash)), got)
+	if !reflect.DeepEqual(got.Link, segment.Link) {
+		fmt.Println("Segments stored with their state should still be readable")
+		t.FailNow()
+	}
+
+	var found cs.SegmentSlice
+	json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"process":"main"}`)), &found)
+	if len(found) != 1 || !reflect.DeepEqual(found[0].Link, segment.Link) {
+		fmt.Println("FindSegments returned", found)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package selector evaluates CouchDB selectors against JSON documents.
+//
+// Supported operators are $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $all,
+// $exists, $and, $or, $nor, $not and $elemMatch.
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Lookup returns the value of a dotted field of a document.
+func Lookup(doc interface{}, field string) (interface{}, bool) {
+	v := doc
+	for _, part := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Match tells whether a document matches a selector.
+func Match(doc interface{}, selector map[string]interface{}) (bool, error) {
+	for field, cond := range selector {
+		var (
+			ok  bool
+			err error
+		)
+		switch field {
+		case "$and", "$or", "$nor":
+			ok, err = matchCombination(doc, field, cond)
+		default:
+			v, exists := Lookup(doc, field)
+			ok, err = matchCondition(v, exists, cond)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchCombination(doc interface{}, op string, cond interface{}) (bool, error) {
+	selectors, ok := cond.([]interface{})
+	if !ok {
+		return false, fmt.Errorf("%s expects an array", op)
+	}
+	matches := 0
+	for _, sel := range selectors {
+		m, ok := sel.(map[string]interface{})
+		if !ok {
+			return false, fmt.Errorf("%s expects an array of selectors", op)
+		}
+		ok, err := Match(doc, m)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matches++
+		}
+	}
+	switch op {
+	case "$and":
+		return matches == len(selectors), nil
+	case "$or":
+		return matches > 0, nil
+	default:
+		return matches == 0, nil
+	}
+}
+
+func matchCondition(v interface{}, exists bool, cond interface{}) (bool, error) {
+	ops, ok := cond.(map[string]interface{})
+	if !ok || !isOperatorObject(ops) {
+		return exists && reflect.DeepEqual(v, cond), nil
+	}
+	for op, arg := range ops {
+		ok, err := matchOperator(v, exists, op, arg)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func isOperatorObject(m map[string]interface{}) bool {
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return len(m) > 0
+}
+
+func matchOperator(v interface{}, exists bool, op string, arg interface{}) (bool, error) {
+	switch op {
+	case "$exists":
+		return exists == (arg == true), nil
+	case "$not":
+		ok, err := matchCondition(v, exists, arg)
+		return !ok, err
+	}
+
+	if !exists {
+		return false, nil
+	}
+
+	switch op {
+	case "$ne":
+		return !reflect.DeepEqual(v, arg), nil
+	case "$nin":
+		values, ok := arg.([]interface{})
+		if !ok {
+			return false, errors.New("$nin expects an array")
+		}
+		return !containsValue(values, v), nil
+	case "$eq":
+		return reflect.DeepEqual(v, arg), nil
+	case "$gt":
+		return sameType(v, arg) && Compare(v, arg) > 0, nil
+	case "$gte":
+		return sameType(v, arg) && Compare(v, arg) >= 0, nil
+	case "$lt":
+		return sameType(v, arg) && Compare(v, arg) < 0, nil
+	case "$lte":
+		return sameType(v, arg) && Compare(v, arg) <= 0, nil
+	case "$in":
+		values, ok := arg.([]interface{})
+		if !ok {
+			return false, errors.New("$in expects an array")
+		}
+		return containsValue(values, v), nil
+	case "$all":
+		values, ok := arg.([]interface{})
+		if !ok {
+			return false, errors.New("$all expects an array")
+		}
+		array, ok := v.([]interface{})
+		if !ok {
+			return false, nil
+		}
+		for _, value := range values {
+			if !containsValue(array, value) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "$elemMatch":
+		array, ok := v.([]interface{})
+		if !ok {
+			return false, nil
+		}
+		for _, elem := range array {
+			var (
+				ok  bool
+				err error
+			)
+			if sel, isSel := arg.(map[string]interface{}); isSel && !isOperatorObject(sel) {
+				ok, err = Match(elem, sel)
+			} else {
+				ok, err = matchCondition(elem, true, arg)
+			}
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unsupported operator %s", op)
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if reflect.DeepEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameType(a, b interface{}) bool {
+	switch a.(type) {
+	case float64:
+		_, ok := b.(float64)
+		return ok
+	case string:
+		_, ok := b.(string)
+		return ok
+	}
+	return false
+}
+
+// Compare orders values like CouchDB collation: null, booleans, numbers,
+// strings, arrays then objects.
+func Compare(a, b interface{}) int {
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch va := a.(type) {
+	case bool:
+		vb := b.(bool)
+		if va == vb {
+			return 0
+		}
+		if !va {
+			return -1
+		}
+		return 1
+	case float64:
+		vb := b.(float64)
+		if va < vb {
+			return -1
+		}
+		if va > vb {
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(va, b.(string))
+	}
+	return 0
+}
+
+func rank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	case []interface{}:
+		return 4
+	}
+	return 5
+}
@@ -0,0 +1,53 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package selector
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	doc := map[string]interface{}{}
+	json.Unmarshal([]byte(`{"docType":"segment","priority":2,"segment":{"link":{"meta":{"mapId":"m","tags":["a","b"]}}}}`), &doc)
+
+	tests := []struct {
+		selector string
+		expected bool
+	}{
+		{`{"docType":"segment"}`, true},
+		{`{"docType":"map"}`, false},
+		{`{"segment.link.meta.mapId":{"$in":["m","n"]}}`, true},
+		{`{"segment.link.meta.mapId":{"$nin":["m"]}}`, false},
+		{`{"segment.link.meta.tags":{"$all":["a"]}}`, true},
+		{`{"priority":{"$gt":1}}`, true},
+		{`{"priority":{"$gt":"1"}}`, false},
+		{`{"pinned":{"$exists":false}}`, true},
+		{`{"$or":[{"docType":"map"},{"priority":2}]}`, true},
+	}
+	for _, test := range tests {
+		sel := map[string]interface{}{}
+		json.Unmarshal([]byte(test.selector), &sel)
+		if ok, err := Match(doc, sel); err != nil || ok != test.expected {
+			fmt.Println("Selector", test.selector, "returned", ok, err)
+			t.FailNow()
+		}
+	}
+	if _, err := Match(doc, map[string]interface{}{"docType": map[string]interface{}{"$regex": "s"}}); err == nil {
+		fmt.Println("Unsupported operators should fail")
+		t.FailNow()
+	}
+}
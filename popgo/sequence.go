@@ -0,0 +1,319 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// MapCounterSequence is the last sequence number assigned in a map. Every
+// new segment gets the next number, stored in its SegmentDoc. The counter
+// is never decremented, so deleted segments leave gaps.
+const MapCounterSequence = "sequence"
+
+// Sort orders accepted by the sortBy field of segment filters
+const (
+	SortByPriority = "priority"
+	SortBySequence = "sequence"
+)
+
+// SegmentFilterOptions are segment filter fields that store.SegmentFilter
+// doesn't have
+type SegmentFilterOptions struct {
+	SortBy string `json:"sortBy"`
+	// MinPriority only keeps segments with at least this priority
+	MinPriority *float64 `json:"minPriority"`
+	// Owner only keeps segments of maps owned by a DID or MSP ID
+	Owner string `json:"owner"`
+	// MaxResponseBytes lowers the response size budget of the
+	// configuration
+	MaxResponseBytes int `json:"maxResponseBytes"`
+	// Annotations and MapAnnotations only keep segments that have, or
+	// whose map has, all the given annotations
+	Annotations    map[string]string `json:"annotations"`
+	MapAnnotations map[string]string `json:"mapAnnotations"`
+	// Disputed only keeps segments with an open dispute when true, and
+	// segments without one when false
+	Disputed *bool `json:"disputed"`
+	// NotAcknowledgedBy only keeps segments an MSP hasn't acknowledged
+	NotAcknowledgedBy string `json:"notAcknowledgedBy"`
+	// Residency only keeps segments of a jurisdiction
+	Residency string `json:"residency"`
+
+	// SchemaVersion only keeps segments declaring a state schema version
+	SchemaVersion string `json:"schemaVersion"`
+}
+
+func parseSegmentFilterOptions(filterBytes []byte) (*SegmentFilterOptions, error) {
+	options := &SegmentFilterOptions{}
+	if err := json.Unmarshal(filterBytes, options); err != nil {
+		return nil, err
+	}
+	if options.MaxResponseBytes < 0 {
+		return nil, errors.New("maxResponseBytes should be positive")
+	}
+	switch options.SortBy {
+	case "", SortByPriority, SortBySequence:
+		return options, nil
+	}
+	return nil, errors.New("Unsupported sort order " + options.SortBy)
+}
+
+// GapReport is returned by DetectGaps
+type GapReport struct {
+	MapID string `json:"mapId"`
+	// Last is the last sequence number assigned in the map
+	Last int `json:"last"`
+	// Missing are the sequence numbers of segments that no longer exist
+	Missing []int `json:"missing"`
+	// OutOfOrder are the link hashes of segments saved before their parent
+	OutOfOrder []string `json:"outOfOrder"`
+	// Unsequenced is the number of segments saved before sequencing
+	Unsequenced int `json:"unsequenced"`
+}
+
+// nextSequence assigns the next sequence number of a map
+func nextSequence(stub shim.ChaincodeStubInterface, mapID string) (int, error) {
+	// Reads don't see the writes of the transaction, so the counter is
+	// read before being incremented
+	sequence, err := getMapCounter(stub, mapID, MapCounterSequence)
+	if err != nil {
+		return 0, err
+	}
+	return sequence + 1, addMapCounter(stub, mapID, MapCounterSequence, 1)
+}
+
+// DetectGaps reports missing and out-of-order segments of a map
+func (s *SmartContract) DetectGaps(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Map ID is required")
+	}
+	if err := checkMapTenant(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	report := GapReport{MapID: args[0], Missing: []int{}, OutOfOrder: []string{}}
+
+	var err error
+	if report.Last, err = getMapCounter(stub, args[0], MapCounterSequence); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	queryBytes, err := json.Marshal(SegmentQuery{
+		Selector: SegmentSelector{
+			ObjectType: ObjectTypeSegment,
+			MapIds:     &MapIdsIn{[]string{args[0]}},
+		},
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	sequences := map[string]int{}
+	parents := map[string]string{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		segmentDoc := &SegmentDoc{}
+		if err := json.Unmarshal(queryResponse.Value, segmentDoc); err != nil {
+			return shim.Error(err.Error())
+		}
+		if segmentDoc.Sequence == 0 {
+			report.Unsequenced++
+			continue
+		}
+		sequences[segmentDoc.ID] = segmentDoc.Sequence
+		parents[segmentDoc.ID] = segmentDoc.Segment.Link.GetPrevLinkHashString()
+	}
+
+	// Cold segments only keep their sequence number outside of the
+	// compressed document
+	coldSequences, err := getColdSequences(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for linkHash, sequence := range coldSequences {
+		if sequence == 0 {
+			report.Unsequenced++
+			continue
+		}
+		sequences[linkHash] = sequence
+	}
+
+	present := map[int]bool{}
+	for linkHash, sequence := range sequences {
+		present[sequence] = true
+		if parent, ok := sequences[parents[linkHash]]; ok && parent > sequence {
+			report.OutOfOrder = append(report.OutOfOrder, linkHash)
+		}
+	}
+	for i := 1; i <= report.Last; i++ {
+		if !present[i] {
+			report.Missing = append(report.Missing, i)
+		}
+	}
+	sort.Strings(report.OutOfOrder)
+
+	reportBytes, err := json.Marshal(report)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(reportBytes)
+}
+
+// MapDelta is returned by GetMapDelta
+type MapDelta struct {
+	MapID string `json:"mapId"`
+	// Since is the sequence number the delta starts after
+	Since int `json:"since"`
+	// Last is the last sequence number assigned in the map
+	Last     int             `json:"last"`
+	Segments []MapDeltaEntry `json:"segments"`
+}
+
+// MapDeltaEntry is a segment of a MapDelta with its sequence number
+type MapDeltaEntry struct {
+	Sequence int         `json:"sequence"`
+	Segment  *cs.Segment `json:"segment"`
+}
+
+// GetMapDelta returns the segments of a map saved after a sequence number,
+// in sequence order. Clients pull the next page from the sequence of the
+// last entry when the response is truncated.
+func (s *SmartContract) GetMapDelta(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 || args[0] == "" {
+		return shim.Error("Map ID and sequence number are required")
+	}
+	if err := checkMapTenant(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	since, err := strconv.Atoi(args[1])
+	if err != nil || since < 0 {
+		return shim.Error("Invalid sequence number " + args[1])
+	}
+	pageSize := 0
+	if len(args) > 2 {
+		if pageSize, err = strconv.Atoi(args[2]); err != nil || pageSize < 0 {
+			return shim.Error("Invalid page size " + args[2])
+		}
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	delta := MapDelta{MapID: args[0], Since: since, Segments: []MapDeltaEntry{}}
+	if delta.Last, err = getMapCounter(stub, args[0], MapCounterSequence); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	tenant, err := getTenantScope(stub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Fetch one more segment than the page size to know if there are more
+	limit := config.pageLimit(pageSize)
+	queryBytes, err := json.Marshal(SegmentQuery{
+		Selector: SegmentSelector{
+			ObjectType: ObjectTypeSegment,
+			MapIds:     &MapIdsIn{[]string{args[0]}},
+			Sequence:   &SequenceGt{since},
+			Tenant:     tenant,
+		},
+		Sort:  []map[string]string{{"sequence": "asc"}},
+		Limit: limit + 1,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	meta, err := checkQueryPlan(config, segmentIndexes, string(queryBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if meta == nil {
+		meta = &ResponseMeta{}
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var rows segmentRows
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		row := &segmentRow{}
+		if err := json.Unmarshal(queryResponse.Value, row); err != nil {
+			return shim.Error(err.Error())
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		meta.Truncated = true
+	}
+
+	// Segments are rendered like the results of FindSegments: labels
+	// redact or leave out segments and embargoes apply
+	if err := classifyRows(stub, config, rows); err != nil {
+		return shim.Error(err.Error())
+	}
+	n, err := rows.render(stub, now, config.responseBudget(0))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if n < len(rows) {
+		rows = rows[:n]
+		meta.Truncated = true
+	}
+	for _, row := range rows {
+		if row.denied {
+			continue
+		}
+		segment := &cs.Segment{}
+		if err := json.Unmarshal(row.rendered, segment); err != nil {
+			return shim.Error(err.Error())
+		}
+		delta.Segments = append(delta.Segments, MapDeltaEntry{row.Sequence, segment})
+	}
+
+	deltaBytes, err := json.Marshal(delta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(deltaBytes, meta)
+}
@@ -0,0 +1,148 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_SegmentSequence(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segments := testutil.Chain("main", 3)
+	stub.SaveSegment(t, segments...)
+	stub.SaveSegment(t, segments[1])
+
+	for i, segment := range segments {
+		segmentDoc := &SegmentDoc{}
+		json.Unmarshal(stub.State[segment.GetLinkHashString()], segmentDoc)
+		if segmentDoc.Sequence != i+1 {
+			fmt.Println("Segment", i, "has sequence", segmentDoc.Sequence)
+			t.FailNow()
+		}
+	}
+
+	var found cs.SegmentSlice
+	filter := []byte(`{"mapIds":["` + segments[0].Link.GetMapID() + `"],"sortBy":"sequence"}`)
+	json.Unmarshal(stub.Invoke(t, "FindSegments", filter), &found)
+	if len(found) != 3 {
+		fmt.Println("FindSegments returned", len(found), "segments")
+		t.FailNow()
+	}
+	for i, segment := range found {
+		if segment.GetLinkHashString() != segments[i].GetLinkHashString() {
+			fmt.Println("Segments not sorted by sequence")
+			t.FailNow()
+		}
+	}
+
+	stub.InvokeError(t, "FindSegments", []byte(`{"sortBy":"unknown"}`))
+}
+
+func TestPop_DetectGaps(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segments := testutil.Chain("main", 4)
+	mapID := []byte(segments[0].Link.GetMapID())
+	stub.SaveSegment(t, segments[0], segments[1], segments[3], segments[2])
+	stub.Invoke(t, "DeleteSegment", []byte(segments[1].GetLinkHashString()))
+
+	report := &GapReport{}
+	json.Unmarshal(stub.Invoke(t, "DetectGaps", mapID), report)
+	expected := &GapReport{
+		MapID:      string(mapID),
+		Last:       4,
+		Missing:    []int{2},
+		OutOfOrder: []string{segments[3].GetLinkHashString()},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		fmt.Println("Got report", report, "expected", expected)
+		t.FailNow()
+	}
+}
+
+func TestPop_GetMapDelta(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	segments := testutil.Chain("main", 4)
+	mapID := []byte(segments[0].Link.GetMapID())
+	stub.SaveSegment(t, segments...)
+
+	delta := &MapDelta{}
+	json.Unmarshal(stub.Invoke(t, "GetMapDelta", mapID, []byte("1")), delta)
+	if delta.Since != 1 || delta.Last != 4 || len(delta.Segments) != 3 {
+		fmt.Println("Got delta", delta)
+		t.FailNow()
+	}
+	for i, entry := range delta.Segments {
+		if entry.Sequence != i+2 || entry.Segment.GetLinkHashString() != segments[i+1].GetLinkHashString() {
+			fmt.Println("Wrong delta entry", i)
+			t.FailNow()
+		}
+	}
+
+	res := stub.Call("GetMapDelta", mapID, []byte("0"), []byte("2"))
+	delta = &MapDelta{}
+	json.Unmarshal(res.Payload, delta)
+	meta := &ResponseMeta{}
+	json.Unmarshal([]byte(res.Message), meta)
+	if len(delta.Segments) != 2 || delta.Segments[1].Sequence != 2 || !meta.Truncated {
+		fmt.Println("Delta should be truncated", res.Message)
+		t.FailNow()
+	}
+
+	delta = &MapDelta{}
+	json.Unmarshal(stub.Invoke(t, "GetMapDelta", mapID, []byte("4")), delta)
+	if len(delta.Segments) != 0 {
+		fmt.Println("Delta should be empty")
+		t.FailNow()
+	}
+
+	stub.InvokeError(t, "GetMapDelta", mapID, []byte("-1"))
+	stub.InvokeError(t, "GetMapDelta", mapID)
+}
+
+func TestPop_FindSegmentsPriority(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	for _, priority := range []float64{0.5, 3, 1, 2} {
+		stub.SaveSegment(t, testutil.Root("main").WithPriority(priority).Build())
+	}
+	stub.SaveSegment(t, testutil.Root("main").Build())
+
+	var found cs.SegmentSlice
+	json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"sortBy":"priority","minPriority":1,"pagination":{"limit":2}}`)), &found)
+	if len(found) != 2 || found[0].Link.GetPriority() != 3 || found[1].Link.GetPriority() != 2 {
+		fmt.Println("Segments not sorted by descending priority", len(found))
+		t.FailNow()
+	}
+
+	found = nil
+	json.Unmarshal(stub.Invoke(t, "FindSegments", []byte(`{"minPriority":1}`)), &found)
+	if len(found) != 3 {
+		fmt.Println("FindSegments returned", len(found), "segments with priority over 1")
+		t.FailNow()
+	}
+
+	res := stub.Call("FindSegments", []byte(`{"sortBy":"priority"}`))
+	meta := &ResponseMeta{}
+	json.Unmarshal([]byte(res.Message), meta)
+	if len(meta.Warnings) != 0 {
+		fmt.Println("Priority sort should be indexed", meta.Warnings)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stratumn/sdk/cs"
+)
+
+// SignatureTypeECDSA is an ECDSA signature of the SHA-256 of the canonical
+// link. Public keys are base64 encoded PKIX keys and signatures base64
+// encoded ASN.1 signatures.
+const SignatureTypeECDSA = "ecdsa-sha256"
+
+// ErrInvalidSignature is returned when a signature doesn't verify
+var ErrInvalidSignature = errors.New("Invalid signature")
+
+// Actor is the end user a gateway submitted a segment for. It is stored in
+// segment.meta.actor with the signature so anyone can check it later.
+type Actor struct {
+	Type      string `json:"type"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+	DID       string `json:"did,omitempty"`
+}
+
+// canonicalLink returns the bytes users sign: the JSON encoded link, with
+// map keys sorted like for link hashes
+func canonicalLink(link *cs.Link) ([]byte, error) {
+	return json.Marshal(link)
+}
+
+// verifyLinkSignature checks a signature of the canonical link
+func verifyLinkSignature(link *cs.Link, sigType, publicKey, signature string) error {
+	if sigType != SignatureTypeECDSA {
+		return errors.New("Unsupported signature type " + sigType)
+	}
+	ecdsaKey, err := parsePublicKey(publicKey)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	sigBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	sig := struct{ R, S *big.Int }{}
+	if _, err := asn1.Unmarshal(sigBytes, &sig); err != nil {
+		return ErrInvalidSignature
+	}
+	linkBytes, err := canonicalLink(link)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(linkBytes)
+	if !ecdsa.Verify(ecdsaKey, hash[:], sig.R, sig.S) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// parsePublicKey decodes a base64 encoded PKIX ECDSA public key
+func parsePublicKey(publicKey string) (*ecdsa.PublicKey, error) {
+	keyBytes, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, errors.New("Public key should be base64 encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Public key should be an ECDSA key")
+	}
+	return ecdsaKey, nil
+}
+
+// parseActor reads the detached signature given to SaveSegment by a
+// gateway and verifies it
+func parseActor(stub shim.ChaincodeStubInterface, link *cs.Link, actorJSON string) (*Actor, error) {
+	if err := requireGateway(stub); err != nil {
+		return nil, err
+	}
+	actor := &Actor{}
+	if err := json.Unmarshal([]byte(actorJSON), actor); err != nil {
+		return nil, errors.New("Could not parse actor")
+	}
+	if err := verifyLinkSignature(link, actor.Type, actor.PublicKey, actor.Signature); err != nil {
+		return nil, err
+	}
+	if actor.DID != "" {
+		if err := checkActorKey(stub, actor.DID, actor.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+	return actor, nil
+}
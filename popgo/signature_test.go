@@ -0,0 +1,86 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func newGatewayStub(t *testing.T) *testutil.Stub {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	config := []byte(`{"admins":["AdminMSP"],"gateways":["GatewayMSP"]}`)
+	if res := stub.MockInit("init", [][]byte{[]byte("init"), config}); res.Status != shim.OK {
+		fmt.Println("Init failed", res.Message)
+		t.FailNow()
+	}
+	stub.Creator = testutil.NewIdentity("GatewayMSP", "gateway")
+	return stub
+}
+
+func newActor(signer *testutil.Signer, segment *cs.Segment, did string) []byte {
+	sig := signer.Sign(&segment.Link)
+	actorBytes, _ := json.Marshal(Actor{
+		Type:      sig.Type,
+		PublicKey: sig.PublicKey,
+		Signature: sig.Signature,
+		DID:       did,
+	})
+	return actorBytes
+}
+
+func TestPop_SaveSegmentDelegated(t *testing.T) {
+	stub := newGatewayStub(t)
+	signer := testutil.NewSigner()
+	segment := testutil.Root("main").WithState("bid", 100.0).Build()
+
+	stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+	stub.Invoke(t, "RegisterActor", []byte("did:example:alice"), []byte(signer.PublicKey()))
+	stub.Creator = testutil.NewIdentity("GatewayMSP", "gateway")
+	stub.Invoke(t, "SaveSegment", mustMarshal(segment), newActor(signer, segment, "did:example:alice"))
+
+	stored := &cs.Segment{}
+	json.Unmarshal(stub.Invoke(t, "GetSegment", []byte(segment.GetLinkHashString())), stored)
+	actor, _ := stored.Meta["actor"].(map[string]interface{})
+	if actor["publicKey"] != signer.PublicKey() || actor["did"] != "did:example:alice" {
+		fmt.Println("Actor not recorded", stored.Meta)
+		t.FailNow()
+	}
+}
+
+func TestPop_SaveSegmentDelegatedInvalid(t *testing.T) {
+	stub := newGatewayStub(t)
+	signer := testutil.NewSigner()
+	segment := testutil.Root("main").Build()
+	other := testutil.Root("main").Build()
+
+	if message := stub.InvokeError(t, "SaveSegment", mustMarshal(segment), newActor(signer, other, "")); message != ErrInvalidSignature.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrInvalidSignature.Error())
+		t.FailNow()
+	}
+	stub.InvokeError(t, "SaveSegment", mustMarshal(segment), []byte(`{"type":"rsa"}`))
+	stub.InvokeError(t, "SaveSegment", mustMarshal(segment), []byte("{"))
+
+	stub.Creator = testutil.NewIdentity("Org1MSP", "user")
+	if message := stub.InvokeError(t, "SaveSegment", mustMarshal(segment), newActor(signer, segment, "")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var postgresTypes = map[string]string{
+	"":            "TEXT",
+	ColumnText:    "TEXT",
+	ColumnNumeric: "NUMERIC",
+	ColumnBoolean: "BOOLEAN",
+	ColumnJSON:    "JSONB",
+}
+
+// PostgresStore upserts rows in a PostgreSQL table. The checkpoint is
+// stored in a table named after the schema table with a _checkpoint
+// suffix.
+//
+// The store uses database/sql, the application registers the driver, ie
+// github.com/lib/pq.
+type PostgresStore struct {
+	db     *sql.DB
+	schema *Schema
+}
+
+// NewPostgresStore creates a store and the tables it needs.
+func NewPostgresStore(ctx context.Context, db *sql.DB, schema *Schema) (*PostgresStore, error) {
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+	s := &PostgresStore{db: db, schema: schema}
+	for _, statement := range s.createStatements() {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *PostgresStore) checkpointTable() string {
+	return s.schema.Table + "_checkpoint"
+}
+
+func (s *PostgresStore) createStatements() []string {
+	columns := []string{KeyColumn + " TEXT PRIMARY KEY"}
+	for _, column := range s.schema.Columns {
+		columns = append(columns, column.Name+" "+postgresTypes[column.Type])
+	}
+	return []string{
+		"CREATE TABLE IF NOT EXISTS " + s.schema.Table + " (" + strings.Join(columns, ", ") + ")",
+		"CREATE TABLE IF NOT EXISTS " + s.checkpointTable() + " (id INTEGER PRIMARY KEY, block_number BIGINT NOT NULL)",
+	}
+}
+
+// Checkpoint implements Store.Checkpoint.
+func (s *PostgresStore) Checkpoint(ctx context.Context) (uint64, bool, error) {
+	var blockNumber int64
+	err := s.db.QueryRowContext(ctx, "SELECT block_number FROM "+s.checkpointTable()+" WHERE id = 1").Scan(&blockNumber)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint64(blockNumber), true, nil
+}
+
+// Apply implements Store.Apply.
+func (s *PostgresStore) Apply(ctx context.Context, blockNumber uint64, rows []*Row) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the checkpoint row serializes concurrent syncers.
+	var last int64
+	err = tx.QueryRowContext(ctx, "SELECT block_number FROM "+s.checkpointTable()+" WHERE id = 1 FOR UPDATE").Scan(&last)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case uint64(last) >= blockNumber:
+		return nil
+	}
+
+	for _, row := range rows {
+		statement, args := s.upsertStatement(row)
+		if _, err := tx.ExecContext(ctx, statement, args...); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO "+s.checkpointTable()+" (id, block_number) VALUES (1, $1) ON CONFLICT (id) DO UPDATE SET block_number = EXCLUDED.block_number",
+		int64(blockNumber))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// upsertStatement returns the statement inserting or updating the columns
+// of a row.
+func (s *PostgresStore) upsertStatement(row *Row) (string, []interface{}) {
+	names := []string{KeyColumn}
+	placeholders := []string{"$1"}
+	var updates []string
+	args := []interface{}{row.LinkHash}
+	for _, column := range s.schema.Columns {
+		value, ok := row.Values[column.Name]
+		if !ok {
+			continue
+		}
+		args = append(args, postgresValue(value))
+		names = append(names, column.Name)
+		placeholders = append(placeholders, "$"+strconv.Itoa(len(args)))
+		updates = append(updates, column.Name+" = EXCLUDED."+column.Name)
+	}
+	statement := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) ",
+		s.schema.Table, strings.Join(names, ", "), strings.Join(placeholders, ", "), KeyColumn)
+	if len(updates) == 0 {
+		return statement + "DO NOTHING", args
+	}
+	return statement + "DO UPDATE SET " + strings.Join(updates, ", "), args
+}
+
+// postgresValue converts a flattened value to a parameter PostgreSQL casts
+// to the type of the column.
+func postgresValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return value
+}
+
+// Close implements Store.Close.
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
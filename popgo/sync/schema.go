@@ -0,0 +1,151 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// KeyColumn is the column holding the link hash of segments. It is the
+// primary key of the table.
+const KeyColumn = "link_hash"
+
+// Types of columns.
+const (
+	ColumnText    = "text"
+	ColumnNumeric = "numeric"
+	ColumnBoolean = "boolean"
+	ColumnJSON    = "json"
+)
+
+var identifierPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Column maps a value of segments to a column.
+type Column struct {
+	// Name of the column.
+	Name string `json:"name"`
+
+	// Dotted path of the value in the segment, ie "link.state.amount".
+	Path string `json:"path"`
+
+	// Type of the column, text by default. Objects and arrays should be
+	// stored in json columns.
+	Type string `json:"type,omitempty"`
+}
+
+// Schema describes the table segments are flattened into.
+type Schema struct {
+	Table   string    `json:"table"`
+	Columns []*Column `json:"columns"`
+}
+
+// Validate checks the names of the table and columns can be used as SQL
+// identifiers.
+func (s *Schema) Validate() error {
+	if !identifierPattern.MatchString(s.Table) {
+		return fmt.Errorf("invalid table name %q", s.Table)
+	}
+	if len(s.Columns) == 0 {
+		return errors.New("a schema needs at least one column")
+	}
+	names := map[string]bool{KeyColumn: true}
+	for _, column := range s.Columns {
+		if !identifierPattern.MatchString(column.Name) {
+			return fmt.Errorf("invalid column name %q", column.Name)
+		}
+		if names[strings.ToLower(column.Name)] {
+			return fmt.Errorf("duplicate column %q", column.Name)
+		}
+		names[strings.ToLower(column.Name)] = true
+		if column.Path == "" {
+			return fmt.Errorf("column %q has no path", column.Name)
+		}
+		switch column.Type {
+		case "", ColumnText, ColumnNumeric, ColumnBoolean, ColumnJSON:
+		default:
+			return fmt.Errorf("column %q has unknown type %q", column.Name, column.Type)
+		}
+	}
+	return nil
+}
+
+// Row contains the values of the columns of a segment. Columns missing
+// from Values are left unchanged by upserts, nil values are set to NULL.
+type Row struct {
+	LinkHash string
+	Values   map[string]interface{}
+}
+
+// Flatten returns the row of a JSON encoded segment. Values are strings,
+// json.Number or bool, objects and arrays are JSON encoded.
+func (s *Schema) Flatten(segmentJSON []byte) (*Row, error) {
+	var segment map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(segmentJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&segment); err != nil {
+		return nil, err
+	}
+
+	linkHash, _ := lookup(segment, "meta.linkHash").(string)
+	if linkHash == "" {
+		return nil, errors.New("segment has no link hash")
+	}
+	row := &Row{LinkHash: linkHash, Values: map[string]interface{}{}}
+	for _, column := range s.Columns {
+		value := lookup(segment, column.Path)
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			valueJSON, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			value = string(valueJSON)
+		}
+		row.Values[column.Name] = value
+	}
+	return row, nil
+}
+
+// Redact returns the row clearing the columns of redacted state fields.
+// Fields are dotted paths in the link state.
+func (s *Schema) Redact(linkHash string, fields []string) *Row {
+	row := &Row{LinkHash: linkHash, Values: map[string]interface{}{}}
+	for _, column := range s.Columns {
+		for _, field := range fields {
+			path := "link.state." + field
+			if column.Path == path || strings.HasPrefix(column.Path, path+".") || strings.HasPrefix(path, column.Path+".") {
+				row.Values[column.Name] = nil
+			}
+		}
+	}
+	return row
+}
+
+// lookup returns the value at a dotted path, nil if it doesn't exist.
+func lookup(value interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sync copies the segments saved by the pop chaincode to a data
+// warehouse, for analytical queries the peers can't serve.
+//
+// Chaincode events are read block by block from a relay.Source and
+// flattened into rows of a table described by a Schema. A Store applies the
+// rows of a block and records the block number in the same transaction, so
+// a restarted syncer resumes after the last applied block and no block is
+// applied twice.
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/piedup/chaincode/popgo/relay"
+)
+
+// Store must be implemented by warehouses.
+type Store interface {
+	// Checkpoint returns the number of the last applied block. The boolean
+	// is false if no block was applied yet.
+	Checkpoint(ctx context.Context) (uint64, bool, error)
+
+	// Apply upserts the rows of a block and records its number atomically.
+	// Blocks at or below the checkpoint must be ignored.
+	Apply(ctx context.Context, blockNumber uint64, rows []*Row) error
+
+	// Close releases the resources used by the store.
+	Close() error
+}
+
+// Config contains configuration options for the syncer.
+type Config struct {
+	// The block to start from when the store has no checkpoint.
+	StartBlock uint64
+}
+
+// ErrNoSchema is returned when a syncer is created without schema.
+var ErrNoSchema = errors.New("a schema is required")
+
+// Syncer copies segments from a source to a store.
+type Syncer struct {
+	config *Config
+	source relay.Source
+	store  Store
+	schema *Schema
+}
+
+// New creates a syncer.
+func New(config *Config, source relay.Source, store Store, schema *Schema) (*Syncer, error) {
+	if schema == nil {
+		return nil, ErrNoSchema
+	}
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+	return &Syncer{
+		config: config,
+		source: source,
+		store:  store,
+		schema: schema,
+	}, nil
+}
+
+// Start copies segments until the context is done or the source fails.
+func (s *Syncer) Start(ctx context.Context) error {
+	from := s.config.StartBlock
+	last, ok, err := s.store.Checkpoint(ctx)
+	if err != nil {
+		return err
+	}
+	if ok {
+		from = last + 1
+	}
+
+	blocks, err := s.source.Blocks(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	for block := range blocks {
+		var rows []*Row
+		for _, event := range block.Events {
+			eventRows, err := s.rows(event)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, eventRows...)
+		}
+		if err := s.store.Apply(ctx, block.Number, rows); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.source.Err()
+}
+
+// rows returns the rows changed by an event. Events that don't change
+// segments have no rows.
+func (s *Syncer) rows(event *relay.Event) ([]*Row, error) {
+	switch event.Name {
+	case "saveSegment", "mirrorSegment":
+		row, err := s.schema.Flatten(event.Payload)
+		if err != nil {
+			return nil, err
+		}
+		return []*Row{row}, nil
+
+	case "saveSegments":
+		var segments []json.RawMessage
+		if err := json.Unmarshal(event.Payload, &segments); err != nil {
+			return nil, err
+		}
+		rows := make([]*Row, 0, len(segments))
+		for _, segment := range segments {
+			row, err := s.schema.Flatten(segment)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+
+	case "redactSegment":
+		var redaction struct {
+			LinkHash string   `json:"linkHash"`
+			Fields   []string `json:"fields"`
+		}
+		if err := json.Unmarshal(event.Payload, &redaction); err != nil {
+			return nil, err
+		}
+		return []*Row{s.schema.Redact(redaction.LinkHash, redaction.Fields)}, nil
+	}
+	return nil, nil
+}
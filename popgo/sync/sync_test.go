@@ -0,0 +1,180 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/relay"
+)
+
+type mockSource struct {
+	blocks []*relay.Block
+	from   uint64
+}
+
+func (s *mockSource) Blocks(ctx context.Context, from uint64) (<-chan *relay.Block, error) {
+	s.from = from
+	c := make(chan *relay.Block)
+	go func() {
+		defer close(c)
+		for _, b := range s.blocks {
+			if b.Number < from {
+				continue
+			}
+			select {
+			case c <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (s *mockSource) Err() error {
+	return nil
+}
+
+type memoryStore struct {
+	rows       map[string]map[string]interface{}
+	checkpoint uint64
+	applied    int
+}
+
+func (s *memoryStore) Checkpoint(ctx context.Context) (uint64, bool, error) {
+	return s.checkpoint, s.applied > 0, nil
+}
+
+func (s *memoryStore) Apply(ctx context.Context, blockNumber uint64, rows []*Row) error {
+	if s.applied > 0 && blockNumber <= s.checkpoint {
+		return nil
+	}
+	for _, row := range rows {
+		if s.rows[row.LinkHash] == nil {
+			s.rows[row.LinkHash] = map[string]interface{}{}
+		}
+		for name, value := range row.Values {
+			s.rows[row.LinkHash][name] = value
+		}
+	}
+	s.checkpoint = blockNumber
+	s.applied++
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+var testSchema = &Schema{
+	Table: "segments",
+	Columns: []*Column{
+		{Name: "process", Path: "link.meta.process"},
+		{Name: "amount", Path: "link.state.amount", Type: ColumnNumeric},
+		{Name: "buyer", Path: "link.state.buyer.name"},
+		{Name: "tags", Path: "link.meta.tags", Type: ColumnJSON},
+	},
+}
+
+func testSegment(linkHash string, amount int) json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`{
+		"link": {"state": {"amount": %d, "buyer": {"name": "alice"}}, "meta": {"process": "main", "tags": ["a"]}},
+		"meta": {"linkHash": "%s"}
+	}`, amount, linkHash))
+}
+
+func testBlocks() []*relay.Block {
+	batch, _ := json.Marshal([]json.RawMessage{testSegment("b", 2), testSegment("c", 3)})
+	return []*relay.Block{
+		{Number: 1, Events: []*relay.Event{{Name: "saveSegment", Payload: testSegment("a", 1)}}},
+		{Number: 2, Events: []*relay.Event{{Name: "saveSegments", Payload: batch}, {Name: "openDispute", Payload: []byte("{}")}}},
+		{Number: 3, Events: []*relay.Event{{Name: "redactSegment", Payload: []byte(`{"linkHash":"a","fields":["buyer"]}`)}}},
+	}
+}
+
+func TestSyncer_Start(t *testing.T) {
+	store := &memoryStore{rows: map[string]map[string]interface{}{}}
+	s, err := New(&Config{}, &mockSource{blocks: testBlocks()}, store, testSchema)
+	if err != nil {
+		t.FailNow()
+	}
+	if err := s.Start(context.Background()); err != nil {
+		fmt.Println("Start failed", err)
+		t.FailNow()
+	}
+
+	if len(store.rows) != 3 || store.checkpoint != 3 {
+		fmt.Println("Got rows", store.rows, "and checkpoint", store.checkpoint)
+		t.FailNow()
+	}
+	a, c := store.rows["a"], store.rows["c"]
+	if a["buyer"] != nil || a["amount"] != json.Number("1") || a["tags"] != `["a"]` {
+		fmt.Println("Got row", a)
+		t.FailNow()
+	}
+	if c["buyer"] != "alice" || c["process"] != "main" {
+		fmt.Println("Got row", c)
+		t.FailNow()
+	}
+}
+
+func TestSyncer_Resume(t *testing.T) {
+	store := &memoryStore{rows: map[string]map[string]interface{}{}, checkpoint: 2, applied: 1}
+	source := &mockSource{blocks: testBlocks()}
+	s, _ := New(&Config{}, source, store, testSchema)
+	if err := s.Start(context.Background()); err != nil {
+		t.FailNow()
+	}
+	if source.from != 3 {
+		fmt.Println("Syncer should resume after checkpoint, started at", source.from)
+		t.FailNow()
+	}
+}
+
+func TestSchema_Validate(t *testing.T) {
+	for _, schema := range []*Schema{
+		{Table: "segments; DROP TABLE x", Columns: testSchema.Columns},
+		{Table: "segments"},
+		{Table: "segments", Columns: []*Column{{Name: "link_hash", Path: "meta.linkHash"}}},
+		{Table: "segments", Columns: []*Column{{Name: "a", Path: "x"}, {Name: "A", Path: "y"}}},
+		{Table: "segments", Columns: []*Column{{Name: "a"}}},
+		{Table: "segments", Columns: []*Column{{Name: "a", Path: "x", Type: "blob"}}},
+	} {
+		if err := schema.Validate(); err == nil {
+			fmt.Println("Schema should be invalid", schema)
+			t.FailNow()
+		}
+	}
+	if _, err := New(&Config{}, &mockSource{}, &memoryStore{}, nil); err != ErrNoSchema {
+		t.FailNow()
+	}
+}
+
+func TestPostgresStore_upsertStatement(t *testing.T) {
+	s := &PostgresStore{schema: testSchema}
+	statement, args := s.upsertStatement(&Row{LinkHash: "a", Values: map[string]interface{}{
+		"amount": json.Number("1"),
+		"buyer":  nil,
+	}})
+	expected := "INSERT INTO segments (link_hash, amount, buyer) VALUES ($1, $2, $3) ON CONFLICT (link_hash) DO UPDATE SET amount = EXCLUDED.amount, buyer = EXCLUDED.buyer"
+	if statement != expected || len(args) != 3 || args[1] != "1" || args[2] != nil {
+		fmt.Println("Got statement", statement, args)
+		t.FailNow()
+	}
+}
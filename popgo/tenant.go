@@ -0,0 +1,181 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Segments and maps are stored with the MSP ID of their submitter as
+// tenant. When the multiTenant option is set, FindSegments and GetMapIDs
+// only return the documents of the tenant of the caller, so several
+// organizations can share a channel. Identities with the cross tenant read
+// attribute see every tenant.
+//
+// Functions reading a single segment, map or process refuse documents of
+// other tenants, and segments can only be appended to the maps of their
+// tenant. Process counters, ie tag facets and activity series, can only
+// be read by the tenant of the process. Admins can give a process to a tenant with the tenant field of
+// its template, processes without tenant are shared.
+
+// AttributeCrossTenantRead is the certificate attribute that lifts tenant
+// scoping when set to "true"
+const AttributeCrossTenantRead = "pop.crossTenantRead"
+
+// segmentTenant returns the MSP ID of the submitter of a segment
+func segmentTenant(segment *cs.Segment) string {
+	switch submitter := segment.Meta["submitter"].(type) {
+	case *Submitter:
+		return submitter.MSPID
+	case map[string]interface{}:
+		mspID, _ := submitter["mspId"].(string)
+		return mspID
+	}
+	return ""
+}
+
+// getTenantScope returns the tenant queries of the caller are restricted
+// to, an empty string if they aren't
+func getTenantScope(stub shim.ChaincodeStubInterface, config *Config) (string, error) {
+	if !config.MultiTenant {
+		return "", nil
+	}
+	attrs, err := getCreatorAttributes(stub)
+	if err != nil {
+		return "", err
+	}
+	if attrs[AttributeCrossTenantRead] == "true" {
+		return "", nil
+	}
+	mspID, err := getCreatorMSPID(stub)
+	if err != nil {
+		return "", err
+	}
+	if mspID == "" {
+		return "", ErrUnauthorized
+	}
+	return mspID, nil
+}
+
+// checkTenant checks the caller can read the documents of a tenant.
+// Documents without tenant were saved before multi-tenancy and are shared.
+func checkTenant(stub shim.ChaincodeStubInterface, config *Config, tenant string) error {
+	if tenant == "" {
+		return nil
+	}
+	scope, err := getTenantScope(stub, config)
+	if err != nil {
+		return err
+	}
+	if scope != "" && scope != tenant {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// checkSegmentTenant checks the caller can read a segment, hot or cold
+func checkSegmentTenant(stub shim.ChaincodeStubInterface, linkHash string) error {
+	config, err := getConfig(stub)
+	if err != nil || !config.MultiTenant {
+		return err
+	}
+	segmentDocBytes, _, err := getSegmentDocBytes(stub, linkHash)
+	if err != nil || segmentDocBytes == nil {
+		return err
+	}
+	segmentDoc := struct {
+		Tenant string `json:"tenant"`
+	}{}
+	if err := json.Unmarshal(segmentDocBytes, &segmentDoc); err != nil {
+		return err
+	}
+	return checkTenant(stub, config, segmentDoc.Tenant)
+}
+
+// checkMapTenant checks the caller can read a map
+func checkMapTenant(stub shim.ChaincodeStubInterface, mapID string) error {
+	config, err := getConfig(stub)
+	if err != nil || !config.MultiTenant {
+		return err
+	}
+	mapDoc, err := getMap(stub, mapID)
+	if err != nil || mapDoc == nil {
+		return err
+	}
+	return checkTenant(stub, config, mapDoc.Tenant)
+}
+
+// checkProcessTenant checks the caller can read a process
+func checkProcessTenant(stub shim.ChaincodeStubInterface, name string) error {
+	config, err := getConfig(stub)
+	if err != nil || !config.MultiTenant {
+		return err
+	}
+	process, err := getProcess(stub, name)
+	if err != nil || process == nil {
+		return err
+	}
+	return checkTenant(stub, config, process.Tenant)
+}
+
+// checkAggregateTenant checks the caller can read the counters of a
+// process. The counters of a process without tenant mix the segments of
+// every tenant, so only callers whose queries aren't scoped can read them.
+func checkAggregateTenant(stub shim.ChaincodeStubInterface, name string) error {
+	config, err := getConfig(stub)
+	if err != nil || !config.MultiTenant {
+		return err
+	}
+	scope, err := getTenantScope(stub, config)
+	if err != nil || scope == "" {
+		return err
+	}
+	process, err := getProcess(stub, name)
+	if err != nil {
+		return err
+	}
+	if process == nil || process.Tenant != scope {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// checkWriteTenant checks a segment is saved in a map and a process of the
+// tenant of its submitter. The cross tenant read attribute doesn't apply.
+func checkWriteTenant(stub shim.ChaincodeStubInterface, segment *cs.Segment) error {
+	config, err := getConfig(stub)
+	if err != nil || !config.MultiTenant {
+		return err
+	}
+	tenant := segmentTenant(segment)
+	mapDoc, err := getMap(stub, segment.Link.GetMapID())
+	if err != nil {
+		return err
+	}
+	if mapDoc != nil && mapDoc.Tenant != "" && mapDoc.Tenant != tenant {
+		return ErrUnauthorized
+	}
+	process, err := getProcess(stub, segment.Link.GetProcess())
+	if err != nil {
+		return err
+	}
+	if process != nil && process.Tenant != "" && process.Tenant != tenant {
+		return ErrUnauthorized
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/piedup/chaincode/popgo/testutil"
+	"github.com/stratumn/sdk/cs"
+)
+
+func TestPop_MultiTenant(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	if res := stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"multiTenant":true}`)}); res.Status != shim.OK {
+		fmt.Println("Init failed", res.Message)
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("Org1MSP", "alice")
+	stub.SaveSegment(t, testutil.Chain("main", 2)...)
+	stub.Creator = testutil.NewIdentity("Org2MSP", "bob")
+	stub.SaveSegment(t, testutil.Chain("main", 1)...)
+
+	count := func(function string) int {
+		var results []interface{}
+		payload := stub.Invoke(t, function, []byte(`{"process":"main"}`))
+		if function == "GetMapIDs" {
+			page := &Page{}
+			json.Unmarshal(payload, page)
+			payload = page.Data
+		}
+		json.Unmarshal(payload, &results)
+		return len(results)
+	}
+	tests := []struct {
+		creator  []byte
+		segments int
+		maps     int
+	}{
+		{testutil.NewIdentity("Org1MSP", "alice"), 2, 1},
+		{testutil.NewIdentity("Org2MSP", "bob"), 1, 1},
+		{testutil.NewIdentityWithAttributes("Org3MSP", "auditor", map[string]string{AttributeCrossTenantRead: "true"}), 3, 2},
+	}
+	for _, test := range tests {
+		stub.Creator = test.creator
+		if segments, maps := count("FindSegments"), count("GetMapIDs"); segments != test.segments || maps != test.maps {
+			fmt.Println("Found", segments, "segments and", maps, "maps, expected", test.segments, "and", test.maps)
+			t.FailNow()
+		}
+	}
+
+	stub.Creator = nil
+	stub.InvokeError(t, "FindSegments", []byte(`{}`))
+}
+
+func TestPop_segmentTenant(t *testing.T) {
+	segment := testutil.Root("main").Build()
+	segment.Meta["submitter"] = &Submitter{MSPID: "Org1MSP"}
+	segmentBytes, _ := json.Marshal(segment)
+	mirrored := &cs.Segment{}
+	json.Unmarshal(segmentBytes, mirrored)
+	if segmentTenant(segment) != "Org1MSP" || segmentTenant(mirrored) != "Org1MSP" {
+		fmt.Println("Wrong tenant")
+		t.FailNow()
+	}
+}
+
+func TestPop_MultiTenantDocuments(t *testing.T) {
+	stub := testutil.NewStub("pop", new(SmartContract))
+	if res := stub.MockInit("init", [][]byte{[]byte("init"), []byte(`{"multiTenant":true,"admins":["AdminMSP"]}`)}); res.Status != shim.OK {
+		fmt.Println("Init failed", res.Message)
+		t.FailNow()
+	}
+	stub.Creator = testutil.NewIdentity("AdminMSP", "admin")
+	stub.Invoke(t, "CreateProcess", []byte(`{"name":"org1","initialActions":["open"],"tenant":"Org1MSP"}`))
+
+	stub.Creator = testutil.NewIdentity("Org1MSP", "alice")
+	root := testutil.Root("main").Build()
+	stub.SaveSegment(t, root, testutil.Root("org1").WithAction("open").Build())
+	linkHash, mapID := []byte(root.GetLinkHashString()), []byte(root.Link.GetMapID())
+	stub.Invoke(t, "GetProcess", []byte("org1"))
+
+	stub.Creator = testutil.NewIdentity("Org2MSP", "bob")
+	for _, call := range []struct {
+		function string
+		args     [][]byte
+	}{
+		{"SaveSegment", [][]byte{mustMarshal(testutil.Child(root).Build())}},
+		{"SaveSegment", [][]byte{mustMarshal(testutil.Root("org1").WithAction("open").Build())}},
+		{"GetSegment", [][]byte{linkHash}},
+		{"GetEvidences", [][]byte{linkHash}},
+		{"GetMapDelta", [][]byte{mapID, []byte("0")}},
+		{"DetectGaps", [][]byte{mapID}},
+		{"GetAnnotations", [][]byte{[]byte("map"), mapID}},
+		{"GetProcess", [][]byte{[]byte("org1")}},
+		{"GetTagFacets", [][]byte{[]byte("org1")}},
+		{"GetTagFacets", [][]byte{[]byte("main")}},
+		{"GetActivitySeries", [][]byte{[]byte("org1"), []byte("2017-01-01"), []byte("2017-01-02")}},
+	} {
+		if message := stub.InvokeError(t, call.function, call.args...); message != ErrUnauthorized.Error() {
+			fmt.Println(call.function, "failed with error", message, "expected", ErrUnauthorized.Error())
+			t.FailNow()
+		}
+	}
+	exists := map[string]bool{}
+	json.Unmarshal(stub.Invoke(t, "HasSegment", linkHash), &exists)
+	if exists[string(linkHash)] {
+		fmt.Println("Segments of other tenants should be reported missing")
+		t.FailNow()
+	}
+	lookup := &MapLookup{}
+	json.Unmarshal(stub.Invoke(t, "HasMapInternal", mapID), lookup)
+	if lookup.Found || lookup.Process != "" {
+		fmt.Println("Maps of other tenants should be reported missing", lookup)
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("Org1MSP", "alice")
+	stub.Invoke(t, "GetTagFacets", []byte("org1"))
+	stub.Invoke(t, "GetActivitySeries", []byte("org1"), []byte("2017-01-01"), []byte("2017-01-02"))
+	json.Unmarshal(stub.Invoke(t, "HasMapInternal", mapID), lookup)
+	if !lookup.Found {
+		fmt.Println("Maps of the tenant should be found")
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentityWithAttributes("Org3MSP", "auditor", map[string]string{AttributeCrossTenantRead: "true"})
+	stub.Invoke(t, "GetSegment", linkHash)
+	stub.Invoke(t, "GetMapDelta", mapID, []byte("0"))
+	stub.Invoke(t, "GetTagFacets", []byte("main"))
+	stub.InvokeError(t, "SaveSegment", mustMarshal(testutil.Child(root).Build()))
+}
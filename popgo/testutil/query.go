@@ -0,0 +1,141 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/piedup/chaincode/popgo/selector"
+)
+
+// couchQuery is the subset of CouchDB queries supported by the stub.
+type couchQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	Sort     []interface{}          `json:"sort"`
+	Limit    int                    `json:"limit"`
+	Skip     int                    `json:"skip"`
+}
+
+// GetQueryResult implements shim.ChaincodeStubInterface.GetQueryResult.
+//
+// It evaluates CouchDB selectors against the JSON documents of the state
+// with the selector package. Sort, limit and skip are supported too.
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	q := couchQuery{}
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		return nil, err
+	}
+	if q.Selector == nil {
+		return nil, errors.New("query should have a selector")
+	}
+	if s.QueryError != nil && len(q.Sort) > 0 {
+		return nil, s.QueryError
+	}
+
+	type result struct {
+		kv  *queryresult.KV
+		doc map[string]interface{}
+	}
+	var results []result
+
+	for elem := s.Keys.Front(); elem != nil; elem = elem.Next() {
+		key := elem.Value.(string)
+		doc := map[string]interface{}{}
+		if err := json.Unmarshal(s.State[key], &doc); err != nil {
+			continue
+		}
+		ok, err := selector.Match(doc, q.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			results = append(results, result{
+				kv:  &queryresult.KV{Namespace: s.Name, Key: key, Value: s.State[key]},
+				doc: doc,
+			})
+		}
+	}
+
+	for i := len(q.Sort) - 1; i >= 0; i-- {
+		field, desc, err := parseSort(q.Sort[i])
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(results, func(a, b int) bool {
+			va, _ := selector.Lookup(results[a].doc, field)
+			vb, _ := selector.Lookup(results[b].doc, field)
+			if desc {
+				return selector.Compare(vb, va) < 0
+			}
+			return selector.Compare(va, vb) < 0
+		})
+	}
+
+	if q.Skip > len(results) {
+		q.Skip = len(results)
+	}
+	results = results[q.Skip:]
+	if q.Limit > 0 && q.Limit < len(results) {
+		results = results[:q.Limit]
+	}
+
+	it := &queryIterator{}
+	for _, r := range results {
+		it.kvs = append(it.kvs, r.kv)
+	}
+	return it, nil
+}
+
+func parseSort(v interface{}) (string, bool, error) {
+	switch s := v.(type) {
+	case string:
+		return s, false, nil
+	case map[string]interface{}:
+		for field, dir := range s {
+			return field, dir == "desc", nil
+		}
+	}
+	return "", false, fmt.Errorf("invalid sort %v", v)
+}
+
+// queryIterator iterates over query results.
+type queryIterator struct {
+	kvs []*queryresult.KV
+}
+
+// HasNext implements shim.StateQueryIteratorInterface.HasNext.
+func (it *queryIterator) HasNext() bool {
+	return len(it.kvs) > 0
+}
+
+// Next implements shim.StateQueryIteratorInterface.Next.
+func (it *queryIterator) Next() (*queryresult.KV, error) {
+	if len(it.kvs) == 0 {
+		return nil, errors.New("no more results")
+	}
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+// Close implements shim.StateQueryIteratorInterface.Close.
+func (it *queryIterator) Close() error {
+	return nil
+}
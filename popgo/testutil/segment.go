@@ -0,0 +1,158 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testutil contains helpers to test the pop chaincode.
+package testutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/cstesting"
+	sdktestutil "github.com/stratumn/sdk/testutil"
+)
+
+// Signature is a detached signature stored in segment.meta.signatures.
+type Signature struct {
+	Type      string `json:"type"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+	DID       string `json:"did,omitempty"`
+}
+
+// SegmentBuilder builds valid segments.
+type SegmentBuilder struct {
+	segment *cs.Segment
+}
+
+// Root starts building the first segment of a new map.
+func Root(process string) *SegmentBuilder {
+	return &SegmentBuilder{
+		segment: &cs.Segment{
+			Link: cs.Link{
+				State: map[string]interface{}{},
+				Meta: map[string]interface{}{
+					"process": process,
+					"mapId":   sdktestutil.RandomString(24),
+				},
+			},
+			Meta: map[string]interface{}{},
+		},
+	}
+}
+
+// Child starts building a segment appended to parent.
+func Child(parent *cs.Segment) *SegmentBuilder {
+	b := Root(parent.Link.GetProcess())
+	b.segment.Link.Meta["mapId"] = parent.Link.GetMapID()
+	b.segment.Link.Meta["prevLinkHash"] = parent.GetLinkHashString()
+	return b
+}
+
+// WithMapID sets link.meta.mapId.
+func (b *SegmentBuilder) WithMapID(mapID string) *SegmentBuilder {
+	return b.WithLinkMeta("mapId", mapID)
+}
+
+// WithAction sets link.meta.action.
+func (b *SegmentBuilder) WithAction(action string) *SegmentBuilder {
+	return b.WithLinkMeta("action", action)
+}
+
+// WithPriority sets link.meta.priority.
+func (b *SegmentBuilder) WithPriority(priority float64) *SegmentBuilder {
+	return b.WithLinkMeta("priority", priority)
+}
+
+// WithTags sets link.meta.tags.
+func (b *SegmentBuilder) WithTags(tags ...string) *SegmentBuilder {
+	t := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		t[i] = tag
+	}
+	return b.WithLinkMeta("tags", t)
+}
+
+// WithRef adds a reference to another segment in link.meta.refs.
+func (b *SegmentBuilder) WithRef(ref *cs.Segment) *SegmentBuilder {
+	refs, _ := b.segment.Link.Meta["refs"].([]interface{})
+	refs = append(refs, map[string]interface{}{
+		"process":  ref.Link.GetProcess(),
+		"linkHash": ref.GetLinkHashString(),
+	})
+	return b.WithLinkMeta("refs", refs)
+}
+
+// WithState sets a value of the link state.
+func (b *SegmentBuilder) WithState(key string, value interface{}) *SegmentBuilder {
+	b.segment.Link.State[key] = value
+	return b
+}
+
+// WithLinkMeta sets a value of the link meta.
+func (b *SegmentBuilder) WithLinkMeta(key string, value interface{}) *SegmentBuilder {
+	b.segment.Link.Meta[key] = value
+	return b
+}
+
+// WithSignature adds a signature to segment.meta.signatures.
+func (b *SegmentBuilder) WithSignature(sig Signature) *SegmentBuilder {
+	entry := map[string]interface{}{
+		"type":      sig.Type,
+		"publicKey": sig.PublicKey,
+		"signature": sig.Signature,
+	}
+	if sig.DID != "" {
+		entry["did"] = sig.DID
+	}
+	sigs, _ := b.segment.Meta["signatures"].([]interface{})
+	b.segment.Meta["signatures"] = append(sigs, entry)
+	return b
+}
+
+// Build computes the link hash and returns the segment.
+// The builder can be reused to build variations of the segment.
+func (b *SegmentBuilder) Build() *cs.Segment {
+	segment := cstesting.CloneSegment(b.segment)
+	segment.Meta["linkHash"] = LinkHash(&segment.Link)
+	return segment
+}
+
+// Chain builds a map of n segments where each segment is the child of the
+// previous one.
+func Chain(process string, n int) []*cs.Segment {
+	var segments []*cs.Segment
+	for i := 0; i < n; i++ {
+		var b *SegmentBuilder
+		if i == 0 {
+			b = Root(process)
+		} else {
+			b = Child(segments[i-1])
+		}
+		segments = append(segments, b.WithState("step", i).Build())
+	}
+	return segments
+}
+
+// LinkHash returns the hex encoded SHA-256 of the JSON encoded link.
+func LinkHash(link *cs.Link) string {
+	linkBytes, err := json.Marshal(link)
+	if err != nil {
+		panic(err)
+	}
+	hash := sha256.Sum256(linkBytes)
+	return hex.EncodeToString(hash[:])
+}
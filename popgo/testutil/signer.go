@@ -0,0 +1,74 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+
+	"github.com/stratumn/sdk/cs"
+)
+
+// Signer signs links with an ECDSA P-256 key.
+type Signer struct {
+	key *ecdsa.PrivateKey
+}
+
+// NewSigner creates a signer with a random key.
+func NewSigner() *Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return &Signer{key}
+}
+
+// PublicKey returns the base64 encoded PKIX public key.
+func (s *Signer) PublicKey() string {
+	keyBytes, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(keyBytes)
+}
+
+// Sign returns an ecdsa-sha256 signature of the JSON encoded link.
+func (s *Signer) Sign(link *cs.Link) Signature {
+	linkBytes, err := json.Marshal(link)
+	if err != nil {
+		panic(err)
+	}
+	hash := sha256.Sum256(linkBytes)
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, hash[:])
+	if err != nil {
+		panic(err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, ss})
+	if err != nil {
+		panic(err)
+	}
+	return Signature{
+		Type:      "ecdsa-sha256",
+		PublicKey: s.PublicKey(),
+		Signature: base64.StdEncoding.EncodeToString(sig),
+	}
+}
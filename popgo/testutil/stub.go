@@ -0,0 +1,219 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/common"
+	sc "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Stub is a shim.MockStub that hands itself to the chaincode, so the
+// methods it overrides are the ones the chaincode sees.
+type Stub struct {
+	*shim.MockStub
+
+	// Timestamp, when set, is the timestamp of every transaction.
+	Timestamp *timestamp.Timestamp
+
+	// Transient is the transient field of every transaction.
+	Transient map[string][]byte
+
+	// QueryError, when set, is returned by GetQueryResult for queries
+	// with a sort, like CouchDB does when no index covers the sort.
+	QueryError error
+
+	// Creator is the serialized identity of the submitter of every
+	// transaction, see NewIdentity.
+	Creator []byte
+
+	// ChannelID is the channel of every transaction, as found in the
+	// signed proposal. There is no signed proposal if it is empty.
+	ChannelID string
+
+	// EventName and EventPayload hold the event set by the last
+	// transaction.
+	EventName    string
+	EventPayload []byte
+
+	cc    shim.Chaincode
+	args  [][]byte
+	txs   int
+	peers map[string]*Stub
+}
+
+// NewStub creates a stub for a chaincode.
+func NewStub(name string, cc shim.Chaincode) *Stub {
+	return &Stub{
+		MockStub:  shim.NewMockStub(name, cc),
+		ChannelID: "mychannel",
+		cc:        cc,
+	}
+}
+
+// GetArgs implements shim.ChaincodeStubInterface.GetArgs.
+func (s *Stub) GetArgs() [][]byte {
+	return s.args
+}
+
+// GetStringArgs implements shim.ChaincodeStubInterface.GetStringArgs.
+func (s *Stub) GetStringArgs() []string {
+	strargs := make([]string, 0, len(s.args))
+	for _, barg := range s.args {
+		strargs = append(strargs, string(barg))
+	}
+	return strargs
+}
+
+// GetFunctionAndParameters implements
+// shim.ChaincodeStubInterface.GetFunctionAndParameters.
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	allargs := s.GetStringArgs()
+	if len(allargs) == 0 {
+		return "", []string{}
+	}
+	return allargs[0], allargs[1:]
+}
+
+// GetCreator implements shim.ChaincodeStubInterface.GetCreator.
+func (s *Stub) GetCreator() ([]byte, error) {
+	return s.Creator, nil
+}
+
+// GetSignedProposal implements
+// shim.ChaincodeStubInterface.GetSignedProposal. Only the channel header of
+// the proposal is set.
+func (s *Stub) GetSignedProposal() (*sc.SignedProposal, error) {
+	if s.ChannelID == "" {
+		return nil, nil
+	}
+	channelHeader, err := proto.Marshal(&common.ChannelHeader{
+		Type:      int32(common.HeaderType_ENDORSER_TRANSACTION),
+		ChannelId: s.ChannelID,
+		TxId:      s.TxID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	header, err := proto.Marshal(&common.Header{ChannelHeader: channelHeader})
+	if err != nil {
+		return nil, err
+	}
+	proposal, err := proto.Marshal(&sc.Proposal{Header: header})
+	if err != nil {
+		return nil, err
+	}
+	return &sc.SignedProposal{ProposalBytes: proposal}, nil
+}
+
+// GetTransient implements shim.ChaincodeStubInterface.GetTransient.
+func (s *Stub) GetTransient() (map[string][]byte, error) {
+	return s.Transient, nil
+}
+
+// SetEvent implements shim.ChaincodeStubInterface.SetEvent.
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	s.EventName, s.EventPayload = name, payload
+	return nil
+}
+
+// MockPeerChaincode registers a stub called by InvokeChaincode for a
+// chaincode name on a channel.
+func (s *Stub) MockPeerChaincode(name, channel string, other *Stub) {
+	if s.peers == nil {
+		s.peers = map[string]*Stub{}
+	}
+	s.peers[name+"/"+channel] = other
+}
+
+// InvokeChaincode implements shim.ChaincodeStubInterface.InvokeChaincode.
+func (s *Stub) InvokeChaincode(name string, args [][]byte, channel string) sc.Response {
+	other, ok := s.peers[name+"/"+channel]
+	if !ok {
+		return shim.Error("chaincode " + name + " not found on channel " + channel)
+	}
+	return other.MockInvoke(s.TxID, args)
+}
+
+// MockTransactionStart starts a transaction.
+func (s *Stub) MockTransactionStart(txID string) {
+	s.MockStub.MockTransactionStart(txID)
+	if s.Timestamp != nil {
+		s.TxTimestamp = s.Timestamp
+	}
+	s.EventName, s.EventPayload = "", nil
+}
+
+// MockInit initializes the chaincode in a transaction.
+func (s *Stub) MockInit(txID string, args [][]byte) sc.Response {
+	s.args = args
+	s.MockTransactionStart(txID)
+	res := s.cc.Init(s)
+	s.MockTransactionEnd(txID)
+	return res
+}
+
+// MockInvoke invokes the chaincode in a transaction.
+func (s *Stub) MockInvoke(txID string, args [][]byte) sc.Response {
+	s.args = args
+	s.MockTransactionStart(txID)
+	res := s.cc.Invoke(s)
+	s.MockTransactionEnd(txID)
+	return res
+}
+
+// Call invokes a chaincode function in a new transaction.
+func (s *Stub) Call(function string, args ...[]byte) sc.Response {
+	s.txs++
+	return s.MockInvoke(strconv.Itoa(s.txs), append([][]byte{[]byte(function)}, args...))
+}
+
+// Invoke calls a chaincode function and fails the test if it returns an
+// error. It returns the payload of the response.
+func (s *Stub) Invoke(t testing.TB, function string, args ...[]byte) []byte {
+	res := s.Call(function, args...)
+	if res.Status != shim.OK {
+		t.Fatalf("%s failed: %s", function, res.Message)
+	}
+	return res.Payload
+}
+
+// InvokeError calls a chaincode function and fails the test if it
+// succeeds. It returns the error message.
+func (s *Stub) InvokeError(t testing.TB, function string, args ...[]byte) string {
+	res := s.Call(function, args...)
+	if res.Status == shim.OK {
+		t.Fatalf("%s should have failed", function)
+	}
+	return res.Message
+}
+
+// SaveSegment saves segments and fails the test if one is rejected.
+func (s *Stub) SaveSegment(t testing.TB, segments ...*cs.Segment) {
+	for _, segment := range segments {
+		segmentBytes, err := json.Marshal(segment)
+		if err != nil {
+			t.Fatalf("could not marshal segment: %s", err)
+		}
+		s.Invoke(t, "SaveSegment", segmentBytes)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestChain(t *testing.T) {
+	segments := Chain("main", 3)
+	for i, segment := range segments {
+		if err := segment.Validate(); err != nil {
+			fmt.Println("Segment", i, "is invalid:", err)
+			t.FailNow()
+		}
+		if segment.GetLinkHashString() != LinkHash(&segment.Link) {
+			fmt.Println("Link hash not computed")
+			t.FailNow()
+		}
+		if i == 0 {
+			continue
+		}
+		if segment.Link.GetPrevLinkHashString() != segments[i-1].GetLinkHashString() {
+			fmt.Println("Segment", i, "is not a child of the previous segment")
+			t.FailNow()
+		}
+		if segment.Link.GetMapID() != segments[0].Link.GetMapID() {
+			fmt.Println("Segment", i, "is not in the same map")
+			t.FailNow()
+		}
+	}
+}
+
+func TestSegmentBuilder(t *testing.T) {
+	root := Root("main").Build()
+	b := Child(root).
+		WithAction("approve").
+		WithTags("a", "b").
+		WithPriority(2).
+		WithRef(root).
+		WithSignature(Signature{Type: "ed25519", PublicKey: "pk", Signature: "sig"})
+	segment := b.Build()
+
+	if err := segment.Validate(); err != nil {
+		fmt.Println("Segment is invalid:", err)
+		t.FailNow()
+	}
+	if len(segment.Link.GetTags()) != 2 || segment.Link.GetPriority() != 2 {
+		fmt.Println("Link meta not set")
+		t.FailNow()
+	}
+	if refs := segment.Link.Meta["refs"].([]interface{}); len(refs) != 1 {
+		fmt.Println("Ref not set")
+		t.FailNow()
+	}
+	if sigs := segment.Meta["signatures"].([]interface{}); len(sigs) != 1 {
+		fmt.Println("Signature not set")
+		t.FailNow()
+	}
+
+	other := b.WithState("changed", true).Build()
+	if other.GetLinkHashString() == segment.GetLinkHashString() {
+		fmt.Println("Link hash should depend on the link")
+		t.FailNow()
+	}
+	if _, ok := segment.Link.State["changed"]; ok {
+		fmt.Println("Built segments should not share state")
+		t.FailNow()
+	}
+}
+
+type echoChaincode struct{}
+
+func (c *echoChaincode) Init(stub shim.ChaincodeStubInterface) sc.Response {
+	return shim.Success(nil)
+}
+
+func (c *echoChaincode) Invoke(stub shim.ChaincodeStubInterface) sc.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function != "echo" {
+		return shim.Error("unknown function")
+	}
+	if err := stub.PutState(stub.GetTxID(), []byte(args[0])); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(args[0]))
+}
+
+func TestStub(t *testing.T) {
+	stub := NewStub("echo", &echoChaincode{})
+
+	if payload := stub.Invoke(t, "echo", []byte("hello")); string(payload) != "hello" {
+		fmt.Println("Unexpected payload", string(payload))
+		t.FailNow()
+	}
+	if message := stub.InvokeError(t, "unknown"); message != "unknown function" {
+		fmt.Println("Unexpected message", message)
+		t.FailNow()
+	}
+	stub.Invoke(t, "echo", []byte("world"))
+	if len(stub.State) != 2 {
+		fmt.Println("Each call should run in its own transaction")
+		t.FailNow()
+	}
+}
+
+func TestStubGetQueryResult(t *testing.T) {
+	stub := NewStub("query", new(echoChaincode))
+	stub.MockTransactionStart("1")
+	stub.PutState("a", []byte(`{"docType":"segment","n":3,"tags":["x","y"]}`))
+	stub.PutState("b", []byte(`{"docType":"segment","n":1,"tags":["y"]}`))
+	stub.PutState("c", []byte(`{"docType":"map","n":2}`))
+	stub.PutState("d", []byte(`not json`))
+	stub.MockTransactionEnd("1")
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{`{"selector":{"docType":"segment"}}`, []string{"a", "b"}},
+		{`{"selector":{"n":{"$gte":2}},"sort":[{"n":"desc"}]}`, []string{"a", "c"}},
+		{`{"selector":{"tags":{"$all":["x"]}}}`, []string{"a"}},
+		{`{"selector":{"tags":{"$exists":false}}}`, []string{"c"}},
+		{`{"selector":{"$or":[{"n":1},{"n":2}]},"sort":["n"],"skip":1}`, []string{"c"}},
+		{`{"selector":{"docType":"segment"},"limit":1}`, []string{"a"}},
+	}
+	for _, test := range tests {
+		it, err := stub.GetQueryResult(test.query)
+		if err != nil {
+			fmt.Println("Query failed", test.query, err)
+			t.FailNow()
+		}
+		var keys []string
+		for it.HasNext() {
+			kv, _ := it.Next()
+			keys = append(keys, kv.Key)
+		}
+		if fmt.Sprint(keys) != fmt.Sprint(test.expected) {
+			fmt.Println("Query", test.query, "returned", keys, "expected", test.expected)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stratumn/sdk/cs"
+)
+
+// Rules checked by SaveSegment, reported in violations
+const (
+	RuleSchema      = "schema"
+	RuleTransition  = "transition"
+	RuleSignature   = "signature"
+	RuleACL         = "acl"
+	RuleFeatures    = "features"
+	RuleConventions = "conventions"
+)
+
+// SaveOptions are the options of SaveSegment, passed as third argument
+type SaveOptions struct {
+	// ValidateAll checks every rule instead of failing on the first
+	// violation, and returns the violations as JSON
+	ValidateAll bool `json:"validateAll"`
+}
+
+// Violation is a rule broken by a segment
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned by SaveSegment in validateAll mode. Its
+// message is the JSON encoded list of violations.
+type ValidationError struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (e *ValidationError) Error() string {
+	b, _ := json.Marshal(e)
+	return string(b)
+}
+
+func parseSaveOptions(args []string) (*SaveOptions, error) {
+	options := &SaveOptions{}
+	if len(args) < 3 || args[2] == "" {
+		return options, nil
+	}
+	if err := json.Unmarshal([]byte(args[2]), options); err != nil {
+		return nil, errors.New("Could not parse options")
+	}
+	return options, nil
+}
+
+// validator collects violations. Unless all rules are checked, the first
+// violation stops the validation.
+type validator struct {
+	all        bool
+	first      error
+	violations []Violation
+}
+
+// check records a violation and tells whether validation goes on
+func (v *validator) check(rule string, err error) bool {
+	if err == nil {
+		return true
+	}
+	if v.first == nil {
+		v.first = err
+	}
+	v.violations = append(v.violations, Violation{rule, err.Error()})
+	return v.all
+}
+
+func (v *validator) err() error {
+	if v.first == nil || !v.all {
+		return v.first
+	}
+	return &ValidationError{v.violations}
+}
+
+// validateSegment checks a segment before it is saved. It returns the actor
+// the segment is submitted for if a gateway passed one. Schema violations
+// stop the validation since other rules expect a well formed segment.
+func validateSegment(stub shim.ChaincodeStubInterface, segment *cs.Segment, actorJSON string, encrypted, all bool) (*Actor, error) {
+	v := &validator{all: all}
+
+	v.check(RuleSchema, segment.Validate())
+	_, err := getEmbargo(segment)
+	v.check(RuleSchema, err)
+	if len(v.violations) > 0 {
+		return nil, v.err()
+	}
+
+	// Check the link state against the schema version of the segment
+	if !v.check(RuleSchema, validateStateSchema(stub, segment)) {
+		return nil, v.err()
+	}
+
+	// Check the tags and map ID follow the conventions of the process
+	if !v.check(RuleConventions, validateConventions(stub, segment)) {
+		return nil, v.err()
+	}
+
+	// Check the segment follows the template of its process
+	if !v.check(RuleTransition, validateTransition(stub, segment)) {
+		return nil, v.err()
+	}
+
+	// Check signatures made by registered actors
+	if !v.check(RuleSignature, validateSignatures(stub, segment)) {
+		return nil, v.err()
+	}
+
+	// Check the signature of the end user if a gateway submits the segment
+	// on their behalf
+	signed := hasActorSignature(segment)
+	var actor *Actor
+	if actorJSON != "" {
+		rule := RuleSignature
+		if actor, err = parseActor(stub, &segment.Link, actorJSON); err == ErrUnauthorized {
+			rule = RuleACL
+		}
+		if !v.check(rule, err) {
+			return nil, v.err()
+		}
+		signed = signed || actor != nil
+	}
+
+	// Check the segment is allowed by the enabled features
+	features, err := getFeatures(stub)
+	if err != nil {
+		return nil, err
+	}
+	v.check(RuleFeatures, checkFeatures(features, segment, signed, encrypted))
+
+	return actor, v.err()
+}
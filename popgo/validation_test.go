@@ -0,0 +1,65 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_SaveSegmentValidateAll(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Invoke(t, "CreateProcess", testProcess)
+	stub.Invoke(t, "SetFeature", []byte(FeaturePrivateData), []byte("true"))
+
+	forged := testutil.NewSigner().Sign(&testutil.Root("auction").Build().Link)
+	forged.DID = "did:example:unknown"
+	segment := mustMarshal(testutil.Root("auction").WithAction("bid").WithSignature(forged).Build())
+
+	message := stub.InvokeError(t, "SaveSegment", segment, []byte(""), []byte(`{"validateAll":true}`))
+	validationErr := &ValidationError{}
+	if err := json.Unmarshal([]byte(message), validationErr); err != nil {
+		fmt.Println("Violations should be returned as JSON", message)
+		t.FailNow()
+	}
+	var rules []string
+	for _, violation := range validationErr.Violations {
+		rules = append(rules, violation.Rule)
+	}
+	if !reflect.DeepEqual(rules, []string{RuleTransition, RuleSignature, RuleFeatures}) {
+		fmt.Println("Got violations", validationErr.Violations)
+		t.FailNow()
+	}
+
+	if message := stub.InvokeError(t, "SaveSegment", segment); message != validationErr.Violations[0].Message {
+		fmt.Println("Failed with error", message, "expected", validationErr.Violations[0].Message)
+		t.FailNow()
+	}
+
+	// Schema violations stop the validation
+	message = stub.InvokeError(t, "SaveSegment", []byte(`{"link":{"meta":{}},"meta":{}}`), []byte(""), []byte(`{"validateAll":true}`))
+	validationErr = &ValidationError{}
+	json.Unmarshal([]byte(message), validationErr)
+	if len(validationErr.Violations) != 1 || validationErr.Violations[0].Rule != RuleSchema {
+		fmt.Println("Got violations", validationErr.Violations)
+		t.FailNow()
+	}
+
+	stub.InvokeError(t, "SaveSegment", segment, []byte(""), []byte(`{`))
+}
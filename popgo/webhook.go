@@ -0,0 +1,208 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	// ObjectTypeWebhook is used in CouchDB documents of webhooks
+	ObjectTypeWebhook = "webhook"
+
+	// TransientWebhookSecret holds the shared secret of a webhook. It is
+	// given in the transient field so it isn't recorded in the ledger.
+	TransientWebhookSecret = "WEBHOOKSECRET"
+)
+
+// WebhookDoc is used to store the webhooks of a process in CouchDB. The
+// relay posts the events of the process to the URL and signs them with the
+// shared secret, which it is given out of band. Only a salted hash of the
+// secret is stored, to check the secret given to the relay: it can't be
+// used to sign payloads.
+type WebhookDoc struct {
+	ObjectType     string     `json:"docType"`
+	ID             string     `json:"id"`
+	Process        string     `json:"process"`
+	URL            string     `json:"url"`
+	Events         []string   `json:"events,omitempty"`
+	SecretSalt     string     `json:"secretSalt"`
+	SecretVerifier string     `json:"secretVerifier"`
+	RegisteredBy   *Submitter `json:"registeredBy,omitempty"`
+}
+
+// WebhookRegistration is the argument of RegisterWebhook
+type WebhookRegistration struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+}
+
+func (r *WebhookRegistration) validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("Webhook URL should be an HTTP(S) URL")
+	}
+	return nil
+}
+
+// getWebhookSecret returns the shared secret of the transient field
+func getWebhookSecret(stub shim.ChaincodeStubInterface) ([]byte, error) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return nil, err
+	}
+	secret := transient[TransientWebhookSecret]
+	if len(secret) < 16 {
+		return nil, errors.New("Webhook secret should be at least 16 characters long, in the " + TransientWebhookSecret + " transient field")
+	}
+	return secret, nil
+}
+
+// webhookSecretVerifier is the salted SHA-256 of a shared secret
+func webhookSecretVerifier(salt string, secret []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(salt))
+	hash.Write([]byte{0})
+	hash.Write(secret)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func getWebhookKey(stub shim.ChaincodeStubInterface, process, id string) (string, error) {
+	return stub.CreateCompositeKey(ObjectTypeWebhook, []string{process, id})
+}
+
+// requireProcessOwner checks the creator of the transaction is an admin or
+// an owner of a process
+func requireProcessOwner(stub shim.ChaincodeStubInterface, name string) error {
+	process, err := getProcess(stub, name)
+	if err != nil {
+		return err
+	}
+	if process != nil && requireCreatorIn(stub, process.Owners) == nil {
+		return nil
+	}
+	return requireAdmin(stub)
+}
+
+// RegisterWebhook registers a webhook for the events of a process. The ID of
+// a webhook is the hash of its URL, registering a URL again replaces it.
+// The shared secret is read from the transient field, see
+// TransientWebhookSecret.
+func (s *SmartContract) RegisterWebhook(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 || args[0] == "" {
+		return shim.Error("Process and webhook are required")
+	}
+	registration := &WebhookRegistration{}
+	if err := json.Unmarshal([]byte(args[1]), registration); err != nil {
+		return shim.Error("Could not parse webhook")
+	}
+	if err := registration.validate(); err != nil {
+		return shim.Error(err.Error())
+	}
+	secret, err := getWebhookSecret(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := requireProcessOwner(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	urlHash := sha256.Sum256([]byte(registration.URL))
+	webhook := &WebhookDoc{
+		ObjectType: ObjectTypeWebhook,
+		ID:         hex.EncodeToString(urlHash[:8]),
+		Process:    args[0],
+		URL:        registration.URL,
+		Events:     registration.Events,
+		SecretSalt: stub.GetTxID(),
+	}
+	webhook.SecretVerifier = webhookSecretVerifier(webhook.SecretSalt, secret)
+	if webhook.RegisteredBy, err = getSubmitter(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := getWebhookKey(stub, webhook.Process, webhook.ID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	webhookBytes, err := json.Marshal(webhook)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, webhookBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(webhookBytes)
+}
+
+// DeleteWebhook deletes a webhook of a process
+func (s *SmartContract) DeleteWebhook(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 2 {
+		return shim.Error("Process and webhook ID are required")
+	}
+	if err := requireProcessOwner(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := getWebhookKey(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.DelState(key); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// GetWebhooks returns the webhooks of a process to its owners
+func (s *SmartContract) GetWebhooks(stub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || args[0] == "" {
+		return shim.Error("Process is required")
+	}
+	if err := requireProcessOwner(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ObjectTypeWebhook, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	webhooks := []*WebhookDoc{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		webhook := &WebhookDoc{}
+		if err := json.Unmarshal(queryResponse.Value, webhook); err != nil {
+			return shim.Error(err.Error())
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	webhooksBytes, err := json.Marshal(webhooks)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return successWithMeta(webhooksBytes, nil)
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/piedup/chaincode/popgo/testutil"
+)
+
+func TestPop_RegisterWebhook(t *testing.T) {
+	stub := newAdminStub(t)
+	stub.Invoke(t, "CreateProcess", []byte(`{"name":"auction","initialActions":["open"],"owners":["SellerMSP"]}`))
+
+	webhook := []byte(`{"url":"https://example.com/hook"}`)
+	stub.Creator = testutil.NewIdentity("SellerMSP", "seller")
+	stub.InvokeError(t, "RegisterWebhook", []byte("auction"), webhook)
+	stub.Transient = map[string][]byte{TransientWebhookSecret: []byte("short")}
+	stub.InvokeError(t, "RegisterWebhook", []byte("auction"), webhook)
+	stub.Transient = map[string][]byte{TransientWebhookSecret: []byte("0123456789abcdef")}
+	stub.InvokeError(t, "RegisterWebhook", []byte("auction"), []byte(`{"url":"ftp://example.com"}`))
+	stub.Invoke(t, "RegisterWebhook", []byte("auction"), webhook)
+	stub.Transient = nil
+
+	var webhooks []*WebhookDoc
+	webhooksBytes := stub.Invoke(t, "GetWebhooks", []byte("auction"))
+	json.Unmarshal(webhooksBytes, &webhooks)
+	if len(webhooks) != 1 || webhooks[0].URL != "https://example.com/hook" {
+		fmt.Println("Got webhooks", webhooks)
+		t.FailNow()
+	}
+
+	// Neither the secret nor its hash, which could be used as signing key,
+	// are stored
+	secretHash := sha256.Sum256([]byte("0123456789abcdef"))
+	for _, leaked := range []string{"0123456789abcdef", hex.EncodeToString(secretHash[:])} {
+		if strings.Contains(string(webhooksBytes), leaked) {
+			fmt.Println("GetWebhooks leaked", leaked)
+			t.FailNow()
+		}
+	}
+	if webhooks[0].SecretVerifier != webhookSecretVerifier(webhooks[0].SecretSalt, []byte("0123456789abcdef")) {
+		fmt.Println("Got verifier", webhooks[0].SecretVerifier)
+		t.FailNow()
+	}
+
+	stub.Creator = testutil.NewIdentity("UserMSP", "user")
+	if message := stub.InvokeError(t, "GetWebhooks", []byte("auction")); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+	stub.Transient = map[string][]byte{TransientWebhookSecret: []byte("0123456789abcdef")}
+	if message := stub.InvokeError(t, "RegisterWebhook", []byte("auction"), webhook); message != ErrUnauthorized.Error() {
+		fmt.Println("Failed with error", message, "expected", ErrUnauthorized.Error())
+		t.FailNow()
+	}
+	stub.InvokeError(t, "DeleteWebhook", []byte("auction"), []byte(webhooks[0].ID))
+
+	stub.Creator = testutil.NewIdentity("SellerMSP", "seller")
+	stub.Invoke(t, "DeleteWebhook", []byte("auction"), []byte(webhooks[0].ID))
+	json.Unmarshal(stub.Invoke(t, "GetWebhooks", []byte("auction")), &webhooks)
+	if len(webhooks) != 0 {
+		fmt.Println("Webhook not deleted")
+		t.FailNow()
+	}
+}